@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -22,8 +23,16 @@ const (
 	RefreshTokenDuration = 7 * 24 * time.Hour
 )
 
-// JWTSecret - секретный ключ для JWT (в реальном проекте должен храниться в защищенном месте)
-var JWTSecret = []byte("secret-jwt-key-mvp-project-2025")
+// JWTSecret - секретный ключ для JWT (в реальном проекте должен храниться в защищенном месте).
+// Берется из JWT_SECRET, тем же ключом warehouse-service проверяет токены для журнала изменений
+var JWTSecret = []byte(jwtSecretFromEnv())
+
+func jwtSecretFromEnv() string {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return secret
+	}
+	return "secret-jwt-key-mvp-project-2025"
+}
 
 // Claims представляет данные JWT токена
 type Claims struct {
@@ -1,18 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -35,7 +38,7 @@ func main() {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -65,6 +68,7 @@ func main() {
    {
        authorized.GET("/profile", getProfile)
        authorized.PUT("/profile", updateProfile)
+       authorized.PATCH("/profile", updateProfile)
        authorized.GET("/users", authorizationMiddleware([]string{RoleAdmin}), listUsers)
        authorized.GET("/users/:id", authorizationMiddleware([]string{RoleAdmin, RoleManager}), getUserByID)
        authorized.PUT("/users/:id/role", authorizationMiddleware([]string{RoleAdmin}), updateUserRole)
@@ -455,24 +459,53 @@ func updateProfile(c *gin.Context) {
 		return
 	}
 	
-	var updateData map[string]interface{}
-	if err := c.ShouldBindJSON(&updateData); err != nil {
+	req, err := parseProfilePatch(c)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	
-	// Не позволяем изменять критичные поля через этот endpoint
-	delete(updateData, "role")
-	delete(updateData, "is_active")
-	delete(updateData, "password_hash")
-	delete(updateData, "username")
+	id, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	
+	updateData := bson.M{"updated_at": time.Now()}
+	if req.FirstName != nil {
+		updateData["first_name"] = *req.FirstName
+	}
+	if req.LastName != nil {
+		updateData["last_name"] = *req.LastName
+	}
+	if req.Department != nil {
+		updateData["department"] = *req.Department
+	}
+	if req.Position != nil {
+		updateData["position"] = *req.Position
+	}
+	
+	// Email должен оставаться уникальным
+	if req.Email != nil {
+		count, err := userCollection.CountDocuments(ctx, bson.M{"email": *req.Email, "_id": bson.M{"$ne": id}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use"})
+			return
+		}
+		updateData["email"] = *req.Email
+	}
 	
 	// Если пришел новый пароль, хешируем его
-	if password, ok := updateData["password"].(string); ok {
+	if req.Password != nil {
 		// TODO: добавить проверку сложности пароля
-		delete(updateData, "password")
-		
-		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		hash, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 			return
@@ -481,19 +514,7 @@ func updateProfile(c *gin.Context) {
 		updateData["password_hash"] = string(hash)
 	}
 	
-	// Добавляем поле updated_at
-	updateData["updated_at"] = time.Now()
-	
 	// Обновляем данные пользователя
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	
-	id, err := primitive.ObjectIDFromHex(userID.(string))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
-		return
-	}
-	
 	result, err := userCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": updateData})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
@@ -508,29 +529,96 @@ func updateProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
 }
 
+// Разбор частичного обновления профиля.
+// Неизвестные и защищенные поля (role, is_active, username) отклоняются,
+// null очищает необязательные поля (department, position).
+func parseProfilePatch(c *gin.Context) (ProfileUpdateRequest, error) {
+	var req ProfileUpdateRequest
+	
+	body, err := c.GetRawData()
+	if err != nil {
+		return req, errors.New("Failed to read request body")
+	}
+	
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return req, errors.New("Request body must be a JSON object")
+	}
+	
+	empty := ""
+	for name, raw := range fields {
+		isNull := string(bytes.TrimSpace(raw)) == "null"
+		switch name {
+		case "first_name", "last_name", "email":
+			if isNull {
+				return req, fmt.Errorf("Field '%s' cannot be removed", name)
+			}
+		case "department", "position":
+			if isNull {
+				if name == "department" {
+					req.Department = &empty
+				} else {
+					req.Position = &empty
+				}
+				delete(fields, name)
+			}
+		case "password":
+			// Пустой пароль означает "не менять"
+			if isNull || string(bytes.TrimSpace(raw)) == `""` {
+				delete(fields, name)
+			}
+		default:
+			return req, fmt.Errorf("Field '%s' cannot be updated", name)
+		}
+	}
+	
+	for name, raw := range fields {
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return req, fmt.Errorf("Field '%s' must be a string", name)
+		}
+		switch name {
+		case "first_name":
+			req.FirstName = &value
+		case "last_name":
+			req.LastName = &value
+		case "email":
+			req.Email = &value
+		case "department":
+			req.Department = &value
+		case "position":
+			req.Position = &value
+		case "password":
+			req.Password = &value
+		}
+	}
+	
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
 // Получение списка всех пользователей (только для администраторов)
 func listUsers(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	
-	findOptions := options.Find()
-	findOptions.SetSort(bson.M{"created_at": -1})
-	
-	cursor, err := userCollection.Find(ctx, bson.M{}, findOptions)
+	// Постраничный вывод: новые пользователи первыми
+	page, err := parsePageQuery(c, "created_at", -1)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer cursor.Close(ctx)
 	
-	var users []User
-	if err := cursor.All(ctx, &users); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode users"})
+	users, pagination, err := findPage[User](ctx, userCollection, bson.M{}, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
 	}
 	
 	// Преобразуем в UserResponse, чтобы не отправлять пароли
-	var usersResponse []UserResponse
+	usersResponse := []UserResponse{}
 	for _, user := range users {
 		usersResponse = append(usersResponse, UserResponse{
 			ID:         user.ID.Hex(),
@@ -548,7 +636,7 @@ func listUsers(c *gin.Context) {
 		})
 	}
 	
-	c.JSON(http.StatusOK, gin.H{"users": usersResponse})
+	c.JSON(http.StatusOK, gin.H{"users": usersResponse, "pagination": pagination})
 }
 
 // Получение информации о пользователе по ID
@@ -721,23 +809,13 @@ func listAuditLogs(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Пагинация
-	page := 1
-	limit := 10
-	if p := c.Query("page"); p != "" {
-		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
-			page = parsed
-		}
-	}
-	if l := c.Query("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
-			limit = parsed
-		}
+	// Пагинация: последние записи первыми
+	page, err := parsePageQuery(c, "timestamp", -1)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	skip := (page - 1) * limit
-	opts := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).SetSort(bson.D{bson.E{Key: "timestamp", Value: -1}})
-
 	filter := bson.M{}
 	if userID := c.Query("user_id"); userID != "" {
 		filter["user_id"] = userID
@@ -746,29 +824,19 @@ func listAuditLogs(c *gin.Context) {
 		filter["action"] = action
 	}
 
-	cursor, err := auditLogCollection.Find(ctx, filter, opts)
+	auditLogs, pagination, err := findPage[AuditLog](ctx, auditLogCollection, filter, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs"})
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var auditLogs []AuditLog
-	if err = cursor.All(ctx, &auditLogs); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode audit logs"})
-		return
-	}
 
 	// Подсчет общего количества
 	total, _ := auditLogCollection.CountDocuments(ctx, filter)
+	pagination["total"] = total
 
 	c.JSON(http.StatusOK, gin.H{
 		"audit_logs": auditLogs,
-		"pagination": gin.H{
-			"page":  page,
-			"limit": limit,
-			"total": total,
-		},
+		"pagination": pagination,
 	})
 }
 
@@ -61,6 +61,17 @@ type SignupRequest struct {
 	EthAddress string `json:"eth_address,omitempty"`
 }
 
+// ProfileUpdateRequest представляет частичное обновление профиля (JSON Merge Patch).
+// Отсутствующие поля не изменяются; роль, статус и имя пользователя через профиль не меняются.
+type ProfileUpdateRequest struct {
+	FirstName  *string `json:"first_name" binding:"omitempty,min=1"`
+	LastName   *string `json:"last_name" binding:"omitempty,min=1"`
+	Email      *string `json:"email" binding:"omitempty,email"`
+	Department *string `json:"department"`
+	Position   *string `json:"position"`
+	Password   *string `json:"password" binding:"omitempty,min=6"`
+}
+
 // LoginRequest представляет запрос на авторизацию пользователя
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Размеры страниц для списков
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// pageQuery описывает запрос страницы списка с сортировкой по ключу (keyset).
+// Списки сервиса сортируются по времени создания (created_at, timestamp),
+// которое задается у каждого документа, поэтому пустых значений нет.
+type pageQuery struct {
+	Limit     int
+	SortField string
+	SortDir   int // 1 - по возрастанию, -1 - по убыванию
+	after     *pageCursor
+}
+
+// pageCursor - позиция последнего документа предыдущей страницы
+// и поле сортировки, для которого выдан курсор
+type pageCursor struct {
+	Key   string             `bson:"k"`
+	Value bson.RawValue      `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+// Разбор параметров limit и cursor из запроса
+func parsePageQuery(c *gin.Context, sortField string, sortDir int) (pageQuery, error) {
+	page := pageQuery{Limit: defaultPageSize, SortField: sortField, SortDir: sortDir}
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit <= 0 {
+			return page, errors.New("Invalid limit parameter")
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+		page.Limit = limit
+	}
+
+	if cursorParam := c.Query("cursor"); cursorParam != "" {
+		cursor, err := decodePageCursor(cursorParam)
+		if err != nil {
+			return page, errors.New("Invalid cursor parameter")
+		}
+		// Курсор другого списка указывает на чужую позицию
+		if cursor.Key != sortField {
+			return page, errors.New("Cursor does not match sort field")
+		}
+		page.after = cursor
+	}
+
+	return page, nil
+}
+
+// Кодирование позиции в непрозрачную строку
+func encodePageCursor(cursor pageCursor) (string, error) {
+	data, err := bson.MarshalExtJSON(cursor, true, false)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Декодирование позиции из строки курсора
+func decodePageCursor(value string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor pageCursor
+	if err := bson.UnmarshalExtJSON(data, true, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// Добавление к фильтру условия "после курсора"
+func (p pageQuery) filter(filter bson.M) bson.M {
+	if p.after == nil {
+		return filter
+	}
+
+	op := "$gt"
+	if p.SortDir < 0 {
+		op = "$lt"
+	}
+	keyset := bson.M{"$or": []bson.M{
+		{p.SortField: bson.M{op: p.after.Value}},
+		{p.SortField: p.after.Value, "_id": bson.M{op: p.after.ID}},
+	}}
+
+	if len(filter) == 0 {
+		return keyset
+	}
+	return bson.M{"$and": []bson.M{filter, keyset}}
+}
+
+// Получение одной страницы документов коллекции.
+// Возвращает документы и описание пагинации для ответа клиенту.
+func findPage[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, page pageQuery) ([]T, gin.H, error) {
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: page.SortField, Value: page.SortDir}, {Key: "_id", Value: page.SortDir}})
+	findOptions.SetLimit(int64(page.Limit + 1)) // Лишний документ показывает, есть ли следующая страница
+
+	cursor, err := collection.Find(ctx, page.filter(filter), findOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var raws []bson.Raw
+	if err := cursor.All(ctx, &raws); err != nil {
+		return nil, nil, err
+	}
+
+	hasMore := len(raws) > page.Limit
+	if hasMore {
+		raws = raws[:page.Limit]
+	}
+
+	results := make([]T, 0, len(raws))
+	for _, raw := range raws {
+		var result T
+		if err := bson.Unmarshal(raw, &result); err != nil {
+			return nil, nil, err
+		}
+		results = append(results, result)
+	}
+
+	var next *string
+	if hasMore {
+		last := raws[len(raws)-1]
+		encoded, err := encodePageCursor(pageCursor{
+			Key:   page.SortField,
+			Value: last.Lookup(page.SortField),
+			ID:    last.Lookup("_id").ObjectID(),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		next = &encoded
+	}
+
+	return results, gin.H{
+		"limit":    page.Limit,
+		"next":     next,
+		"has_more": hasMore,
+	}, nil
+}
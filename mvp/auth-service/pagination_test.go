@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Курсор журнала аудита: следующая страница начинается после последней записи
+func TestAuditLogCursor(t *testing.T) {
+	logID := primitive.NewObjectID()
+	_, data, err := bson.MarshalValue(time.Date(2025, 3, 14, 10, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := encodePageCursor(pageCursor{Key: "timestamp", Value: bson.RawValue{Type: bson.TypeDateTime, Value: data}, ID: logID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		sortField string
+		wantErr   bool
+	}{
+		{"audit log cursor", "cursor=" + url.QueryEscape(encoded), "timestamp", false},
+		{"audit log cursor in user list", "cursor=" + url.QueryEscape(encoded), "created_at", true},
+		{"broken cursor", "cursor=bm90IGpzb24", "timestamp", true},
+		{"invalid limit", "limit=0", "timestamp", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/audit-logs?"+tt.query, nil)
+			page, err := parsePageQuery(c, tt.sortField, -1)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parsePageQuery(%q) succeeded, want error", tt.query)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePageQuery: %v", err)
+			}
+			if page.after == nil || page.after.ID != logID {
+				t.Fatalf("cursor = %+v, want id %s", page.after, logID.Hex())
+			}
+			if !page.after.Value.Equal(bson.RawValue{Type: bson.TypeDateTime, Value: data}) {
+				t.Errorf("timestamp = %s after round trip", page.after.Value)
+			}
+		})
+	}
+}
+
+// Фильтр по действию сохраняется вместе с условием курсора
+func TestAuditLogPageFilter(t *testing.T) {
+	after := &pageCursor{Key: "timestamp", ID: primitive.NewObjectID()}
+	page := pageQuery{Limit: 10, SortField: "timestamp", SortDir: -1, after: after}
+
+	filter := page.filter(bson.M{"action": "login"})
+	conditions, ok := filter["$and"].([]bson.M)
+	if !ok || len(conditions) != 2 {
+		t.Fatalf("filter = %v, want $and of action and keyset", filter)
+	}
+	if conditions[0]["action"] != "login" {
+		t.Errorf("action filter lost: %v", conditions[0])
+	}
+	keyset, ok := conditions[1]["$or"].([]bson.M)
+	if !ok || len(keyset) != 2 {
+		t.Fatalf("keyset = %v, want two conditions", conditions[1])
+	}
+	if _, ok := keyset[0]["timestamp"].(bson.M)["$lt"]; !ok {
+		t.Errorf("descending keyset must use $lt: %v", keyset[0])
+	}
+
+	if got := (pageQuery{SortField: "timestamp", SortDir: -1}).filter(bson.M{}); len(got) != 0 {
+		t.Errorf("first page filter = %v, want empty", got)
+	}
+}
@@ -199,6 +199,48 @@ const createDemoUsers = async () => {
   }
 };
 
+/**
+ * Создание дерева категорий (оборудование ссылается на категории по коду)
+ */
+const createCategories = async () => {
+  log("Создание категорий оборудования...");
+
+  // Родительские категории создаются раньше дочерних
+  const categories = [
+    { code: "it_equipment", name: "ИТ-оборудование" },
+    { code: "computers", name: "Компьютеры", parent_category: "it_equipment" },
+    { code: "tablets", name: "Планшеты", parent_category: "it_equipment" },
+    { code: "scanners", name: "Сканеры", parent_category: "it_equipment" },
+    { code: "measuring", name: "Измерительные приборы" },
+    {
+      code: "measuring_equipment",
+      name: "Измерительное оборудование",
+      parent_category: "measuring",
+    },
+    {
+      code: "thermal_cameras",
+      name: "Тепловизоры",
+      parent_category: "measuring",
+    },
+  ];
+
+  for (const categoryData of categories) {
+    try {
+      await makeRequest(
+        "POST",
+        `${API_CONFIG.warehouse}/categories`,
+        categoryData,
+        {
+          Authorization: `Bearer ${authToken}`,
+        }
+      );
+      log(`✓ Категория "${categoryData.name}" создана`);
+    } catch (error) {
+      log(`Категория ${categoryData.code} не создана (возможно, уже существует)`, "WARN");
+    }
+  }
+};
+
 /**
  * Создание оборудования на складе
  */
@@ -915,6 +957,7 @@ const main = async () => {
     await checkServices();
     await createAdminUser();
     await createDemoUsers();
+    await createCategories();
     await createWarehouseItems();
     await createTransactions();
     await createInvoices();
@@ -768,7 +768,7 @@ create_categories() {
         -d '{
             "name": "Компьютерное оборудование",
             "description": "Ноутбуки, настольные компьютеры, серверы",
-            "code": "COMP"
+            "code": "computers"
         }' > /dev/null
     
     curl -s -X POST "$WAREHOUSE_SERVICE/categories" \
@@ -777,7 +777,7 @@ create_categories() {
         -d '{
             "name": "Измерительные приборы",
             "description": "Газоанализаторы, мультиметры, осциллографы",
-            "code": "MEAS"
+            "code": "measuring_equipment"
         }' > /dev/null
     
     curl -s -X POST "$WAREHOUSE_SERVICE/categories" \
@@ -786,16 +786,16 @@ create_categories() {
         -d '{
             "name": "Ручной инструмент",
             "description": "Отвертки, ключи, дрели",
-            "code": "TOOL"
+            "code": "tools"
         }' > /dev/null
     
     curl -s -X POST "$WAREHOUSE_SERVICE/categories" \
         -H "Content-Type: application/json" \
         -H "Authorization: Bearer $MANAGER_TOKEN" \
         -d '{
-            "name": "Периферия",
-            "description": "Мониторы, клавиатуры, мыши",
-            "code": "PERIF"
+            "name": "Мониторы",
+            "description": "Мониторы и дисплеи",
+            "code": "monitors"
         }' > /dev/null
     
     echo -e "${GREEN}✓ Категории товаров созданы${NC}"
@@ -810,8 +810,9 @@ create_warehouses() {
         -H "Content-Type: application/json" \
         -H "Authorization: Bearer $MANAGER_TOKEN" \
         -d '{
+            "code": "MAIN",
             "name": "Главный склад",
-            "address": "г. Москва, ул. Складская, д. 1",
+            "address": {"city": "Москва", "street": "ул. Складская, д. 1"},
             "description": "Основное складское помещение",
             "capacity": 1000,
             "manager": "warehouse_manager"
@@ -821,8 +822,9 @@ create_warehouses() {
         -H "Content-Type: application/json" \
         -H "Authorization: Bearer $MANAGER_TOKEN" \
         -d '{
+            "code": "MEAS",
             "name": "Склад измерительного оборудования",
-            "address": "г. Москва, ул. Приборная, д. 5",
+            "address": {"city": "Москва", "street": "ул. Приборная, д. 5"},
             "description": "Специализированный склад для точных приборов",
             "capacity": 200,
             "manager": "employee_maria"
@@ -832,8 +834,9 @@ create_warehouses() {
         -H "Content-Type: application/json" \
         -H "Authorization: Bearer $MANAGER_TOKEN" \
         -d '{
+            "code": "TOOLS",
             "name": "Склад инструментов",
-            "address": "г. Москва, ул. Инструментальная, д. 10",
+            "address": {"city": "Москва", "street": "ул. Инструментальная, д. 10"},
             "description": "Склад ручного и электроинструмента",
             "capacity": 500,
             "manager": "employee_alex"
@@ -1034,6 +1037,8 @@ main() {
     check_services
     create_users
     get_auth_tokens
+    # Оборудование ссылается на категории по коду, поэтому они создаются первыми
+    create_categories
     create_warehouse_items
     create_intake_transactions
     create_tracking_equipment
@@ -1043,7 +1048,6 @@ main() {
     create_audit_logs
     create_system_settings
     create_maintenance_schedules
-    create_categories
     create_warehouses
     create_suppliers
     create_reports
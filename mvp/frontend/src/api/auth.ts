@@ -1,4 +1,4 @@
-import api from "@/utils/api";
+import api, { fetchAllPages } from "@/utils/api";
 import { LoginRequest, LoginResponse, SignupRequest, User } from "@/types/user";
 
 export const authApi = {
@@ -59,8 +59,8 @@ export const authApi = {
    * Получение списка пользователей (только для админов)
    */
   getUsers: async (): Promise<{ users: User[] }> => {
-    const response = await api.auth.get("/users");
-    return response.data;
+    const users = await fetchAllPages<User>(api.auth, "/users", "users");
+    return { users };
   },
 
   /**
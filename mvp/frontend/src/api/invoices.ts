@@ -1,6 +1,6 @@
-import api from "@/utils/api";
+import api, { fetchAllPages } from "@/utils/api";
 import { CreateInvoiceRequest, Invoice, InvoiceType } from "@/types/invoices";
-import { InventoryTransaction } from "@/types/warehouse";
+import { Attachment, InventoryTransaction } from "@/types/warehouse";
 
 export const invoicesApi = {
   /**
@@ -25,7 +25,25 @@ export const invoicesApi = {
    */
   getInvoices: async (type?: string): Promise<Invoice[]> => {
     const params = type ? { type } : {};
-    const response = await api.warehouse.get("/invoices", { params });
+    return fetchAllPages<Invoice>(
+      api.warehouse,
+      "/invoices",
+      "invoices",
+      params
+    );
+  },
+
+  /**
+   * Выгрузка накладных в CSV или XLSX (одна строка на позицию)
+   */
+  exportInvoices: async (
+    format: "csv" | "xlsx",
+    filters?: { type?: InvoiceType; from?: string; to?: string }
+  ): Promise<Blob> => {
+    const response = await api.warehouse.get("/invoices/export", {
+      params: { ...filters, format },
+      responseType: "blob",
+    });
     return response.data;
   },
 
@@ -36,4 +54,29 @@ export const invoicesApi = {
     const response = await api.warehouse.get("/transactions/without-invoices");
     return response.data;
   },
+
+  /**
+   * Вложения накладной (сканы подписанных документов, сертификаты)
+   */
+  getInvoiceAttachments: async (id: string): Promise<Attachment[]> => {
+    const response = await api.warehouse.get(`/invoices/${id}/attachments`);
+    return response.data;
+  },
+
+  /**
+   * Загрузка вложения накладной (до 20 МБ)
+   */
+  uploadInvoiceAttachment: async (
+    id: string,
+    file: File,
+    kind: Attachment["kind"] = "other",
+    description?: string
+  ): Promise<Attachment> => {
+    const form = new FormData();
+    form.append("file", file);
+    form.append("kind", kind);
+    if (description) form.append("description", description);
+    const response = await api.warehouse.post(`/invoices/${id}/attachments`, form);
+    return response.data;
+  },
 };
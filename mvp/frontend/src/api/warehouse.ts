@@ -1,10 +1,33 @@
-import api from "@/utils/api";
+import api, { fetchAllPages } from "@/utils/api";
 import {
   WarehouseItem,
+  WarehouseItemPatch,
   CreateWarehouseItemRequest,
   InventoryTransaction,
   CreateTransactionRequest,
+  ItemPackaging,
+  UnitOfMeasure,
+  Lot,
+  LotAllocation,
+  ExpiringLot,
+  ItemImportReport,
+  ExchangeState,
+  CatalogImportReport,
+  LabelSheetRequest,
+  ItemBarcode,
+  ItemLookupResult,
+  ScanSession,
+  ScanSessionLine,
+  ScanEvent,
+  CreateScanSessionRequest,
+  ScanRequest,
+  Attachment,
+  Category,
+  CategoryAttribute,
+  CategoryNode,
+  ItemSearchResult,
 } from "@/types/warehouse";
+import { Invoice } from "@/types/invoices";
 
 export const warehouseApi = {
   /**
@@ -29,8 +52,39 @@ export const warehouseApi = {
    * Получение списка оборудования с фильтрацией
    */
   getItems: async (filters?: Record<string, any>): Promise<WarehouseItem[]> => {
-    const response = await api.warehouse.get("/items", { params: filters });
-    return response.data.items;
+    return fetchAllPages<WarehouseItem>(
+      api.warehouse,
+      "/items",
+      "items",
+      filters
+    );
+  },
+
+  /**
+   * Поиск оборудования с фасетами; фильтры по атрибутам категорий
+   * передаются как attr.<код>, attr.<код>.min, attr.<код>.max
+   */
+  searchItems: async (
+    filters?: Record<string, any>
+  ): Promise<ItemSearchResult> => {
+    const response = await api.warehouse.get("/items/search", {
+      params: filters,
+    });
+    return response.data;
+  },
+
+  /**
+   * Выгрузка оборудования в CSV или XLSX с фильтрами поиска
+   */
+  exportItems: async (
+    format: "csv" | "xlsx",
+    filters?: Record<string, any>
+  ): Promise<Blob> => {
+    const response = await api.warehouse.get("/items/export", {
+      params: { ...filters, format },
+      responseType: "blob",
+    });
+    return response.data;
   },
 
   /**
@@ -38,17 +92,470 @@ export const warehouseApi = {
    */
   updateItem: async (
     id: string,
-    data: Partial<WarehouseItem>
+    data: WarehouseItemPatch,
+    version: number
   ): Promise<WarehouseItem> => {
-    const response = await api.warehouse.put(`/items/${id}`, data);
-    return response.data;
+    const response = await api.warehouse.put(`/items/${id}`, data, {
+      headers: { "If-Match": `"${version}"` },
+    });
+    return response.data.item;
   },
 
   /**
    * Удаление оборудования со склада
    */
-  deleteItem: async (id: string): Promise<void> => {
-    await api.warehouse.delete(`/items/${id}`);
+  deleteItem: async (id: string, version: number): Promise<void> => {
+    await api.warehouse.delete(`/items/${id}`, {
+      headers: { "If-Match": `"${version}"` },
+    });
+  },
+
+  /**
+   * Архивация оборудования (скрывает из списков, запрещает транзакции)
+   */
+  archiveItem: async (
+    id: string,
+    version: number,
+    reason?: string
+  ): Promise<WarehouseItem> => {
+    const response = await api.warehouse.post(
+      `/items/${id}/archive`,
+      { reason },
+      { headers: { "If-Match": `"${version}"` } }
+    );
+    return response.data.item;
+  },
+
+  /**
+   * Возврат оборудования из архива
+   */
+  unarchiveItem: async (id: string, version: number): Promise<WarehouseItem> => {
+    const response = await api.warehouse.post(`/items/${id}/unarchive`, null, {
+      headers: { "If-Match": `"${version}"` },
+    });
+    return response.data.item;
+  },
+
+  /**
+   * Списание оборудования с указанием причины
+   */
+  decommissionItem: async (
+    id: string,
+    version: number,
+    reason: string,
+    quantity?: number
+  ): Promise<WarehouseItem> => {
+    const response = await api.warehouse.post(
+      `/items/${id}/decommission`,
+      { reason, quantity },
+      { headers: { "If-Match": `"${version}"` } }
+    );
+    return response.data.item;
+  },
+
+  /**
+   * Импорт оборудования из CSV/XLSX; по умолчанию пробный запуск без сохранения
+   */
+  importItems: async (
+    file: File,
+    options: {
+      dryRun?: boolean;
+      skipInvalid?: boolean;
+      mapping?: Record<string, string>;
+      sheet?: string;
+    } = {}
+  ): Promise<ItemImportReport> => {
+    const form = new FormData();
+    form.append("file", file);
+    form.append("dry_run", String(options.dryRun ?? true));
+    if (options.skipInvalid) form.append("skip_invalid", "true");
+    if (options.mapping) form.append("mapping", JSON.stringify(options.mapping));
+    if (options.sheet) form.append("sheet", options.sheet);
+    const response = await api.warehouse.post("/items/import", form, {
+      // 422 - файл с ошибками, отчет по строкам возвращается как результат
+      validateStatus: (status) => status < 300 || status === 422,
+    });
+    return response.data;
+  },
+
+  /**
+   * Выгрузка в 1С (CommerceML): каталог, поставщики или накладные,
+   * измененные после последней подтвержденной выгрузки
+   */
+  exportCommerceML: async (
+    kind: ExchangeState["kind"],
+    options: { full?: boolean; since?: string } = {}
+  ): Promise<{ file: Blob; until: string }> => {
+    const response = await api.warehouse.get(`/exchange/1c/${kind}`, {
+      params: options,
+      responseType: "blob",
+    });
+    return { file: response.data, until: response.headers["x-exchange-until"] };
+  },
+
+  /**
+   * Подтверждение загрузки выгрузки в 1С; следующая выгрузка начнется с until
+   */
+  confirmCommerceMLExport: async (
+    kind: ExchangeState["kind"],
+    until: string
+  ): Promise<ExchangeState> => {
+    const response = await api.warehouse.post(`/exchange/1c/${kind}/confirm`, {
+      until,
+    });
+    return response.data;
+  },
+
+  /**
+   * Состояние выгрузок в 1С
+   */
+  getExchangeState: async (): Promise<ExchangeState[]> => {
+    const response = await api.warehouse.get("/exchange/1c/state");
+    return response.data;
+  },
+
+  /**
+   * Загрузка каталога из 1С (import.xml); по умолчанию пробный запуск без сохранения
+   */
+  importCommerceMLCatalog: async (
+    file: File,
+    options: {
+      dryRun?: boolean;
+      skipInvalid?: boolean;
+      location?: string;
+      warehouse?: string;
+    } = {}
+  ): Promise<CatalogImportReport> => {
+    const form = new FormData();
+    form.append("file", file);
+    form.append("dry_run", String(options.dryRun ?? true));
+    if (options.skipInvalid) form.append("skip_invalid", "true");
+    if (options.location) form.append("location", options.location);
+    if (options.warehouse) form.append("warehouse", options.warehouse);
+    const response = await api.warehouse.post("/exchange/1c/catalog", form, {
+      // 422 - файл с ошибками, отчет возвращается как результат
+      validateStatus: (status) => status < 300 || status === 422,
+    });
+    return response.data;
+  },
+
+  /**
+   * Этикетка оборудования со штрихкодом серийного номера и QR-кодом
+   */
+  getItemLabel: async (
+    id: string,
+    format: "pdf" | "png" = "pdf",
+    size?: { width?: number; height?: number; dpi?: number }
+  ): Promise<Blob> => {
+    const response = await api.warehouse.get(`/items/${id}/label`, {
+      params: { format, ...size },
+      responseType: "blob",
+    });
+    return response.data;
+  },
+
+  /**
+   * Этикетки нескольких единиц оборудования на листах A4 (PDF)
+   */
+  printItemLabels: async (data: LabelSheetRequest): Promise<Blob> => {
+    const response = await api.warehouse.post("/items/labels", data, {
+      responseType: "blob",
+    });
+    return response.data;
+  },
+
+  /**
+   * Вложения оборудования: фотографии, паспорта, сертификаты, руководства
+   */
+  getItemAttachments: async (
+    id: string,
+    kind?: Attachment["kind"]
+  ): Promise<Attachment[]> => {
+    const response = await api.warehouse.get(`/items/${id}/attachments`, {
+      params: kind ? { kind } : undefined,
+    });
+    return response.data;
+  },
+
+  /**
+   * Загрузка вложения оборудования (до 20 МБ)
+   */
+  uploadItemAttachment: async (
+    id: string,
+    file: File,
+    kind: Attachment["kind"] = "other",
+    description?: string
+  ): Promise<Attachment> => {
+    const form = new FormData();
+    form.append("file", file);
+    form.append("kind", kind);
+    if (description) form.append("description", description);
+    const response = await api.warehouse.post(`/items/${id}/attachments`, form);
+    return response.data;
+  },
+
+  /**
+   * Содержимое вложения
+   */
+  getAttachmentContent: async (id: string): Promise<Blob> => {
+    const response = await api.warehouse.get(`/attachments/${id}/content`, {
+      responseType: "blob",
+    });
+    return response.data;
+  },
+
+  /**
+   * Миниатюра изображения (JPEG)
+   */
+  getAttachmentThumbnail: async (id: string): Promise<Blob> => {
+    const response = await api.warehouse.get(`/attachments/${id}/thumbnail`, {
+      responseType: "blob",
+    });
+    return response.data;
+  },
+
+  /**
+   * Удаление вложения
+   */
+  deleteAttachment: async (id: string): Promise<void> => {
+    await api.warehouse.delete(`/attachments/${id}`);
+  },
+
+  /**
+   * Дерево активных категорий
+   */
+  getCategoryTree: async (): Promise<CategoryNode[]> => {
+    const response = await api.warehouse.get("/categories/tree");
+    return response.data.tree;
+  },
+
+  /**
+   * Получение категории со схемой атрибутов
+   */
+  getCategory: async (id: string): Promise<Category> => {
+    const response = await api.warehouse.get(`/categories/${id}`);
+    return response.data;
+  },
+
+  /**
+   * Замена схемы атрибутов категории
+   */
+  updateCategoryAttributes: async (
+    id: string,
+    version: number,
+    attributes: CategoryAttribute[]
+  ): Promise<Category> => {
+    const response = await api.warehouse.patch(
+      `/categories/${id}`,
+      { attributes },
+      { headers: { "If-Match": `"${version}"` } }
+    );
+    return response.data.category;
+  },
+
+  /**
+   * Поиск оборудования по отсканированному значению:
+   * ID, ссылка из QR-кода этикетки, серийный номер или штрихкод
+   */
+  lookupItem: async (code: string): Promise<ItemLookupResult> => {
+    const response = await api.warehouse.get("/items/lookup", {
+      params: { code },
+    });
+    return response.data;
+  },
+
+  /**
+   * Замена дополнительных штрихкодов оборудования
+   */
+  updateItemBarcodes: async (
+    id: string,
+    version: number,
+    barcodes: ItemBarcode[]
+  ): Promise<WarehouseItem> => {
+    const response = await api.warehouse.put(
+      `/items/${id}/barcodes`,
+      { barcodes },
+      { headers: { "If-Match": `"${version}"` } }
+    );
+    return response.data;
+  },
+
+  /**
+   * Создание сессии сканирования приемки или выдачи
+   */
+  createScanSession: async (
+    data: CreateScanSessionRequest
+  ): Promise<ScanSession> => {
+    const response = await api.warehouse.post("/scan-sessions", data);
+    return response.data;
+  },
+
+  /**
+   * Список сессий сканирования
+   */
+  getScanSessions: async (
+    filters?: Record<string, any>
+  ): Promise<ScanSession[]> => {
+    return fetchAllPages<ScanSession>(
+      api.warehouse,
+      "/scan-sessions",
+      "scan_sessions",
+      filters
+    );
+  },
+
+  /**
+   * Получение сессии сканирования
+   */
+  getScanSession: async (id: string): Promise<ScanSession> => {
+    const response = await api.warehouse.get(`/scan-sessions/${id}`);
+    return response.data;
+  },
+
+  /**
+   * Сканирование в сессии; количество добавляется к позиции оборудования
+   */
+  scan: async (
+    sessionId: string,
+    data: ScanRequest
+  ): Promise<{
+    session: ScanSession;
+    scan: ScanEvent;
+    line: ScanSessionLine;
+    item: WarehouseItem;
+  }> => {
+    const response = await api.warehouse.post(
+      `/scan-sessions/${sessionId}/scans`,
+      data
+    );
+    return response.data;
+  },
+
+  /**
+   * Исправление количества позиции сессии; 0 удаляет позицию
+   */
+  updateScanSessionLine: async (
+    sessionId: string,
+    lineId: string,
+    version: number,
+    quantity: number,
+    unit?: string
+  ): Promise<ScanSession> => {
+    const response = await api.warehouse.put(
+      `/scan-sessions/${sessionId}/lines/${lineId}`,
+      { quantity, unit },
+      { headers: { "If-Match": `"${version}"` } }
+    );
+    return response.data;
+  },
+
+  /**
+   * Удаление позиции сессии
+   */
+  deleteScanSessionLine: async (
+    sessionId: string,
+    lineId: string,
+    version: number
+  ): Promise<ScanSession> => {
+    const response = await api.warehouse.delete(
+      `/scan-sessions/${sessionId}/lines/${lineId}`,
+      { headers: { "If-Match": `"${version}"` } }
+    );
+    return response.data;
+  },
+
+  /**
+   * Проведение сессии: транзакции по позициям и одна накладная
+   */
+  completeScanSession: async (
+    id: string,
+    version: number
+  ): Promise<{
+    session: ScanSession;
+    transactions: InventoryTransaction[];
+    invoice: Invoice;
+  }> => {
+    const response = await api.warehouse.post(
+      `/scan-sessions/${id}/complete`,
+      null,
+      { headers: { "If-Match": `"${version}"` } }
+    );
+    return response.data;
+  },
+
+  /**
+   * Отмена сессии без движения остатков
+   */
+  cancelScanSession: async (id: string, version: number): Promise<ScanSession> => {
+    const response = await api.warehouse.post(`/scan-sessions/${id}/cancel`, null, {
+      headers: { "If-Match": `"${version}"` },
+    });
+    return response.data;
+  },
+
+  /**
+   * Изменение базовой единицы и упаковок оборудования
+   */
+  updateItemUnits: async (
+    id: string,
+    version: number,
+    unit: string,
+    packagings: ItemPackaging[] = []
+  ): Promise<WarehouseItem> => {
+    const response = await api.warehouse.put(
+      `/items/${id}/units`,
+      { unit, packagings },
+      { headers: { "If-Match": `"${version}"` } }
+    );
+    return response.data;
+  },
+
+  /**
+   * Справочник единиц измерения
+   */
+  getUnits: async (): Promise<UnitOfMeasure[]> => {
+    const response = await api.warehouse.get("/units");
+    return response.data;
+  },
+
+  /**
+   * Остатки оборудования по партиям
+   */
+  getItemLots: async (
+    id: string,
+    all = false
+  ): Promise<{ lots: Lot[]; unlotted_quantity: number }> => {
+    const response = await api.warehouse.get(`/items/${id}/lots`, {
+      params: all ? { all: true } : undefined,
+    });
+    return response.data;
+  },
+
+  /**
+   * Предложение партий для выдачи по FEFO
+   */
+  getLotSuggestion: async (
+    id: string,
+    quantity: number,
+    unit?: string
+  ): Promise<{ allocations: LotAllocation[]; shortage: number }> => {
+    const response = await api.warehouse.get(`/items/${id}/lots/fefo`, {
+      params: { quantity, unit },
+    });
+    return response.data;
+  },
+
+  /**
+   * Партии с истекающим и истекшим сроком годности
+   */
+  getExpiringLots: async (
+    days?: number,
+    includeExpired = true
+  ): Promise<{ lots: ExpiringLot[]; summary: Record<string, number> }> => {
+    const response = await api.warehouse.get("/lots/expiring", {
+      params: { days, include_expired: includeExpired },
+    });
+    return response.data;
   },
 
   /**
@@ -67,10 +574,26 @@ export const warehouseApi = {
   getTransactions: async (
     filters?: Record<string, any>
   ): Promise<InventoryTransaction[]> => {
-    const response = await api.warehouse.get("/transactions", {
-      params: filters,
+    return fetchAllPages<InventoryTransaction>(
+      api.warehouse,
+      "/transactions",
+      "transactions",
+      filters
+    );
+  },
+
+  /**
+   * Выгрузка транзакций в CSV или XLSX
+   */
+  exportTransactions: async (
+    format: "csv" | "xlsx",
+    filters?: Record<string, any>
+  ): Promise<Blob> => {
+    const response = await api.warehouse.get("/transactions/export", {
+      params: { ...filters, format },
+      responseType: "blob",
     });
-    return response.data.transactions;
+    return response.data;
   },
 
   /**
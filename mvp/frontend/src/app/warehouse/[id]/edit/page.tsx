@@ -9,7 +9,6 @@ import {
   Grid,
   Group,
   NumberInput,
-  Select,
   Stack,
   TextInput,
   Textarea,
@@ -19,9 +18,10 @@ import { DateInput } from "@mantine/dates";
 import { IconArrowLeft, IconDeviceFloppy } from "@tabler/icons-react";
 import { warehouseApi } from "@/api/warehouse";
 import AuthGuard from "@/components/common/AuthGuard";
+import CategorySelect from "@/components/common/CategorySelect";
 import LoadingOverlay from "@/components/common/LoadingOverlay";
 import { useRouter } from "next/navigation";
-import { WarehouseItem, WarehouseItemStatus } from "@/types/warehouse";
+import { WarehouseItemPatch } from "@/types/warehouse";
 import { isNotEmpty, useForm } from "@mantine/form";
 
 interface WarehouseItemEditPageProps {
@@ -30,11 +30,42 @@ interface WarehouseItemEditPageProps {
   };
 }
 
+// Дата из поля формы (DateInput может вернуть строку) в формате ISO
+const toISODate = (value: Date | string | null): string | null =>
+  value ? new Date(value).toISOString() : null;
+
+// Редактируемые поля формы в виде изменения оборудования
+const toPatch = (values: {
+  name: string;
+  serial_number: string;
+  category: string;
+  description: string;
+  manufacturer: string;
+  min_quantity: number;
+  price: number;
+  location: string;
+  purchase_date: Date | string;
+  warranty_expiry: Date | string | null;
+}): WarehouseItemPatch => ({
+  name: values.name,
+  serial_number: values.serial_number,
+  category: values.category,
+  description: values.description,
+  manufacturer: values.manufacturer,
+  min_quantity: values.min_quantity,
+  price: values.price,
+  location: values.location,
+  purchase_date: toISODate(values.purchase_date) ?? undefined,
+  warranty_expiry: toISODate(values.warranty_expiry),
+});
+
 export default function WarehouseItemEditPage({
   params,
 }: WarehouseItemEditPageProps) {
   const [isLoading, setIsLoading] = useState(true);
   const [isSaving, setIsSaving] = useState(false);
+  const [version, setVersion] = useState(0);
+  const [loadedValues, setLoadedValues] = useState<WarehouseItemPatch>({});
   const router = useRouter();
   const resolvedParams = React.use(params);
   const itemId = resolvedParams.id;
@@ -51,9 +82,8 @@ export default function WarehouseItemEditPage({
       min_quantity: 0,
       price: 0,
       location: "",
-      purchase_date: new Date(),
-      warranty_expiry: null as Date | null,
-      status: WarehouseItemStatus.AVAILABLE,
+      purchase_date: new Date() as Date | string,
+      warranty_expiry: null as Date | string | null,
     },
     validate: {
       name: isNotEmpty("Название обязательно для заполнения"),
@@ -75,8 +105,11 @@ export default function WarehouseItemEditPage({
       // Fetch item details
       const item = await warehouseApi.getItem(itemId);
 
+      // Remember the version for conflict detection
+      setVersion(item.version);
+
       // Set form values
-      form.setValues({
+      const values = {
         name: item.name,
         serial_number: item.serial_number,
         category: item.category,
@@ -84,13 +117,16 @@ export default function WarehouseItemEditPage({
         manufacturer: item.manufacturer,
         quantity: item.quantity,
         min_quantity: item.min_quantity,
+        price: item.price ?? 0,
         location: item.location,
         purchase_date: new Date(item.purchase_date),
         warranty_expiry: item.warranty_expiry
           ? new Date(item.warranty_expiry)
           : null,
-        status: item.status,
-      });
+      };
+      form.setValues(values);
+      // Загруженные значения - основа для списка изменений при сохранении
+      setLoadedValues(toPatch(values));
 
       setIsLoading(false);
     } catch (error) {
@@ -103,20 +139,31 @@ export default function WarehouseItemEditPage({
     try {
       setIsSaving(true);
 
-      // Format dates back to strings
-      const updateData: Partial<WarehouseItem> = {
-        ...values,
-        purchase_date: values.purchase_date.toISOString(),
-        warranty_expiry: values.warranty_expiry?.toISOString() || undefined,
-      };
+      // Отправляем только измененные поля: остаток и статус меняются транзакциями
+      const current = toPatch(values);
+      const changes: WarehouseItemPatch = {};
+      for (const key of Object.keys(current) as (keyof WarehouseItemPatch)[]) {
+        if (current[key] !== loadedValues[key]) {
+          Object.assign(changes, { [key]: current[key] });
+        }
+      }
 
-      // Update the item
-      await warehouseApi.updateItem(itemId, updateData);
+      if (Object.keys(changes).length > 0) {
+        await warehouseApi.updateItem(itemId, changes, version);
+      }
 
       // Navigate back to item view
       router.push(`/warehouse/${itemId}`);
-    } catch (error) {
+    } catch (error: any) {
       console.error("Error updating item:", error);
+      if (error?.response?.status === 412) {
+        alert(
+          "Элемент был изменен другим пользователем. Загружены актуальные данные, проверьте изменения и сохраните еще раз."
+        );
+        await fetchItemData();
+        setIsSaving(false);
+        return;
+      }
       alert(
         "Не удалось обновить данные элемента. Пожалуйста, попробуйте еще раз."
       );
@@ -168,9 +215,9 @@ export default function WarehouseItemEditPage({
                     />
                   </Grid.Col>
                   <Grid.Col span={{ base: 12, md: 6 }}>
-                    <TextInput
+                    <CategorySelect
                       label="Категория"
-                      placeholder="Введите категорию оборудования"
+                      placeholder="Выберите категорию оборудования"
                       required
                       {...form.getInputProps("category")}
                     />
@@ -186,9 +233,8 @@ export default function WarehouseItemEditPage({
                   <Grid.Col span={{ base: 12, md: 6 }}>
                     <NumberInput
                       label="Количество"
-                      placeholder="Введите текущее количество"
-                      min={0}
-                      required
+                      description="Изменяется приходом и расходом"
+                      disabled
                       {...form.getInputProps("quantity")}
                     />
                   </Grid.Col>
@@ -219,28 +265,6 @@ export default function WarehouseItemEditPage({
                       {...form.getInputProps("location")}
                     />
                   </Grid.Col>
-                  <Grid.Col span={{ base: 12, md: 6 }}>
-                    <Select
-                      label="Статус"
-                      placeholder="Выберите статус"
-                      data={[
-                        {
-                          value: WarehouseItemStatus.AVAILABLE,
-                          label: "Доступно",
-                        },
-                        {
-                          value: WarehouseItemStatus.RESERVED,
-                          label: "Зарезервировано",
-                        },
-                        {
-                          value: WarehouseItemStatus.UNAVAILABLE,
-                          label: "Недоступно",
-                        },
-                      ]}
-                      required
-                      {...form.getInputProps("status")}
-                    />
-                  </Grid.Col>
                   <Grid.Col span={{ base: 12, md: 6 }}>
                     <DateInput
                       label="Дата покупки"
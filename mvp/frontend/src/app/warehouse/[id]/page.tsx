@@ -141,6 +141,10 @@ export default function WarehouseItemViewPage({
         return { color: "blue", label: "Возврат" };
       case TransactionType.ADJUSTMENT:
         return { color: "gray", label: "Корректировка" };
+      case TransactionType.WRITE_OFF:
+        return { color: "red", label: "Списание" };
+      case TransactionType.SUPPLIER_RETURN:
+        return { color: "grape", label: "Возврат поставщику" };
       default:
         return { color: "gray", label: type };
     }
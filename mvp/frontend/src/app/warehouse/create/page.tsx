@@ -19,6 +19,7 @@ import { DateInput } from "@mantine/dates";
 import { IconArrowLeft, IconDeviceFloppy } from "@tabler/icons-react";
 import { warehouseApi } from "@/api/warehouse";
 import AuthGuard from "@/components/common/AuthGuard";
+import CategorySelect from "@/components/common/CategorySelect";
 import { useRouter } from "next/navigation";
 import {
   CreateWarehouseItemRequest,
@@ -128,9 +129,9 @@ export default function CreateWarehouseItemPage() {
                   />
                 </Grid.Col>
                 <Grid.Col span={{ base: 12, md: 6 }}>
-                  <TextInput
+                  <CategorySelect
                     label="Категория"
-                    placeholder="Введите категорию оборудования"
+                    placeholder="Выберите категорию оборудования"
                     required
                     {...form.getInputProps("category")}
                   />
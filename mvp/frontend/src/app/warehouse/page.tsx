@@ -149,13 +149,18 @@ export default function WarehousePage() {
   };
 
   // Handle item deletion
-  const handleDeleteItem = async (id: string) => {
+  const handleDeleteItem = async (item: WarehouseItem) => {
     if (window.confirm("Вы уверены, что хотите удалить этот элемент?")) {
       try {
-        await warehouseApi.deleteItem(id);
+        await warehouseApi.deleteItem(item.id, item.version);
         fetchWarehouseItems(); // Refresh the list
-      } catch (error) {
+      } catch (error: any) {
         console.error("Error deleting item:", error);
+        if (error?.response?.status === 412) {
+          alert("Элемент был изменен другим пользователем. Список обновлен.");
+          fetchWarehouseItems();
+          return;
+        }
         alert("Не удалось удалить элемент. Пожалуйста, попробуйте еще раз.");
       }
     }
@@ -371,7 +376,7 @@ export default function WarehousePage() {
                                   <ActionIcon
                                     variant="subtle"
                                     color="red"
-                                    onClick={() => handleDeleteItem(item.id)}
+                                    onClick={() => handleDeleteItem(item)}
                                   >
                                     <IconTrash size={18} />
                                   </ActionIcon>
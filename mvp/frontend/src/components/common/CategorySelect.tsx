@@ -0,0 +1,60 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { Select, SelectProps } from "@mantine/core";
+import { warehouseApi } from "@/api/warehouse";
+import { CategoryNode } from "@/types/warehouse";
+
+interface CategoryOption {
+  value: string;
+  label: string;
+}
+
+// Плоский список категорий дерева; вложенность показывается отступом
+const flattenTree = (
+  nodes: CategoryNode[],
+  depth = 0,
+  result: CategoryOption[] = []
+): CategoryOption[] => {
+  for (const node of nodes) {
+    result.push({
+      value: node.code,
+      label: `${"— ".repeat(depth)}${node.name}`,
+    });
+    flattenTree(node.children ?? [], depth + 1, result);
+  }
+  return result;
+};
+
+/**
+ * Выбор категории оборудования из справочника (/categories/tree).
+ * Текущее значение, которого нет среди активных категорий, остается в списке.
+ */
+export default function CategorySelect(props: Omit<SelectProps, "data">) {
+  const [options, setOptions] = useState<CategoryOption[]>([]);
+  const [isLoading, setIsLoading] = useState(true);
+
+  useEffect(() => {
+    warehouseApi
+      .getCategoryTree()
+      .then((tree) => setOptions(flattenTree(tree)))
+      .catch((error) => console.error("Error loading categories:", error))
+      .finally(() => setIsLoading(false));
+  }, []);
+
+  const value = props.value;
+  const data =
+    value && !options.some((option) => option.value === value)
+      ? [...options, { value, label: value }]
+      : options;
+
+  return (
+    <Select
+      searchable
+      nothingFoundMessage="Категория не найдена"
+      disabled={isLoading}
+      {...props}
+      data={data}
+    />
+  );
+}
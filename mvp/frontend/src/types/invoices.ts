@@ -14,7 +14,14 @@ export interface InvoiceItem {
   category: string;
   manufacturer: string;
   quantity: number;
+  unit?: string; // По умолчанию базовая единица оборудования
+  baseQuantity?: number; // Рассчитывается сервером
+  lotNumber?: string; // Обязательна для оборудования с учетом партий
+  expiryDate?: string; // По умолчанию срок годности партии
   price: number;
+  vatRate?: number; // Ставка НДС в процентах; не указана - без НДС
+  netAmount?: number; // Рассчитывается сервером
+  vatAmount?: number; // Рассчитывается сервером
   totalAmount: number;
 }
 
@@ -34,9 +41,15 @@ export interface Invoice {
   items: InvoiceItem[];
   receivedBy: PersonInfo;
   issuedBy: PersonInfo;
+  currency?: string;
+  vatIncluded?: boolean;
+  netAmount?: number;
+  vatAmount?: number;
   totalAmount: number;
   notes?: string;
   transactionId?: string;
+  transactionIds?: string[]; // Транзакции накладной, оформленной по сессии сканирования
+  scanSessionId?: string;
   createdAt?: Date;
 }
 
@@ -48,7 +61,9 @@ export interface CreateInvoiceRequest {
   items: InvoiceItem[];
   receivedBy: PersonInfo;
   issuedBy: PersonInfo;
-  totalAmount: number;
+  currency?: string; // По умолчанию RUB
+  vatIncluded?: boolean; // Цены позиций указаны с НДС
+  totalAmount?: number; // Проверяется сервером
   notes?: string;
   transactionId?: string;
 }
@@ -6,13 +6,24 @@ export interface WarehouseItem {
   description: string;
   manufacturer: string;
   price?: number;
-  quantity: number;
+  currency?: string; // ISO 4217, по умолчанию RUB
+  quantity: number; // В базовой единице
   min_quantity: number;
+  unit?: string; // Базовая единица измерения, по умолчанию pcs
+  packagings?: ItemPackaging[];
+  track_lots?: boolean; // Учет по партиям и срокам годности
+  external_id?: string; // Ид номенклатуры в 1С
+  barcodes?: ItemBarcode[]; // Дополнительные штрихкоды для сканирования
+  attributes?: Record<string, AttributeValue>; // Значения атрибутов по схеме категории
   location: string;
   purchase_date: string;
   warranty_expiry: string;
   status: WarehouseItemStatus;
   last_inventory: string;
+  archived?: boolean;
+  archived_at?: string;
+  archive_reason?: string;
+  version: number;
   created_at: string;
   updated_at: string;
 }
@@ -27,12 +38,15 @@ export interface InventoryTransaction {
   id: string;
   item_id: string;
   transaction_type: TransactionType;
-  quantity: number;
+  quantity: number; // В базовой единице оборудования
+  unit?: string; // Единица, в которой введено количество
+  unit_quantity?: number;
   responsible_user: string;
   destination_user?: string;
   reason: string;
   date: string;
   notes?: string;
+  lots?: LotAllocation[]; // Партии, по которым прошло движение
 }
 
 export enum TransactionType {
@@ -40,6 +54,8 @@ export enum TransactionType {
   ISSUE = "issue",
   RETURN = "return",
   ADJUSTMENT = "adjustment",
+  WRITE_OFF = "write_off",
+  SUPPLIER_RETURN = "supplier_return",
 }
 
 export interface CreateWarehouseItemRequest {
@@ -50,18 +66,297 @@ export interface CreateWarehouseItemRequest {
   manufacturer: string;
   quantity: number;
   min_quantity: number;
+  unit?: string;
+  packagings?: ItemPackaging[];
+  track_lots?: boolean;
+  lot_number?: string; // Партия начального остатка
+  expiry_date?: string;
   location: string;
   purchase_date: string;
   warranty_expiry?: string;
+  attributes?: Record<string, AttributeValue>;
   status: WarehouseItemStatus;
 }
 
+// Изменение оборудования в формате JSON Merge Patch: передаются только измененные поля,
+// null удаляет поле. Остаток и статус меняются только транзакциями
+export type WarehouseItemPatch = Partial<
+  Omit<
+    CreateWarehouseItemRequest,
+    "quantity" | "status" | "lot_number" | "expiry_date" | "warranty_expiry"
+  >
+> & {
+  price?: number;
+  warranty_expiry?: string | null;
+};
+
 export interface CreateTransactionRequest {
   item_id: string;
   transaction_type: TransactionType;
   quantity: number;
+  unit?: string; // По умолчанию базовая единица оборудования
   responsible_user: string;
   destination_user?: string;
   reason: string;
   notes?: string;
+  lot_number?: string; // Для оборудования с учетом партий
+  expiry_date?: string; // Срок годности партии (только для прихода)
+}
+
+// Упаковка оборудования: сколько базовых единиц в одной упаковке
+export interface ItemPackaging {
+  unit: string;
+  factor: number;
+}
+
+// Единица измерения
+export interface UnitOfMeasure {
+  id: string;
+  code: string;
+  name: string;
+  dimension?: "count" | "length" | "mass" | "volume";
+  factor?: number;
+  precision: number;
+}
+
+// Партия оборудования
+export interface Lot {
+  id: string;
+  item_id: string;
+  number: string;
+  expiry_date?: string;
+  quantity: number; // Остаток в базовой единице
+  received_quantity: number;
+  received_at: string;
+  is_expired: boolean;
+}
+
+// Количество, прошедшее по партии
+export interface LotAllocation {
+  lot_id: string;
+  number: string;
+  expiry_date?: string;
+  quantity: number;
+}
+
+// Партия с истекающим сроком годности
+export interface ExpiringLot extends Lot {
+  item_name: string;
+  serial_number: string;
+  category: string;
+  warehouse?: string;
+  location: string;
+  unit: string;
+  days_left: number;
+}
+
+// Результат обработки строки импорта
+export interface ItemImportRow {
+  row: number;
+  serial_number?: string;
+  status: "valid" | "invalid" | "created" | "failed" | "skipped";
+  item_id?: string;
+  errors?: { field?: string; message: string }[];
+}
+
+// Отчет импорта оборудования
+export interface ItemImportReport {
+  dry_run: boolean;
+  total_rows: number;
+  valid_rows: number;
+  invalid_rows: number;
+  created?: number;
+  failed?: number;
+  rows: ItemImportRow[];
+  error?: string;
+}
+
+// Граница последней подтвержденной выгрузки в 1С
+export interface ExchangeState {
+  kind: "catalog" | "suppliers" | "documents";
+  exported_until: string;
+  confirmed_by?: string;
+  updated_at?: string;
+}
+
+// Результат загрузки группы или товара из каталога 1С
+export interface CatalogImportEntry {
+  kind: "group" | "item";
+  external_id: string;
+  name: string;
+  action: "create" | "update" | "unchanged" | "skipped" | "invalid" | "failed";
+  id?: string;
+  code?: string;
+  changes?: string[];
+  warnings?: string[];
+  errors?: string[];
+}
+
+// Отчет загрузки каталога из 1С
+export interface CatalogImportReport {
+  dry_run: boolean;
+  groups: Record<string, number>;
+  items: Record<string, number>;
+  entries: CatalogImportEntry[];
+  error?: string;
+}
+
+// Печать этикеток на листах A4 (размеры в мм)
+export interface LabelSheetRequest {
+  item_ids: string[];
+  copies?: number;
+  columns?: number; // По умолчанию сетка 3x8
+  rows?: number;
+  margin_top?: number;
+  margin_left?: number;
+  gap_x?: number;
+  gap_y?: number;
+  label_width?: number;
+  label_height?: number;
+  skip?: number; // Уже использованные этикетки в начале листа
+  border?: boolean;
+}
+
+// Дополнительный штрихкод оборудования; штрихкод упаковки указывает единицу
+export interface ItemBarcode {
+  code: string;
+  unit?: string;
+}
+
+// Результат поиска оборудования по отсканированному значению
+export interface ItemLookupResult {
+  item: WarehouseItem;
+  matched_by: "id" | "url" | "serial_number" | "barcode";
+  unit?: string; // Единица штрихкода упаковки
+}
+
+// Позиция сессии сканирования (количество в базовой единице)
+export interface ScanSessionLine {
+  id: string;
+  item_id: string;
+  item_name: string;
+  serial_number: string;
+  unit: string;
+  quantity: number;
+  lot_number?: string;
+  expiry_date?: string;
+  scans: number;
+}
+
+// Запись журнала сканирований
+export interface ScanEvent {
+  code: string;
+  matched_by: ItemLookupResult["matched_by"];
+  item_id: string;
+  line_id: string;
+  quantity: number;
+  unit?: string;
+  scanned_by: string;
+  scanned_at: string;
+}
+
+// Сессия сканирования: сканы проводятся одной приходной или расходной накладной
+export interface ScanSession {
+  id: string;
+  number: string;
+  type: "intake" | "issue";
+  status: "open" | "completed" | "cancelled";
+  responsible_user: string;
+  destination_user?: string;
+  supplier_id?: string;
+  reason?: string;
+  notes?: string;
+  lines: ScanSessionLine[];
+  scans: ScanEvent[];
+  transaction_ids?: string[];
+  invoice_id?: string;
+  created_by: string;
+  completed_at?: string;
+  cancelled_at?: string;
+  version: number;
+  created_at: string;
+  updated_at: string;
+}
+
+// Создание сессии сканирования
+export interface CreateScanSessionRequest {
+  type: ScanSession["type"];
+  responsible_user: string;
+  destination_user?: string; // Обязателен для выдачи
+  supplier_id?: string; // Только для приемки
+  reason?: string;
+  notes?: string;
+}
+
+// Сканирование в сессии
+export interface ScanRequest {
+  code: string;
+  quantity?: number; // По умолчанию 1
+  unit?: string;
+  lot_number?: string;
+  expiry_date?: string;
+}
+
+// Вложение оборудования или накладной (фотография, паспорт, сертификат, руководство)
+export interface Attachment {
+  id: string;
+  owner_type: "item" | "invoice";
+  owner_id: string;
+  kind: "photo" | "passport" | "certificate" | "manual" | "other";
+  file_name: string;
+  content_type: string;
+  size: number;
+  sha256: string;
+  width?: number;
+  height?: number;
+  description?: string;
+  has_thumbnail: boolean;
+  uploaded_by: string;
+  created_at: string;
+}
+
+// Значение атрибута оборудования; дата передается как YYYY-MM-DD
+export type AttributeValue = string | number | boolean;
+
+// Атрибут оборудования категории (расход, давление, диапазон измерений)
+export interface CategoryAttribute {
+  code: string;
+  name: string;
+  type: "string" | "number" | "integer" | "boolean" | "date" | "enum";
+  unit?: string;
+  required: boolean;
+  values?: string[]; // Допустимые значения для enum
+  min?: number;
+  max?: number;
+}
+
+// Категория оборудования; схема атрибутов наследуется подкатегориями
+export interface Category {
+  id: string;
+  code: string;
+  name: string;
+  description?: string;
+  parent_category?: string;
+  external_id?: string;
+  attributes?: CategoryAttribute[];
+  is_active: boolean;
+  version: number;
+  created_at: string;
+  updated_at: string;
+}
+
+// Узел дерева категорий с количеством оборудования
+export interface CategoryNode extends Category {
+  item_count: number;
+  total_item_count: number;
+  children: CategoryNode[];
+}
+
+// Результат поиска оборудования с фасетами
+export interface ItemSearchResult {
+  items: WarehouseItem[];
+  total: number;
+  limit: number;
+  skip: number;
+  facets?: Record<string, { value: string; count: number }[]>;
 }
@@ -1,4 +1,4 @@
-import axios, { AxiosError, AxiosRequestConfig } from "axios";
+import axios, { AxiosError, AxiosInstance, AxiosRequestConfig } from "axios";
 import { store } from "@/store";
 import { logout, updateToken, updateUser } from "@/store/authSlice";
 
@@ -163,6 +163,43 @@ const refreshToken = async () => {
   );
 });
 
+// Максимальный размер страницы списков на сервере
+const MAX_PAGE_SIZE = 200;
+
+// Описание страницы в ответе списка с курсорной пагинацией
+interface PageInfo {
+  limit: number;
+  next: string | null;
+  has_more: boolean;
+}
+
+/**
+ * Загрузка всех страниц списка: запрос повторяется с курсором pagination.next,
+ * пока сервер сообщает has_more
+ */
+export async function fetchAllPages<T>(
+  client: AxiosInstance,
+  url: string,
+  key: string,
+  params?: Record<string, any>
+): Promise<T[]> {
+  const results: T[] = [];
+  let cursor: string | null = null;
+  do {
+    const response: { data: Record<string, any> } = await client.get(url, {
+      params: {
+        limit: MAX_PAGE_SIZE,
+        ...params,
+        ...(cursor ? { cursor } : {}),
+      },
+    });
+    results.push(...((response.data[key] as T[]) ?? []));
+    const pagination = response.data.pagination as PageInfo | undefined;
+    cursor = pagination?.has_more ? pagination.next : null;
+  } while (cursor);
+  return results;
+}
+
 export default {
   auth: authApi,
   warehouse: warehouseApi,
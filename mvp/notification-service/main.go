@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -20,8 +21,19 @@ type Notification struct {
     CreatedAt time.Time `json:"created_at"`
 }
 
-// Хранилище уведомлений (в реальной системе будет использоваться MongoDB)
-var notifications = []Notification{}
+// Хранилище уведомлений (в реальной системе будет использоваться MongoDB).
+// Пополняется HTTP-обработчиками и потребителями RabbitMQ одновременно, поэтому доступ через notificationsMu
+var (
+    notifications   = []Notification{}
+    notificationsMu sync.RWMutex
+)
+
+// Добавление уведомлений в хранилище
+func addNotifications(items ...Notification) {
+    notificationsMu.Lock()
+    defer notificationsMu.Unlock()
+    notifications = append(notifications, items...)
+}
 
 // CORS middleware
 func corsMiddleware(next http.Handler) http.Handler {
@@ -149,11 +161,13 @@ func getUserNotifications(w http.ResponseWriter, r *http.Request) {
 
     // Фильтрация уведомлений для пользователя
     var userNotifications []Notification
+    notificationsMu.RLock()
     for _, notification := range notifications {
         if notification.UserID == userID || notification.UserID == "all" {
             userNotifications = append(userNotifications, notification)
         }
     }
+    notificationsMu.RUnlock()
 
     // Сортировка по времени создания (в реальной системе будет делать MongoDB)
     // ...
@@ -181,11 +195,13 @@ func getUnreadCount(w http.ResponseWriter, r *http.Request) {
 
     // Подсчет непрочитанных уведомлений
     count := 0
+    notificationsMu.RLock()
     for _, notification := range notifications {
         if (notification.UserID == userID || notification.UserID == "all") && !notification.IsRead {
             count++
         }
     }
+    notificationsMu.RUnlock()
 
     // Отправка ответа
     w.Header().Set("Content-Type", "application/json")
@@ -219,6 +235,7 @@ func markAsRead(w http.ResponseWriter, r *http.Request) {
 
     // Обновление статуса уведомления
     updated := false
+    notificationsMu.Lock()
     for i := range notifications {
         if notifications[i].ID == request.NotificationID && 
           (notifications[i].UserID == request.UserID || notifications[i].UserID == "all") {
@@ -227,6 +244,7 @@ func markAsRead(w http.ResponseWriter, r *http.Request) {
             break
         }
     }
+    notificationsMu.Unlock()
 
     // Отправка ответа
     w.Header().Set("Content-Type", "application/json")
@@ -263,7 +281,7 @@ func createNotification(w http.ResponseWriter, r *http.Request) {
     notification.IsRead = false
 
     // Добавление уведомления
-    notifications = append(notifications, notification)
+    addNotifications(notification)
 
     // Отправка ответа
     w.Header().Set("Content-Type", "application/json")
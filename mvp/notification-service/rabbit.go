@@ -19,9 +19,14 @@ var (
 
 // Константы для обмена сообщениями
 const (
-	TransferExchange      = "tracking_exchange"
-	TransferKey           = "equipment.transferred"
-	TransferQueueName     = "equipment_transferred_queue"
+	TransferExchange  = "tracking_exchange"
+	TransferKey       = "equipment.transferred"
+	TransferQueueName = "equipment_transferred_queue"
+
+	WarehouseExchange        = "warehouse_exchange"
+	CheckoutOverdueKey       = "checkout.overdue"
+	WarrantyExpiringKey      = "warranty.expiring"
+	WarehouseAlertsQueueName = "warehouse_alerts_queue"
 )
 
 // Сообщение о передаче оборудования
@@ -37,6 +42,32 @@ type TransferMessage struct {
 	BlockchainTxID  string    `json:"blockchain_tx_id"`
 }
 
+// Сообщение о просроченном возврате оборудования (от warehouse-service)
+type CheckoutOverdueMessage struct {
+	CheckoutID          string    `json:"checkout_id"`
+	ItemID              string    `json:"item_id"`
+	ItemName            string    `json:"item_name"`
+	SerialNumber        string    `json:"serial_number"`
+	Holder              string    `json:"holder"`
+	ResponsibleUser     string    `json:"responsible_user"`
+	OutstandingQuantity float64   `json:"outstanding_quantity"`
+	Unit                string    `json:"unit"`
+	DueDate             time.Time `json:"due_date"`
+	DaysOverdue         int       `json:"days_overdue"`
+}
+
+// Сообщение о скором окончании гарантии (от warehouse-service)
+type WarrantyExpiringMessage struct {
+	ItemID         string    `json:"item_id"`
+	Name           string    `json:"name"`
+	SerialNumber   string    `json:"serial_number"`
+	Category       string    `json:"category"`
+	Location       string    `json:"location"`
+	WarrantyExpiry time.Time `json:"warranty_expiry"`
+	DaysLeft       int       `json:"days_left"`
+	WindowDays     int       `json:"window_days"`
+}
+
 // Инициализация подключения к RabbitMQ
 func initRabbitMQ() error {
 	// Получаем URI из переменной окружения или используем значение по умолчанию
@@ -103,8 +134,53 @@ func initRabbitMQ() error {
 		return err
 	}
 
-	// Запуск потребителя сообщений
+	// Объявление обмена склада для предупреждений
+	err = ch.ExchangeDeclare(
+		WarehouseExchange, // name
+		"direct",          // type
+		true,              // durable
+		false,             // auto-deleted
+		false,             // internal
+		false,             // no-wait
+		nil,               // arguments
+	)
+	if err != nil {
+		log.Printf("Failed to declare warehouse exchange: %v", err)
+		return err
+	}
+
+	// Объявление очереди предупреждений склада
+	alertsQueue, err := ch.QueueDeclare(
+		WarehouseAlertsQueueName, // name
+		true,                     // durable
+		false,                    // delete when unused
+		false,                    // exclusive
+		false,                    // no-wait
+		nil,                      // arguments
+	)
+	if err != nil {
+		log.Printf("Failed to declare warehouse alerts queue: %v", err)
+		return err
+	}
+
+	// Связывание очереди предупреждений с обменом склада
+	for _, routingKey := range []string{CheckoutOverdueKey, WarrantyExpiringKey} {
+		err = ch.QueueBind(
+			alertsQueue.Name,  // queue name
+			routingKey,        // routing key
+			WarehouseExchange, // exchange
+			false,             // no-wait
+			nil,               // arguments
+		)
+		if err != nil {
+			log.Printf("Failed to bind warehouse alerts queue: %v", err)
+			return err
+		}
+	}
+
+	// Запуск потребителей сообщений
 	go consumeTransferMessages()
+	go consumeWarehouseAlerts()
 
 	log.Println("RabbitMQ initialized successfully")
 	return nil
@@ -149,8 +225,7 @@ func consumeTransferMessages() {
 		toUserNotification := createTransferNotification(transferMsg, transferMsg.ToHolderID, true)
 
 		// Сохраняем уведомления (в настоящей реализации здесь будет сохранение в MongoDB)
-		notifications = append(notifications, fromUserNotification)
-		notifications = append(notifications, toUserNotification)
+		addNotifications(fromUserNotification, toUserNotification)
 
 		log.Printf("Created notifications for transfer: %s -> %s", transferMsg.FromHolderID, transferMsg.ToHolderID)
 
@@ -196,6 +271,116 @@ func createTransferNotification(transferMsg TransferMessage, userID string, isRe
 	}
 }
 
+// Потребитель предупреждений от warehouse-service
+func consumeWarehouseAlerts() {
+	if rabbitChannel == nil {
+		log.Println("RabbitMQ channel is not initialized")
+		return
+	}
+
+	msgs, err := rabbitChannel.Consume(
+		WarehouseAlertsQueueName, // queue
+		"",                       // consumer
+		false,                    // auto-ack
+		false,                    // exclusive
+		false,                    // no-local
+		false,                    // no-wait
+		nil,                      // args
+	)
+	if err != nil {
+		log.Printf("Failed to register a warehouse alerts consumer: %v", err)
+		return
+	}
+
+	log.Printf("Started consuming messages from queue: %s", WarehouseAlertsQueueName)
+
+	for msg := range msgs {
+		switch msg.RoutingKey {
+		case CheckoutOverdueKey:
+			var overdueMsg CheckoutOverdueMessage
+			if err := json.Unmarshal(msg.Body, &overdueMsg); err != nil {
+				log.Printf("Error parsing checkout overdue message: %v", err)
+				msg.Nack(false, false) // Некорректное сообщение не возвращаем в очередь
+				continue
+			}
+
+			log.Printf("Received overdue message for checkout: %s", overdueMsg.CheckoutID)
+
+			// Уведомляем сотрудника, у которого оборудование, и выдавшего его
+			addNotifications(createOverdueNotification(overdueMsg, overdueMsg.Holder))
+			if overdueMsg.ResponsibleUser != "" && overdueMsg.ResponsibleUser != overdueMsg.Holder {
+				addNotifications(createOverdueNotification(overdueMsg, overdueMsg.ResponsibleUser))
+			}
+		case WarrantyExpiringKey:
+			var warrantyMsg WarrantyExpiringMessage
+			if err := json.Unmarshal(msg.Body, &warrantyMsg); err != nil {
+				log.Printf("Error parsing warranty expiring message: %v", err)
+				msg.Nack(false, false)
+				continue
+			}
+
+			log.Printf("Received warranty expiring message for item: %s", warrantyMsg.ItemID)
+
+			// Уведомление для всех сотрудников, планирующих закупки
+			addNotifications(createWarrantyNotification(warrantyMsg))
+		default:
+			log.Printf("Unknown warehouse alert routing key: %s", msg.RoutingKey)
+		}
+
+		msg.Ack(false)
+	}
+}
+
+// Создание уведомления о просроченном возврате оборудования
+func createOverdueNotification(overdueMsg CheckoutOverdueMessage, userID string) Notification {
+	message := fmt.Sprintf("Просрочено возвращение: %s", overdueMsg.ItemName)
+	if overdueMsg.SerialNumber != "" {
+		message = fmt.Sprintf("%s (S/N: %s)", message, overdueMsg.SerialNumber)
+	}
+	unit := overdueMsg.Unit
+	if unit == "" {
+		unit = "шт"
+	}
+	message = fmt.Sprintf("%s. Срок возврата: %s, не возвращено: %g %s.",
+		message, overdueMsg.DueDate.Format("02.01.2006"), overdueMsg.OutstandingQuantity, unit)
+
+	return Notification{
+		ID:        fmt.Sprintf("overdue_%s_%d_%s", overdueMsg.CheckoutID, overdueMsg.DaysOverdue, strings.ReplaceAll(userID, "-", "")),
+		UserID:    userID,
+		Type:      "warning",
+		Message:   message,
+		RelatedTo: fmt.Sprintf("checkout-%s", overdueMsg.CheckoutID),
+		IsRead:    false,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Создание уведомления об окончании гарантии
+func createWarrantyNotification(warrantyMsg WarrantyExpiringMessage) Notification {
+	message := fmt.Sprintf("Заканчивается гарантия: %s", warrantyMsg.Name)
+	if warrantyMsg.SerialNumber != "" {
+		message = fmt.Sprintf("%s (S/N: %s)", message, warrantyMsg.SerialNumber)
+	}
+	message = fmt.Sprintf("%s. Гарантия до %s, осталось дней: %d",
+		message, warrantyMsg.WarrantyExpiry.Format("02.01.2006"), warrantyMsg.DaysLeft)
+
+	notificationType := "info"
+	if warrantyMsg.WindowDays <= 30 {
+		notificationType = "warning"
+	}
+
+	return Notification{
+		// Дата окончания входит в ID: после продления гарантии окна напоминаний срабатывают заново
+		ID:        fmt.Sprintf("warranty_%s_%s_%d", warrantyMsg.ItemID, warrantyMsg.WarrantyExpiry.Format("20060102"), warrantyMsg.WindowDays),
+		UserID:    "all",
+		Type:      notificationType,
+		Message:   message,
+		RelatedTo: fmt.Sprintf("item-%s", warrantyMsg.ItemID),
+		IsRead:    false,
+		CreatedAt: time.Now(),
+	}
+}
+
 // Закрытие подключения к RabbitMQ
 func closeRabbitMQ() {
 	if rabbitChannel != nil {
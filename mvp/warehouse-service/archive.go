@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Тип транзакции списания оборудования
+const TransactionTypeWriteOff = "write_off"
+
+// Запрос на архивацию оборудования
+type ArchiveRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Запрос на списание оборудования
+type DecommissionRequest struct {
+	Reason   string  `json:"reason" binding:"required"`
+	Quantity float64 `json:"quantity"` // По умолчанию списывается весь остаток
+	Unit     string  `json:"unit"`     // По умолчанию базовая единица оборудования
+	// Партия списания; по умолчанию списываются партии по FEFO, начиная с просроченных
+	LotNumber string `json:"lot_number"`
+	Notes     string `json:"notes"`
+}
+
+// Фильтр архивного оборудования для списков:
+// по умолчанию архив скрыт, archived=true - только архив, include_archived=true - все
+func applyArchivedFilter(c *gin.Context, filter bson.M) error {
+	switch c.Query("archived") {
+	case "":
+	case "true":
+		filter["archived"] = true
+		return nil
+	case "false":
+		filter["archived"] = bson.M{"$ne": true}
+		return nil
+	default:
+		return &requestError{http.StatusBadRequest, "Invalid archived parameter"}
+	}
+
+	if c.Query("include_archived") != "true" {
+		filter["archived"] = bson.M{"$ne": true}
+	}
+	return nil
+}
+
+// Проверка, что оборудование не находится у сотрудников
+func checkNoOpenCheckouts(ctx context.Context, itemID primitive.ObjectID) error {
+	count, err := checkoutCollection.CountDocuments(ctx, bson.M{
+		"item_id": itemID,
+		"status":  bson.M{"$in": activeCheckoutStatuses},
+	})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return &requestError{http.StatusConflict, "Item has open checkouts and must be returned first"}
+	}
+	return nil
+}
+
+// Разбор ID оборудования и заголовка If-Match для операций архива
+func parseItemVersionRequest(c *gin.Context) (primitive.ObjectID, int64, bool) {
+	itemID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID format"})
+		return primitive.NilObjectID, 0, false
+	}
+
+	version, err := parseIfMatch(c)
+	if err != nil {
+		respondError(c, err, "")
+		return primitive.NilObjectID, 0, false
+	}
+	return itemID, version, true
+}
+
+// Архивация оборудования: скрывает его из списков и запрещает новые транзакции.
+// История транзакций и изменений остается доступной.
+func archiveItem(c *gin.Context) {
+	itemID, version, ok := parseItemVersionRequest(c)
+	if !ok {
+		return
+	}
+
+	var req ArchiveRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var item WarehouseItem
+	before, ok := loadForUpdate(c, ctx, warehouseCollection, itemID, version, "Item not found", &item)
+	if !ok {
+		return
+	}
+	if item.Archived {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item is already archived"})
+		return
+	}
+
+	// Нельзя архивировать оборудование, которое находится у сотрудников
+	if err := checkNoOpenCheckouts(ctx, itemID); err != nil {
+		respondError(c, err, "Failed to check checkouts: ")
+		return
+	}
+
+	update := bson.M{"$set": bson.M{
+		"archived":    true,
+		"archived_at": time.Now(),
+	}}
+	if reason := strings.TrimSpace(req.Reason); reason != "" {
+		update["$set"].(bson.M)["archive_reason"] = reason
+	}
+
+	var updated WarehouseItem
+	_, err := applyRevisionedUpdate(ctx, warehouseCollection, versionFilter(itemID, item.Version), update, Revision{
+		ResourceType: RevisionResourceItem,
+		ResourceID:   itemID,
+		Action:       RevisionActionArchive,
+		ChangedBy:    requestUser(c),
+	}, before, &updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			respondVersionConflict(c, ctx, warehouseCollection, itemID, "Item not found")
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to archive item: " + err.Error()})
+		}
+		return
+	}
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, gin.H{"message": "Item archived successfully", "item": updated})
+}
+
+// Возврат оборудования из архива
+func unarchiveItem(c *gin.Context) {
+	itemID, version, ok := parseItemVersionRequest(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var item WarehouseItem
+	before, ok := loadForUpdate(c, ctx, warehouseCollection, itemID, version, "Item not found", &item)
+	if !ok {
+		return
+	}
+	if !item.Archived {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item is not archived"})
+		return
+	}
+	// Списанное оборудование вернуть нельзя - для него нужна новая карточка
+	if item.Decommission != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Decommissioned item cannot be unarchived"})
+		return
+	}
+
+	update := bson.M{"$unset": bson.M{
+		"archived":       "",
+		"archived_at":    "",
+		"archive_reason": "",
+	}}
+
+	var updated WarehouseItem
+	_, err := applyRevisionedUpdate(ctx, warehouseCollection, versionFilter(itemID, item.Version), update, Revision{
+		ResourceType: RevisionResourceItem,
+		ResourceID:   itemID,
+		Action:       RevisionActionUnarchive,
+		ChangedBy:    requestUser(c),
+	}, before, &updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			respondVersionConflict(c, ctx, warehouseCollection, itemID, "Item not found")
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unarchive item: " + err.Error()})
+		}
+		return
+	}
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, gin.H{"message": "Item unarchived successfully", "item": updated})
+}
+
+// Списание оборудования с указанием причины.
+// Создает транзакцию списания; при списании всего остатка оборудование уходит в архив.
+func decommissionItem(c *gin.Context) {
+	itemID, version, ok := parseItemVersionRequest(c)
+	if !ok {
+		return
+	}
+
+	var req DecommissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Decommission reason is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var item WarehouseItem
+	if _, ok := loadForUpdate(c, ctx, warehouseCollection, itemID, version, "Item not found", &item); !ok {
+		return
+	}
+	if item.Archived {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item is archived"})
+		return
+	}
+
+	quantity := item.Quantity
+	if req.Quantity != 0 {
+		units, err := loadUnits(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load units: " + err.Error()})
+			return
+		}
+		if quantity, err = units.toBase(item, req.Quantity, req.Unit); err != nil {
+			respondError(c, err, "")
+			return
+		}
+	}
+	if quantity <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to decommission: item quantity is zero"})
+		return
+	}
+	if quantity > item.Quantity {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient quantity available"})
+		return
+	}
+
+	// При полном списании оборудование не должно числиться за сотрудниками
+	newQuantity := roundQuantity(item.Quantity - quantity)
+	fullWriteOff := newQuantity == 0
+	if fullWriteOff {
+		if err := checkNoOpenCheckouts(ctx, itemID); err != nil {
+			respondError(c, err, "Failed to check checkouts: ")
+			return
+		}
+	}
+
+	user := requestUser(c)
+	now := time.Now()
+	transaction := InventoryTransaction{
+		ID:              primitive.NewObjectID(),
+		ItemID:          itemID,
+		TransactionType: TransactionTypeWriteOff,
+		Quantity:        quantity,
+		ResponsibleUser: user,
+		Reason:          req.Reason,
+		Notes:           req.Notes,
+		Date:            now,
+	}
+	if req.Quantity != 0 && req.Unit != "" && req.Unit != itemUnit(item) {
+		transaction.Unit = req.Unit
+		transaction.UnitQuantity = req.Quantity
+	}
+	lots, err := prepareLotMovement(ctx, item, TransactionTypeWriteOff, req.LotNumber, nil, quantity)
+	if err != nil {
+		respondError(c, err, "Failed to process lots: ")
+		return
+	}
+	if lots != nil {
+		transaction.Lots = lots.Allocations
+	}
+
+	updatedItem := item
+	updatedItem.Quantity = newQuantity
+	updatedItem.Status = itemStockStatus(newQuantity, item.MinQuantity)
+	updatedItem.Version = item.Version + 1
+	updatedItem.UpdatedAt = now
+	set := bson.M{
+		"quantity":   updatedItem.Quantity,
+		"status":     updatedItem.Status,
+		"updated_at": now,
+	}
+	if fullWriteOff {
+		updatedItem.Archived = true
+		updatedItem.ArchivedAt = now
+		updatedItem.ArchiveReason = req.Reason
+		updatedItem.Decommission = &Decommission{
+			Reason:           req.Reason,
+			Quantity:         quantity,
+			TransactionID:    transaction.ID,
+			DecommissionedBy: user,
+			DecommissionedAt: now,
+		}
+		set["archived"] = true
+		set["archived_at"] = now
+		set["archive_reason"] = req.Reason
+		set["decommission"] = updatedItem.Decommission
+	}
+
+	session, err := mongoClient.StartSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session: " + err.Error()})
+		return
+	}
+	defer session.EndSession(ctx)
+
+	// Транзакция списания и изменение остатка сохраняются атомарно
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if err := postTransactionCost(sessCtx, item, &transaction); err != nil {
+			return nil, err
+		}
+		if _, err := transactionCollection.InsertOne(sessCtx, transaction); err != nil {
+			return nil, err
+		}
+
+		result, err := warehouseCollection.UpdateOne(sessCtx, versionFilter(itemID, item.Version), bson.M{
+			"$set": set,
+			"$inc": bson.M{"version": 1},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, &requestError{http.StatusPreconditionFailed, "Item was modified by another request"}
+		}
+		if err := lots.apply(sessCtx); err != nil {
+			return nil, err
+		}
+
+		return nil, recordRevision(sessCtx, Revision{
+			ResourceType: RevisionResourceItem,
+			ResourceID:   itemID,
+			Action:       RevisionActionDecommission,
+			ChangedBy:    user,
+		}, item, updatedItem)
+	})
+	if err != nil {
+		respondError(c, err, "Failed to decommission item: ")
+		return
+	}
+
+	setETag(c, updatedItem.Version)
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "Item decommissioned successfully",
+		"transaction": transaction,
+		"item":        updatedItem,
+	})
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Ограничения вложений
+const (
+	maxAttachmentSize        = 20 << 20 // 20 МБ
+	maxAttachmentsPerOwner   = 50
+	maxAttachmentImagePixels = 50 << 20 // Защита от изображений, распаковывающихся в гигабайты
+	attachmentThumbnailSize  = 256      // Наибольшая сторона миниатюры в пикселях
+	attachmentTimeout        = 60 * time.Second
+)
+
+// Допустимые типы содержимого; тип определяется по содержимому, а не по заголовку клиента
+var attachmentContentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":       true,
+}
+
+// Документы Office - ZIP-архивы, их тип уточняется по расширению
+var officeContentTypes = map[string]string{
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+var attachmentKinds = []string{
+	AttachmentKindPhoto,
+	AttachmentKindPassport,
+	AttachmentKindCertificate,
+	AttachmentKindManual,
+	AttachmentKindOther,
+}
+
+// Коллекция владельца вложений и сообщение, если владелец не найден
+func attachmentOwner(ownerType string) (*mongo.Collection, string) {
+	if ownerType == AttachmentOwnerInvoice {
+		return invoiceCollection, "Invoice not found"
+	}
+	return warehouseCollection, "Item not found"
+}
+
+// Проверка существования владельца вложений
+func checkAttachmentOwner(ctx context.Context, ownerType string, ownerID primitive.ObjectID) error {
+	collection, notFound := attachmentOwner(ownerType)
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": ownerID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return &requestError{http.StatusNotFound, notFound}
+	}
+	return nil
+}
+
+// Тип содержимого файла по первым байтам; ZIP принимается только как документ Office
+func detectAttachmentType(data []byte, fileName string) (string, error) {
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return "", err
+	}
+	if contentType == "application/zip" {
+		contentType = officeContentTypes[strings.ToLower(filepath.Ext(fileName))]
+	}
+	if !attachmentContentTypes[contentType] {
+		return "", &requestError{http.StatusUnsupportedMediaType, "Unsupported file type; allowed: JPEG, PNG, GIF, WebP, PDF, DOCX, XLSX"}
+	}
+	return contentType, nil
+}
+
+// Миниатюра изображения в JPEG: наибольшая сторона не больше attachmentThumbnailSize.
+// Прозрачные области заливаются белым.
+func makeThumbnail(data []byte) ([]byte, image.Config, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, config, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxAttachmentImagePixels {
+		return nil, config, fmt.Errorf("image is too large (%dx%d)", config.Width, config.Height)
+	}
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, config, err
+	}
+
+	width, height := config.Width, config.Height
+	if width > attachmentThumbnailSize || height > attachmentThumbnailSize {
+		if width >= height {
+			width, height = attachmentThumbnailSize, max(1, height*attachmentThumbnailSize/config.Width)
+		} else {
+			width, height = max(1, width*attachmentThumbnailSize/config.Height), attachmentThumbnailSize
+		}
+	}
+	thumbnail := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(thumbnail, thumbnail.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), source, source.Bounds(), draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, config, err
+	}
+	return buf.Bytes(), config, nil
+}
+
+// Заполнение вычисляемых полей вложения
+func fillAttachment(attachment *Attachment) {
+	attachment.HasThumbnail = attachment.ThumbnailKey != ""
+}
+
+// Загрузка вложения (multipart: file, kind, description)
+func uploadAttachment(ownerType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ownerID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + ownerType + " ID format"})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAttachmentSize+1<<20)
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large (max 20 MB)"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File is required (multipart field 'file')"})
+			return
+		}
+		if fileHeader.Size > maxAttachmentSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large (max 20 MB)"})
+			return
+		}
+		if fileHeader.Size == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File is empty"})
+			return
+		}
+
+		kind := c.DefaultPostForm("kind", AttachmentKindOther)
+		if !containsString(attachmentKinds, kind) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be one of: " + strings.Join(attachmentKinds, ", ")})
+			return
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file: " + err.Error()})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(file, maxAttachmentSize+1))
+		file.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file: " + err.Error()})
+			return
+		}
+
+		fileName := filepath.Base(strings.ReplaceAll(fileHeader.Filename, "\\", "/"))
+		if fileName == "." || fileName == "/" {
+			fileName = "file"
+		}
+		contentType, err := detectAttachmentType(data, fileName)
+		if err != nil {
+			respondError(c, err, "Failed to detect file type: ")
+			return
+		}
+		isImage := strings.HasPrefix(contentType, "image/")
+		if kind == AttachmentKindPhoto && !isImage {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Photo must be a JPEG, PNG, GIF or WebP image"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), attachmentTimeout)
+		defer cancel()
+
+		if err := checkAttachmentOwner(ctx, ownerType, ownerID); err != nil {
+			respondError(c, err, "Failed to check owner: ")
+			return
+		}
+		count, err := attachmentCollection.CountDocuments(ctx, bson.M{"owner_type": ownerType, "owner_id": ownerID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count attachments: " + err.Error()})
+			return
+		}
+		if count >= maxAttachmentsPerOwner {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("At most %d attachments are allowed", maxAttachmentsPerOwner)})
+			return
+		}
+
+		sum := sha256.Sum256(data)
+		attachment := Attachment{
+			ID:          primitive.NewObjectID(),
+			OwnerType:   ownerType,
+			OwnerID:     ownerID,
+			Kind:        kind,
+			FileName:    fileName,
+			ContentType: contentType,
+			Size:        int64(len(data)),
+			SHA256:      hex.EncodeToString(sum[:]),
+			Description: strings.TrimSpace(c.PostForm("description")),
+			UploadedBy:  requestUser(c),
+			CreatedAt:   time.Now(),
+		}
+		attachment.StorageKey = fmt.Sprintf("%ss/%s/%s", ownerType, ownerID.Hex(), attachment.ID.Hex())
+
+		// Изображение, которое не удается декодировать, считается поврежденным
+		var thumbnail []byte
+		if isImage {
+			var config image.Config
+			thumbnail, config, err = makeThumbnail(data)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Image cannot be processed: " + err.Error()})
+				return
+			}
+			attachment.Width, attachment.Height = config.Width, config.Height
+			attachment.ThumbnailKey = attachment.StorageKey + "-thumb.jpg"
+		}
+
+		// Сначала сохраняется содержимое: запись без файла хуже, чем файл без записи
+		if err := attachmentStore.Put(ctx, attachment.StorageKey, bytes.NewReader(data), attachment.Size, contentType); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file: " + err.Error()})
+			return
+		}
+		if thumbnail != nil {
+			if err := attachmentStore.Put(ctx, attachment.ThumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), "image/jpeg"); err != nil {
+				removeAttachmentBlobs(attachment)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store thumbnail: " + err.Error()})
+				return
+			}
+		}
+		if _, err := attachmentCollection.InsertOne(ctx, attachment); err != nil {
+			removeAttachmentBlobs(attachment)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment: " + err.Error()})
+			return
+		}
+
+		fillAttachment(&attachment)
+		c.JSON(http.StatusCreated, attachment)
+	}
+}
+
+// Список вложений владельца
+func listAttachments(ownerType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ownerID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + ownerType + " ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		filter := bson.M{"owner_type": ownerType, "owner_id": ownerID}
+		if kind := c.Query("kind"); kind != "" {
+			filter["kind"] = kind
+		}
+		attachments, err := loadAll[Attachment](ctx, attachmentCollection, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachments: " + err.Error()})
+			return
+		}
+		for i := range attachments {
+			fillAttachment(&attachments[i])
+		}
+
+		c.JSON(http.StatusOK, attachments)
+	}
+}
+
+// Загрузка метаданных вложения по ID из пути
+func loadAttachment(c *gin.Context, ctx context.Context) (Attachment, bool) {
+	var attachment Attachment
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID format"})
+		return attachment, false
+	}
+	if err := attachmentCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&attachment); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachment: " + err.Error()})
+		}
+		return attachment, false
+	}
+	fillAttachment(&attachment)
+	return attachment, true
+}
+
+// Метаданные вложения
+func getAttachment(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	attachment, ok := loadAttachment(c, ctx)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, attachment)
+}
+
+// Отправка содержимого из хранилища
+func streamBlob(c *gin.Context, ctx context.Context, key string, size int64, contentType string, headers map[string]string) {
+	reader, err := attachmentStore.Get(ctx, key)
+	if err != nil {
+		if err == errBlobNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment content not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read attachment: " + err.Error()})
+		}
+		return
+	}
+	defer reader.Close()
+
+	// Тип проверен при загрузке; браузер не должен угадывать его заново
+	headers["X-Content-Type-Options"] = "nosniff"
+	headers["Cache-Control"] = "private, max-age=3600"
+	c.DataFromReader(http.StatusOK, size, contentType, reader, headers)
+}
+
+// Скачивание вложения; inline=true открывает изображения и PDF в браузере
+func downloadAttachment(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), attachmentTimeout)
+	defer cancel()
+
+	attachment, ok := loadAttachment(c, ctx)
+	if !ok {
+		return
+	}
+
+	disposition := "attachment"
+	if c.Query("inline") == "true" && (strings.HasPrefix(attachment.ContentType, "image/") || attachment.ContentType == "application/pdf") {
+		disposition = "inline"
+	}
+	headers := map[string]string{
+		"Content-Disposition": mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}),
+		"ETag":                `"` + attachment.SHA256 + `"`,
+	}
+	streamBlob(c, ctx, attachment.StorageKey, attachment.Size, attachment.ContentType, headers)
+}
+
+// Миниатюра изображения (JPEG)
+func downloadAttachmentThumbnail(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	attachment, ok := loadAttachment(c, ctx)
+	if !ok {
+		return
+	}
+	if attachment.ThumbnailKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment has no thumbnail"})
+		return
+	}
+	streamBlob(c, ctx, attachment.ThumbnailKey, -1, "image/jpeg", map[string]string{})
+}
+
+// Удаление содержимого вложения из хранилища; ошибки только записываются в журнал
+func removeAttachmentBlobs(attachment Attachment) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := attachmentStore.Delete(ctx, key); err != nil {
+			log.Printf("Warning: failed to delete attachment blob %s: %v", key, err)
+		}
+	}
+}
+
+// Удаление вложения
+func deleteAttachment(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	attachment, ok := loadAttachment(c, ctx)
+	if !ok {
+		return
+	}
+	result, err := attachmentCollection.DeleteOne(ctx, bson.M{"_id": attachment.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment: " + err.Error()})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	removeAttachmentBlobs(attachment)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
+
+// Удаление всех вложений владельца (при удалении оборудования)
+func deleteOwnerAttachments(ctx context.Context, ownerType string, ownerID primitive.ObjectID) error {
+	filter := bson.M{"owner_type": ownerType, "owner_id": ownerID}
+	attachments, err := loadAll[Attachment](ctx, attachmentCollection, filter)
+	if err != nil {
+		return err
+	}
+	if _, err := attachmentCollection.DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		removeAttachmentBlobs(attachment)
+	}
+	return nil
+}
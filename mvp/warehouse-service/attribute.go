@@ -0,0 +1,726 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Ограничения схемы и значений атрибутов
+const (
+	maxCategoryAttributes = 100
+	maxAttributeValues    = 200
+	maxAttributeText      = 1000
+	maxAttributeErrors    = 5 // Сколько несовместимых единиц оборудования перечислить в ошибке
+)
+
+// Код атрибута используется в пути поля MongoDB и в параметрах поиска attr.<код>
+var attributeCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Параметры поиска: attr.<код>, attr.<код>.min, attr.<код>.max
+const attributeQueryPrefix = "attr."
+
+// attributeSchema - действующая схема атрибутов категории с учетом родительских категорий
+type attributeSchema map[string]CategoryAttribute
+
+// Проверка и нормализация схемы атрибутов категории
+func validateAttributeDefinitions(attributes []CategoryAttribute) ([]CategoryAttribute, error) {
+	if len(attributes) > maxCategoryAttributes {
+		return nil, &requestError{http.StatusBadRequest, fmt.Sprintf("Category can have at most %d attributes", maxCategoryAttributes)}
+	}
+
+	seen := map[string]bool{}
+	result := make([]CategoryAttribute, 0, len(attributes))
+	for _, attr := range attributes {
+		attr.Code = strings.TrimSpace(attr.Code)
+		attr.Name = strings.TrimSpace(attr.Name)
+		attr.Unit = strings.TrimSpace(attr.Unit)
+		attr.Type = strings.ToLower(strings.TrimSpace(attr.Type))
+
+		if !attributeCodePattern.MatchString(attr.Code) {
+			return nil, &requestError{http.StatusBadRequest, "Attribute code '" + attr.Code + "' must start with a letter and contain only lowercase letters, digits and underscores"}
+		}
+		if seen[attr.Code] {
+			return nil, &requestError{http.StatusBadRequest, "Duplicate attribute code '" + attr.Code + "'"}
+		}
+		seen[attr.Code] = true
+		if attr.Name == "" {
+			return nil, &requestError{http.StatusBadRequest, "Attribute '" + attr.Code + "' must have a name"}
+		}
+
+		switch attr.Type {
+		case AttributeTypeString, AttributeTypeBoolean, AttributeTypeDate:
+			if attr.Min != nil || attr.Max != nil {
+				return nil, &requestError{http.StatusBadRequest, "Attribute '" + attr.Code + "': min and max are allowed only for number and integer attributes"}
+			}
+		case AttributeTypeNumber, AttributeTypeInteger:
+			if attr.Min != nil && attr.Max != nil && *attr.Min > *attr.Max {
+				return nil, &requestError{http.StatusBadRequest, "Attribute '" + attr.Code + "': min must not exceed max"}
+			}
+		case AttributeTypeEnum:
+			if attr.Min != nil || attr.Max != nil {
+				return nil, &requestError{http.StatusBadRequest, "Attribute '" + attr.Code + "': min and max are allowed only for number and integer attributes"}
+			}
+			values, err := normalizeEnumValues(attr)
+			if err != nil {
+				return nil, err
+			}
+			attr.Values = values
+		default:
+			return nil, &requestError{http.StatusBadRequest, "Attribute '" + attr.Code + "' has unsupported type '" + attr.Type + "' (expected string, number, integer, boolean, date or enum)"}
+		}
+		if attr.Type != AttributeTypeEnum && len(attr.Values) > 0 {
+			return nil, &requestError{http.StatusBadRequest, "Attribute '" + attr.Code + "': allowed values are supported only for enum attributes"}
+		}
+
+		result = append(result, attr)
+	}
+	return result, nil
+}
+
+// Допустимые значения перечисления: непустые и без повторов
+func normalizeEnumValues(attr CategoryAttribute) ([]string, error) {
+	if len(attr.Values) == 0 {
+		return nil, &requestError{http.StatusBadRequest, "Enum attribute '" + attr.Code + "' must list allowed values"}
+	}
+	if len(attr.Values) > maxAttributeValues {
+		return nil, &requestError{http.StatusBadRequest, fmt.Sprintf("Enum attribute '%s' can have at most %d values", attr.Code, maxAttributeValues)}
+	}
+	seen := map[string]bool{}
+	values := make([]string, 0, len(attr.Values))
+	for _, value := range attr.Values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, &requestError{http.StatusBadRequest, "Enum attribute '" + attr.Code + "' has an empty value"}
+		}
+		if seen[value] {
+			return nil, &requestError{http.StatusBadRequest, "Enum attribute '" + attr.Code + "' has duplicate value '" + value + "'"}
+		}
+		seen[value] = true
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Схема атрибутов из значения обновления: []CategoryAttribute из merge patch
+// или массив документов из снимка ревизии при восстановлении
+func decodeAttributeDefinitions(value interface{}) ([]CategoryAttribute, error) {
+	if attributes, ok := value.([]CategoryAttribute); ok {
+		return attributes, nil
+	}
+	raw, err := bson.Marshal(bson.M{"attributes": value})
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Attributes []CategoryAttribute `bson:"attributes"`
+	}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, &requestError{http.StatusBadRequest, "Field 'attributes' must be an array of attribute definitions"}
+	}
+	return doc.Attributes, nil
+}
+
+// Действующая схема категории: атрибуты категории и всех ее предков.
+// Ближайшая к категории схема переопределяет атрибут с тем же кодом.
+func effectiveAttributeSchema(categories map[string]Category, code string) attributeSchema {
+	schema := attributeSchema{}
+	current := code
+	for depth := 0; current != "" && depth < maxCategoryDepth; depth++ {
+		category, ok := categories[current]
+		if !ok {
+			break
+		}
+		for _, attr := range category.Attributes {
+			if _, exists := schema[attr.Code]; !exists {
+				schema[attr.Code] = attr
+			}
+		}
+		current = ""
+		if category.ParentCategory != nil {
+			current = *category.ParentCategory
+		}
+	}
+	return schema
+}
+
+// Все категории по коду (для расчета наследуемых схем)
+func loadCategoriesByCode(ctx context.Context) (map[string]Category, error) {
+	categories, err := loadAll[Category](ctx, categoryCollection, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]Category, len(categories))
+	for _, category := range categories {
+		result[category.Code] = category
+	}
+	return result, nil
+}
+
+// Действующая схема атрибутов категории по ее коду
+func categoryAttributeSchema(ctx context.Context, code string) (attributeSchema, error) {
+	categories := map[string]Category{}
+	current := code
+	for depth := 0; current != "" && depth < maxCategoryDepth; depth++ {
+		var category Category
+		err := categoryCollection.FindOne(ctx, bson.M{"code": current}).Decode(&category)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				break
+			}
+			return nil, err
+		}
+		categories[category.Code] = category
+		current = ""
+		if category.ParentCategory != nil {
+			current = *category.ParentCategory
+		}
+	}
+	return effectiveAttributeSchema(categories, code), nil
+}
+
+// Проверка значений атрибутов оборудования по схеме категории.
+// Пустая строка означает отсутствие значения. Без requireAll обязательность не проверяется.
+func validateItemAttributes(schema attributeSchema, values map[string]interface{}, requireAll bool) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	for code, value := range values {
+		attr, ok := schema[code]
+		if !ok {
+			return nil, &requestError{http.StatusBadRequest, "Attribute '" + code + "' is not defined for the item category"}
+		}
+		if text, isString := value.(string); isString && strings.TrimSpace(text) == "" {
+			continue
+		}
+		normalized, err := normalizeAttributeValue(attr, value)
+		if err != nil {
+			return nil, err
+		}
+		result[code] = normalized
+	}
+
+	if requireAll {
+		missing := []string{}
+		for code, attr := range schema {
+			if _, ok := result[code]; attr.Required && !ok {
+				missing = append(missing, code)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return nil, &requestError{http.StatusBadRequest, "Required attributes are missing: " + strings.Join(missing, ", ")}
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// Приведение значения атрибута к типу, сохраняемому в MongoDB.
+// Принимает значения из JSON (json.Number, float64) и из BSON (int32, int64, DateTime).
+func normalizeAttributeValue(attr CategoryAttribute, value interface{}) (interface{}, error) {
+	invalid := func(expected string) error {
+		return &requestError{http.StatusBadRequest, fmt.Sprintf("Attribute '%s' must be %s", attr.Code, expected)}
+	}
+
+	switch attr.Type {
+	case AttributeTypeString, AttributeTypeEnum:
+		text, ok := value.(string)
+		if !ok {
+			return nil, invalid("a string")
+		}
+		text = strings.TrimSpace(text)
+		if utf8.RuneCountInString(text) > maxAttributeText {
+			return nil, invalid(fmt.Sprintf("at most %d characters long", maxAttributeText))
+		}
+		if attr.Type == AttributeTypeEnum {
+			for _, allowed := range attr.Values {
+				if text == allowed {
+					return text, nil
+				}
+			}
+			return nil, invalid("one of: " + strings.Join(attr.Values, ", "))
+		}
+		return text, nil
+
+	case AttributeTypeNumber, AttributeTypeInteger:
+		number, ok := attributeNumber(value)
+		if !ok {
+			return nil, invalid("a number")
+		}
+		if attr.Min != nil && number < *attr.Min {
+			return nil, invalid(fmt.Sprintf("at least %s", strconv.FormatFloat(*attr.Min, 'f', -1, 64)))
+		}
+		if attr.Max != nil && number > *attr.Max {
+			return nil, invalid(fmt.Sprintf("at most %s", strconv.FormatFloat(*attr.Max, 'f', -1, 64)))
+		}
+		if attr.Type == AttributeTypeInteger {
+			if number != math.Trunc(number) || math.Abs(number) > 1<<53 {
+				return nil, invalid("an integer")
+			}
+			return int64(number), nil
+		}
+		return number, nil
+
+	case AttributeTypeBoolean:
+		flag, ok := value.(bool)
+		if !ok {
+			return nil, invalid("a boolean")
+		}
+		return flag, nil
+
+	case AttributeTypeDate:
+		var date time.Time
+		switch typed := value.(type) {
+		case string:
+			parsed, err := parseDateParam(strings.TrimSpace(typed))
+			if err != nil {
+				return nil, invalid("a date (YYYY-MM-DD)")
+			}
+			date = parsed
+		case time.Time:
+			date = typed
+		case primitive.DateTime:
+			date = typed.Time().UTC()
+		default:
+			return nil, invalid("a date (YYYY-MM-DD)")
+		}
+		return date.Format("2006-01-02"), nil
+	}
+
+	return nil, invalid("a supported value")
+}
+
+// Числовое значение атрибута из JSON или BSON
+func attributeNumber(value interface{}) (float64, bool) {
+	var number float64
+	switch typed := value.(type) {
+	case json.Number:
+		parsed, err := typed.Float64()
+		if err != nil {
+			return 0, false
+		}
+		number = parsed
+	case float64:
+		number = typed
+	case int:
+		number = float64(typed)
+	case int32:
+		number = float64(typed)
+	case int64:
+		number = float64(typed)
+	default:
+		return 0, false
+	}
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, false
+	}
+	return number, true
+}
+
+// Значения атрибутов из документа обновления (снимок ревизии хранит их как BSON-документ)
+func attributeValues(value interface{}) (map[string]interface{}, error) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		return typed, nil
+	case bson.M:
+		return typed, nil
+	case bson.D:
+		return typed.Map(), nil
+	}
+	return nil, &requestError{http.StatusBadRequest, "Field 'attributes' must be an object"}
+}
+
+// Проверка атрибутов нового оборудования по схеме его категории
+func validateNewItemAttributes(ctx context.Context, item *WarehouseItem) error {
+	schema, err := categoryAttributeSchema(ctx, item.Category)
+	if err != nil {
+		return err
+	}
+	attributes, err := validateItemAttributes(schema, item.Attributes, true)
+	if err != nil {
+		return err
+	}
+	item.Attributes = attributes
+	return nil
+}
+
+// Проверка изменения атрибутов или категории оборудования.
+// Изменения отдельных атрибутов (attributes.<код>) объединяются с текущими значениями,
+// и в обновление записывается итоговый проверенный объект attributes.
+func validateItemAttributeUpdate(ctx context.Context, item WarehouseItem, update bson.M) error {
+	set, _ := update["$set"].(bson.M)
+	unset, _ := update["$unset"].(bson.M)
+
+	values := map[string]interface{}{}
+	for code, value := range item.Attributes {
+		values[code] = value
+	}
+
+	changed := false
+	if value, ok := set["attributes"]; ok {
+		replaced, err := attributeValues(value)
+		if err != nil {
+			return err
+		}
+		values = map[string]interface{}{}
+		for code, value := range replaced {
+			values[code] = value
+		}
+		delete(set, "attributes")
+		changed = true
+	}
+	if _, ok := unset["attributes"]; ok {
+		values = map[string]interface{}{}
+		delete(unset, "attributes")
+		changed = true
+	}
+	for path, value := range set {
+		if code, ok := strings.CutPrefix(path, "attributes."); ok {
+			values[code] = value
+			delete(set, path)
+			changed = true
+		}
+	}
+	for path := range unset {
+		if code, ok := strings.CutPrefix(path, "attributes."); ok {
+			delete(values, code)
+			delete(unset, path)
+			changed = true
+		}
+	}
+
+	// При смене категории текущие значения проверяются по схеме новой категории
+	category := item.Category
+	if value, ok := set["category"].(string); ok && value != item.Category {
+		category = value
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	schema, err := categoryAttributeSchema(ctx, category)
+	if err != nil {
+		return err
+	}
+	attributes, err := validateItemAttributes(schema, values, true)
+	if err != nil {
+		return err
+	}
+
+	if len(attributes) > 0 {
+		if set == nil {
+			set = bson.M{}
+			update["$set"] = set
+		}
+		set["attributes"] = attributes
+	} else {
+		if unset == nil {
+			unset = bson.M{}
+			update["$unset"] = unset
+		}
+		unset["attributes"] = ""
+	}
+	if len(set) == 0 {
+		delete(update, "$set")
+	}
+	return nil
+}
+
+// Проверка изменения схемы атрибутов категории из merge patch или восстанавливаемой ревизии
+func normalizeCategoryAttributeUpdate(update bson.M) (bool, error) {
+	set, _ := update["$set"].(bson.M)
+	unset, _ := update["$unset"].(bson.M)
+	if _, ok := unset["attributes"]; ok {
+		return true, nil
+	}
+	value, ok := set["attributes"]
+	if !ok {
+		return false, nil
+	}
+
+	attributes, err := decodeAttributeDefinitions(value)
+	if err != nil {
+		return false, err
+	}
+	attributes, err = validateAttributeDefinitions(attributes)
+	if err != nil {
+		return false, err
+	}
+	if len(attributes) == 0 {
+		delete(set, "attributes")
+		if unset == nil {
+			unset = bson.M{}
+			update["$unset"] = unset
+		}
+		unset["attributes"] = ""
+		return true, nil
+	}
+	set["attributes"] = attributes
+	return true, nil
+}
+
+// Проверка, что значения атрибутов оборудования категории и ее подкатегорий
+// остаются допустимыми после изменения схемы или родителя категории.
+// Отсутствие обязательных значений не проверяется: оно исправляется при следующем изменении оборудования.
+func checkCategoryItemAttributes(ctx context.Context, current Category, update bson.M) error {
+	set, _ := update["$set"].(bson.M)
+	unset, _ := update["$unset"].(bson.M)
+
+	proposed := current
+	if attributes, ok := set["attributes"].([]CategoryAttribute); ok {
+		proposed.Attributes = attributes
+	}
+	if _, ok := unset["attributes"]; ok {
+		proposed.Attributes = nil
+	}
+	if parent, ok := set["parent_category"].(string); ok {
+		proposed.ParentCategory = &parent
+	}
+	if _, ok := unset["parent_category"]; ok {
+		proposed.ParentCategory = nil
+	}
+
+	categories, err := loadCategoriesByCode(ctx)
+	if err != nil {
+		return err
+	}
+	categories[current.Code] = proposed
+
+	subtree, err := categoryWithDescendants(ctx, current.Code)
+	if err != nil {
+		return err
+	}
+	schemas := map[string]attributeSchema{}
+	for _, code := range subtree {
+		schemas[code] = effectiveAttributeSchema(categories, code)
+	}
+
+	cursor, err := warehouseCollection.Find(ctx, bson.M{
+		"category":   bson.M{"$in": subtree},
+		"attributes": bson.M{"$exists": true},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	invalid := 0
+	examples := []string{}
+	for cursor.Next(ctx) {
+		var item WarehouseItem
+		if err := cursor.Decode(&item); err != nil {
+			return err
+		}
+		if _, err := validateItemAttributes(schemas[item.Category], item.Attributes, false); err != nil {
+			invalid++
+			if len(examples) < maxAttributeErrors {
+				examples = append(examples, item.SerialNumber+": "+err.Error())
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	if invalid > 0 {
+		return &requestError{http.StatusConflict, fmt.Sprintf("%d item(s) have attribute values incompatible with the new schema: %s",
+			invalid, strings.Join(examples, "; "))}
+	}
+	return nil
+}
+
+// Добавление фильтров по атрибутам (attr.<код>, attr.<код>.min, attr.<код>.max) в фильтр поиска.
+// Тип атрибута определяется по схемам категорий из фильтра (или всех категорий).
+func addAttributeFilters(c *gin.Context, ctx context.Context, filter bson.M) error {
+	type attributeQuery struct {
+		exact    string
+		min, max string
+	}
+	queries := map[string]*attributeQuery{}
+	for key, values := range c.Request.URL.Query() {
+		rest, ok := strings.CutPrefix(key, attributeQueryPrefix)
+		if !ok || len(values) == 0 || values[0] == "" {
+			continue
+		}
+		code, bound := rest, ""
+		if base, found := strings.CutSuffix(rest, ".min"); found {
+			code, bound = base, "min"
+		} else if base, found := strings.CutSuffix(rest, ".max"); found {
+			code, bound = base, "max"
+		}
+		if !attributeCodePattern.MatchString(code) {
+			return &requestError{http.StatusBadRequest, "Invalid attribute filter: " + key}
+		}
+
+		query := queries[code]
+		if query == nil {
+			query = &attributeQuery{}
+			queries[code] = query
+		}
+		switch bound {
+		case "min":
+			query.min = values[0]
+		case "max":
+			query.max = values[0]
+		default:
+			query.exact = values[0]
+		}
+	}
+	if len(queries) == 0 {
+		return nil
+	}
+
+	categories, err := loadCategoriesByCode(ctx)
+	if err != nil {
+		return err
+	}
+	codes := filterCategoryCodes(categories, filter)
+
+	for code, query := range queries {
+		attr, err := searchAttributeDefinition(categories, codes, code)
+		if err != nil {
+			return err
+		}
+		if query.exact != "" && (query.min != "" || query.max != "") {
+			return &requestError{http.StatusBadRequest, "Attribute '" + code + "' filter cannot combine an exact value with a range"}
+		}
+
+		field := "attributes." + code
+		if query.exact != "" {
+			condition, err := attributeExactFilter(attr, query.exact)
+			if err != nil {
+				return err
+			}
+			filter[field] = condition
+			continue
+		}
+
+		if attr.Type != AttributeTypeNumber && attr.Type != AttributeTypeInteger && attr.Type != AttributeTypeDate {
+			return &requestError{http.StatusBadRequest, "Attribute '" + code + "' does not support range filters"}
+		}
+		rangeFilter := bson.M{}
+		for operator, raw := range map[string]string{"$gte": query.min, "$lte": query.max} {
+			if raw == "" {
+				continue
+			}
+			value, err := parseAttributeQueryValue(attr, raw)
+			if err != nil {
+				return err
+			}
+			rangeFilter[operator] = value
+		}
+		filter[field] = rangeFilter
+	}
+	return nil
+}
+
+// Категории из фильтра поиска; без фильтра по категории - все активные категории
+func filterCategoryCodes(categories map[string]Category, filter bson.M) []string {
+	switch value := filter["category"].(type) {
+	case string:
+		return []string{value}
+	case bson.M:
+		codes, _ := value["$in"].([]string)
+		return codes
+	}
+	codes := []string{}
+	for code, category := range categories {
+		if category.IsActive {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// Атрибуты выбранных категорий в порядке кодов; при совпадении кодов берется первое определение
+func categoryAttributeList(categories map[string]Category, codes []string) []CategoryAttribute {
+	seen := map[string]bool{}
+	result := []CategoryAttribute{}
+	for _, categoryCode := range codes {
+		for code, attr := range effectiveAttributeSchema(categories, categoryCode) {
+			if !seen[code] {
+				seen[code] = true
+				result = append(result, attr)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Code < result[j].Code })
+	return result
+}
+
+// Определение атрибута для поиска; один код не может иметь разные типы в выбранных категориях
+func searchAttributeDefinition(categories map[string]Category, codes []string, code string) (CategoryAttribute, error) {
+	var found *CategoryAttribute
+	for _, categoryCode := range codes {
+		attr, ok := effectiveAttributeSchema(categories, categoryCode)[code]
+		if !ok {
+			continue
+		}
+		if found != nil && found.Type != attr.Type {
+			return CategoryAttribute{}, &requestError{http.StatusBadRequest,
+				"Attribute '" + code + "' has different types in the selected categories; narrow the search with the category parameter"}
+		}
+		found = &attr
+	}
+	if found == nil {
+		return CategoryAttribute{}, &requestError{http.StatusBadRequest, "Attribute '" + code + "' is not defined for the selected categories"}
+	}
+	return *found, nil
+}
+
+// Условие точного совпадения; для строк и перечислений несколько значений передаются через запятую
+func attributeExactFilter(attr CategoryAttribute, raw string) (interface{}, error) {
+	if attr.Type == AttributeTypeString || attr.Type == AttributeTypeEnum {
+		values := strings.Split(raw, ",")
+		if len(values) == 1 {
+			return strings.TrimSpace(values[0]), nil
+		}
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		return bson.M{"$in": values}, nil
+	}
+	return parseAttributeQueryValue(attr, raw)
+}
+
+// Разбор значения параметра поиска по типу атрибута
+func parseAttributeQueryValue(attr CategoryAttribute, raw string) (interface{}, error) {
+	invalid := &requestError{http.StatusBadRequest, "Invalid value for attribute '" + attr.Code + "' filter"}
+	switch attr.Type {
+	case AttributeTypeNumber, AttributeTypeInteger:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		return value, nil
+	case AttributeTypeBoolean:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, invalid
+		}
+		return value, nil
+	case AttributeTypeDate:
+		value, err := parseDateParam(raw)
+		if err != nil {
+			return nil, invalid
+		}
+		return value.Format("2006-01-02"), nil
+	}
+	return raw, nil
+}
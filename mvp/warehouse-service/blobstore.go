@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Хранилище содержимого вложений по умолчанию
+const (
+	defaultAttachmentDir = "data/attachments"
+	defaultS3Bucket      = "warehouse-attachments"
+)
+
+// Объект не найден в хранилище
+var errBlobNotFound = errors.New("blob not found")
+
+// blobStore - хранилище содержимого файлов; метаданные вложений хранятся в MongoDB
+type blobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Хранилище вложений, выбранное при запуске
+var attachmentStore blobStore
+
+// Выбор хранилища вложений: ATTACHMENT_STORAGE=local (по умолчанию) или s3
+func initBlobStore() error {
+	switch storage := strings.ToLower(os.Getenv("ATTACHMENT_STORAGE")); storage {
+	case "", "local":
+		dir := os.Getenv("ATTACHMENT_DIR")
+		if dir == "" {
+			dir = defaultAttachmentDir
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		attachmentStore = localBlobStore{root: dir}
+		log.Printf("Attachments are stored in %s", dir)
+	case "s3":
+		store, err := newS3BlobStore()
+		if err != nil {
+			return err
+		}
+		attachmentStore = store
+		log.Printf("Attachments are stored in S3 bucket %s", store.bucket)
+	default:
+		return fmt.Errorf("unknown ATTACHMENT_STORAGE %q (expected local or s3)", storage)
+	}
+	return nil
+}
+
+// localBlobStore хранит файлы в каталоге на диске
+type localBlobStore struct {
+	root string
+}
+
+// Путь файла по ключу; ключ не может выйти за пределы каталога хранилища
+func (s localBlobStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+// Запись во временный файл и переименование: читатель не увидит частично записанный файл
+func (s localBlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (s localBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, errBlobNotFound
+	}
+	return file, err
+}
+
+func (s localBlobStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// s3BlobStore хранит файлы в S3-совместимом хранилище (MinIO, Yandex Object Storage)
+type s3BlobStore struct {
+	client *minio.Client
+	bucket string
+}
+
+// Подключение к S3 по S3_ENDPOINT, S3_ACCESS_KEY, S3_SECRET_KEY, S3_BUCKET, S3_REGION, S3_USE_SSL.
+// Бакет создается, если его еще нет.
+func newS3BlobStore() (*s3BlobStore, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		return nil, errors.New("S3_ENDPOINT is required for ATTACHMENT_STORAGE=s3")
+	}
+	bucket := os.Getenv("S3_BUCKET")
+	if bucket == "" {
+		bucket = defaultS3Bucket
+	}
+	region := os.Getenv("S3_REGION")
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"), ""),
+		Secure: os.Getenv("S3_USE_SSL") == "true",
+		Region: region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+		}
+	}
+	return &s3BlobStore{client: client, bucket: bucket}, nil
+}
+
+func (s *s3BlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+// Объект читается лениво, поэтому наличие проверяется запросом метаданных
+func (s *s3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, errBlobNotFound
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+func (s *s3BlobStore) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
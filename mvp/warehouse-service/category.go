@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Максимальная глубина дерева категорий (защита от зацикливания при обходе)
+const maxCategoryDepth = 32
+
+// CategoryNode представляет категорию в дереве с дочерними категориями
+type CategoryNode struct {
+	Category
+	ItemCount      int64           `json:"item_count"`       // Оборудование непосредственно в категории
+	TotalItemCount int64           `json:"total_item_count"` // Оборудование в категории и всех подкатегориях
+	Children       []*CategoryNode `json:"children"`
+}
+
+// Проверка уникальности кода категории
+func checkCategoryCodeUnique(ctx context.Context, code string, selfID primitive.ObjectID) error {
+	filter := bson.M{"code": code}
+	if !selfID.IsZero() {
+		filter["_id"] = bson.M{"$ne": selfID}
+	}
+	count, err := categoryCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return &requestError{http.StatusConflict, "Category with code '" + code + "' already exists"}
+	}
+	return nil
+}
+
+// Проверка родительской категории: она должна существовать, быть активной
+// и не находиться в поддереве изменяемой категории (иначе образуется цикл)
+func validateCategoryParent(ctx context.Context, parentCode, code string, selfID primitive.ObjectID) error {
+	if parentCode == code {
+		return &requestError{http.StatusBadRequest, "Category cannot be its own parent"}
+	}
+
+	current := parentCode
+	for depth := 0; current != ""; depth++ {
+		if depth >= maxCategoryDepth {
+			return &requestError{http.StatusBadRequest, "Category tree is too deep"}
+		}
+
+		var ancestor Category
+		err := categoryCollection.FindOne(ctx, bson.M{"code": current}).Decode(&ancestor)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return &requestError{http.StatusBadRequest, "Parent category '" + current + "' not found"}
+			}
+			return err
+		}
+		if depth == 0 && !ancestor.IsActive {
+			return &requestError{http.StatusBadRequest, "Parent category '" + current + "' is inactive"}
+		}
+		if !selfID.IsZero() && ancestor.ID == selfID {
+			return &requestError{http.StatusBadRequest, "Parent category would create a cycle"}
+		}
+
+		current = ""
+		if ancestor.ParentCategory != nil {
+			current = *ancestor.ParentCategory
+		}
+	}
+	return nil
+}
+
+// Проверка новой категории перед сохранением
+func validateNewCategory(ctx context.Context, category *Category) error {
+	category.Code = strings.TrimSpace(category.Code)
+	if category.Code == "" || strings.TrimSpace(category.Name) == "" {
+		return &requestError{http.StatusBadRequest, "Category code and name are required"}
+	}
+	if err := checkCategoryCodeUnique(ctx, category.Code, primitive.NilObjectID); err != nil {
+		return err
+	}
+
+	attributes, err := validateAttributeDefinitions(category.Attributes)
+	if err != nil {
+		return err
+	}
+	category.Attributes = nil
+	if len(attributes) > 0 {
+		category.Attributes = attributes
+	}
+
+	if category.ParentCategory != nil && *category.ParentCategory == "" {
+		category.ParentCategory = nil
+	}
+	if category.ParentCategory != nil {
+		return validateCategoryParent(ctx, *category.ParentCategory, category.Code, primitive.NilObjectID)
+	}
+	return nil
+}
+
+// Проверка изменения категории (код, родитель и схема атрибутов).
+// Пустой parent_category переносит категорию в корень дерева.
+func validateCategoryUpdate(ctx context.Context, current Category, update bson.M) error {
+	attributesChanged, err := normalizeCategoryAttributeUpdate(update)
+	if err != nil {
+		return err
+	}
+
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		if attributesChanged {
+			return checkCategoryItemAttributes(ctx, current, update)
+		}
+		return nil
+	}
+
+	code := current.Code
+	if value, ok := set["code"].(string); ok && value != current.Code {
+		code = strings.TrimSpace(value)
+		set["code"] = code
+		if err := checkCategoryCodeUnique(ctx, code, current.ID); err != nil {
+			return err
+		}
+
+		// Оборудование и подкатегории ссылаются на категорию по коду
+		items, err := warehouseCollection.CountDocuments(ctx, bson.M{"category": current.Code})
+		if err != nil {
+			return err
+		}
+		children, err := categoryCollection.CountDocuments(ctx, bson.M{"parent_category": current.Code})
+		if err != nil {
+			return err
+		}
+		if items > 0 || children > 0 {
+			return &requestError{http.StatusConflict, "Category code cannot be changed while items or subcategories reference it"}
+		}
+	}
+
+	parentChanged := false
+	if parent, ok := set["parent_category"].(string); ok {
+		if parent == "" {
+			delete(set, "parent_category")
+			unset, _ := update["$unset"].(bson.M)
+			if unset == nil {
+				unset = bson.M{}
+				update["$unset"] = unset
+			}
+			unset["parent_category"] = ""
+		} else if err := validateCategoryParent(ctx, parent, code, current.ID); err != nil {
+			return err
+		}
+		parentChanged = current.ParentCategory == nil && parent != "" ||
+			current.ParentCategory != nil && *current.ParentCategory != parent
+	}
+
+	// Схема подкатегорий наследуется: значения оборудования должны ей соответствовать
+	if attributesChanged || parentChanged {
+		return checkCategoryItemAttributes(ctx, current, update)
+	}
+	return nil
+}
+
+// Проверка ссылки оборудования на категорию по коду
+func validateItemCategory(ctx context.Context, code string) error {
+	var category Category
+	err := categoryCollection.FindOne(ctx, bson.M{"code": code}).Decode(&category)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &requestError{http.StatusBadRequest, "Category '" + code + "' not found"}
+		}
+		return err
+	}
+	if !category.IsActive {
+		return &requestError{http.StatusBadRequest, "Category '" + code + "' is inactive"}
+	}
+	return nil
+}
+
+// Создание справочника для категорий, которые оборудование указывало текстом до его появления.
+// Без записи в справочнике такое оборудование нельзя сохранить: категория проверяется при каждом изменении.
+func migrateItemCategories() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	codes, err := warehouseCollection.Distinct(ctx, "category", bson.M{"category": bson.M{"$nin": bson.A{nil, ""}}})
+	if err != nil {
+		log.Printf("Warning: failed to collect item categories: %v", err)
+		return
+	}
+
+	created := 0
+	for _, value := range codes {
+		code, ok := value.(string)
+		if !ok {
+			continue
+		}
+		now := time.Now()
+		result, err := categoryCollection.UpdateOne(ctx,
+			bson.M{"code": code},
+			bson.M{"$setOnInsert": Category{
+				Code:      code,
+				Name:      code,
+				IsActive:  true,
+				Version:   1,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			log.Printf("Warning: failed to create category %s: %v", code, err)
+			continue
+		}
+		created += int(result.UpsertedCount)
+	}
+	if created > 0 {
+		log.Printf("Created %d categories from item category names", created)
+	}
+}
+
+// Коды категории и всех ее подкатегорий.
+// Неизвестный код возвращается как есть, чтобы фильтр оставался точным.
+func categoryWithDescendants(ctx context.Context, code string) ([]string, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"code": code}},
+		{"$graphLookup": bson.M{
+			"from":             categoryCollection.Name(),
+			"startWith":        "$code",
+			"connectFromField": "code",
+			"connectToField":   "parent_category",
+			"as":               "descendants",
+			"maxDepth":         maxCategoryDepth,
+		}},
+	}
+
+	cursor, err := categoryCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Descendants []struct {
+			Code string `bson:"code"`
+		} `bson:"descendants"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	codes := []string{code}
+	for _, result := range results {
+		for _, descendant := range result.Descendants {
+			codes = append(codes, descendant.Code)
+		}
+	}
+	return codes, nil
+}
+
+// Фильтр оборудования по категориям с учетом подкатегорий.
+// descendants=false в запросе отключает включение подкатегорий.
+func categoryFilter(c *gin.Context, ctx context.Context, codes []string) (interface{}, error) {
+	all := []string{}
+	for _, code := range codes {
+		if c.Query("descendants") == "false" {
+			all = append(all, code)
+			continue
+		}
+		expanded, err := categoryWithDescendants(ctx, code)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, expanded...)
+	}
+
+	if len(all) == 1 {
+		return all[0], nil
+	}
+	return bson.M{"$in": all}, nil
+}
+
+// Дерево категорий с количеством оборудования
+func getCategoryTree(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"is_active": true}
+	if c.Query("include_inactive") == "true" {
+		filter = bson.M{}
+	}
+
+	cursor, err := categoryCollection.Find(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories: " + err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var categories []Category
+	if err := cursor.All(ctx, &categories); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode categories: " + err.Error()})
+		return
+	}
+
+	// Количество оборудования по кодам категорий (без архивного)
+	countCursor, err := warehouseCollection.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"archived": bson.M{"$ne": true}}},
+		{"$group": bson.M{"_id": "$category", "count": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count items: " + err.Error()})
+		return
+	}
+	defer countCursor.Close(ctx)
+
+	var counts []FacetBucket
+	if err := countCursor.All(ctx, &counts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode item counts: " + err.Error()})
+		return
+	}
+	itemCounts := map[string]int64{}
+	for _, bucket := range counts {
+		itemCounts[bucket.Value] = int64(bucket.Count)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tree": buildCategoryTree(categories, itemCounts)})
+}
+
+// Построение дерева из плоского списка категорий.
+// Категории с отсутствующим родителем попадают в корень.
+func buildCategoryTree(categories []Category, itemCounts map[string]int64) []*CategoryNode {
+	nodes := map[string]*CategoryNode{}
+	for _, category := range categories {
+		nodes[category.Code] = &CategoryNode{
+			Category:  category,
+			ItemCount: itemCounts[category.Code],
+			Children:  []*CategoryNode{},
+		}
+	}
+
+	roots := []*CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.Code]
+		if category.ParentCategory != nil {
+			if parent, ok := nodes[*category.ParentCategory]; ok && parent != node {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	sortCategoryNodes(roots, 0)
+	return roots
+}
+
+// Сортировка по названию и подсчет оборудования в поддеревьях
+func sortCategoryNodes(nodes []*CategoryNode, depth int) int64 {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	var total int64
+	for _, node := range nodes {
+		node.TotalItemCount = node.ItemCount
+		if depth < maxCategoryDepth {
+			node.TotalItemCount += sortCategoryNodes(node.Children, depth+1)
+		}
+		total += node.TotalItemCount
+	}
+	return total
+}
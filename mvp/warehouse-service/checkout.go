@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Интервал между повторными уведомлениями о просрочке одной и той же выдачи
+const overdueRenotifyInterval = 24 * time.Hour
+
+// Статусы выдач, по которым оборудование еще находится у сотрудника
+var activeCheckoutStatuses = []string{CheckoutStatusOpen, CheckoutStatusPartiallyReturned}
+
+// Подготовка выдачи сотруднику для транзакции.
+// Для расхода с due_date создается новая выдача, для возврата с checkout_id
+// находится и обновляется существующая, для возврата без него - самая ранняя открытая.
+// Возвращает nil, если транзакция не связана с выдачей.
+func prepareCheckout(ctx context.Context, req TransactionRequest, item WarehouseItem, transaction *InventoryTransaction) (*Checkout, error) {
+	if req.DueDate != nil {
+		if req.TransactionType != "issue" {
+			return nil, &requestError{http.StatusBadRequest, "due_date is only allowed for issue transactions"}
+		}
+		if req.DestinationUser == "" {
+			return nil, &requestError{http.StatusBadRequest, "destination_user is required when due_date is set"}
+		}
+		if !req.DueDate.After(time.Now()) {
+			return nil, &requestError{http.StatusBadRequest, "due_date must be in the future"}
+		}
+
+		checkout := &Checkout{
+			ID:                   primitive.NewObjectID(),
+			ItemID:               item.ID,
+			ItemName:             item.Name,
+			SerialNumber:         item.SerialNumber,
+			Holder:               req.DestinationUser,
+			ResponsibleUser:      req.ResponsibleUser,
+			Quantity:             req.Quantity,
+			Unit:                 itemUnit(item),
+			IssueTransactionID:   transaction.ID,
+			ReturnTransactionIDs: []primitive.ObjectID{},
+			IssuedAt:             transaction.Date,
+			DueDate:              *req.DueDate,
+			Status:               CheckoutStatusOpen,
+			CreatedAt:            time.Now(),
+			UpdatedAt:            time.Now(),
+		}
+		transaction.CheckoutID = checkout.ID
+		transaction.DueDate = checkout.DueDate
+		return checkout, nil
+	}
+
+	var checkout Checkout
+	if req.CheckoutID == "" {
+		if req.TransactionType != "return" {
+			return nil, nil
+		}
+		// Возврат без checkout_id закрывает самую раннюю открытую выдачу оборудования
+		// (сотрудника из destination_user, если он указан)
+		filter := bson.M{"item_id": item.ID, "status": bson.M{"$in": activeCheckoutStatuses}}
+		if req.DestinationUser != "" {
+			filter["holder"] = req.DestinationUser
+		}
+		findOptions := options.FindOne().SetSort(bson.D{{Key: "issued_at", Value: 1}, {Key: "_id", Value: 1}})
+		err := checkoutCollection.FindOne(ctx, filter, findOptions).Decode(&checkout)
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if req.TransactionType != "return" {
+			return nil, &requestError{http.StatusBadRequest, "checkout_id is only allowed for return transactions"}
+		}
+
+		checkoutID, err := primitive.ObjectIDFromHex(req.CheckoutID)
+		if err != nil {
+			return nil, &requestError{http.StatusBadRequest, "Invalid checkout ID format"}
+		}
+
+		err = checkoutCollection.FindOne(ctx, bson.M{"_id": checkoutID}).Decode(&checkout)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, &requestError{http.StatusNotFound, "Checkout not found"}
+			}
+			return nil, err
+		}
+	}
+
+	if checkout.ItemID != item.ID {
+		return nil, &requestError{http.StatusBadRequest, "Checkout belongs to another item"}
+	}
+	if checkout.Status == CheckoutStatusReturned {
+		return nil, &requestError{http.StatusBadRequest, "Checkout is already fully returned"}
+	}
+	if req.Quantity > checkout.Outstanding() {
+		return nil, &requestError{http.StatusBadRequest, fmt.Sprintf("Return quantity exceeds outstanding quantity (%s)", formatQuantity(checkout.Outstanding()))}
+	}
+
+	// Частичный возврат допускается, полный закрывает выдачу
+	checkout.ReturnedQuantity = roundQuantity(checkout.ReturnedQuantity + req.Quantity)
+	checkout.ReturnTransactionIDs = append(checkout.ReturnTransactionIDs, transaction.ID)
+	checkout.Status = CheckoutStatusPartiallyReturned
+	if checkout.Outstanding() == 0 {
+		checkout.Status = CheckoutStatusReturned
+		checkout.ReturnedAt = transaction.Date
+	}
+	checkout.UpdatedAt = time.Now()
+
+	transaction.CheckoutID = checkout.ID
+	if transaction.DestinationUser == "" {
+		transaction.DestinationUser = checkout.Holder
+	}
+	return &checkout, nil
+}
+
+// Сохранение выдачи в рамках транзакции MongoDB
+func saveCheckout(sessCtx mongo.SessionContext, checkout *Checkout, transaction InventoryTransaction) error {
+	if checkout.IssueTransactionID == transaction.ID {
+		_, err := checkoutCollection.InsertOne(sessCtx, checkout)
+		return err
+	}
+
+	// Фильтр по предыдущему количеству защищает от одновременных возвратов
+	previousReturned := roundQuantity(checkout.ReturnedQuantity - transaction.Quantity)
+	update := bson.M{
+		"$set": bson.M{
+			"returned_quantity": checkout.ReturnedQuantity,
+			"status":            checkout.Status,
+			"updated_at":        checkout.UpdatedAt,
+		},
+		"$push": bson.M{"return_transaction_ids": transaction.ID},
+	}
+	if checkout.Status == CheckoutStatusReturned {
+		update["$set"].(bson.M)["returned_at"] = checkout.ReturnedAt
+	}
+
+	result, err := checkoutCollection.UpdateOne(sessCtx, bson.M{
+		"_id":               checkout.ID,
+		"returned_quantity": previousReturned,
+	}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("checkout %s was modified concurrently", checkout.ID.Hex())
+	}
+	return nil
+}
+
+// Отметка просрочки для ответа клиенту
+func markOverdue(checkouts []Checkout) {
+	now := time.Now()
+	for i := range checkouts {
+		checkouts[i].IsOverdue = checkouts[i].Status != CheckoutStatusReturned && checkouts[i].DueDate.Before(now)
+	}
+}
+
+// Список выдач оборудования
+func listCheckouts(c *gin.Context) {
+	filter := bson.M{}
+	if holder := c.Query("holder"); holder != "" {
+		filter["holder"] = holder
+	}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	if itemIDStr := c.Query("item_id"); itemIDStr != "" {
+		itemID, err := primitive.ObjectIDFromHex(itemIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID format"})
+			return
+		}
+		filter["item_id"] = itemID
+	}
+	if c.Query("overdue") == "true" {
+		filter["status"] = bson.M{"$in": activeCheckoutStatuses}
+		filter["due_date"] = bson.M{"$lt": time.Now()}
+	}
+
+	// Постраничный вывод: ближайшие сроки возврата первыми
+	page, err := parsePageQuery(c, "due_date", 1)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	checkouts, pagination, err := findPage[Checkout](ctx, checkoutCollection, filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch checkouts: " + err.Error()})
+		return
+	}
+	markOverdue(checkouts)
+
+	c.JSON(http.StatusOK, gin.H{"checkouts": checkouts, "pagination": pagination})
+}
+
+// Получение выдачи по ID
+func getCheckout(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid checkout ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var checkout Checkout
+	err = checkoutCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&checkout)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Checkout not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch checkout: " + err.Error()})
+		}
+		return
+	}
+
+	checkouts := []Checkout{checkout}
+	markOverdue(checkouts)
+	c.JSON(http.StatusOK, checkouts[0])
+}
+
+// Оборудование, которое сейчас находится у сотрудника
+func getHolderCheckouts(c *gin.Context) {
+	holder := c.Param("holder")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.M{"due_date": 1})
+
+	cursor, err := checkoutCollection.Find(ctx, bson.M{
+		"holder": holder,
+		"status": bson.M{"$in": activeCheckoutStatuses},
+	}, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch checkouts: " + err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	checkouts := []Checkout{}
+	if err := cursor.All(ctx, &checkouts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode checkouts: " + err.Error()})
+		return
+	}
+	markOverdue(checkouts)
+
+	// Сводка по оборудованию на руках
+	outstanding := 0.0
+	overdue := 0
+	for _, checkout := range checkouts {
+		outstanding = roundQuantity(outstanding + checkout.Outstanding())
+		if checkout.IsOverdue {
+			overdue++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"holder":            holder,
+		"checkouts":         checkouts,
+		"total_outstanding": outstanding,
+		"overdue_count":     overdue,
+	})
+}
+
+// Запуск фоновой проверки просроченных возвратов
+func startOverdueMonitor() {
+	interval := time.Hour
+	if value := os.Getenv("CHECKOUT_OVERDUE_CHECK_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Warning: invalid CHECKOUT_OVERDUE_CHECK_INTERVAL %q, using %s", value, interval)
+		} else {
+			interval = parsed
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			checkOverdueCheckouts()
+			<-ticker.C
+		}
+	}()
+
+	log.Printf("Checkout overdue monitor started (interval %s)", interval)
+}
+
+// Поиск просроченных выдач и отправка событий в notification-service
+func checkOverdueCheckouts() {
+	if !isRabbitConnected() {
+		log.Println("RabbitMQ connection not available, skipping overdue check")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	cursor, err := checkoutCollection.Find(ctx, bson.M{
+		"status":   bson.M{"$in": activeCheckoutStatuses},
+		"due_date": bson.M{"$lt": now},
+		"$or": []bson.M{
+			{"overdue_notified_at": bson.M{"$exists": false}},
+			{"overdue_notified_at": bson.M{"$lt": now.Add(-overdueRenotifyInterval)}},
+		},
+	})
+	if err != nil {
+		log.Printf("Error fetching overdue checkouts: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var checkouts []Checkout
+	if err := cursor.All(ctx, &checkouts); err != nil {
+		log.Printf("Error decoding overdue checkouts: %v", err)
+		return
+	}
+
+	// Обозначения единиц для текста уведомления; без справочника выводится код единицы
+	units, err := loadUnits(ctx)
+	if err != nil {
+		log.Printf("Warning: failed to load units: %v", err)
+	}
+
+	for _, checkout := range checkouts {
+		message := CheckoutOverdueMessage{
+			CheckoutID:          checkout.ID.Hex(),
+			ItemID:              checkout.ItemID.Hex(),
+			ItemName:            checkout.ItemName,
+			SerialNumber:        checkout.SerialNumber,
+			Holder:              checkout.Holder,
+			ResponsibleUser:     checkout.ResponsibleUser,
+			OutstandingQuantity: checkout.Outstanding(),
+			Unit:                unitName(units, checkout.Unit),
+			DueDate:             checkout.DueDate,
+			DaysOverdue:         int(now.Sub(checkout.DueDate).Hours() / 24),
+		}
+
+		if err := publishNotification(CheckoutOverdueKey, message); err != nil {
+			log.Printf("Failed to publish overdue event for checkout %s: %v", checkout.ID.Hex(), err)
+			continue
+		}
+
+		_, err := checkoutCollection.UpdateOne(ctx, bson.M{"_id": checkout.ID}, bson.M{
+			"$set": bson.M{"overdue_notified_at": now},
+		})
+		if err != nil {
+			log.Printf("Failed to mark checkout %s as notified: %v", checkout.ID.Hex(), err)
+		}
+	}
+}
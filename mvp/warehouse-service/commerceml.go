@@ -0,0 +1,1526 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Версия схемы CommerceML
+const commerceMLVersion = "2.10"
+
+// Идентификаторы классификатора и каталога склада в 1С
+const (
+	commerceMLClassifierID = "warehouse-classifier"
+	commerceMLCatalogID    = "warehouse-catalog"
+)
+
+// Виды выгрузки в 1С; для каждого хранится граница последней подтвержденной выгрузки
+const (
+	ExchangeKindCatalog   = "catalog"
+	ExchangeKindSuppliers = "suppliers"
+	ExchangeKindDocuments = "documents"
+)
+
+var exchangeKinds = []string{ExchangeKindCatalog, ExchangeKindSuppliers, ExchangeKindDocuments}
+
+// Действия над группой или товаром при загрузке каталога из 1С
+const (
+	CatalogImportCreate    = "create"
+	CatalogImportUpdate    = "update"
+	CatalogImportUnchanged = "unchanged"
+	CatalogImportSkipped   = "skipped"
+	CatalogImportInvalid   = "invalid"
+	CatalogImportFailed    = "failed"
+)
+
+// Единица измерения по ОКЕИ
+type okeiUnit struct {
+	Code          string
+	FullName      string
+	International string
+}
+
+// Коды ОКЕИ стандартных единиц измерения
+var okeiUnits = map[string]okeiUnit{
+	"pcs":  {"796", "Штука", "PCE"},
+	"mm":   {"003", "Миллиметр", "MMT"},
+	"cm":   {"004", "Сантиметр", "CMT"},
+	"m":    {"006", "Метр", "MTR"},
+	"km":   {"008", "Километр", "KMT"},
+	"g":    {"163", "Грамм", "GRM"},
+	"kg":   {"166", "Килограмм", "KGM"},
+	"t":    {"168", "Тонна", "TNE"},
+	"ml":   {"111", "Миллилитр", "MLT"},
+	"l":    {"112", "Литр", "LTR"},
+	"pack": {"778", "Упаковка", "NMP"},
+	"roll": {"736", "Рулон", "NPL"},
+	"set":  {"839", "Комплект", "SET"},
+}
+
+// Элементы CommerceML
+
+type cmlRequisite struct {
+	Name  string `xml:"Наименование"`
+	Value string `xml:"Значение"`
+}
+
+type cmlUnit struct {
+	Code          string `xml:"Код,attr,omitempty"`
+	FullName      string `xml:"НаименованиеПолное,attr,omitempty"`
+	International string `xml:"МеждународноеСокращение,attr,omitempty"`
+	Name          string `xml:",chardata"`
+}
+
+type cmlGroup struct {
+	ID     string     `xml:"Ид"`
+	Name   string     `xml:"Наименование"`
+	Groups *cmlGroups `xml:"Группы,omitempty"`
+}
+
+// Списки элементов; пустой список не выводится вместе с родительским элементом
+
+type cmlGroups struct {
+	Items []cmlGroup `xml:"Группа"`
+}
+
+type cmlGroupIDs struct {
+	Items []string `xml:"Ид"`
+}
+
+func (groups *cmlGroups) list() []cmlGroup {
+	if groups == nil {
+		return nil
+	}
+	return groups.Items
+}
+
+func (ids *cmlGroupIDs) list() []string {
+	if ids == nil {
+		return nil
+	}
+	return ids.Items
+}
+
+type cmlRequisites struct {
+	Items []cmlRequisite `xml:"ЗначениеРеквизита"`
+}
+
+type cmlContacts struct {
+	Items []cmlContact `xml:"Контакт"`
+}
+
+type cmlRepresentatives struct {
+	Items []cmlRepresentative `xml:"Представитель>Контрагент"`
+}
+
+type cmlTaxes struct {
+	Items []cmlTax `xml:"Налог"`
+}
+
+type cmlClassifier struct {
+	XMLName xml.Name   `xml:"Классификатор"`
+	ID      string     `xml:"Ид"`
+	Name    string     `xml:"Наименование"`
+	Groups  *cmlGroups `xml:"Группы,omitempty"`
+}
+
+type cmlManufacturer struct {
+	Name string `xml:"Наименование"`
+}
+
+type cmlProduct struct {
+	XMLName      xml.Name         `xml:"Товар"`
+	Status       string           `xml:"Статус,attr,omitempty"` // Удален
+	ID           string           `xml:"Ид"`
+	Article      string           `xml:"Артикул,omitempty"`
+	Name         string           `xml:"Наименование"`
+	BaseUnit     cmlUnit          `xml:"БазоваяЕдиница"`
+	GroupIDs     *cmlGroupIDs     `xml:"Группы,omitempty"`
+	Description  string           `xml:"Описание,omitempty"`
+	Manufacturer *cmlManufacturer `xml:"Изготовитель,omitempty"`
+	DeletionMark bool             `xml:"ПометкаУдаления,omitempty"`
+	Requisites   *cmlRequisites   `xml:"ЗначенияРеквизитов,omitempty"`
+}
+
+type cmlContact struct {
+	Type  string `xml:"Тип"`
+	Value string `xml:"Значение"`
+}
+
+type cmlRepresentative struct {
+	Relation string `xml:"Отношение"`
+	ID       string `xml:"Ид"`
+	Name     string `xml:"Наименование"`
+}
+
+type cmlParty struct {
+	XMLName         xml.Name            `xml:"Контрагент"`
+	ID              string              `xml:"Ид"`
+	Name            string              `xml:"Наименование"`
+	Role            string              `xml:"Роль,omitempty"`
+	OfficialName    string              `xml:"ОфициальноеНаименование,omitempty"`
+	FullName        string              `xml:"ПолноеНаименование,omitempty"`
+	TaxID           string              `xml:"ИНН,omitempty"`
+	KPP             string              `xml:"КПП,omitempty"`
+	Contacts        *cmlContacts        `xml:"Контакты,omitempty"`
+	Representatives *cmlRepresentatives `xml:"Представители,omitempty"`
+}
+
+type cmlTaxRate struct {
+	Name string `xml:"Наименование"`
+	Rate string `xml:"Ставка"`
+}
+
+type cmlTax struct {
+	Name     string `xml:"Наименование"`
+	InAmount bool   `xml:"УчтеноВСумме"`
+	Amount   string `xml:"Сумма"`
+	Rate     string `xml:"Ставка,omitempty"`
+}
+
+type cmlDocumentLine struct {
+	ID         string         `xml:"Ид"`
+	Article    string         `xml:"Артикул,omitempty"`
+	Name       string         `xml:"Наименование"`
+	BaseUnit   cmlUnit        `xml:"БазоваяЕдиница"`
+	Price      string         `xml:"ЦенаЗаЕдиницу"`
+	Quantity   string         `xml:"Количество"`
+	Amount     string         `xml:"Сумма"`
+	TaxRates   []cmlTaxRate   `xml:"СтавкиНалогов>СтавкаНалога"`
+	Taxes      *cmlTaxes      `xml:"Налоги,omitempty"`
+	Requisites *cmlRequisites `xml:"ЗначенияРеквизитов,omitempty"`
+}
+
+type cmlDocument struct {
+	XMLName    xml.Name          `xml:"Документ"`
+	ID         string            `xml:"Ид"`
+	Number     string            `xml:"Номер"`
+	Date       string            `xml:"Дата"`
+	Operation  string            `xml:"ХозОперация"`
+	Role       string            `xml:"Роль"`
+	Currency   string            `xml:"Валюта"`
+	Rate       string            `xml:"Курс"`
+	Amount     string            `xml:"Сумма"`
+	Parties    []cmlParty        `xml:"Контрагенты>Контрагент"`
+	Time       string            `xml:"Время"`
+	Comment    string            `xml:"Комментарий,omitempty"`
+	Taxes      *cmlTaxes         `xml:"Налоги,omitempty"`
+	Lines      []cmlDocumentLine `xml:"Товары>Товар"`
+	Requisites *cmlRequisites    `xml:"ЗначенияРеквизитов,omitempty"`
+}
+
+// Файл каталога из 1С (import.xml)
+type cmlCatalogFile struct {
+	XMLName    xml.Name `xml:"КоммерческаяИнформация"`
+	Classifier struct {
+		Groups []cmlGroup `xml:"Группы>Группа"`
+	} `xml:"Классификатор"`
+	Catalog struct {
+		Products []cmlProduct `xml:"Товары>Товар"`
+	} `xml:"Каталог"`
+}
+
+// CatalogImportEntry представляет результат загрузки группы или товара из 1С
+type CatalogImportEntry struct {
+	Kind       string   `json:"kind"` // group, item
+	ExternalID string   `json:"external_id"`
+	Name       string   `json:"name"`
+	Action     string   `json:"action"`            // create, update, unchanged, skipped, invalid, failed
+	ID         string   `json:"id,omitempty"`      // Категория или оборудование на складе
+	Code       string   `json:"code,omitempty"`    // Код категории
+	Changes    []string `json:"changes,omitempty"` // Изменяемые поля
+	Warnings   []string `json:"warnings,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// Форматирование чисел и дат для CommerceML
+func cmlQuantity(value float64) string {
+	return strconv.FormatFloat(roundQuantity(value), 'f', -1, 64)
+}
+
+func cmlDate(t time.Time) string {
+	return t.In(time.Local).Format("2006-01-02")
+}
+
+func cmlTime(t time.Time) string {
+	return t.In(time.Local).Format("15:04:05")
+}
+
+// Единица измерения с кодом ОКЕИ
+func cmlUnitFor(catalog unitCatalog, code string) cmlUnit {
+	if code == "" {
+		code = defaultUnit
+	}
+	okei := okeiUnits[code]
+	return cmlUnit{Code: okei.Code, FullName: okei.FullName, International: okei.International, Name: unitName(catalog, code)}
+}
+
+// Код единицы склада по единице из 1С: код ОКЕИ, международное сокращение или обозначение
+func resolveCMLUnit(catalog unitCatalog, unit cmlUnit) (string, bool) {
+	for code, okei := range okeiUnits {
+		if (unit.Code != "" && strings.TrimLeft(unit.Code, "0") == strings.TrimLeft(okei.Code, "0")) ||
+			(unit.International != "" && strings.EqualFold(unit.International, okei.International)) {
+			return code, true
+		}
+	}
+	name := strings.TrimSpace(unit.Name)
+	if name == "" {
+		return "", false
+	}
+	code := catalog.resolve(name)
+	_, ok := catalog[code]
+	return code, ok
+}
+
+// Ид оборудования и категорий в 1С: загруженные из 1С сохраняют исходный Ид
+func itemExchangeID(item WarehouseItem) string {
+	if item.ExternalID != "" {
+		return item.ExternalID
+	}
+	return item.ID.Hex()
+}
+
+func categoryExchangeID(category Category) string {
+	if category.ExternalID != "" {
+		return category.ExternalID
+	}
+	return category.Code
+}
+
+// Начало документа CommerceML
+func startCommerceML(c *gin.Context, name string) (*xml.Encoder, error) {
+	filename := fmt.Sprintf("%s-%s.xml", name, time.Now().Format("20060102-150405"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Content-Type", "application/xml; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	if _, err := io.WriteString(c.Writer, xml.Header); err != nil {
+		return nil, err
+	}
+	encoder := xml.NewEncoder(c.Writer)
+	encoder.Indent("", "  ")
+	return encoder, encoder.EncodeToken(xml.StartElement{
+		Name: xml.Name{Local: "КоммерческаяИнформация"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "ВерсияСхемы"}, Value: commerceMLVersion},
+			{Name: xml.Name{Local: "ДатаФормирования"}, Value: time.Now().Format("2006-01-02T15:04:05")},
+		},
+	})
+}
+
+// Закрытие открытых элементов и сброс буфера
+func endCommerceML(encoder *xml.Encoder, names ...string) error {
+	for _, name := range names {
+		if err := encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}}); err != nil {
+			return err
+		}
+	}
+	if err := encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: "КоммерческаяИнформация"}}); err != nil {
+		return err
+	}
+	return encoder.Flush()
+}
+
+// Отставание границы выгрузки от текущего момента.
+// created_at и updated_at проставляются до записи документа, а запись завершается в пределах
+// таймаута запроса (до 30 секунд); документы моложе границы могли еще не появиться в базе,
+// и после подтверждения выгрузки они были бы пропущены.
+const exchangeCommitLag = time.Minute
+
+// Границы выгрузки: изменения после последней подтвержденной выгрузки до момента,
+// к которому все записи гарантированно завершены.
+// full=true выгружает все данные, since задает начало периода явно.
+func exchangeWindow(c *gin.Context, ctx context.Context, kind string) (time.Time, time.Time, error) {
+	// MongoDB хранит время с точностью до миллисекунд
+	until := time.Now().Add(-exchangeCommitLag).Truncate(time.Millisecond)
+
+	if c.Query("full") == "true" {
+		return time.Time{}, until, nil
+	}
+	if value := c.Query("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, until, &requestError{http.StatusBadRequest, "Invalid since parameter (RFC3339 expected)"}
+		}
+		return since, until, nil
+	}
+
+	var state ExchangeState
+	err := exchangeStateCollection.FindOne(ctx, bson.M{"_id": kind}).Decode(&state)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return time.Time{}, until, err
+	}
+	return state.ExportedUntil, until, nil
+}
+
+// Фильтр изменений в границах выгрузки
+func exchangeFilter(field string, since, until time.Time) bson.M {
+	period := bson.M{"$lte": until}
+	if !since.IsZero() {
+		period["$gt"] = since
+	}
+	return bson.M{field: period}
+}
+
+// Заголовки с границами выгрузки; X-Exchange-Until передается в подтверждение
+func setExchangeHeaders(c *gin.Context, since, until time.Time) {
+	if !since.IsZero() {
+		c.Header("X-Exchange-Since", since.Format(time.RFC3339Nano))
+	}
+	c.Header("X-Exchange-Until", until.Format(time.RFC3339Nano))
+}
+
+// Состояние выгрузок в 1С
+func listExchangeState(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	states, err := loadAll[ExchangeState](ctx, exchangeStateCollection, bson.M{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exchange state: " + err.Error()})
+		return
+	}
+
+	byKind := map[string]ExchangeState{}
+	for _, state := range states {
+		byKind[state.ID] = state
+	}
+	result := make([]ExchangeState, 0, len(exchangeKinds))
+	for _, kind := range exchangeKinds {
+		state, ok := byKind[kind]
+		if !ok {
+			state = ExchangeState{ID: kind}
+		}
+		result = append(result, state)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Подтверждение загрузки выгрузки в 1С: следующая выгрузка начнется с until.
+// Граница только сдвигается вперед, повторное подтверждение старой выгрузки ничего не меняет.
+func confirmExchange(c *gin.Context) {
+	kind := c.Param("kind")
+	if !containsString(exchangeKinds, kind) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown exchange kind (catalog, suppliers or documents)"})
+		return
+	}
+
+	var req struct {
+		Until time.Time `json:"until" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "until is required (value of X-Exchange-Until header)"})
+		return
+	}
+	// Граница не может быть позже той, что выдается в X-Exchange-Until, иначе незавершенные записи будут пропущены
+	if req.Until.After(time.Now().Add(-exchangeCommitLag)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "until cannot be later than the current exchange window"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var state ExchangeState
+	err := exchangeStateCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": kind, "exported_until": bson.M{"$not": bson.M{"$gte": req.Until}}},
+		bson.M{"$set": bson.M{
+			"exported_until": req.Until,
+			"confirmed_by":   requestUser(c),
+			"updated_at":     time.Now(),
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&state)
+	if mongo.IsDuplicateKeyError(err) {
+		// Уже подтверждена более поздняя выгрузка
+		err = exchangeStateCollection.FindOne(ctx, bson.M{"_id": kind}).Decode(&state)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm exchange: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+// Дерево групп классификатора из категорий
+func buildCMLGroups(categories []Category) *cmlGroups {
+	children := map[string][]Category{}
+	codes := map[string]bool{}
+	for _, category := range categories {
+		codes[category.Code] = true
+	}
+	for _, category := range categories {
+		parent := ""
+		if category.ParentCategory != nil && codes[*category.ParentCategory] {
+			parent = *category.ParentCategory
+		}
+		children[parent] = append(children[parent], category)
+	}
+
+	var build func(parent string, depth int) *cmlGroups
+	build = func(parent string, depth int) *cmlGroups {
+		if depth >= maxCategoryDepth || len(children[parent]) == 0 {
+			return nil
+		}
+		groups := &cmlGroups{}
+		for _, category := range children[parent] {
+			groups.Items = append(groups.Items, cmlGroup{
+				ID:     categoryExchangeID(category),
+				Name:   category.Name,
+				Groups: build(category.Code, depth+1),
+			})
+		}
+		return groups
+	}
+	return build("", 0)
+}
+
+// Выгрузка каталога оборудования в CommerceML (import.xml):
+// классификатор со всеми группами и товары, измененные после последней выгрузки
+func exportCatalogCommerceML(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	since, until, err := exchangeWindow(c, ctx, ExchangeKindCatalog)
+	if err != nil {
+		respondError(c, err, "Failed to read exchange state: ")
+		return
+	}
+
+	categories, err := loadAll[Category](ctx, categoryCollection, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories: " + err.Error()})
+		return
+	}
+	units, err := loadUnits(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch units: " + err.Error()})
+		return
+	}
+	groupIDs := map[string]string{}
+	for _, category := range categories {
+		groupIDs[category.Code] = categoryExchangeID(category)
+	}
+
+	cursor, err := warehouseCollection.Find(ctx, exchangeFilter("updated_at", since, until),
+		options.Find().SetSort(bson.D{{Key: "updated_at", Value: 1}}).SetBatchSize(exportBatchSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items: " + err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	setExchangeHeaders(c, since, until)
+	encoder, err := startCommerceML(c, "catalog")
+	if err == nil {
+		err = encoder.Encode(cmlClassifier{
+			ID:     commerceMLClassifierID,
+			Name:   "Классификатор (Склад)",
+			Groups: buildCMLGroups(categories),
+		})
+	}
+	if err == nil {
+		err = encoder.EncodeToken(xml.StartElement{
+			Name: xml.Name{Local: "Каталог"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "СодержитТолькоИзменения"}, Value: strconv.FormatBool(!since.IsZero())}},
+		})
+	}
+	for _, element := range [][2]string{{"Ид", commerceMLCatalogID}, {"ИдКлассификатора", commerceMLClassifierID}, {"Наименование", "Каталог оборудования"}} {
+		if err == nil {
+			err = encoder.EncodeElement(element[1], xml.StartElement{Name: xml.Name{Local: element[0]}})
+		}
+	}
+	if err == nil {
+		err = encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: "Товары"}})
+	}
+	if err != nil {
+		log.Printf("Failed to start catalog export: %v", err)
+		return
+	}
+
+	count := 0
+	for cursor.Next(ctx) {
+		var item WarehouseItem
+		if err := cursor.Decode(&item); err != nil {
+			log.Printf("Failed to decode item for catalog export: %v", err)
+			return
+		}
+
+		product := cmlProduct{
+			ID:          itemExchangeID(item),
+			Article:     item.SerialNumber,
+			Name:        item.Name,
+			BaseUnit:    cmlUnitFor(units, item.Unit),
+			Description: item.Description,
+			Requisites: &cmlRequisites{Items: []cmlRequisite{
+				{Name: "ВидНоменклатуры", Value: "Товар"},
+				{Name: "ТипНоменклатуры", Value: "Товар"},
+				{Name: "Полное наименование", Value: item.Name},
+			}},
+		}
+		if groupID, ok := groupIDs[item.Category]; ok {
+			product.GroupIDs = &cmlGroupIDs{Items: []string{groupID}}
+		}
+		if item.Manufacturer != "" {
+			product.Manufacturer = &cmlManufacturer{Name: item.Manufacturer}
+		}
+		// Архивное оборудование помечается на удаление
+		if item.Archived {
+			product.Status = "Удален"
+			product.DeletionMark = true
+		}
+
+		if err := encoder.Encode(product); err != nil {
+			log.Printf("Failed to write catalog export: %v", err)
+			return
+		}
+		count++
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Failed to read items for catalog export: %v", err)
+		return
+	}
+	if err := endCommerceML(encoder, "Товары", "Каталог"); err != nil {
+		log.Printf("Failed to finish catalog export: %v", err)
+		return
+	}
+	log.Printf("Exported %d items to CommerceML catalog", count)
+}
+
+// Контрагент CommerceML по карточке поставщика
+func supplierParty(supplier Supplier) cmlParty {
+	party := cmlParty{
+		ID:           supplier.ID.Hex(),
+		Name:         supplier.CompanyName,
+		OfficialName: supplier.CompanyName,
+		FullName:     supplier.CompanyName,
+		TaxID:        supplier.TaxID,
+		KPP:          supplier.KPP,
+	}
+	for _, contact := range []cmlContact{
+		{"Телефон рабочий", supplier.Contact.Phone},
+		{"Почта", supplier.Contact.Email},
+		{"Адрес сайта", supplier.Contact.Website},
+	} {
+		if contact.Value != "" {
+			if party.Contacts == nil {
+				party.Contacts = &cmlContacts{}
+			}
+			party.Contacts.Items = append(party.Contacts.Items, contact)
+		}
+	}
+	if supplier.ContactPerson.Name != "" {
+		party.Representatives = &cmlRepresentatives{Items: []cmlRepresentative{{
+			Relation: "Контактное лицо",
+			ID:       supplier.ID.Hex() + "-contact",
+			Name:     supplier.ContactPerson.Name,
+		}}}
+	}
+	return party
+}
+
+// Контрагент CommerceML по участнику накладной (сотрудник или сдавший товар)
+func personParty(person PersonInfo, role string) cmlParty {
+	id := person.UserID
+	if id == "" {
+		id = person.FullName
+	}
+	return cmlParty{ID: id, Name: person.FullName, FullName: person.FullName, Role: role}
+}
+
+// Выгрузка поставщиков, измененных после последней выгрузки, в CommerceML
+func exportSuppliersCommerceML(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	since, until, err := exchangeWindow(c, ctx, ExchangeKindSuppliers)
+	if err != nil {
+		respondError(c, err, "Failed to read exchange state: ")
+		return
+	}
+
+	cursor, err := supplierCollection.Find(ctx, exchangeFilter("updated_at", since, until),
+		options.Find().SetSort(bson.D{{Key: "updated_at", Value: 1}}).SetBatchSize(exportBatchSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suppliers: " + err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	setExchangeHeaders(c, since, until)
+	encoder, err := startCommerceML(c, "suppliers")
+	if err == nil {
+		err = encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: "Контрагенты"}})
+	}
+	if err != nil {
+		log.Printf("Failed to start suppliers export: %v", err)
+		return
+	}
+
+	count := 0
+	for cursor.Next(ctx) {
+		var supplier Supplier
+		if err := cursor.Decode(&supplier); err != nil {
+			log.Printf("Failed to decode supplier for export: %v", err)
+			return
+		}
+		if err := encoder.Encode(supplierParty(supplier)); err != nil {
+			log.Printf("Failed to write suppliers export: %v", err)
+			return
+		}
+		count++
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Failed to read suppliers for export: %v", err)
+		return
+	}
+	if err := endCommerceML(encoder, "Контрагенты"); err != nil {
+		log.Printf("Failed to finish suppliers export: %v", err)
+		return
+	}
+	log.Printf("Exported %d suppliers to CommerceML", count)
+}
+
+// Справочники для выгрузки накладных; заполняются по мере чтения накладных
+type cmlDocumentReferences struct {
+	units     unitCatalog
+	items     map[primitive.ObjectID]string // Оборудование -> Ид в 1С
+	suppliers map[primitive.ObjectID]*Supplier
+	orders    map[primitive.ObjectID]primitive.ObjectID // Заказ -> поставщик
+}
+
+// Ид оборудования накладной в 1С
+func (refs *cmlDocumentReferences) itemIDs(ctx context.Context, invoice Invoice) error {
+	var missing []primitive.ObjectID
+	for _, line := range invoice.Items {
+		if _, ok := refs.items[line.ItemID]; !ok {
+			missing = append(missing, line.ItemID)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	items, err := loadAll[WarehouseItem](ctx, warehouseCollection, bson.M{"_id": bson.M{"$in": missing}},
+		options.Find().SetProjection(bson.M{"external_id": 1}))
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		refs.items[item.ID] = itemExchangeID(item)
+	}
+	// Удаленное оборудование выгружается под ID склада
+	for _, id := range missing {
+		if _, ok := refs.items[id]; !ok {
+			refs.items[id] = id.Hex()
+		}
+	}
+	return nil
+}
+
+// Поставщик приходной накладной по заказу поставщику
+func (refs *cmlDocumentReferences) supplier(ctx context.Context, orderID primitive.ObjectID) (*Supplier, error) {
+	if orderID.IsZero() {
+		return nil, nil
+	}
+	supplierID, ok := refs.orders[orderID]
+	if !ok {
+		var order PurchaseOrder
+		err := purchaseOrderCollection.FindOne(ctx, bson.M{"_id": orderID}, options.FindOne().SetProjection(bson.M{"supplier_id": 1})).Decode(&order)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		supplierID = order.SupplierID
+		refs.orders[orderID] = supplierID
+	}
+	if supplierID.IsZero() {
+		return nil, nil
+	}
+
+	supplier, ok := refs.suppliers[supplierID]
+	if !ok {
+		supplier = &Supplier{}
+		err := supplierCollection.FindOne(ctx, bson.M{"_id": supplierID}).Decode(supplier)
+		if err == mongo.ErrNoDocuments {
+			supplier = nil
+		} else if err != nil {
+			return nil, err
+		}
+		refs.suppliers[supplierID] = supplier
+	}
+	return supplier, nil
+}
+
+// Налог НДС позиции или документа
+func vatTax(amount Money, rate string) cmlTax {
+	return cmlTax{Name: "НДС", InAmount: true, Amount: amount.StringFixed(), Rate: rate}
+}
+
+// Документ CommerceML по накладной.
+// Приходная накладная выгружается как покупка у поставщика, расходная - как отпуск получателю.
+func invoiceDocument(ctx context.Context, invoice Invoice, refs *cmlDocumentReferences) (cmlDocument, error) {
+	if err := refs.itemIDs(ctx, invoice); err != nil {
+		return cmlDocument{}, err
+	}
+
+	currency := invoice.Currency
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	document := cmlDocument{
+		ID:        invoice.ID.Hex(),
+		Number:    invoice.Number,
+		Date:      cmlDate(invoice.Date),
+		Operation: "Отпуск товара",
+		Currency:  currency,
+		Rate:      "1",
+		Amount:    invoice.TotalAmount.StringFixed(),
+		Time:      cmlTime(invoice.Date),
+		Comment:   invoice.Notes,
+		Requisites: &cmlRequisites{Items: []cmlRequisite{
+			{Name: "Вид накладной", Value: invoiceTypeTitles[invoice.Type]},
+			{Name: "Цены включают НДС", Value: strconv.FormatBool(invoice.VatIncluded)},
+		}},
+	}
+
+	if invoice.Type == InvoiceTypeReceipt {
+		document.Role = "Покупатель"
+		supplier, err := refs.supplier(ctx, invoice.PurchaseOrderID)
+		if err != nil {
+			return cmlDocument{}, err
+		}
+		if supplier != nil {
+			party := supplierParty(*supplier)
+			party.Role = "Продавец"
+			document.Parties = append(document.Parties, party)
+		} else {
+			document.Parties = append(document.Parties, personParty(invoice.IssuedBy, "Продавец"))
+		}
+	} else {
+		document.Role = "Продавец"
+		document.Parties = append(document.Parties, personParty(invoice.ReceivedBy, "Покупатель"))
+	}
+
+	hasVat := false
+	for _, line := range invoice.Items {
+		documentLine := cmlDocumentLine{
+			ID:       refs.items[line.ItemID],
+			Article:  line.SerialNumber,
+			Name:     line.Name,
+			BaseUnit: cmlUnitFor(refs.units, line.Unit),
+			Price:    line.Price.StringFixed(),
+			Quantity: cmlQuantity(line.Quantity),
+			Amount:   line.TotalAmount.StringFixed(),
+		}
+		if line.VatRate != nil {
+			hasVat = true
+			rate := strconv.Itoa(*line.VatRate)
+			documentLine.TaxRates = []cmlTaxRate{{Name: "НДС", Rate: rate}}
+			documentLine.Taxes = &cmlTaxes{Items: []cmlTax{vatTax(line.VatAmount, rate)}}
+		} else {
+			documentLine.TaxRates = []cmlTaxRate{{Name: "НДС", Rate: "Без налога"}}
+		}
+		var requisites []cmlRequisite
+		if line.LotNumber != "" {
+			requisites = append(requisites, cmlRequisite{Name: "Партия", Value: line.LotNumber})
+		}
+		if !line.ExpiryDate.IsZero() {
+			requisites = append(requisites, cmlRequisite{Name: "Годен до", Value: line.ExpiryDate.Format("2006-01-02")})
+		}
+		if len(requisites) > 0 {
+			documentLine.Requisites = &cmlRequisites{Items: requisites}
+		}
+		document.Lines = append(document.Lines, documentLine)
+	}
+	if hasVat {
+		document.Taxes = &cmlTaxes{Items: []cmlTax{vatTax(invoice.VatAmount, "")}}
+	}
+	return document, nil
+}
+
+// Выгрузка накладных, сохраненных после последней выгрузки, в CommerceML.
+// Сохраненная накладная считается проведенной и не изменяется, поэтому отбор идет по времени сохранения.
+func exportInvoicesCommerceML(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	since, until, err := exchangeWindow(c, ctx, ExchangeKindDocuments)
+	if err != nil {
+		respondError(c, err, "Failed to read exchange state: ")
+		return
+	}
+
+	filter := exchangeFilter("created_at", since, until)
+	if invoiceType := c.Query("type"); invoiceType != "" {
+		if invoiceType != string(InvoiceTypeReceipt) && invoiceType != string(InvoiceTypeExpense) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice type (receipt or expense)"})
+			return
+		}
+		filter["type"] = invoiceType
+	}
+
+	refs := &cmlDocumentReferences{
+		items:     map[primitive.ObjectID]string{},
+		suppliers: map[primitive.ObjectID]*Supplier{},
+		orders:    map[primitive.ObjectID]primitive.ObjectID{},
+	}
+	if refs.units, err = loadUnits(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch units: " + err.Error()})
+		return
+	}
+
+	cursor, err := invoiceCollection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).SetBatchSize(exportBatchSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoices: " + err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	setExchangeHeaders(c, since, until)
+	encoder, err := startCommerceML(c, "documents")
+	if err != nil {
+		log.Printf("Failed to start documents export: %v", err)
+		return
+	}
+
+	count := 0
+	for cursor.Next(ctx) {
+		var invoice Invoice
+		if err := cursor.Decode(&invoice); err != nil {
+			log.Printf("Failed to decode invoice for export: %v", err)
+			return
+		}
+		document, err := invoiceDocument(ctx, invoice, refs)
+		if err != nil {
+			log.Printf("Failed to prepare invoice %s for export: %v", invoice.Number, err)
+			return
+		}
+		if err := encoder.Encode(document); err != nil {
+			log.Printf("Failed to write documents export: %v", err)
+			return
+		}
+		count++
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Failed to read invoices for export: %v", err)
+		return
+	}
+	if err := endCommerceML(encoder); err != nil {
+		log.Printf("Failed to finish documents export: %v", err)
+		return
+	}
+	log.Printf("Exported %d invoices to CommerceML", count)
+}
+
+// Разбор файла каталога; кодировка берется из объявления XML (UTF-8 или windows-1251)
+func parseCMLCatalog(data []byte) (*cmlCatalogFile, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		encoding, err := htmlindex.Get(label)
+		if err != nil {
+			return nil, err
+		}
+		return encoding.NewDecoder().Reader(input), nil
+	}
+
+	var file cmlCatalogFile
+	if err := decoder.Decode(&file); err != nil {
+		return nil, &requestError{http.StatusBadRequest, "Invalid CommerceML file: " + err.Error()}
+	}
+	return &file, nil
+}
+
+// Группа классификатора с Ид родительской группы
+type cmlFlatGroup struct {
+	cmlGroup
+	ParentID string
+}
+
+// Группы классификатора в порядке обхода дерева: родитель раньше подгрупп
+func flattenCMLGroups(groups []cmlGroup, parentID string, depth int, out []cmlFlatGroup) []cmlFlatGroup {
+	if depth >= maxCategoryDepth {
+		return out
+	}
+	for _, group := range groups {
+		out = append(out, cmlFlatGroup{cmlGroup: group, ParentID: parentID})
+		out = flattenCMLGroups(group.Groups.list(), group.ID, depth+1, out)
+	}
+	return out
+}
+
+// Состояние загрузки каталога: справочники склада с учетом уже обработанных групп
+type catalogImport struct {
+	dryRun    bool
+	user      string
+	location  string // Местоположение нового оборудования
+	warehouse string // Склад нового оборудования
+	units     unitCatalog
+
+	categories map[string]*Category // Код -> категория
+	created    map[string]bool      // Коды категорий, созданных этой загрузкой
+	groupCodes map[string]string    // Ид группы в 1С -> код категории
+	items      []*WarehouseItem     // Оборудование, с которым сопоставляются товары
+	serials    map[string]primitive.ObjectID
+	seen       map[string]bool // Ид товаров, уже обработанных в файле
+}
+
+// Поиск категории по Ид группы: по сохраненному Ид 1С, затем по коду (выгруженные со склада группы)
+func (ci *catalogImport) findCategory(externalID string) *Category {
+	for _, category := range ci.categories {
+		if category.ExternalID == externalID {
+			return category
+		}
+	}
+	return ci.categories[externalID]
+}
+
+// Загрузка группы классификатора в категорию
+func (ci *catalogImport) importGroup(ctx context.Context, group cmlFlatGroup) CatalogImportEntry {
+	entry := CatalogImportEntry{Kind: "group", ExternalID: strings.TrimSpace(group.ID), Name: strings.TrimSpace(group.Name)}
+	if entry.ExternalID == "" || entry.Name == "" {
+		entry.Action = CatalogImportInvalid
+		entry.Errors = append(entry.Errors, "Group Ид and Наименование are required")
+		return entry
+	}
+
+	var parent *string
+	if group.ParentID != "" {
+		code, ok := ci.groupCodes[group.ParentID]
+		if !ok {
+			entry.Action = CatalogImportInvalid
+			entry.Errors = append(entry.Errors, "Parent group '"+group.ParentID+"' was not imported")
+			return entry
+		}
+		parent = &code
+	}
+
+	current := ci.findCategory(entry.ExternalID)
+	if current == nil {
+		category := &Category{
+			ID:             primitive.NewObjectID(),
+			Code:           entry.ExternalID,
+			Name:           entry.Name,
+			ParentCategory: parent,
+			ExternalID:     entry.ExternalID,
+			IsActive:       true,
+			Version:        1,
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		}
+		entry.Action, entry.Code = CatalogImportCreate, category.Code
+		if !ci.dryRun {
+			if _, err := categoryCollection.InsertOne(ctx, category); err != nil {
+				entry.Action = CatalogImportFailed
+				entry.Errors = append(entry.Errors, "Failed to create category: "+err.Error())
+				return entry
+			}
+			err := recordRevision(ctx, Revision{
+				ResourceType: RevisionResourceCategory,
+				ResourceID:   category.ID,
+				Action:       RevisionActionCreate,
+				ChangedBy:    ci.user,
+			}, nil, category)
+			if err != nil {
+				log.Printf("Warning: failed to record revision for category %s: %v", category.ID.Hex(), err)
+			}
+		}
+		entry.ID = category.ID.Hex()
+		ci.categories[category.Code] = category
+		ci.created[category.Code] = true
+		ci.groupCodes[entry.ExternalID] = category.Code
+		return entry
+	}
+
+	entry.ID, entry.Code = current.ID.Hex(), current.Code
+	ci.groupCodes[entry.ExternalID] = current.Code
+
+	set := bson.M{}
+	if current.Name != entry.Name {
+		set["name"] = entry.Name
+	}
+	if current.ExternalID != entry.ExternalID {
+		set["external_id"] = entry.ExternalID
+	}
+	currentParent := ""
+	if current.ParentCategory != nil {
+		currentParent = *current.ParentCategory
+	}
+	newParent := ""
+	if parent != nil {
+		newParent = *parent
+	}
+	if currentParent != newParent {
+		set["parent_category"] = newParent
+	}
+	if len(set) == 0 {
+		entry.Action = CatalogImportUnchanged
+		return entry
+	}
+	for field := range set {
+		entry.Changes = append(entry.Changes, field)
+	}
+	sort.Strings(entry.Changes)
+	entry.Action = CatalogImportUpdate
+
+	update := bson.M{"$set": set}
+	// Родитель, созданный в этой же загрузке, при пробном запуске еще не сохранен в базе
+	if _, ok := set["parent_category"]; ok && !(ci.dryRun && ci.created[newParent]) {
+		if err := validateCategoryUpdate(ctx, *current, update); err != nil {
+			entry.Action = CatalogImportInvalid
+			entry.Errors = append(entry.Errors, err.Error())
+			return entry
+		}
+	}
+	if ci.dryRun {
+		return entry
+	}
+
+	var updated Category
+	after, err := applyMergeUpdate(ctx, categoryCollection, versionFilter(current.ID, current.Version), update, &updated)
+	if err != nil {
+		entry.Action = CatalogImportFailed
+		entry.Errors = append(entry.Errors, "Failed to update category: "+err.Error())
+		return entry
+	}
+	err = recordRevision(ctx, Revision{
+		ResourceType: RevisionResourceCategory,
+		ResourceID:   current.ID,
+		Action:       RevisionActionUpdate,
+		ChangedBy:    ci.user,
+	}, *current, after)
+	if err != nil {
+		log.Printf("Warning: failed to record revision for category %s: %v", current.ID.Hex(), err)
+	}
+	*current = updated
+	return entry
+}
+
+// Поиск оборудования для товара: по сохраненному Ид 1С, по ID склада (выгруженное со склада),
+// затем по артикулу, совпадающему с серийным номером
+func (ci *catalogImport) findItem(product cmlProduct) *WarehouseItem {
+	id := strings.TrimSpace(product.ID)
+	for _, item := range ci.items {
+		if item.ExternalID == id {
+			return item
+		}
+	}
+	if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+		for _, item := range ci.items {
+			if item.ID == objectID {
+				return item
+			}
+		}
+	}
+	if article := strings.TrimSpace(product.Article); article != "" {
+		for _, item := range ci.items {
+			if item.SerialNumber == article && item.ExternalID == "" {
+				return item
+			}
+		}
+	}
+	return nil
+}
+
+// Загрузка товара каталога в карточку оборудования.
+// 1С ведет наименование, описание, производителя и группу; пустые значения из 1С не стирают данные склада.
+// Остатки, цены и единицы измерения существующего оборудования не меняются.
+func (ci *catalogImport) importProduct(ctx context.Context, product cmlProduct) CatalogImportEntry {
+	entry := CatalogImportEntry{Kind: "item", ExternalID: strings.TrimSpace(product.ID), Name: strings.TrimSpace(product.Name)}
+	fail := func(message string) {
+		entry.Errors = append(entry.Errors, message)
+	}
+	if entry.ExternalID == "" || entry.Name == "" {
+		entry.Action = CatalogImportInvalid
+		fail("Product Ид and Наименование are required")
+		return entry
+	}
+	if ci.seen[entry.ExternalID] {
+		entry.Action = CatalogImportInvalid
+		fail("Duplicate product Ид in file")
+		return entry
+	}
+	ci.seen[entry.ExternalID] = true
+
+	current := ci.findItem(product)
+	if current != nil {
+		entry.ID = current.ID.Hex()
+	}
+	if product.Status == "Удален" || product.DeletionMark {
+		entry.Action = CatalogImportSkipped
+		if current != nil && !current.Archived {
+			entry.Warnings = append(entry.Warnings, "Product is marked for deletion in 1C; archive the item manually if it is no longer used")
+		}
+		return entry
+	}
+
+	// Группа товара
+	category := ""
+	groupIDs := product.GroupIDs.list()
+	if len(groupIDs) > 0 {
+		groupID := strings.TrimSpace(groupIDs[0])
+		code, ok := ci.groupCodes[groupID]
+		if !ok {
+			if found := ci.findCategory(groupID); found != nil {
+				code, ok = found.Code, true
+			}
+		}
+		if !ok {
+			fail("Group '" + groupID + "' not found")
+		} else if !ci.categories[code].IsActive {
+			fail("Category '" + code + "' is inactive")
+		} else {
+			category = code
+		}
+	}
+
+	// Базовая единица
+	unit := ""
+	if product.BaseUnit != (cmlUnit{}) {
+		code, ok := resolveCMLUnit(ci.units, product.BaseUnit)
+		if ok {
+			unit = code
+		} else if current == nil {
+			fail("Unknown base unit '" + strings.TrimSpace(product.BaseUnit.Name) + "'")
+		} else {
+			entry.Warnings = append(entry.Warnings, "Unknown base unit '"+strings.TrimSpace(product.BaseUnit.Name)+"' is ignored")
+		}
+	}
+
+	manufacturer := ""
+	if product.Manufacturer != nil {
+		manufacturer = strings.TrimSpace(product.Manufacturer.Name)
+	}
+	description := strings.TrimSpace(product.Description)
+	serial := strings.TrimSpace(product.Article)
+
+	if current == nil {
+		if serial == "" {
+			serial = entry.ExternalID
+		}
+		if len(groupIDs) == 0 {
+			fail("Group is required for a new item")
+		}
+		if ci.location == "" {
+			fail("Location is required for new items (parameter 'location')")
+		}
+		if _, ok := ci.serials[serial]; ok {
+			fail("Item with serial number '" + serial + "' already exists")
+		}
+		if len(entry.Errors) > 0 {
+			entry.Action = CatalogImportInvalid
+			return entry
+		}
+
+		item := newWarehouseItem(WarehouseItemRequest{
+			Name:         entry.Name,
+			SerialNumber: serial,
+			Category:     category,
+			Description:  description,
+			Manufacturer: manufacturer,
+			Unit:         unit,
+			Location:     ci.location,
+			Warehouse:    ci.warehouse,
+		}, defaultCurrency, primitive.NilObjectID)
+		item.ExternalID = entry.ExternalID
+		entry.Action, entry.ID = CatalogImportCreate, item.ID.Hex()
+
+		if !ci.dryRun {
+			if _, err := warehouseCollection.InsertOne(ctx, item); err != nil {
+				entry.Action = CatalogImportFailed
+				fail("Failed to create item: " + err.Error())
+				return entry
+			}
+			err := recordRevision(ctx, Revision{
+				ResourceType: RevisionResourceItem,
+				ResourceID:   item.ID,
+				Action:       RevisionActionCreate,
+				ChangedBy:    ci.user,
+			}, nil, item)
+			if err != nil {
+				log.Printf("Warning: failed to record revision for item %s: %v", item.ID.Hex(), err)
+			}
+			if err := publishEquipmentCreated(item); err != nil {
+				log.Printf("Warning: Failed to publish message to RabbitMQ: %v", err)
+			}
+		}
+		ci.items = append(ci.items, &item)
+		ci.serials[item.SerialNumber] = item.ID
+		return entry
+	}
+
+	if len(entry.Errors) > 0 {
+		entry.Action = CatalogImportInvalid
+		return entry
+	}
+
+	set := bson.M{}
+	for _, field := range []struct {
+		name           string
+		current, value string
+	}{
+		{"name", current.Name, entry.Name},
+		{"description", current.Description, description},
+		{"manufacturer", current.Manufacturer, manufacturer},
+		{"category", current.Category, category},
+		{"serial_number", current.SerialNumber, serial},
+		{"external_id", current.ExternalID, entry.ExternalID},
+	} {
+		if field.value != "" && field.value != field.current {
+			set[field.name] = field.value
+			entry.Changes = append(entry.Changes, field.name)
+		}
+	}
+	if owner, ok := ci.serials[serial]; ok && set["serial_number"] != nil && owner != current.ID {
+		entry.Action = CatalogImportInvalid
+		fail("Item with serial number '" + serial + "' already exists")
+		return entry
+	}
+	if unit != "" && unit != itemUnit(*current) {
+		entry.Warnings = append(entry.Warnings, "Base unit differs from 1C ("+unit+"); change it with PUT /items/"+entry.ID+"/units")
+	}
+	if len(set) == 0 {
+		entry.Action = CatalogImportUnchanged
+		return entry
+	}
+	entry.Action = CatalogImportUpdate
+	if ci.dryRun {
+		return entry
+	}
+
+	var updated WarehouseItem
+	after, err := applyMergeUpdate(ctx, warehouseCollection, versionFilter(current.ID, current.Version), bson.M{"$set": set}, &updated)
+	if err != nil {
+		entry.Action = CatalogImportFailed
+		fail("Failed to update item: " + err.Error())
+		return entry
+	}
+	err = recordRevision(ctx, Revision{
+		ResourceType: RevisionResourceItem,
+		ResourceID:   current.ID,
+		Action:       RevisionActionUpdate,
+		ChangedBy:    ci.user,
+	}, *current, after)
+	if err != nil {
+		log.Printf("Warning: failed to record revision for item %s: %v", current.ID.Hex(), err)
+	}
+	delete(ci.serials, current.SerialNumber)
+	ci.serials[updated.SerialNumber] = updated.ID
+	*current = updated
+	return entry
+}
+
+// Загрузка справочников склада для сопоставления с каталогом 1С
+func newCatalogImport(ctx context.Context, file *cmlCatalogFile, dryRun bool) (*catalogImport, error) {
+	ci := &catalogImport{
+		dryRun:     dryRun,
+		categories: map[string]*Category{},
+		created:    map[string]bool{},
+		groupCodes: map[string]string{},
+		serials:    map[string]primitive.ObjectID{},
+		seen:       map[string]bool{},
+	}
+
+	categories, err := loadAll[Category](ctx, categoryCollection, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range categories {
+		ci.categories[categories[i].Code] = &categories[i]
+	}
+	if ci.units, err = loadUnits(ctx); err != nil {
+		return nil, err
+	}
+
+	// Оборудование, которое может соответствовать товарам файла
+	var externalIDs, serials []string
+	var ids []primitive.ObjectID
+	for _, product := range file.Catalog.Products {
+		id := strings.TrimSpace(product.ID)
+		externalIDs = append(externalIDs, id)
+		serials = append(serials, id)
+		if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+			ids = append(ids, objectID)
+		}
+		if article := strings.TrimSpace(product.Article); article != "" {
+			serials = append(serials, article)
+		}
+	}
+	items, err := loadAll[WarehouseItem](ctx, warehouseCollection, bson.M{"$or": bson.A{
+		bson.M{"external_id": bson.M{"$in": externalIDs}},
+		bson.M{"_id": bson.M{"$in": ids}},
+		bson.M{"serial_number": bson.M{"$in": serials}},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		ci.items = append(ci.items, &items[i])
+		ci.serials[items[i].SerialNumber] = items[i].ID
+	}
+	return ci, nil
+}
+
+// Выполнение загрузки каталога: сначала группы, затем товары
+func (ci *catalogImport) run(ctx context.Context, file *cmlCatalogFile) []CatalogImportEntry {
+	groups := flattenCMLGroups(file.Classifier.Groups, "", 0, nil)
+	entries := make([]CatalogImportEntry, 0, len(groups)+len(file.Catalog.Products))
+	for _, group := range groups {
+		entries = append(entries, ci.importGroup(ctx, group))
+	}
+	for _, product := range file.Catalog.Products {
+		entries = append(entries, ci.importProduct(ctx, product))
+	}
+	return entries
+}
+
+// Количество групп и товаров по действиям
+func catalogImportSummary(entries []CatalogImportEntry) gin.H {
+	groups, items := map[string]int{}, map[string]int{}
+	for _, entry := range entries {
+		if entry.Kind == "group" {
+			groups[entry.Action]++
+		} else {
+			items[entry.Action]++
+		}
+	}
+	return gin.H{"groups": groups, "items": items}
+}
+
+// Параметр загрузки из формы или строки запроса (1С передает файл телом запроса)
+func exchangeParam(c *gin.Context, key, defaultValue string) string {
+	if value, ok := c.GetPostForm(key); ok {
+		return value
+	}
+	return c.DefaultQuery(key, defaultValue)
+}
+
+// Загрузка каталога из 1С (import.xml): группы классификатора становятся категориями,
+// товары - карточками оборудования. Файл передается полем file или телом запроса.
+// По умолчанию выполняется пробный запуск (dry_run=true). Если в файле есть ошибки,
+// загрузка отклоняется, пока не указан skip_invalid=true.
+func importCatalogCommerceML(c *gin.Context) {
+	var data []byte
+	if fileHeader, err := c.FormFile("file"); err == nil {
+		if fileHeader.Size > maxImportFileSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large (max 10 MB)"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to open file: " + err.Error()})
+			return
+		}
+		data, err = io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file: " + err.Error()})
+			return
+		}
+	} else {
+		data, err = io.ReadAll(io.LimitReader(c.Request.Body, maxImportFileSize+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body: " + err.Error()})
+			return
+		}
+		if len(data) > maxImportFileSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large (max 10 MB)"})
+			return
+		}
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CommerceML file is required (multipart field 'file' or request body)"})
+		return
+	}
+
+	dryRun := exchangeParam(c, "dry_run", "true") != "false"
+	skipInvalid := exchangeParam(c, "skip_invalid", "") == "true"
+	location := strings.TrimSpace(exchangeParam(c, "location", ""))
+	warehouse := strings.TrimSpace(exchangeParam(c, "warehouse", ""))
+
+	file, err := parseCMLCatalog(data)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+	if len(file.Classifier.Groups) == 0 && len(file.Catalog.Products) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File contains no groups or products"})
+		return
+	}
+	if len(file.Catalog.Products) > maxImportRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many products (max " + strconv.Itoa(maxImportRows) + ")"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if warehouse != "" {
+		if err := validateItemWarehouse(ctx, warehouse); err != nil {
+			respondError(c, err, "Failed to validate warehouse: ")
+			return
+		}
+	}
+
+	// Проверка всего файла без сохранения
+	ci, err := newCatalogImport(ctx, file, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load reference data: " + err.Error()})
+		return
+	}
+	ci.location, ci.warehouse = location, warehouse
+	entries := ci.run(ctx, file)
+
+	invalid := 0
+	for _, entry := range entries {
+		if entry.Action == CatalogImportInvalid {
+			invalid++
+		}
+	}
+	summary := catalogImportSummary(entries)
+	summary["dry_run"] = dryRun
+	summary["entries"] = entries
+	if dryRun {
+		c.JSON(http.StatusOK, summary)
+		return
+	}
+	if invalid > 0 && !skipInvalid {
+		summary["error"] = "File contains invalid groups or products; fix them or set skip_invalid=true"
+		c.JSON(http.StatusUnprocessableEntity, summary)
+		return
+	}
+
+	// Сохранение; недопустимые группы и товары пропускаются
+	if ci, err = newCatalogImport(ctx, file, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load reference data: " + err.Error()})
+		return
+	}
+	ci.location, ci.warehouse, ci.user = location, warehouse, requestUser(c)
+	entries = ci.run(ctx, file)
+	for i := range entries {
+		if entries[i].Action == CatalogImportInvalid {
+			entries[i].Action = CatalogImportSkipped
+		}
+	}
+
+	summary = catalogImportSummary(entries)
+	summary["dry_run"] = false
+	summary["entries"] = entries
+	c.JSON(http.StatusOK, summary)
+}
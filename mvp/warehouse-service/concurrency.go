@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Значение If-Match "*" - подходит любая версия документа
+const anyVersion int64 = -1
+
+// Формирование ETag из версии документа
+func formatETag(version int64) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// Установка заголовка ETag для ответа с документом
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", formatETag(version))
+}
+
+// Разбор обязательного заголовка If-Match.
+// Поддерживаются сильные и слабые теги ("3", W/"3") и "*".
+func parseIfMatch(c *gin.Context) (int64, error) {
+	value := strings.TrimSpace(c.GetHeader("If-Match"))
+	if value == "" {
+		return 0, &requestError{http.StatusPreconditionRequired, "If-Match header is required"}
+	}
+	if value == "*" {
+		return anyVersion, nil
+	}
+
+	tag := strings.TrimPrefix(value, "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, &requestError{http.StatusBadRequest, "Invalid If-Match header"}
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 0 {
+		return 0, &requestError{http.StatusBadRequest, "Invalid If-Match header"}
+	}
+	return version, nil
+}
+
+// Проверка версии документа против значения If-Match
+func versionMatches(current, expected int64) bool {
+	return expected == anyVersion || current == expected
+}
+
+// Фильтр документа по ID с учетом ожидаемой версии
+func versionFilter(id primitive.ObjectID, version int64) bson.M {
+	filter := bson.M{"_id": id}
+	if version != anyVersion {
+		filter["version"] = version
+	}
+	return filter
+}
+
+// Ответ 412, когда документ изменен другим пользователем
+func respondPreconditionFailed(c *gin.Context, current int64) {
+	setETag(c, current)
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":           "Resource was modified by another request",
+		"current_version": current,
+	})
+}
+
+// Ответ, когда обновление по versionFilter не нашло документ:
+// 404, если документа нет, или 412, если не совпала версия
+func respondVersionConflict(c *gin.Context, ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, notFound string) {
+	var current struct {
+		Version int64 `bson:"version"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"version": 1})
+	err := collection.FindOne(ctx, bson.M{"_id": id}, opts).Decode(&current)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check document version: " + err.Error()})
+		}
+		return
+	}
+	respondPreconditionFailed(c, current.Version)
+}
+
+// Версия документа из bson.Raw
+func rawVersion(doc bson.Raw) int64 {
+	value := doc.Lookup("version")
+	if version, ok := value.Int64OK(); ok {
+		return version
+	}
+	if version, ok := value.Int32OK(); ok {
+		return int64(version)
+	}
+	return 0
+}
+
+// Загрузка документа перед изменением с проверкой If-Match.
+// Декодирует документ в doc и возвращает исходное состояние для истории изменений;
+// при ошибке сам отправляет ответ (404, 412 или 500).
+func loadForUpdate(c *gin.Context, ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, version int64, notFound string, doc interface{}) (bson.Raw, bool) {
+	raw, err := collection.FindOne(ctx, bson.M{"_id": id}).Raw()
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch document: " + err.Error()})
+		}
+		return nil, false
+	}
+
+	if current := rawVersion(raw); !versionMatches(current, version) {
+		respondPreconditionFailed(c, current)
+		return nil, false
+	}
+
+	if err := bson.Unmarshal(raw, doc); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode document: " + err.Error()})
+		return nil, false
+	}
+	return raw, true
+}
@@ -0,0 +1,603 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Методы оценки запасов
+const (
+	CostingMethodFIFO    = "fifo"    // Списание по стоимости первых поступлений
+	CostingMethodAverage = "average" // Списание по средней стоимости остатка
+)
+
+// Источники стоимости слоя
+const (
+	CostSourceInvoice       = "invoice"        // Цена из приходной накладной
+	CostSourcePurchaseOrder = "purchase_order" // Цена из заказа поставщику
+	CostSourceItemPrice     = "item_price"     // Цена из карточки оборудования на момент прихода
+	CostSourceOpening       = "opening"        // Начальный остаток без транзакций прихода
+	CostSourceReturn        = "return"         // Возврат по стоимости выдачи
+)
+
+// Метод оценки запасов задается в конфигурации сервиса и одинаков для всех отчетов
+var costingMethod = CostingMethodFIFO
+
+// Чтение метода оценки из INVENTORY_COSTING_METHOD при запуске сервиса
+func initCostingMethod() error {
+	switch method := strings.ToLower(os.Getenv("INVENTORY_COSTING_METHOD")); method {
+	case "":
+	case CostingMethodFIFO, CostingMethodAverage:
+		costingMethod = method
+	default:
+		return fmt.Errorf("unknown INVENTORY_COSTING_METHOD %q (expected fifo or average)", method)
+	}
+	log.Printf("Inventory is valued using %s costing", costingMethod)
+	return nil
+}
+
+// Знак влияния транзакции на остаток
+func transactionSign(transactionType string) float64 {
+	switch transactionType {
+	case "intake", "return":
+		return 1
+	case "issue", "adjustment", TransactionTypeWriteOff, TransactionTypeSupplierReturn:
+		return -1
+	}
+	return 0
+}
+
+// Типы транзакций, уменьшающих остаток
+var issueTransactionTypes = []string{"issue", "adjustment", TransactionTypeWriteOff, TransactionTypeSupplierReturn}
+
+// costReceipt представляет оцененное поступление
+type costReceipt struct {
+	Quantity float64
+	Amount   Money
+	Currency string
+	Source   string
+}
+
+// Поступление по цене единицы
+func priceReceipt(price Money, currency string, quantity float64, source string) costReceipt {
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	return costReceipt{Quantity: quantity, Amount: price.MulQuantity(quantity).Round(), Currency: currency, Source: source}
+}
+
+// Поступление по цене карточки оборудования на момент прихода
+func itemPriceReceipt(item WarehouseItem, quantity float64) costReceipt {
+	return priceReceipt(item.Price, item.Currency, quantity, CostSourceItemPrice)
+}
+
+// Поступление по позиции заказа поставщику
+func orderLineReceipt(order PurchaseOrder, lineID primitive.ObjectID, quantity float64) (costReceipt, bool) {
+	for _, line := range order.Lines {
+		if line.ID == lineID {
+			return priceReceipt(line.UnitPrice, order.Currency, quantity, CostSourcePurchaseOrder), true
+		}
+	}
+	return costReceipt{}, false
+}
+
+// Поступление по позиции приходной накладной; себестоимость учитывается без НДС
+func invoiceLineReceipt(line InvoiceItem, currency string, quantity float64) (costReceipt, bool) {
+	lineQuantity := line.BaseQuantity
+	if lineQuantity <= 0 {
+		lineQuantity = line.Quantity
+	}
+	if lineQuantity <= 0 || line.NetAmount.IsZero() {
+		return costReceipt{}, false
+	}
+	return costReceipt{
+		Quantity: quantity,
+		Amount:   line.NetAmount.MulRatio(quantity, lineQuantity),
+		Currency: currency,
+		Source:   CostSourceInvoice,
+	}, true
+}
+
+// Стоимость прихода на момент проведения: позиция заказа поставщику, иначе цена карточки
+func intakeReceipt(item WarehouseItem, transaction InventoryTransaction, order *PurchaseOrder) costReceipt {
+	if order != nil {
+		if receipt, ok := orderLineReceipt(*order, transaction.PurchaseOrderLineID, transaction.Quantity); ok {
+			return receipt
+		}
+	}
+	return itemPriceReceipt(item, transaction.Quantity)
+}
+
+// costBook - слои себестоимости одного оборудования при проведении движений
+type costBook struct {
+	item         WarehouseItem
+	layers       []CostLayer // Слои с остатком в порядке поступления
+	created      map[primitive.ObjectID]bool
+	changed      map[primitive.ObjectID]bool
+	lastUnitCost Money // Стоимость последнего движения (для расхода сверх остатка слоев)
+	lastCurrency string
+	lastIssue    []CostAllocation // Последняя выдача (для возвратов при пересчете истории)
+}
+
+func newCostBook(item WarehouseItem) *costBook {
+	currency := item.Currency
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	return &costBook{
+		item:         item,
+		created:      map[primitive.ObjectID]bool{},
+		changed:      map[primitive.ObjectID]bool{},
+		lastUnitCost: item.Price,
+		lastCurrency: currency,
+	}
+}
+
+// Загрузка слоев с остатком для проведения движения
+func loadCostBook(ctx context.Context, item WarehouseItem) (*costBook, error) {
+	book := newCostBook(item)
+	layers, err := loadAll[CostLayer](ctx, costLayerCollection,
+		bson.M{"item_id": item.ID, "remaining": bson.M{"$gt": 0}},
+		options.Find().SetSort(bson.D{{Key: "received_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	book.layers = layers
+
+	last := CostLayer{}
+	if len(layers) > 0 {
+		last = layers[len(layers)-1]
+	} else {
+		err := costLayerCollection.FindOne(ctx, bson.M{"item_id": item.ID},
+			options.FindOne().SetSort(bson.D{{Key: "received_at", Value: -1}, {Key: "_id", Value: -1}})).Decode(&last)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+	}
+	if !last.ID.IsZero() {
+		book.lastUnitCost, book.lastCurrency = last.UnitCost, last.Currency
+	}
+	return book, nil
+}
+
+// Поступление: по каждой оценке создается слой, стоимость записывается в транзакцию
+func (b *costBook) receive(transaction *InventoryTransaction, date time.Time, receipts ...costReceipt) {
+	now := time.Now()
+	for _, receipt := range receipts {
+		if receipt.Quantity <= 0 {
+			continue
+		}
+		layer := CostLayer{
+			ID:             primitive.NewObjectID(),
+			ItemID:         b.item.ID,
+			TransactionID:  transaction.ID,
+			ReceivedAt:     date,
+			Quantity:       receipt.Quantity,
+			Remaining:      receipt.Quantity,
+			UnitCost:       receipt.Amount.DivQuantity(receipt.Quantity),
+			Amount:         receipt.Amount,
+			RemainingValue: receipt.Amount,
+			Currency:       receipt.Currency,
+			Source:         receipt.Source,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		b.layers = append(b.layers, layer)
+		b.created[layer.ID] = true
+		b.lastUnitCost, b.lastCurrency = layer.UnitCost, layer.Currency
+
+		transaction.Costs = append(transaction.Costs, CostAllocation{
+			LayerID:  layer.ID,
+			Quantity: layer.Quantity,
+			UnitCost: layer.UnitCost,
+			Amount:   layer.Amount,
+			Currency: layer.Currency,
+		})
+	}
+}
+
+// Списание части остатка слоя. Последняя часть списывает весь остаток стоимости,
+// поэтому сумма списаний слоя равна его стоимости без ошибок округления.
+func (b *costBook) take(i int, quantity float64) CostAllocation {
+	layer := &b.layers[i]
+	amount := layer.RemainingValue
+	if quantity < layer.Remaining {
+		amount = layer.RemainingValue.MulRatio(quantity, layer.Remaining)
+		layer.Remaining = roundQuantity(layer.Remaining - quantity)
+		layer.RemainingValue = layer.RemainingValue.Sub(amount)
+	} else {
+		quantity = layer.Remaining
+		layer.Remaining = 0
+		layer.RemainingValue = Money{}
+	}
+	b.changed[layer.ID] = true
+	b.lastUnitCost, b.lastCurrency = layer.UnitCost, layer.Currency
+
+	return CostAllocation{
+		LayerID:  layer.ID,
+		Quantity: quantity,
+		UnitCost: amount.DivQuantity(quantity),
+		Amount:   amount,
+		Currency: layer.Currency,
+	}
+}
+
+// Расход: FIFO списывает слои в порядке поступления, средняя стоимость - пропорционально всем слоям
+func (b *costBook) issue(transaction *InventoryTransaction) {
+	left := transaction.Quantity
+	costs := []CostAllocation{}
+
+	if costingMethod == CostingMethodAverage {
+		var total float64
+		for _, layer := range b.layers {
+			total += layer.Remaining
+		}
+		if total > 0 {
+			quantity := min(left, total)
+			for i := range b.layers {
+				if b.layers[i].Remaining <= 0 {
+					continue
+				}
+				taken := min(roundQuantity(quantity*b.layers[i].Remaining/total), b.layers[i].Remaining, left)
+				if taken <= 0 {
+					continue
+				}
+				allocation := b.take(i, taken)
+				costs = append(costs, allocation)
+				left = roundQuantity(left - allocation.Quantity)
+			}
+		}
+	}
+
+	// FIFO; для средней стоимости - остаток после пропорционального округления
+	for i := range b.layers {
+		if left <= 0 {
+			break
+		}
+		if b.layers[i].Remaining <= 0 {
+			continue
+		}
+		allocation := b.take(i, min(left, b.layers[i].Remaining))
+		costs = append(costs, allocation)
+		left = roundQuantity(left - allocation.Quantity)
+	}
+
+	// Расход сверх остатка слоев оценивается по стоимости последнего движения
+	if left > 0 {
+		log.Printf("Warning: item %s has no cost layers for %s units, using last cost", b.item.ID.Hex(), formatQuantity(left))
+		costs = append(costs, CostAllocation{
+			Quantity: left,
+			UnitCost: b.lastUnitCost,
+			Amount:   b.lastUnitCost.MulQuantity(left).Round(),
+			Currency: b.lastCurrency,
+		})
+	}
+
+	transaction.Costs = costs
+	b.lastIssue = costs
+}
+
+// Оценка возврата по стоимости выдачи пропорционально выданному количеству в каждой валюте
+func (b *costBook) returnReceipts(quantity float64, issue []CostAllocation) []costReceipt {
+	type part struct {
+		quantity float64
+		amount   Money
+	}
+	parts := map[string]*part{}
+	currencies := []string{}
+	var total float64
+	for _, allocation := range issue {
+		p, ok := parts[allocation.Currency]
+		if !ok {
+			p = &part{}
+			parts[allocation.Currency] = p
+			currencies = append(currencies, allocation.Currency)
+		}
+		p.quantity += allocation.Quantity
+		p.amount = p.amount.Add(allocation.Amount)
+		total += allocation.Quantity
+	}
+	if total <= 0 {
+		return []costReceipt{priceReceipt(b.lastUnitCost, b.lastCurrency, quantity, CostSourceReturn)}
+	}
+
+	receipts := []costReceipt{}
+	left := quantity
+	for i, currency := range currencies {
+		p := parts[currency]
+		share := roundQuantity(quantity * p.quantity / total)
+		if i == len(currencies)-1 {
+			share = left
+		}
+		left = roundQuantity(left - share)
+		receipts = append(receipts, costReceipt{
+			Quantity: share,
+			Amount:   p.amount.MulRatio(share, p.quantity),
+			Currency: currency,
+			Source:   CostSourceReturn,
+		})
+	}
+	return receipts
+}
+
+// Сохранение новых и измененных слоев
+func (b *costBook) save(ctx context.Context) error {
+	now := time.Now()
+	for _, layer := range b.layers {
+		if b.created[layer.ID] {
+			if _, err := costLayerCollection.InsertOne(ctx, layer); err != nil {
+				return err
+			}
+			continue
+		}
+		if !b.changed[layer.ID] {
+			continue
+		}
+		_, err := costLayerCollection.UpdateOne(ctx, bson.M{"_id": layer.ID}, bson.M{"$set": bson.M{
+			"remaining":       layer.Remaining,
+			"remaining_value": layer.RemainingValue,
+			"updated_at":      now,
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	b.created = map[primitive.ObjectID]bool{}
+	b.changed = map[primitive.ObjectID]bool{}
+	return nil
+}
+
+// Стоимость выдачи, по которой оценивается возврат: выдача сотруднику или последняя выдача оборудования
+func loadReturnIssueCosts(ctx context.Context, transaction InventoryTransaction) ([]CostAllocation, error) {
+	filter := bson.M{"item_id": transaction.ItemID, "transaction_type": "issue", "costs": bson.M{"$exists": true}}
+	if !transaction.CheckoutID.IsZero() {
+		var checkout Checkout
+		err := checkoutCollection.FindOne(ctx, bson.M{"_id": transaction.CheckoutID}).Decode(&checkout)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		if !checkout.IssueTransactionID.IsZero() {
+			filter = bson.M{"_id": checkout.IssueTransactionID}
+		}
+	}
+
+	var issue InventoryTransaction
+	err := transactionCollection.FindOne(ctx, filter,
+		options.FindOne().SetSort(bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}})).Decode(&issue)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	return issue.Costs, nil
+}
+
+// Себестоимость транзакции при проведении: приход создает слой по переданной оценке,
+// возврат - по стоимости выдачи, расход списывает слои по методу оценки.
+// Вызывается до сохранения транзакции в той же транзакции MongoDB, что и изменение остатка.
+func postTransactionCost(ctx context.Context, item WarehouseItem, transaction *InventoryTransaction, receipts ...costReceipt) error {
+	transaction.Costs = nil
+	book, err := loadCostBook(ctx, item)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case transaction.TransactionType == "return":
+		issue, err := loadReturnIssueCosts(ctx, *transaction)
+		if err != nil {
+			return err
+		}
+		book.receive(transaction, transaction.Date, book.returnReceipts(transaction.Quantity, issue)...)
+	case transactionSign(transaction.TransactionType) > 0:
+		if len(receipts) == 0 {
+			receipts = []costReceipt{itemPriceReceipt(item, transaction.Quantity)}
+		}
+		book.receive(transaction, transaction.Date, receipts...)
+	case transactionSign(transaction.TransactionType) < 0:
+		book.issue(transaction)
+	}
+	return book.save(ctx)
+}
+
+// Переоценка остатка слоев по приходной накладной, привязанной к транзакции прихода.
+// Уже списанная часть остается по стоимости на момент списания.
+func revalueInvoiceLayers(ctx context.Context, invoice Invoice) error {
+	if invoice.Type != InvoiceTypeReceipt || invoice.TransactionID.IsZero() {
+		return nil
+	}
+	for _, line := range invoice.Items {
+		if line.ItemID.IsZero() {
+			continue
+		}
+		var layer CostLayer
+		err := costLayerCollection.FindOne(ctx, bson.M{"transaction_id": invoice.TransactionID, "item_id": line.ItemID}).Decode(&layer)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if layer.Currency != invoice.Currency {
+			log.Printf("Warning: invoice %s currency %s differs from cost layer currency %s, layer is not revalued",
+				invoice.ID.Hex(), invoice.Currency, layer.Currency)
+			continue
+		}
+		receipt, ok := invoiceLineReceipt(line, invoice.Currency, layer.Quantity)
+		if !ok {
+			continue
+		}
+
+		remainingValue := receipt.Amount
+		if layer.Remaining < layer.Quantity {
+			remainingValue = receipt.Amount.MulRatio(layer.Remaining, layer.Quantity)
+		}
+		set := bson.M{
+			"unit_cost":       receipt.Amount.DivQuantity(layer.Quantity),
+			"remaining_value": remainingValue,
+			"source":          CostSourceInvoice,
+			"updated_at":      time.Now(),
+		}
+		update := bson.M{"$set": set}
+		if delta := remainingValue.Sub(layer.RemainingValue); !delta.IsZero() {
+			update["$push"] = bson.M{"revaluations": CostRevaluation{Date: time.Now(), InvoiceID: invoice.ID, Amount: delta}}
+		}
+
+		// Остаток слоя не должен измениться между чтением и переоценкой
+		result, err := costLayerCollection.UpdateOne(ctx, bson.M{
+			"_id":             layer.ID,
+			"remaining":       layer.Remaining,
+			"remaining_value": layer.RemainingValue,
+		}, update)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return fmt.Errorf("cost layer %s was modified concurrently", layer.ID.Hex())
+		}
+	}
+	return nil
+}
+
+// Начальное заполнение слоев себестоимости по истории движений.
+// Оборудование без слоев пересчитывается один раз: цены приходов берутся из накладных,
+// заказов поставщикам и карточки, стоимость каждого движения сохраняется в транзакции.
+func migrateCostLayers() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	itemIDs, err := costLayerCollection.Distinct(ctx, "item_id", bson.M{})
+	if err != nil {
+		log.Printf("Warning: failed to load cost layers: %v", err)
+		return
+	}
+	items, err := loadAll[WarehouseItem](ctx, warehouseCollection, bson.M{"_id": bson.M{"$nin": itemIDs}})
+	if err != nil {
+		log.Printf("Warning: failed to load items for cost layers: %v", err)
+		return
+	}
+
+	migrated := 0
+	for _, item := range items {
+		ok, err := migrateItemCostLayers(ctx, item)
+		if err != nil {
+			log.Printf("Warning: failed to build cost layers for item %s: %v", item.ID.Hex(), err)
+			continue
+		}
+		if ok {
+			migrated++
+		}
+	}
+	if migrated > 0 {
+		log.Printf("Built cost layers for %d items", migrated)
+	}
+}
+
+// Пересчет истории движений одного оборудования в слои себестоимости
+func migrateItemCostLayers(ctx context.Context, item WarehouseItem) (bool, error) {
+	transactions, err := loadAll[InventoryTransaction](ctx, transactionCollection,
+		bson.M{"item_id": item.ID},
+		options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return false, err
+	}
+	if len(transactions) == 0 && item.Quantity <= 0 {
+		return false, nil
+	}
+
+	transactionIDs := []primitive.ObjectID{}
+	lineIDs := []primitive.ObjectID{}
+	opening := item.Quantity
+	for _, transaction := range transactions {
+		transactionIDs = append(transactionIDs, transaction.ID)
+		if !transaction.PurchaseOrderLineID.IsZero() {
+			lineIDs = append(lineIDs, transaction.PurchaseOrderLineID)
+		}
+		opening -= transactionSign(transaction.TransactionType) * transaction.Quantity
+	}
+
+	// Цены приходов из накладных и заказов поставщикам
+	invoices, err := loadAll[Invoice](ctx, invoiceCollection, bson.M{
+		"type": InvoiceTypeReceipt,
+		"$or": bson.A{
+			bson.M{"transaction_id": bson.M{"$in": transactionIDs}},
+			bson.M{"transaction_ids": bson.M{"$in": transactionIDs}},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	invoiceLines := map[primitive.ObjectID]costReceipt{}
+	for _, invoice := range invoices {
+		ids := append([]primitive.ObjectID{invoice.TransactionID}, invoice.TransactionIDs...)
+		for _, transaction := range transactions {
+			if !containsObjectID(ids, transaction.ID) {
+				continue
+			}
+			for _, line := range invoice.Items {
+				if line.ItemID != item.ID {
+					continue
+				}
+				if receipt, ok := invoiceLineReceipt(line, invoice.Currency, transaction.Quantity); ok {
+					invoiceLines[transaction.ID] = receipt
+				}
+			}
+		}
+	}
+	orders, err := loadAll[PurchaseOrder](ctx, purchaseOrderCollection, bson.M{"lines._id": bson.M{"$in": lineIDs}})
+	if err != nil {
+		return false, err
+	}
+
+	book := newCostBook(item)
+	if opening = roundQuantity(opening); opening > 0 {
+		book.receive(&InventoryTransaction{}, item.CreatedAt, priceReceipt(item.Price, item.Currency, opening, CostSourceOpening))
+	}
+	for i := range transactions {
+		transaction := &transactions[i]
+		transaction.Costs = nil
+		switch sign := transactionSign(transaction.TransactionType); {
+		case transaction.TransactionType == "return":
+			book.receive(transaction, transaction.Date, book.returnReceipts(transaction.Quantity, book.lastIssue)...)
+		case sign > 0:
+			receipt, ok := invoiceLines[transaction.ID]
+			if !ok {
+				receipt = itemPriceReceipt(item, transaction.Quantity)
+				for _, order := range orders {
+					if r, found := orderLineReceipt(order, transaction.PurchaseOrderLineID, transaction.Quantity); found {
+						receipt = r
+					}
+				}
+			}
+			book.receive(transaction, transaction.Date, receipt)
+		case sign < 0:
+			book.issue(transaction)
+		default:
+			continue
+		}
+		_, err := transactionCollection.UpdateOne(ctx, bson.M{"_id": transaction.ID}, bson.M{"$set": bson.M{"costs": transaction.Costs}})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Все слои сохраняются, включая израсходованные: по ним строится оценка на прошлые даты
+	return true, book.save(ctx)
+}
+
+// Проверка наличия ID в списке
+func containsObjectID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, value := range ids {
+		if value == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func mustMoney(t *testing.T, value string) Money {
+	t.Helper()
+	m, err := ParseMoney(value)
+	if err != nil {
+		t.Fatalf("ParseMoney(%q): %v", value, err)
+	}
+	return m
+}
+
+func TestCostBookIssue(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		receipts []costReceipt
+		issue    float64
+		amounts  []string // Суммы списания по слоям
+		values   []string // Остаток стоимости слоев после списания
+	}{
+		{
+			name:   "fifo takes oldest layer first",
+			method: CostingMethodFIFO,
+			receipts: []costReceipt{
+				{Quantity: 10, Amount: MoneyFromInt(100), Currency: "RUB"},
+				{Quantity: 10, Amount: MoneyFromInt(200), Currency: "RUB"},
+			},
+			issue:   15,
+			amounts: []string{"100", "100"},
+			values:  []string{"0", "100"},
+		},
+		{
+			name:   "fifo partial take rounds to kopecks",
+			method: CostingMethodFIFO,
+			receipts: []costReceipt{
+				{Quantity: 3, Amount: MoneyFromInt(100), Currency: "RUB"},
+			},
+			issue:   1,
+			amounts: []string{"33.33"},
+			values:  []string{"66.67"},
+		},
+		{
+			name:   "last take consumes remaining value",
+			method: CostingMethodFIFO,
+			receipts: []costReceipt{
+				{Quantity: 3, Amount: MoneyFromInt(100), Currency: "RUB"},
+			},
+			issue:   3,
+			amounts: []string{"100"},
+			values:  []string{"0"},
+		},
+		{
+			name:   "average takes all layers proportionally",
+			method: CostingMethodAverage,
+			receipts: []costReceipt{
+				{Quantity: 10, Amount: MoneyFromInt(100), Currency: "RUB"},
+				{Quantity: 30, Amount: MoneyFromInt(600), Currency: "RUB"},
+			},
+			issue:   20,
+			amounts: []string{"50", "300"},
+			values:  []string{"50", "300"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := costingMethod
+			costingMethod = tt.method
+			defer func() { costingMethod = saved }()
+
+			book := newCostBook(WarehouseItem{ID: primitive.NewObjectID()})
+			book.receive(&InventoryTransaction{ID: primitive.NewObjectID()}, time.Now(), tt.receipts...)
+
+			transaction := InventoryTransaction{TransactionType: "issue", Quantity: tt.issue}
+			book.issue(&transaction)
+
+			if len(transaction.Costs) != len(tt.amounts) {
+				t.Fatalf("got %d allocations, want %d: %+v", len(transaction.Costs), len(tt.amounts), transaction.Costs)
+			}
+			var quantity float64
+			for i, allocation := range transaction.Costs {
+				if !allocation.Amount.Equal(mustMoney(t, tt.amounts[i])) {
+					t.Errorf("allocation %d amount = %s, want %s", i, allocation.Amount, tt.amounts[i])
+				}
+				quantity += allocation.Quantity
+			}
+			if roundQuantity(quantity) != tt.issue {
+				t.Errorf("issued quantity = %v, want %v", quantity, tt.issue)
+			}
+			for i, layer := range book.layers {
+				if !layer.RemainingValue.Equal(mustMoney(t, tt.values[i])) {
+					t.Errorf("layer %d remaining value = %s, want %s", i, layer.RemainingValue, tt.values[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCostBookIssueBeyondLayers(t *testing.T) {
+	book := newCostBook(WarehouseItem{ID: primitive.NewObjectID(), Price: MoneyFromInt(7), Currency: "RUB"})
+	book.receive(&InventoryTransaction{ID: primitive.NewObjectID()}, time.Now(),
+		costReceipt{Quantity: 2, Amount: MoneyFromInt(10), Currency: "RUB"})
+
+	transaction := InventoryTransaction{TransactionType: "issue", Quantity: 3}
+	book.issue(&transaction)
+
+	if len(transaction.Costs) != 2 {
+		t.Fatalf("got %d allocations, want 2", len(transaction.Costs))
+	}
+	shortfall := transaction.Costs[1]
+	if !shortfall.LayerID.IsZero() || shortfall.Quantity != 1 || !shortfall.Amount.Equal(MoneyFromInt(5)) {
+		t.Errorf("shortfall = %+v, want 1 unit at last cost 5", shortfall)
+	}
+}
+
+func TestCostBookReturnReceipts(t *testing.T) {
+	tests := []struct {
+		name     string
+		issue    []CostAllocation
+		quantity float64
+		want     []costReceipt
+	}{
+		{
+			name:     "return at issue cost",
+			issue:    []CostAllocation{{Quantity: 4, Amount: MoneyFromInt(100), Currency: "RUB"}},
+			quantity: 1,
+			want:     []costReceipt{{Quantity: 1, Amount: MoneyFromInt(25), Currency: "RUB"}},
+		},
+		{
+			name: "return split by issue currencies",
+			issue: []CostAllocation{
+				{Quantity: 2, Amount: MoneyFromInt(20), Currency: "RUB"},
+				{Quantity: 2, Amount: MoneyFromInt(4), Currency: "USD"},
+			},
+			quantity: 2,
+			want: []costReceipt{
+				{Quantity: 1, Amount: MoneyFromInt(10), Currency: "RUB"},
+				{Quantity: 1, Amount: MoneyFromInt(2), Currency: "USD"},
+			},
+		},
+		{
+			name:     "return without issue uses last cost",
+			quantity: 2,
+			want:     []costReceipt{{Quantity: 2, Amount: MoneyFromInt(6), Currency: "RUB"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := newCostBook(WarehouseItem{Price: MoneyFromInt(3)})
+			got := book.returnReceipts(tt.quantity, tt.issue)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d receipts, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i].Quantity != tt.want[i].Quantity || !got[i].Amount.Equal(tt.want[i].Amount) || got[i].Currency != tt.want[i].Currency {
+					t.Errorf("receipt %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+				if got[i].Source != CostSourceReturn {
+					t.Errorf("receipt %d source = %s, want %s", i, got[i].Source, CostSourceReturn)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// dependency описывает документы, ссылающиеся на деактивируемый ресурс
+type dependency struct {
+	Name       string            // Название в ответе клиенту (items, subcategories)
+	Collection *mongo.Collection // Коллекция зависимых документов
+	Resource   string            // Тип ресурса для истории изменений ("" - без истории)
+	Filter     bson.M            // Фильтр зависимых документов
+	Field      string            // Поле ссылки, которое меняется при переносе ("" - перенос невозможен)
+}
+
+// deactivationSpec описывает деактивацию и повторную активацию ресурса
+type deactivationSpec struct {
+	Resource   string // Тип ресурса для истории изменений ("" - без истории)
+	Label      string // Название ресурса в сообщениях
+	Collection *mongo.Collection
+	NotFound   string
+	// Зависимые документы ресурса
+	Dependencies func(ctx context.Context, doc bson.Raw) ([]dependency, error)
+	// Проверка ресурса из reassign_to и значение ссылки на него
+	ResolveTarget func(ctx context.Context, doc bson.Raw, ref string) (interface{}, error)
+	// Дополнительная проверка перед повторной активацией (может быть nil)
+	CanActivate func(ctx context.Context, doc bson.Raw) error
+}
+
+// Деактивация категории: оборудование и подкатегории переносятся в другую категорию
+func categoryDeactivation() deactivationSpec {
+	return deactivationSpec{
+		Resource:   RevisionResourceCategory,
+		Label:      "Category",
+		Collection: categoryCollection,
+		NotFound:   "Category not found",
+		Dependencies: func(ctx context.Context, doc bson.Raw) ([]dependency, error) {
+			code := doc.Lookup("code").StringValue()
+			return []dependency{
+				{"items", warehouseCollection, RevisionResourceItem, bson.M{"category": code}, "category"},
+				{"subcategories", categoryCollection, RevisionResourceCategory, bson.M{"parent_category": code, "is_active": true}, "parent_category"},
+			}, nil
+		},
+		ResolveTarget: func(ctx context.Context, doc bson.Raw, ref string) (interface{}, error) {
+			code := doc.Lookup("code").StringValue()
+			if err := validateItemCategory(ctx, ref); err != nil {
+				return nil, err
+			}
+			// Перенос в собственное поддерево оставил бы ссылки на неактивную ветку
+			subtree, err := categoryWithDescendants(ctx, code)
+			if err != nil {
+				return nil, err
+			}
+			for _, descendant := range subtree {
+				if descendant == ref {
+					return nil, &requestError{http.StatusBadRequest, "reassign_to must not be the category itself or its subcategory"}
+				}
+			}
+			return ref, nil
+		},
+		CanActivate: func(ctx context.Context, doc bson.Raw) error {
+			parent, ok := doc.Lookup("parent_category").StringValueOK()
+			if !ok || parent == "" {
+				return nil
+			}
+			count, err := categoryCollection.CountDocuments(ctx, bson.M{"code": parent, "is_active": true})
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				return &requestError{http.StatusConflict, "Parent category '" + parent + "' is inactive, activate it first"}
+			}
+			return nil
+		},
+	}
+}
+
+// Деактивация склада: оборудование переносится на другой склад
+func warehouseDeactivation() deactivationSpec {
+	return deactivationSpec{
+		Label:      "Warehouse",
+		Collection: warehouseLocationCollection,
+		NotFound:   "Warehouse not found",
+		Dependencies: func(ctx context.Context, doc bson.Raw) ([]dependency, error) {
+			code := doc.Lookup("code").StringValue()
+			name, _ := doc.Lookup("name").StringValueOK()
+			return []dependency{
+				{"items", warehouseCollection, RevisionResourceItem, warehouseItemsFilter(code, name), "warehouse"},
+			}, nil
+		},
+		ResolveTarget: func(ctx context.Context, doc bson.Raw, ref string) (interface{}, error) {
+			if ref == doc.Lookup("code").StringValue() {
+				return nil, &requestError{http.StatusBadRequest, "reassign_to must be another warehouse"}
+			}
+			if err := validateItemWarehouse(ctx, ref); err != nil {
+				return nil, err
+			}
+			return ref, nil
+		},
+	}
+}
+
+// Оборудование склада. У оборудования, созданного до появления справочника складов,
+// поля warehouse нет, и склад указан только в начале текстового location ("Склад А-1, Стеллаж 2-3").
+func warehouseItemsFilter(code, name string) bson.M {
+	prefixes := []string{regexp.QuoteMeta(code)}
+	if name != "" {
+		prefixes = append(prefixes, regexp.QuoteMeta(name))
+	}
+	return bson.M{"$or": []bson.M{
+		{"warehouse": code},
+		{
+			"warehouse": bson.M{"$in": []interface{}{nil, ""}},
+			"location":  bson.M{"$regex": "^(" + strings.Join(prefixes, "|") + ")(\\s*,|\\s*$)", "$options": "i"},
+		},
+	}}
+}
+
+// Деактивация поставщика: оборудование переходит к другому поставщику
+func supplierDeactivation() deactivationSpec {
+	return deactivationSpec{
+		Resource:   RevisionResourceSupplier,
+		Label:      "Supplier",
+		Collection: supplierCollection,
+		NotFound:   "Supplier not found",
+		Dependencies: func(ctx context.Context, doc bson.Raw) ([]dependency, error) {
+			id := doc.Lookup("_id").ObjectID()
+			return []dependency{
+				{"items", warehouseCollection, RevisionResourceItem, bson.M{"supplier_id": id}, "supplier_id"},
+				// Открытые заказы нужно закрыть: перенос заказа к другому поставщику не имеет смысла
+				{"open_purchase_orders", purchaseOrderCollection, "", bson.M{
+					"supplier_id": id,
+					"status":      bson.M{"$in": openPurchaseOrderStatuses},
+				}, ""},
+			}, nil
+		},
+		ResolveTarget: func(ctx context.Context, doc bson.Raw, ref string) (interface{}, error) {
+			id, err := primitive.ObjectIDFromHex(ref)
+			if err != nil {
+				return nil, &requestError{http.StatusBadRequest, "Invalid reassign_to supplier ID"}
+			}
+			if id == doc.Lookup("_id").ObjectID() {
+				return nil, &requestError{http.StatusBadRequest, "reassign_to must be another supplier"}
+			}
+			if err := validateItemSupplier(ctx, id); err != nil {
+				return nil, err
+			}
+			return id, nil
+		},
+		CanActivate: func(ctx context.Context, doc bson.Raw) error {
+			// Пока поставщик был неактивен, его ИНН мог занять другой поставщик
+			taxID, _ := doc.Lookup("tax_id").StringValueOK()
+			return checkSupplierTaxIDUnique(ctx, taxID, doc.Lookup("_id").ObjectID())
+		},
+	}
+}
+
+// Деактивация ресурса с проверкой зависимостей.
+// Без reassign_to при наличии зависимостей возвращается 409 со списком зависимостей;
+// с reassign_to зависимые документы переносятся в той же транзакции MongoDB.
+func deactivateResource(c *gin.Context, spec deactivationSpec) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + spec.Label + " ID"})
+		return
+	}
+
+	version, err := parseIfMatch(c)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var current struct {
+		IsActive bool  `bson:"is_active"`
+		Version  int64 `bson:"version"`
+	}
+	before, ok := loadForUpdate(c, ctx, spec.Collection, id, version, spec.NotFound, &current)
+	if !ok {
+		return
+	}
+	if !current.IsActive {
+		c.JSON(http.StatusConflict, gin.H{"error": spec.Label + " is already inactive"})
+		return
+	}
+
+	dependencies, err := spec.Dependencies(ctx, before)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check dependencies: " + err.Error()})
+		return
+	}
+
+	counts := gin.H{}
+	var total, blocking int64
+	for _, dep := range dependencies {
+		count, err := dep.Collection.CountDocuments(ctx, dep.Filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check dependencies: " + err.Error()})
+			return
+		}
+		counts[dep.Name] = count
+		total += count
+		if dep.Field == "" {
+			blocking += count
+		}
+	}
+
+	// Зависимости без поля ссылки перенести нельзя
+	if blocking > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":        spec.Label + " has dependent records that cannot be reassigned",
+			"dependencies": counts,
+		})
+		return
+	}
+
+	reassignTo := c.Query("reassign_to")
+	if total > 0 && reassignTo == "" {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":        spec.Label + " has dependent records; pass reassign_to to move them",
+			"dependencies": counts,
+		})
+		return
+	}
+
+	var target interface{}
+	if total > 0 {
+		target, err = spec.ResolveTarget(ctx, before, reassignTo)
+		if err != nil {
+			respondError(c, err, "Failed to validate reassign_to: ")
+			return
+		}
+	}
+
+	user := requestUser(c)
+	session, err := mongoClient.StartSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session: " + err.Error()})
+		return
+	}
+	defer session.EndSession(ctx)
+
+	var updated bson.M
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// Переносим зависимые документы
+		if total > 0 {
+			for _, dep := range dependencies {
+				if _, err := reassignDocuments(sessCtx, dep, target, user); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		// Мягкое удаление - устанавливаем is_active = false
+		after, err := applyMergeUpdate(sessCtx, spec.Collection, versionFilter(id, current.Version), bson.M{
+			"$set": bson.M{"is_active": false},
+		}, &updated)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, &requestError{http.StatusPreconditionFailed, "Resource was modified by another request"}
+			}
+			return nil, err
+		}
+
+		if spec.Resource != "" {
+			err = recordRevision(sessCtx, Revision{
+				ResourceType: spec.Resource,
+				ResourceID:   id,
+				Action:       RevisionActionUpdate,
+				ChangedBy:    user,
+			}, before, after)
+		}
+		return nil, err
+	})
+	if err != nil {
+		respondError(c, err, "Failed to deactivate "+spec.Label+": ")
+		return
+	}
+
+	response := gin.H{"message": spec.Label + " deactivated successfully"}
+	if total > 0 {
+		response["reassigned"] = counts
+		response["reassigned_to"] = reassignTo
+	}
+	setETag(c, current.Version+1)
+	c.JSON(http.StatusOK, response)
+}
+
+// Перенос зависимых документов на другой ресурс.
+// Каждый документ обновляется с проверкой версии и попадает в историю изменений.
+func reassignDocuments(sessCtx mongo.SessionContext, dep dependency, target interface{}, user string) (int64, error) {
+	cursor, err := dep.Collection.Find(sessCtx, dep.Filter)
+	if err != nil {
+		return 0, err
+	}
+	var docs []bson.Raw
+	if err := cursor.All(sessCtx, &docs); err != nil {
+		return 0, err
+	}
+
+	for _, before := range docs {
+		id := before.Lookup("_id").ObjectID()
+		var after bson.M
+		raw, err := applyMergeUpdate(sessCtx, dep.Collection, versionFilter(id, rawVersion(before)), bson.M{
+			"$set": bson.M{dep.Field: target},
+		}, &after)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return 0, &requestError{http.StatusConflict, fmt.Sprintf("Dependent document %s was modified concurrently", id.Hex())}
+			}
+			return 0, err
+		}
+
+		if dep.Resource != "" {
+			err = recordRevision(sessCtx, Revision{
+				ResourceType: dep.Resource,
+				ResourceID:   id,
+				Action:       RevisionActionUpdate,
+				ChangedBy:    user,
+			}, before, raw)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return int64(len(docs)), nil
+}
+
+// Повторная активация ресурса
+func activateResource(c *gin.Context, spec deactivationSpec) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + spec.Label + " ID"})
+		return
+	}
+
+	version, err := parseIfMatch(c)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var current struct {
+		IsActive bool  `bson:"is_active"`
+		Version  int64 `bson:"version"`
+	}
+	before, ok := loadForUpdate(c, ctx, spec.Collection, id, version, spec.NotFound, &current)
+	if !ok {
+		return
+	}
+	if current.IsActive {
+		c.JSON(http.StatusConflict, gin.H{"error": spec.Label + " is already active"})
+		return
+	}
+	if spec.CanActivate != nil {
+		if err := spec.CanActivate(ctx, before); err != nil {
+			respondError(c, err, "Failed to check "+spec.Label+": ")
+			return
+		}
+	}
+
+	// Ресурсы с историей изменений активируются вместе с записью ревизии
+	var updated bson.M
+	update := bson.M{"$set": bson.M{"is_active": true}}
+	var after bson.Raw
+	if spec.Resource != "" {
+		after, err = applyRevisionedUpdate(ctx, spec.Collection, versionFilter(id, current.Version), update, Revision{
+			ResourceType: spec.Resource,
+			ResourceID:   id,
+			Action:       RevisionActionUpdate,
+			ChangedBy:    requestUser(c),
+		}, before, &updated)
+	} else {
+		after, err = applyMergeUpdate(ctx, spec.Collection, versionFilter(id, current.Version), update, &updated)
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			respondVersionConflict(c, ctx, spec.Collection, id, spec.NotFound)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to activate " + spec.Label + ": " + err.Error()})
+		}
+		return
+	}
+
+	setETag(c, rawVersion(after))
+	c.JSON(http.StatusOK, gin.H{"message": spec.Label + " activated successfully"})
+}
+
+// Проверка ссылки оборудования на склад по коду
+func validateItemWarehouse(ctx context.Context, code string) error {
+	var warehouse Warehouse
+	err := warehouseLocationCollection.FindOne(ctx, bson.M{"code": code}).Decode(&warehouse)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &requestError{http.StatusBadRequest, "Warehouse '" + code + "' not found"}
+		}
+		return err
+	}
+	if !warehouse.IsActive {
+		return &requestError{http.StatusBadRequest, "Warehouse '" + code + "' is inactive"}
+	}
+	return nil
+}
+
+// Проверка уникальности кода склада
+func checkWarehouseCodeUnique(ctx context.Context, code string, selfID primitive.ObjectID) error {
+	filter := bson.M{"code": code}
+	if !selfID.IsZero() {
+		filter["_id"] = bson.M{"$ne": selfID}
+	}
+	count, err := warehouseLocationCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return &requestError{http.StatusConflict, "Warehouse with code '" + code + "' already exists"}
+	}
+	return nil
+}
+
+// Проверка изменения склада: новый код уникален, а код склада, на который
+// ссылается оборудование, не меняется, иначе связь с оборудованием потеряется
+func validateWarehouseUpdate(ctx context.Context, current Warehouse, update bson.M) error {
+	set, _ := update["$set"].(bson.M)
+	value, ok := set["code"].(string)
+	if !ok || value == current.Code {
+		return nil
+	}
+	code := strings.TrimSpace(value)
+	if code == "" {
+		return &requestError{http.StatusBadRequest, "Warehouse code is required"}
+	}
+	set["code"] = code
+	if code == current.Code {
+		return nil
+	}
+	if err := checkWarehouseCodeUnique(ctx, code, current.ID); err != nil {
+		return err
+	}
+
+	items, err := warehouseCollection.CountDocuments(ctx, warehouseItemsFilter(current.Code, current.Name))
+	if err != nil {
+		return err
+	}
+	if items > 0 {
+		return &requestError{http.StatusConflict, "Warehouse code cannot be changed while items reference it"}
+	}
+	return nil
+}
+
+// Проверка ссылки оборудования на поставщика
+func validateItemSupplier(ctx context.Context, id primitive.ObjectID) error {
+	var supplier Supplier
+	err := supplierCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&supplier)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &requestError{http.StatusBadRequest, "Supplier '" + id.Hex() + "' not found"}
+		}
+		return err
+	}
+	if !supplier.IsActive {
+		return &requestError{http.StatusBadRequest, "Supplier '" + id.Hex() + "' is inactive"}
+	}
+	return nil
+}
+
+// Проверка измененных ссылок оборудования (категория, склад, поставщик)
+func validateItemReferenceUpdate(ctx context.Context, item WarehouseItem, update bson.M) error {
+	set, _ := update["$set"].(bson.M)
+	if category, ok := set["category"].(string); ok && category != item.Category {
+		if err := validateItemCategory(ctx, category); err != nil {
+			return err
+		}
+	}
+	if warehouse, ok := set["warehouse"].(string); ok && warehouse != item.Warehouse {
+		// Пустой код убирает привязку к складу
+		if warehouse == "" {
+			delete(set, "warehouse")
+			unset, _ := update["$unset"].(bson.M)
+			if unset == nil {
+				unset = bson.M{}
+				update["$unset"] = unset
+			}
+			unset["warehouse"] = ""
+		} else if err := validateItemWarehouse(ctx, warehouse); err != nil {
+			return err
+		}
+	}
+	if supplierID, ok := set["supplier_id"].(primitive.ObjectID); ok && supplierID != item.SupplierID {
+		if err := validateItemSupplier(ctx, supplierID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
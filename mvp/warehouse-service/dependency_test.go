@@ -0,0 +1,34 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestWarehouseItemsFilterLegacyLocation(t *testing.T) {
+	filter := warehouseItemsFilter("A1", "Склад А-1")
+	legacy := filter["$or"].([]bson.M)[1]["location"].(bson.M)
+	pattern := regexp.MustCompile("(?i)" + legacy["$regex"].(string))
+
+	tests := []struct {
+		location string
+		want     bool
+	}{
+		{"Склад А-1, Стеллаж 2-3", true},
+		{"склад а-1", true},
+		{"A1 , полка 4", true},
+		{"Склад А-12, Стеллаж 1-1", false},
+		{"Склад Б-1, Стеллаж 2-4", false},
+		{"Стеллаж 2, Склад А-1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			if got := pattern.MatchString(tt.location); got != tt.want {
+				t.Errorf("match %q = %v, want %v", tt.location, got, tt.want)
+			}
+		})
+	}
+}
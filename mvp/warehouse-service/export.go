@@ -0,0 +1,598 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Параметры выгрузки
+const (
+	exportTimeout   = 10 * time.Minute
+	exportBatchSize = 1000
+	exportFlushRows = 1000    // Сброс CSV клиенту каждые N строк
+	maxXLSXRows     = 1048575 // Ограничение листа Excel без строки заголовков
+)
+
+// Форматы выгрузки
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+)
+
+// exportDate - дата без времени (дата покупки, срок годности)
+type exportDate time.Time
+
+// exportColumn описывает колонку выгрузки
+type exportColumn struct {
+	Title string
+	Width float64 // Ширина колонки в XLSX
+}
+
+// tableWriter - потоковая запись таблицы в CSV или XLSX.
+// Значения ячеек: string, float64, int, Money, time.Time (дата и время), exportDate.
+type tableWriter interface {
+	WriteRow(cells []interface{}) error
+	Close() error
+}
+
+// Русские названия типов транзакций
+var transactionTypeTitles = map[string]string{
+	"intake":                      "Приход",
+	"issue":                       "Выдача",
+	"return":                      "Возврат",
+	"adjustment":                  "Корректировка",
+	TransactionTypeWriteOff:       "Списание",
+	TransactionTypeSupplierReturn: "Возврат поставщику",
+}
+
+// Русские названия типов накладных
+var invoiceTypeTitles = map[InvoiceType]string{
+	InvoiceTypeReceipt: "Приходная",
+	InvoiceTypeExpense: "Расходная",
+}
+
+// Время в часовом поясе сервера
+func exportTime(t time.Time) time.Time {
+	return t.In(time.Local)
+}
+
+// Число с десятичной запятой, как ожидает русская версия Excel
+func formatExportNumber(value float64) string {
+	return strings.Replace(strconv.FormatFloat(value, 'f', -1, 64), ".", ",", 1)
+}
+
+// CSV для Excel: UTF-8 с BOM, разделитель ";", даты ДД.ММ.ГГГГ, десятичная запятая
+type csvTableWriter struct {
+	writer *csv.Writer
+	rows   int
+}
+
+func newCSVTableWriter(w io.Writer, columns []exportColumn) (*csvTableWriter, error) {
+	if _, err := w.Write([]byte("\xef\xbb\xbf")); err != nil {
+		return nil, err
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = ';'
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Title
+	}
+	return &csvTableWriter{writer: writer}, writer.Write(header)
+}
+
+func (t *csvTableWriter) WriteRow(cells []interface{}) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		switch value := cell.(type) {
+		case string:
+			record[i] = escapeCSVFormula(value)
+		case float64:
+			record[i] = formatExportNumber(value)
+		case int:
+			record[i] = strconv.Itoa(value)
+		case Money:
+			record[i] = strings.Replace(value.StringFixed(), ".", ",", 1)
+		case time.Time:
+			if !value.IsZero() {
+				record[i] = exportTime(value).Format("02.01.2006 15:04")
+			}
+		case exportDate:
+			if !time.Time(value).IsZero() {
+				record[i] = time.Time(value).Format("02.01.2006")
+			}
+		case nil:
+		default:
+			record[i] = escapeCSVFormula(fmt.Sprint(value))
+		}
+	}
+	if err := t.writer.Write(record); err != nil {
+		return err
+	}
+
+	t.rows++
+	if t.rows%exportFlushRows == 0 {
+		t.writer.Flush()
+		return t.writer.Error()
+	}
+	return nil
+}
+
+// Текст, который Excel принял бы за формулу (начинается с =, +, -, @, табуляции или перевода строки),
+// выводится с апострофом, чтобы введенные пользователями данные не выполнялись при открытии файла
+func escapeCSVFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (t *csvTableWriter) Close() error {
+	t.writer.Flush()
+	return t.writer.Error()
+}
+
+// XLSX через потоковую запись excelize: строки сбрасываются во временный файл,
+// книга собирается и отправляется клиенту при закрытии
+type xlsxTableWriter struct {
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	output io.Writer
+	row    int
+	styles struct {
+		date, dateTime, money, number int
+	}
+}
+
+func newXLSXTableWriter(w io.Writer, sheet string, columns []exportColumn) (*xlsxTableWriter, error) {
+	file := excelize.NewFile()
+	if err := file.SetSheetName("Sheet1", sheet); err != nil {
+		return nil, err
+	}
+	t := &xlsxTableWriter{file: file, output: w, row: 1}
+
+	var err error
+	styles := []struct {
+		target *int
+		format string
+	}{
+		{&t.styles.date, "dd.mm.yyyy"},
+		{&t.styles.dateTime, "dd.mm.yyyy hh:mm"},
+		{&t.styles.money, "#,##0.00"},
+		{&t.styles.number, "0.######"},
+	}
+	for _, style := range styles {
+		format := style.format
+		if *style.target, err = file.NewStyle(&excelize.Style{CustomNumFmt: &format}); err != nil {
+			return nil, err
+		}
+	}
+	headerStyle, err := file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return nil, err
+	}
+
+	if t.stream, err = file.NewStreamWriter(sheet); err != nil {
+		return nil, err
+	}
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		if err := t.stream.SetColWidth(i+1, i+1, column.Width); err != nil {
+			return nil, err
+		}
+		header[i] = excelize.Cell{StyleID: headerStyle, Value: column.Title}
+	}
+	if err := t.stream.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return nil, err
+	}
+	return t, t.stream.SetRow("A1", header)
+}
+
+func (t *xlsxTableWriter) WriteRow(cells []interface{}) error {
+	if t.row > maxXLSXRows {
+		return fmt.Errorf("XLSX sheet row limit reached (%d rows)", maxXLSXRows)
+	}
+	t.row++
+
+	row := make([]interface{}, len(cells))
+	for i, cell := range cells {
+		switch value := cell.(type) {
+		case float64:
+			row[i] = excelize.Cell{StyleID: t.styles.number, Value: value}
+		case Money:
+			row[i] = excelize.Cell{StyleID: t.styles.money, Value: value.Float64()}
+		case time.Time:
+			// Excel хранит время без часового пояса
+			if !value.IsZero() {
+				local := exportTime(value)
+				row[i] = excelize.Cell{StyleID: t.styles.dateTime, Value: time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), 0, time.UTC)}
+			}
+		case exportDate:
+			if !time.Time(value).IsZero() {
+				row[i] = excelize.Cell{StyleID: t.styles.date, Value: time.Time(value)}
+			}
+		default:
+			row[i] = value
+		}
+	}
+
+	cell, err := excelize.CoordinatesToCellName(1, t.row)
+	if err != nil {
+		return err
+	}
+	return t.stream.SetRow(cell, row)
+}
+
+func (t *xlsxTableWriter) Close() error {
+	defer t.file.Close()
+	if err := t.stream.Flush(); err != nil {
+		return err
+	}
+	_, err := t.file.WriteTo(t.output)
+	return err
+}
+
+// Формат выгрузки из параметра format (по умолчанию CSV)
+func parseExportFormat(c *gin.Context) (string, error) {
+	switch format := strings.ToLower(c.DefaultQuery("format", ExportFormatCSV)); format {
+	case ExportFormatCSV, ExportFormatXLSX:
+		return format, nil
+	}
+	return "", &requestError{http.StatusBadRequest, "Invalid format parameter (csv or xlsx)"}
+}
+
+// Потоковая выгрузка результатов курсора: заголовки ответа отправляются до чтения данных,
+// поэтому ошибка в середине выгрузки только прерывает ответ и пишется в журнал
+func streamExport[T any](c *gin.Context, ctx context.Context, cursor *mongo.Cursor, name, sheet string, columns []exportColumn, row func(T) [][]interface{}) {
+	defer cursor.Close(ctx)
+
+	format, _ := parseExportFormat(c)
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == ExportFormatXLSX {
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	}
+	c.Status(http.StatusOK)
+
+	var writer tableWriter
+	var err error
+	if format == ExportFormatXLSX {
+		writer, err = newXLSXTableWriter(c.Writer, sheet, columns)
+	} else {
+		writer, err = newCSVTableWriter(c.Writer, columns)
+	}
+	if err != nil {
+		log.Printf("Failed to start %s export: %v", name, err)
+		return
+	}
+
+	count := 0
+	for cursor.Next(ctx) {
+		var doc T
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("Failed to decode %s export row: %v", name, err)
+			return
+		}
+		for _, cells := range row(doc) {
+			if err := writer.WriteRow(cells); err != nil {
+				log.Printf("Failed to write %s export row: %v", name, err)
+				return
+			}
+			count++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Failed to read %s for export: %v", name, err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		log.Printf("Failed to finish %s export: %v", name, err)
+		return
+	}
+	log.Printf("Exported %d %s rows (%s)", count, name, format)
+}
+
+// Колонки выгрузки оборудования совпадают с колонками импорта;
+// атрибуты категорий выгружаются в колонки attr.<код>
+func itemExportColumns(attributes []CategoryAttribute) []exportColumn {
+	columns := make([]exportColumn, 0, len(itemColumns)+len(attributes)+3)
+	for _, column := range itemColumns {
+		columns = append(columns, exportColumn{Title: column.Title, Width: 18})
+	}
+	for _, attr := range attributes {
+		columns = append(columns, exportColumn{Title: attributeQueryPrefix + attr.Code, Width: 18})
+	}
+	return append(columns,
+		exportColumn{Title: "Статус", Width: 14},
+		exportColumn{Title: "Создано", Width: 18},
+		exportColumn{Title: "Изменено", Width: 18},
+	)
+}
+
+// Значение атрибута в ячейке: даты и логические значения в том же виде, что и в остальных колонках
+func exportAttributeValue(attr CategoryAttribute, value interface{}) interface{} {
+	switch typed := value.(type) {
+	case int32:
+		return int(typed)
+	case int64:
+		return int(typed)
+	case bool:
+		if typed {
+			return "да"
+		}
+		return "нет"
+	case string:
+		if attr.Type == AttributeTypeDate {
+			if date, err := time.Parse("2006-01-02", typed); err == nil {
+				return exportDate(date)
+			}
+		}
+		return typed
+	}
+	return value
+}
+
+// Выгрузка оборудования с фильтрами поиска
+func exportWarehouseItems(c *gin.Context) {
+	if _, err := parseExportFormat(c); err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	filter, err := buildItemSearchFilter(c, ctx)
+	if err != nil {
+		respondError(c, err, "Failed to build search filter: ")
+		return
+	}
+	sortDoc, err := buildItemSort(c.Query("sort"), false)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	// Колонки атрибутов выгружаемых категорий
+	categories, err := loadCategoriesByCode(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load categories: " + err.Error()})
+		return
+	}
+	attributes := categoryAttributeList(categories, filterCategoryCodes(categories, filter))
+
+	cursor, err := warehouseCollection.Find(ctx, filter, options.Find().SetSort(sortDoc).SetBatchSize(exportBatchSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items: " + err.Error()})
+		return
+	}
+
+	trackLots := func(item WarehouseItem) string {
+		if item.TrackLots {
+			return "да"
+		}
+		return "нет"
+	}
+	supplier := func(item WarehouseItem) string {
+		if item.SupplierID.IsZero() {
+			return ""
+		}
+		return item.SupplierID.Hex()
+	}
+
+	streamExport(c, ctx, cursor, "items", "Оборудование", itemExportColumns(attributes), func(item WarehouseItem) [][]interface{} {
+		cells := []interface{}{
+			item.Name,
+			item.SerialNumber,
+			item.Category,
+			item.Description,
+			item.Manufacturer,
+			item.Price,
+			item.Currency,
+			item.Quantity,
+			item.MinQuantity,
+			itemUnit(item),
+			item.Location,
+			item.Warehouse,
+			supplier(item),
+			exportDate(item.PurchaseDate),
+			exportDate(item.WarrantyExpiry),
+			trackLots(item),
+			"", // Партия и срок годности указываются только при импорте начального остатка
+			nil,
+		}
+		for _, attr := range attributes {
+			cells = append(cells, exportAttributeValue(attr, item.Attributes[attr.Code]))
+		}
+		return [][]interface{}{append(cells, item.Status, item.CreatedAt, item.UpdatedAt)}
+	})
+}
+
+// Транзакция с данными оборудования для выгрузки
+type transactionExportRow struct {
+	InventoryTransaction `bson:",inline"`
+	Item                 struct {
+		Name         string `bson:"name"`
+		SerialNumber string `bson:"serial_number"`
+		Unit         string `bson:"unit"`
+	} `bson:"item"`
+}
+
+// Выгрузка транзакций с фильтрами списка транзакций
+func exportTransactions(c *gin.Context) {
+	if _, err := parseExportFormat(c); err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	// Название и единица оборудования подставляются в базе, чтобы не держать справочник в памяти
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: transactionFilter(c)}},
+		{{Key: "$sort", Value: bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         warehouseCollection.Name(),
+			"localField":   "item_id",
+			"foreignField": "_id",
+			"as":           "item",
+			"pipeline":     bson.A{bson.M{"$project": bson.M{"name": 1, "serial_number": 1, "unit": 1}}},
+		}}},
+		{{Key: "$unwind", Value: bson.M{"path": "$item", "preserveNullAndEmptyArrays": true}}},
+	}
+	cursor, err := transactionCollection.Aggregate(ctx, pipeline, options.Aggregate().SetBatchSize(exportBatchSize).SetAllowDiskUse(true))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions: " + err.Error()})
+		return
+	}
+
+	columns := []exportColumn{
+		{Title: "Дата", Width: 18},
+		{Title: "Операция", Width: 20},
+		{Title: "Наименование", Width: 30},
+		{Title: "Серийный номер", Width: 18},
+		{Title: "Количество", Width: 12},
+		{Title: "Единица измерения", Width: 10},
+		{Title: "Количество в единице ввода", Width: 12},
+		{Title: "Единица ввода", Width: 10},
+		{Title: "Партии", Width: 20},
+		{Title: "Ответственный", Width: 20},
+		{Title: "Получатель", Width: 20},
+		{Title: "Причина", Width: 30},
+		{Title: "Примечание", Width: 30},
+	}
+
+	streamExport(c, ctx, cursor, "transactions", "Операции", columns, func(t transactionExportRow) [][]interface{} {
+		operation := transactionTypeTitles[t.TransactionType]
+		if operation == "" {
+			operation = t.TransactionType
+		}
+		unit := t.Item.Unit
+		if unit == "" {
+			unit = defaultUnit
+		}
+		var unitQuantity interface{}
+		if t.Unit != "" {
+			unitQuantity = t.UnitQuantity
+		}
+		lots := make([]string, len(t.Lots))
+		for i, lot := range t.Lots {
+			lots[i] = lot.Number + " (" + formatExportNumber(lot.Quantity) + ")"
+		}
+
+		return [][]interface{}{{
+			t.Date,
+			operation,
+			t.Item.Name,
+			t.Item.SerialNumber,
+			t.Quantity,
+			unit,
+			unitQuantity,
+			t.Unit,
+			strings.Join(lots, ", "),
+			t.ResponsibleUser,
+			t.DestinationUser,
+			t.Reason,
+			t.Notes,
+		}}
+	})
+}
+
+// Выгрузка накладных: одна строка на позицию, реквизиты накладной повторяются
+func exportInvoices(c *gin.Context) {
+	if _, err := parseExportFormat(c); err != nil {
+		respondError(c, err, "")
+		return
+	}
+	filter, err := invoiceFilter(c)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}}).
+		SetBatchSize(exportBatchSize)
+	cursor, err := invoiceCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении списка накладных: " + err.Error()})
+		return
+	}
+
+	columns := []exportColumn{
+		{Title: "Номер накладной", Width: 16},
+		{Title: "Тип", Width: 12},
+		{Title: "Дата", Width: 12},
+		{Title: "Выдал", Width: 24},
+		{Title: "Получил", Width: 24},
+		{Title: "Валюта", Width: 8},
+		{Title: "Цены с НДС", Width: 10},
+		{Title: "Наименование", Width: 30},
+		{Title: "Серийный номер", Width: 18},
+		{Title: "Количество", Width: 12},
+		{Title: "Единица измерения", Width: 10},
+		{Title: "Партия", Width: 14},
+		{Title: "Годен до", Width: 12},
+		{Title: "Цена", Width: 14},
+		{Title: "Ставка НДС, %", Width: 10},
+		{Title: "Сумма без НДС", Width: 14},
+		{Title: "НДС", Width: 14},
+		{Title: "Сумма с НДС", Width: 14},
+		{Title: "Итого по накладной", Width: 16},
+	}
+
+	streamExport(c, ctx, cursor, "invoices", "Накладные", columns, func(invoice Invoice) [][]interface{} {
+		vatIncluded := "нет"
+		if invoice.VatIncluded {
+			vatIncluded = "да"
+		}
+		rows := make([][]interface{}, 0, len(invoice.Items))
+		for _, line := range invoice.Items {
+			var vatRate interface{}
+			if line.VatRate != nil {
+				vatRate = *line.VatRate
+			}
+			rows = append(rows, []interface{}{
+				invoice.Number,
+				invoiceTypeTitles[invoice.Type],
+				exportDate(exportTime(invoice.Date)),
+				invoice.IssuedBy.FullName,
+				invoice.ReceivedBy.FullName,
+				invoice.Currency,
+				vatIncluded,
+				line.Name,
+				line.SerialNumber,
+				line.Quantity,
+				line.Unit,
+				line.LotNumber,
+				exportDate(line.ExpiryDate),
+				line.Price,
+				vatRate,
+				line.NetAmount,
+				line.VatAmount,
+				line.TotalAmount,
+				invoice.TotalAmount,
+			})
+		}
+		return rows
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCSVTableWriterEscapesFormulas(t *testing.T) {
+	tests := []struct {
+		name string
+		cell interface{}
+		want string
+	}{
+		{"plain text", "Ноутбук", "Ноутбук"},
+		{"formula", "=HYPERLINK(\"http://evil\")", "\"'=HYPERLINK(\"\"http://evil\"\")\""},
+		{"plus", "+79001234567", "'+79001234567"},
+		{"minus", "-2+3", "'-2+3"},
+		{"at", "@SUM(A1)", "'@SUM(A1)"},
+		{"tab", "\t=1", "'\t=1"},
+		{"negative number", -2.5, "-2,5"},
+		{"negative money", MoneyFromInt(-3), "-3,00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := newCSVTableWriter(&buf, []exportColumn{{Title: "Значение"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.WriteRow([]interface{}{tt.cell}); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			if got := lines[len(lines)-1]; got != tt.want {
+				t.Errorf("row = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,695 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Ограничения импорта оборудования
+const (
+	maxImportFileSize      = 10 << 20 // 10 МБ
+	maxImportRows          = 10000
+	defaultImportBatchSize = 500
+	maxImportBatchSize     = 1000
+)
+
+// Статусы строк отчета импорта
+const (
+	ImportRowValid   = "valid"   // Строка прошла проверку (пробный запуск)
+	ImportRowInvalid = "invalid" // Строка содержит ошибки
+	ImportRowCreated = "created" // Оборудование создано
+	ImportRowFailed  = "failed"  // Ошибка сохранения пакета
+	ImportRowSkipped = "skipped" // Строка с ошибками пропущена при импорте
+)
+
+// itemColumn описывает колонку таблицы оборудования для импорта и экспорта
+type itemColumn struct {
+	Field    string // Имя поля в JSON
+	Title    string // Заголовок колонки
+	Required bool
+}
+
+// Колонки таблицы оборудования; заголовок распознается по имени поля или по русскому названию
+var itemColumns = []itemColumn{
+	{Field: "name", Title: "Наименование", Required: true},
+	{Field: "serial_number", Title: "Серийный номер", Required: true},
+	{Field: "category", Title: "Категория", Required: true},
+	{Field: "description", Title: "Описание"},
+	{Field: "manufacturer", Title: "Производитель"},
+	{Field: "price", Title: "Цена"},
+	{Field: "currency", Title: "Валюта"},
+	{Field: "quantity", Title: "Количество", Required: true},
+	{Field: "min_quantity", Title: "Минимальный остаток"},
+	{Field: "unit", Title: "Единица измерения"},
+	{Field: "location", Title: "Местоположение", Required: true},
+	{Field: "warehouse", Title: "Склад"},
+	{Field: "supplier_id", Title: "Поставщик"},
+	{Field: "purchase_date", Title: "Дата покупки"},
+	{Field: "warranty_expiry", Title: "Гарантия до"},
+	{Field: "track_lots", Title: "Учет партий"},
+	{Field: "lot_number", Title: "Партия"},
+	{Field: "expiry_date", Title: "Годен до"},
+}
+
+// ImportFieldError описывает ошибку в поле строки импорта
+type ImportFieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportRowResult представляет результат обработки строки импорта
+type ImportRowResult struct {
+	Row          int                `json:"row"` // Номер строки в файле (заголовок - строка 1)
+	SerialNumber string             `json:"serial_number,omitempty"`
+	Status       string             `json:"status"`            // valid, invalid, created, failed, skipped
+	ItemID       string             `json:"item_id,omitempty"` // Созданное оборудование
+	Errors       []ImportFieldError `json:"errors,omitempty"`
+}
+
+// Проверенная строка импорта, готовая к сохранению
+type importRow struct {
+	result *ImportRowResult
+	item   WarehouseItem
+	lots   *lotMovement
+}
+
+// Справочники для проверки строк импорта, загружаются один раз на файл
+type importReferences struct {
+	categories map[string]bool            // Код категории -> активна
+	attributes map[string]attributeSchema // Код категории -> действующая схема атрибутов
+	warehouses map[string]bool            // Код склада -> активен
+	suppliers  map[primitive.ObjectID]bool
+	serials    map[string]bool // Серийные номера существующего оборудования
+	units      unitCatalog
+}
+
+// Загрузка справочников для проверки строк импорта
+func loadImportReferences(ctx context.Context, serials []string) (*importReferences, error) {
+	refs := &importReferences{
+		categories: map[string]bool{},
+		attributes: map[string]attributeSchema{},
+		warehouses: map[string]bool{},
+		suppliers:  map[primitive.ObjectID]bool{},
+		serials:    map[string]bool{},
+	}
+
+	categories, err := loadAll[Category](ctx, categoryCollection, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	byCode := map[string]Category{}
+	for _, category := range categories {
+		refs.categories[category.Code] = category.IsActive
+		byCode[category.Code] = category
+	}
+	for code := range byCode {
+		refs.attributes[code] = effectiveAttributeSchema(byCode, code)
+	}
+
+	warehouses, err := loadAll[Warehouse](ctx, warehouseLocationCollection, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	for _, warehouse := range warehouses {
+		refs.warehouses[warehouse.Code] = warehouse.IsActive
+	}
+
+	suppliers, err := loadAll[Supplier](ctx, supplierCollection, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	for _, supplier := range suppliers {
+		refs.suppliers[supplier.ID] = supplier.IsActive
+	}
+
+	existing, err := loadAll[WarehouseItem](ctx, warehouseCollection, bson.M{"serial_number": bson.M{"$in": serials}})
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range existing {
+		refs.serials[item.SerialNumber] = true
+	}
+
+	if refs.units, err = loadUnits(ctx); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// Чтение таблицы из CSV или XLSX; первая строка - заголовки
+func readImportTable(data []byte, format, sheet string) ([][]string, error) {
+	switch format {
+	case "xlsx":
+		file, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, &requestError{http.StatusBadRequest, "Failed to read XLSX file: " + err.Error()}
+		}
+		defer file.Close()
+		if sheet == "" {
+			sheet = file.GetSheetName(0)
+		}
+		rows, err := file.GetRows(sheet)
+		if err != nil {
+			return nil, &requestError{http.StatusBadRequest, "Failed to read sheet '" + sheet + "': " + err.Error()}
+		}
+		return rows, nil
+
+	case "csv":
+		// Excel сохраняет CSV в Windows-1251 и с разделителем ";"
+		data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+		if !utf8.Valid(data) {
+			decoded, err := charmap.Windows1251.NewDecoder().Bytes(data)
+			if err != nil {
+				return nil, &requestError{http.StatusBadRequest, "Failed to decode CSV file"}
+			}
+			data = decoded
+		}
+		firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+		reader := csv.NewReader(bytes.NewReader(data))
+		if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+			reader.Comma = ';'
+		}
+		reader.FieldsPerRecord = -1
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, &requestError{http.StatusBadRequest, "Failed to read CSV file: " + err.Error()}
+		}
+		return rows, nil
+	}
+	return nil, &requestError{http.StatusBadRequest, "Unsupported import format (csv or xlsx)"}
+}
+
+// Сопоставление полей оборудования колонкам таблицы.
+// mapping задает заголовок или номер колонки (с 1) для поля; остальные поля ищутся по заголовкам.
+// Колонки attr.<код> содержат значения атрибутов категории.
+func mapImportColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	known := map[string]bool{}
+	for _, column := range itemColumns {
+		known[column.Field] = true
+	}
+
+	byTitle := map[string]int{}
+	columns := map[string]int{}
+	for i, title := range header {
+		title = strings.ToLower(strings.TrimSpace(title))
+		byTitle[title] = i
+		if code, ok := strings.CutPrefix(title, attributeQueryPrefix); ok && attributeCodePattern.MatchString(code) {
+			columns[title] = i
+		}
+	}
+
+	for field, source := range mapping {
+		code, isAttribute := strings.CutPrefix(field, attributeQueryPrefix)
+		if !known[field] && !(isAttribute && attributeCodePattern.MatchString(code)) {
+			return nil, &requestError{http.StatusBadRequest, "Unknown field in mapping: " + field}
+		}
+		if index, ok := byTitle[strings.ToLower(strings.TrimSpace(source))]; ok {
+			columns[field] = index
+			continue
+		}
+		number, err := strconv.Atoi(source)
+		if err != nil || number < 1 || number > len(header) {
+			return nil, &requestError{http.StatusBadRequest, "Column '" + source + "' for field " + field + " not found"}
+		}
+		columns[field] = number - 1
+	}
+
+	for _, column := range itemColumns {
+		if _, ok := columns[column.Field]; ok {
+			continue
+		}
+		for _, title := range []string{column.Field, column.Title} {
+			if index, ok := byTitle[strings.ToLower(title)]; ok {
+				columns[column.Field] = index
+				break
+			}
+		}
+		if _, ok := columns[column.Field]; !ok && column.Required {
+			return nil, &requestError{http.StatusBadRequest, "Required column not found: " + column.Field + " (" + column.Title + ")"}
+		}
+	}
+	return columns, nil
+}
+
+// Разбор числа с запятой или точкой и пробелами между разрядами
+func parseImportNumber(value string) (float64, error) {
+	value = strings.NewReplacer(" ", "", " ", "", ",", ".").Replace(value)
+	return strconv.ParseFloat(value, 64)
+}
+
+// Разбор даты: YYYY-MM-DD, ДД.ММ.ГГГГ или RFC3339
+func parseImportDate(value string) (time.Time, error) {
+	if parsed, err := time.Parse("02.01.2006", value); err == nil {
+		return parsed, nil
+	}
+	return parseDateParam(value)
+}
+
+// Разбор логического значения: true/false, да/нет, 1/0
+func parseImportBool(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "true", "да", "1", "yes", "+":
+		return true, true
+	case "false", "нет", "0", "no", "-", "":
+		return false, true
+	}
+	return false, false
+}
+
+// Разбор и проверка строки импорта. Ошибки собираются по всем полям строки.
+func parseImportRow(values map[string]string, refs *importReferences, seen map[string]int) (WarehouseItem, *lotMovement, []ImportFieldError) {
+	var errs []ImportFieldError
+	fail := func(field, message string) {
+		errs = append(errs, ImportFieldError{Field: field, Message: message})
+	}
+
+	req := WarehouseItemRequest{
+		Name:         values["name"],
+		SerialNumber: values["serial_number"],
+		Category:     values["category"],
+		Description:  values["description"],
+		Manufacturer: values["manufacturer"],
+		Location:     values["location"],
+		Warehouse:    values["warehouse"],
+		LotNumber:    values["lot_number"],
+	}
+	for _, column := range itemColumns {
+		if column.Required && values[column.Field] == "" {
+			fail(column.Field, "Required field is empty")
+		}
+	}
+
+	if value := values["price"]; value != "" {
+		price, err := ParseMoney(strings.NewReplacer(" ", "", " ", "", ",", ".").Replace(value))
+		if err != nil {
+			fail("price", "Invalid number")
+		} else if err := validatePrice(price, "price"); err != nil {
+			fail("price", err.Error())
+		}
+		req.Price = price
+	}
+	currency, err := normalizeCurrency(values["currency"])
+	if err != nil {
+		fail("currency", err.Error())
+	}
+
+	for _, column := range []struct {
+		field  string
+		target *float64
+	}{{"quantity", &req.Quantity}, {"min_quantity", &req.MinQuantity}} {
+		field, target := column.field, column.target
+		if value := values[field]; value != "" {
+			number, err := parseImportNumber(value)
+			if err != nil || number < 0 {
+				fail(field, "Must be a non-negative number")
+				continue
+			}
+			*target = number
+		}
+	}
+
+	for _, column := range []struct {
+		field  string
+		target *time.Time
+	}{{"purchase_date", &req.PurchaseDate}, {"warranty_expiry", &req.WarrantyExpiry}} {
+		field, target := column.field, column.target
+		if value := values[field]; value != "" {
+			date, err := parseImportDate(value)
+			if err != nil {
+				fail(field, "Invalid date (expected YYYY-MM-DD or DD.MM.YYYY)")
+				continue
+			}
+			*target = date
+		}
+	}
+	if value := values["expiry_date"]; value != "" {
+		date, err := parseImportDate(value)
+		if err != nil {
+			fail("expiry_date", "Invalid date (expected YYYY-MM-DD or DD.MM.YYYY)")
+		} else {
+			req.ExpiryDate = &date
+		}
+	}
+	if trackLots, ok := parseImportBool(values["track_lots"]); ok {
+		req.TrackLots = trackLots
+	} else {
+		fail("track_lots", "Expected true/false or да/нет")
+	}
+
+	// Единица указывается кодом (pcs) или обозначением (шт)
+	if value := values["unit"]; value != "" {
+		req.Unit = refs.units.resolve(value)
+	}
+
+	// Ссылки на справочники
+	if req.Category != "" {
+		if active, ok := refs.categories[req.Category]; !ok {
+			fail("category", "Category '"+req.Category+"' not found")
+		} else if !active {
+			fail("category", "Category '"+req.Category+"' is inactive")
+		}
+	}
+	if req.Warehouse != "" {
+		if active, ok := refs.warehouses[req.Warehouse]; !ok {
+			fail("warehouse", "Warehouse '"+req.Warehouse+"' not found")
+		} else if !active {
+			fail("warehouse", "Warehouse '"+req.Warehouse+"' is inactive")
+		}
+	}
+	var supplierID primitive.ObjectID
+	if value := values["supplier_id"]; value != "" {
+		if supplierID, err = primitive.ObjectIDFromHex(value); err != nil {
+			fail("supplier_id", "Invalid supplier ID format")
+		} else if active, ok := refs.suppliers[supplierID]; !ok {
+			fail("supplier_id", "Supplier '"+value+"' not found")
+		} else if !active {
+			fail("supplier_id", "Supplier '"+value+"' is inactive")
+		}
+	}
+
+	// Дубликаты серийных номеров в файле и среди существующего оборудования
+	if req.SerialNumber != "" {
+		if refs.serials[req.SerialNumber] {
+			fail("serial_number", "Item with serial number '"+req.SerialNumber+"' already exists")
+		} else if row, ok := seen[req.SerialNumber]; ok {
+			fail("serial_number", "Duplicate serial number (same as row "+strconv.Itoa(row)+")")
+		}
+	}
+
+	item := newWarehouseItem(req, currency, supplierID)
+	if err := refs.units.validateItemUnits(item.Unit, nil); err != nil {
+		fail("unit", err.Error())
+	} else {
+		if err := refs.units.checkBaseQuantity(item, item.Quantity, "quantity"); err != nil {
+			fail("quantity", err.Error())
+		}
+		if err := refs.units.checkBaseQuantity(item, item.MinQuantity, "min_quantity"); err != nil {
+			fail("min_quantity", err.Error())
+		}
+	}
+	lots, err := initialLotMovement(item, req.LotNumber, req.ExpiryDate)
+	if err != nil {
+		fail("lot_number", err.Error())
+	}
+
+	// Атрибуты проверяются только для существующей категории
+	if schema, ok := refs.attributes[req.Category]; ok {
+		attributes, err := parseImportAttributes(values, schema)
+		if err != nil {
+			fail("attributes", err.Error())
+		}
+		item.Attributes = attributes
+	}
+	return item, lots, errs
+}
+
+// Значения атрибутов из колонок attr.<код> с разбором чисел, дат и логических значений как в остальных колонках
+func parseImportAttributes(values map[string]string, schema attributeSchema) (map[string]interface{}, error) {
+	raw := map[string]interface{}{}
+	for field, text := range values {
+		code, ok := strings.CutPrefix(field, attributeQueryPrefix)
+		if !ok || text == "" {
+			continue
+		}
+		attr, defined := schema[code]
+		if !defined {
+			return nil, &requestError{http.StatusBadRequest, "Attribute '" + code + "' is not defined for the item category"}
+		}
+
+		var value interface{} = text
+		switch attr.Type {
+		case AttributeTypeNumber, AttributeTypeInteger:
+			number, err := parseImportNumber(text)
+			if err != nil {
+				return nil, &requestError{http.StatusBadRequest, "Attribute '" + code + "' must be a number"}
+			}
+			value = number
+		case AttributeTypeBoolean:
+			flag, ok := parseImportBool(text)
+			if !ok {
+				return nil, &requestError{http.StatusBadRequest, "Attribute '" + code + "' expects true/false or да/нет"}
+			}
+			value = flag
+		case AttributeTypeDate:
+			date, err := parseImportDate(text)
+			if err != nil {
+				return nil, &requestError{http.StatusBadRequest, "Attribute '" + code + "' must be a date (YYYY-MM-DD or DD.MM.YYYY)"}
+			}
+			value = date
+		}
+		raw[code] = value
+	}
+	return validateItemAttributes(schema, raw, true)
+}
+
+// Сохранение пакета оборудования в транзакции MongoDB: оборудование, начальные
+// транзакции прихода, партии и ревизии сохраняются вместе или не сохраняются совсем
+func saveImportBatch(ctx context.Context, batch []importRow, user string) error {
+	session, err := mongoClient.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		items := make([]interface{}, 0, len(batch))
+		transactions := make([]interface{}, 0, len(batch))
+		lots := []interface{}{}
+		for _, row := range batch {
+			items = append(items, row.item)
+			// Начальный остаток оценивается по цене карточки
+			transaction := initialIntakeTransaction(row.item, user, row.lots)
+			if err := postTransactionCost(sessCtx, row.item, &transaction); err != nil {
+				return nil, err
+			}
+			transactions = append(transactions, transaction)
+			if row.lots != nil {
+				lots = append(lots, row.lots.NewLot)
+			}
+		}
+
+		if _, err := warehouseCollection.InsertMany(sessCtx, items); err != nil {
+			return nil, err
+		}
+		if _, err := transactionCollection.InsertMany(sessCtx, transactions); err != nil {
+			return nil, err
+		}
+		if len(lots) > 0 {
+			if _, err := lotCollection.InsertMany(sessCtx, lots); err != nil {
+				return nil, err
+			}
+		}
+		for _, row := range batch {
+			err := recordRevision(sessCtx, Revision{
+				ResourceType: RevisionResourceItem,
+				ResourceID:   row.item.ID,
+				Action:       RevisionActionCreate,
+				ChangedBy:    user,
+			}, nil, row.item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// Импорт оборудования из CSV или XLSX.
+// По умолчанию выполняется пробный запуск (dry_run=true): строки проверяются, ничего не сохраняется.
+// При dry_run=false строки сохраняются пакетами; если в файле есть ошибки, импорт отклоняется,
+// пока не указан skip_invalid=true.
+func importWarehouseItems(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required (multipart field 'file')"})
+		return
+	}
+	if fileHeader.Size > maxImportFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large (max 10 MB)"})
+		return
+	}
+
+	format := strings.ToLower(c.PostForm("format"))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileHeader.Filename)), ".")
+	}
+
+	mapping := map[string]string{}
+	if value := c.PostForm("mapping"); value != "" {
+		if err := json.Unmarshal([]byte(value), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object {\"field\": \"column\"}"})
+			return
+		}
+	}
+
+	dryRun := c.DefaultPostForm("dry_run", "true") != "false"
+	skipInvalid := c.PostForm("skip_invalid") == "true"
+	batchSize := defaultImportBatchSize
+	if value := c.PostForm("batch_size"); value != "" {
+		batchSize, err = strconv.Atoi(value)
+		if err != nil || batchSize <= 0 || batchSize > maxImportBatchSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "batch_size must be between 1 and " + strconv.Itoa(maxImportBatchSize)})
+			return
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to open file: " + err.Error()})
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file: " + err.Error()})
+		return
+	}
+
+	table, err := readImportTable(data, format, c.PostForm("sheet"))
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+	if len(table) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File must contain a header row and at least one data row"})
+		return
+	}
+	if len(table)-1 > maxImportRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many rows (max " + strconv.Itoa(maxImportRows) + ")"})
+		return
+	}
+	columns, err := mapImportColumns(table[0], mapping)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	// Значения строк по полям; пустые строки пропускаются
+	type rawRow struct {
+		number int
+		values map[string]string
+	}
+	var rawRows []rawRow
+	var serials []string
+	for i, record := range table[1:] {
+		values := map[string]string{}
+		empty := true
+		for field, index := range columns {
+			if index < len(record) {
+				values[field] = strings.TrimSpace(record[index])
+				empty = empty && values[field] == ""
+			}
+		}
+		if empty {
+			continue
+		}
+		rawRows = append(rawRows, rawRow{number: i + 2, values: values})
+		if serial := values["serial_number"]; serial != "" {
+			serials = append(serials, serial)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	refs, err := loadImportReferences(ctx, serials)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load reference data: " + err.Error()})
+		return
+	}
+
+	// Проверка всех строк
+	results := make([]ImportRowResult, len(rawRows))
+	var valid []importRow
+	seen := map[string]int{}
+	for i, raw := range rawRows {
+		item, lots, errs := parseImportRow(raw.values, refs, seen)
+		results[i] = ImportRowResult{Row: raw.number, SerialNumber: item.SerialNumber, Status: ImportRowValid, Errors: errs}
+		if item.SerialNumber != "" {
+			if _, ok := seen[item.SerialNumber]; !ok {
+				seen[item.SerialNumber] = raw.number
+			}
+		}
+		if len(errs) > 0 {
+			results[i].Status = ImportRowInvalid
+			continue
+		}
+		valid = append(valid, importRow{result: &results[i], item: item, lots: lots})
+	}
+	invalid := len(rawRows) - len(valid)
+
+	summary := gin.H{
+		"dry_run":      dryRun,
+		"total_rows":   len(rawRows),
+		"valid_rows":   len(valid),
+		"invalid_rows": invalid,
+		"rows":         results,
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, summary)
+		return
+	}
+	if invalid > 0 && !skipInvalid {
+		summary["error"] = "File contains invalid rows; fix them or set skip_invalid=true"
+		c.JSON(http.StatusUnprocessableEntity, summary)
+		return
+	}
+
+	// Сохранение пакетами; ошибка пакета не отменяет уже сохраненные пакеты
+	user := requestUser(c)
+	created, failed := 0, 0
+	for start := 0; start < len(valid); start += batchSize {
+		batch := valid[start:min(start+batchSize, len(valid))]
+		if err := saveImportBatch(ctx, batch, user); err != nil {
+			log.Printf("Failed to import batch of %d items: %v", len(batch), err)
+			for _, row := range batch {
+				row.result.Status = ImportRowFailed
+				row.result.Errors = []ImportFieldError{{Message: "Failed to save: " + err.Error()}}
+			}
+			failed += len(batch)
+			continue
+		}
+
+		for _, row := range batch {
+			row.result.Status = ImportRowCreated
+			row.result.ItemID = row.item.ID.Hex()
+			if err := publishEquipmentCreated(row.item); err != nil {
+				log.Printf("Warning: Failed to publish message to RabbitMQ: %v", err)
+			}
+		}
+		created += len(batch)
+	}
+	for i := range results {
+		if results[i].Status == ImportRowInvalid {
+			results[i].Status = ImportRowSkipped
+		}
+	}
+
+	summary["created"] = created
+	summary["failed"] = failed
+	status := http.StatusCreated
+	if created == 0 && failed > 0 {
+		status = http.StatusInternalServerError
+	} else if created == 0 {
+		status = http.StatusOK
+	}
+	c.JSON(status, summary)
+}
@@ -5,25 +5,29 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // InvoiceRequest представляет запрос на создание накладной
 type InvoiceRequest struct {
-	Number        string        `json:"number" binding:"required"`
-	Type          InvoiceType   `json:"type" binding:"required"` // receipt или expense
-	Date          time.Time     `json:"date"`
-	Items         []InvoiceItem `json:"items" binding:"required"`
-	ReceivedBy    PersonInfo    `json:"receivedBy" binding:"required"`
-	IssuedBy      PersonInfo    `json:"issuedBy" binding:"required"`
-	TotalAmount   float64       `json:"totalAmount" binding:"required"`
-	Notes         string        `json:"notes"`
-	TransactionID string        `json:"transactionId"`
+	Number          string        `json:"number" binding:"required"`
+	Type            InvoiceType   `json:"type" binding:"required"` // receipt или expense
+	Date            time.Time     `json:"date"`
+	Items           []InvoiceItem `json:"items" binding:"required"`
+	ReceivedBy      PersonInfo    `json:"receivedBy" binding:"required"`
+	IssuedBy        PersonInfo    `json:"issuedBy" binding:"required"`
+	Currency        string        `json:"currency"`    // По умолчанию RUB
+	VatIncluded     bool          `json:"vatIncluded"` // Цены позиций указаны с НДС
+	TotalAmount     *Money        `json:"totalAmount"` // Если указана, должна совпадать с суммой позиций
+	Notes           string        `json:"notes"`
+	TransactionID   string        `json:"transactionId"`
+	PurchaseOrderID string        `json:"purchaseOrderId"` // Заказ поставщику, по которому принят товар
 }
 
 // Создание новой накладной
@@ -50,10 +54,35 @@ func createInvoice(c *gin.Context) {
 		Items:       req.Items,
 		ReceivedBy:  req.ReceivedBy,
 		IssuedBy:    req.IssuedBy,
-		TotalAmount: req.TotalAmount,
+		VatIncluded: req.VatIncluded,
 		Notes:       req.Notes,
 		CreatedAt:   time.Now(),
 	}
+
+	// Количество позиций может быть указано в любой единице, пересчитываемой в базовую
+	if err := fillInvoiceBaseQuantities(context.Background(), &invoice); err != nil {
+		respondError(c, err, "Не удалось пересчитать количество: ")
+		return
+	}
+
+	// Итоги считаются на сервере по правилам округления
+	currency, err := normalizeCurrency(req.Currency)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+	invoice.Currency = currency
+	if err := calculateInvoiceTotals(&invoice); err != nil {
+		respondError(c, err, "")
+		return
+	}
+	if req.TotalAmount != nil && !req.TotalAmount.Round().Equal(invoice.TotalAmount) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":          "Итоговая сумма накладной не совпадает с суммой позиций",
+			"expectedAmount": invoice.TotalAmount,
+		})
+		return
+	}
 	
 	// Если указан ID транзакции, связываем накладную с ней
 	if req.TransactionID != "" {
@@ -63,14 +92,33 @@ func createInvoice(c *gin.Context) {
 		}
 	}
 
+	// Приходная накладная может ссылаться на заказ поставщику
+	if req.PurchaseOrderID != "" {
+		purchaseOrderID, err := primitive.ObjectIDFromHex(req.PurchaseOrderID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ID заказа поставщику"})
+			return
+		}
+		if err := validateInvoicePurchaseOrder(context.Background(), purchaseOrderID, invoice); err != nil {
+			respondError(c, err, "Не удалось проверить заказ поставщику: ")
+			return
+		}
+		invoice.PurchaseOrderID = purchaseOrderID
+	}
+
 	// Сохраняем накладную в MongoDB
-	_, err := invoiceCollection.InsertOne(context.Background(), invoice)
+	_, err = invoiceCollection.InsertOne(context.Background(), invoice)
 	if err != nil {
 		log.Printf("Error saving invoice: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось сохранить накладную"})
 		return
 	}
 
+	// Остаток прихода переоценивается по цене накладной
+	if err := revalueInvoiceLayers(context.Background(), invoice); err != nil {
+		log.Printf("Warning: failed to revalue cost layers by invoice %s: %v", invoice.ID.Hex(), err)
+	}
+
 	// Отправляем уведомление о создании накладной
 	if err := sendInvoiceNotification(invoice); err != nil {
 		log.Printf("Failed to send invoice notification: %v", err)
@@ -85,43 +133,51 @@ func createInvoice(c *gin.Context) {
 
 // Получение списка накладных
 func listInvoices(c *gin.Context) {
-	// Опции для получения списка накладных
-	findOptions := options.Find()
-	
-	// Обратная сортировка по дате создания
-	findOptions.SetSort(bson.D{{Key: "created_at", Value: -1}})
-	
-	// Лимит результатов (по умолчанию)
-	limit := 50
-	if limitParam := c.Query("limit"); limitParam != "" {
-		// TODO: обработка ошибки парсинга
-		fmt.Sscanf(limitParam, "%d", &limit)
+	// Постраничный вывод: обратная сортировка по дате создания
+	page, err := parsePageQuery(c, "created_at", -1)
+	if err != nil {
+		respondError(c, err, "")
+		return
 	}
-	findOptions.SetLimit(int64(limit))
 
-	// Фильтр по типу, если указан
-	filter := bson.M{}
-	if invoiceType := c.Query("type"); invoiceType != "" {
-		filter["type"] = invoiceType
+	filter, err := invoiceFilter(c)
+	if err != nil {
+		respondError(c, err, "")
+		return
 	}
 
 	// Поиск в БД
 	ctx := context.Background()
-	cursor, err := invoiceCollection.Find(ctx, filter, findOptions)
+	invoices, pagination, err := findPage[Invoice](ctx, invoiceCollection, filter, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении списка накладных"})
 		return
 	}
-	defer cursor.Close(ctx)
 
-	// Результаты
-	var invoices []Invoice
-	if err := cursor.All(ctx, &invoices); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при обработке результатов"})
-		return
-	}
+	c.JSON(http.StatusOK, gin.H{
+		"invoices":   invoices,
+		"pagination": pagination,
+	})
+}
 
-	c.JSON(http.StatusOK, invoices)
+// Фильтр накладных по параметрам запроса: тип, заказ поставщику и период по дате накладной
+func invoiceFilter(c *gin.Context) (bson.M, error) {
+	// Фильтр по типу, если указан
+	filter := bson.M{}
+	if invoiceType := c.Query("type"); invoiceType != "" {
+		filter["type"] = invoiceType
+	}
+	if purchaseOrderID := c.Query("purchase_order_id"); purchaseOrderID != "" {
+		id, err := primitive.ObjectIDFromHex(purchaseOrderID)
+		if err != nil {
+			return nil, &requestError{http.StatusBadRequest, "Некорректный ID заказа поставщику"}
+		}
+		filter["purchase_order_id"] = id
+	}
+	if err := addDateRange(c, filter, "date", "from", "to"); err != nil {
+		return nil, &requestError{http.StatusBadRequest, "Некорректный период (from/to)"}
+	}
+	return filter, nil
 }
 
 // Получение накладной по ID
@@ -147,15 +203,93 @@ func getInvoice(c *gin.Context) {
 	c.JSON(http.StatusOK, invoice)
 }
 
-// Проверка наличия накладной для транзакции
+// Проверка наличия накладной для транзакции (в том числе накладной по сессии сканирования)
 func checkInvoiceExists(ctx context.Context, transactionID primitive.ObjectID) (bool, error) {
-	count, err := invoiceCollection.CountDocuments(ctx, bson.M{"transaction_id": transactionID})
+	count, err := invoiceCollection.CountDocuments(ctx, bson.M{"$or": bson.A{
+		bson.M{"transaction_id": transactionID},
+		bson.M{"transaction_ids": transactionID},
+	}})
 	if err != nil {
 		return false, err
 	}
 	return count > 0, nil
 }
 
+// Пересчет количества позиций накладной в базовые единицы оборудования и проверка партий
+func fillInvoiceBaseQuantities(ctx context.Context, invoice *Invoice) error {
+	units, err := loadUnits(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range invoice.Items {
+		line := &invoice.Items[i]
+		if line.ItemID.IsZero() {
+			if line.Unit != "" {
+				return &requestError{http.StatusBadRequest, fmt.Sprintf("Позиция %d: единица измерения указывается только для оборудования со склада", i+1)}
+			}
+			line.BaseQuantity = line.Quantity
+			continue
+		}
+
+		var item WarehouseItem
+		if err := warehouseCollection.FindOne(ctx, bson.M{"_id": line.ItemID}).Decode(&item); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return &requestError{http.StatusBadRequest, fmt.Sprintf("Позиция %d: оборудование не найдено", i+1)}
+			}
+			return err
+		}
+		if line.BaseQuantity, err = units.toBase(item, line.Quantity, line.Unit); err != nil {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Позиция %d: %s", i+1, err.Error())}
+		}
+		if line.Unit == "" {
+			line.Unit = itemUnit(item)
+		}
+		if err := fillInvoiceLineLot(ctx, invoice.Type, line, item); err != nil {
+			if reqErr, ok := err.(*requestError); ok {
+				reqErr.Message = fmt.Sprintf("Позиция %d: %s", i+1, reqErr.Message)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Проверка партии позиции накладной. Для оборудования с учетом партий партия обязательна;
+// расходная накладная ссылается на существующую партию, срок годности берется из партии.
+func fillInvoiceLineLot(ctx context.Context, invoiceType InvoiceType, line *InvoiceItem, item WarehouseItem) error {
+	line.LotNumber = strings.TrimSpace(line.LotNumber)
+	if !item.TrackLots {
+		if line.LotNumber != "" || !line.ExpiryDate.IsZero() {
+			return &requestError{http.StatusBadRequest, "оборудование не ведет учет партий"}
+		}
+		return nil
+	}
+	if line.LotNumber == "" {
+		return &requestError{http.StatusBadRequest, "укажите номер партии"}
+	}
+	if !line.ExpiryDate.IsZero() {
+		line.ExpiryDate = expiryDay(line.ExpiryDate)
+	}
+
+	lot, err := findLot(ctx, item.ID, line.LotNumber)
+	if err != nil {
+		return err
+	}
+	if lot == nil {
+		// Приходная накладная может быть оформлена до прихода партии
+		if invoiceType == InvoiceTypeExpense {
+			return &requestError{http.StatusBadRequest, "партия " + line.LotNumber + " не найдена"}
+		}
+		return nil
+	}
+	if line.ExpiryDate.IsZero() {
+		line.ExpiryDate = lot.ExpiryDate
+	} else if !line.ExpiryDate.Equal(lot.ExpiryDate) {
+		return &requestError{http.StatusBadRequest, "срок годности не совпадает со сроком партии " + line.LotNumber + formatLotExpiry(lot.ExpiryDate)}
+	}
+	return nil
+}
+
 // Отправка уведомления о создании накладной
 func sendInvoiceNotification(invoice Invoice) error {
 	// Создаем сообщение для уведомления
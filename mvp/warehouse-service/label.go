@@ -0,0 +1,645 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
+	"github.com/gin-gonic/gin"
+	"github.com/jung-kurt/gofpdf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Шрифты с кириллицей для этикеток
+var (
+	//go:embed fonts/DejaVuSansCondensed.ttf
+	labelFontRegular []byte
+	//go:embed fonts/DejaVuSansCondensed-Bold.ttf
+	labelFontBold []byte
+)
+
+// Параметры этикеток (размеры в миллиметрах)
+const (
+	defaultLabelWidth  = 58.0
+	defaultLabelHeight = 40.0
+	minLabelWidth      = 30.0
+	minLabelHeight     = 20.0
+	maxLabelSize       = 150.0
+	defaultLabelDPI    = 300
+	maxLabelDPI        = 1200
+	minBarcodeModule   = 0.15 // Минимальная ширина штриха Code128, которую уверенно читают сканеры
+	maxBatchLabels     = 1000
+	a4Width            = 210.0
+	a4Height           = 297.0
+	pointsPerMM        = 72 / 25.4
+)
+
+// Форматы этикетки
+const (
+	LabelFormatPDF = "pdf"
+	LabelFormatPNG = "png"
+)
+
+// LabelSheetRequest описывает печать этикеток на листах A4.
+// По умолчанию - сетка 3x8 без полей (этикетки 70x37 мм).
+type LabelSheetRequest struct {
+	ItemIDs     []string `json:"item_ids" binding:"required"`
+	Copies      int      `json:"copies"`       // Количество этикеток на оборудование, по умолчанию 1
+	Columns     int      `json:"columns"`      // Колонок на листе
+	Rows        int      `json:"rows"`         // Строк на листе
+	MarginTop   float64  `json:"margin_top"`   // Поле сверху (и снизу), мм
+	MarginLeft  float64  `json:"margin_left"`  // Поле слева (и справа), мм
+	GapX        float64  `json:"gap_x"`        // Расстояние между колонками, мм
+	GapY        float64  `json:"gap_y"`        // Расстояние между строками, мм
+	LabelWidth  float64  `json:"label_width"`  // Ширина этикетки, мм; по умолчанию по сетке
+	LabelHeight float64  `json:"label_height"` // Высота этикетки, мм; по умолчанию по сетке
+	Skip        int      `json:"skip"`         // Пропустить ячейки в начале первого листа (уже использованные этикетки)
+	Border      bool     `json:"border"`       // Рамка вокруг этикетки для резки на обычной бумаге
+}
+
+// Данные этикетки оборудования
+type itemLabel struct {
+	Name     string
+	Serial   string
+	Caption  string // Категория и местоположение
+	QRText   string
+	code128  barcode.Barcode
+	qrMatrix barcode.Barcode
+}
+
+// labelCanvas - поверхность, на которой рисуется этикетка (координаты в мм, размер шрифта в пунктах)
+type labelCanvas interface {
+	Rect(x, y, w, h float64)
+	Text(x, baseline float64, size float64, bold bool, text string)
+	TextWidth(size float64, bold bool, text string) float64
+	Snap(value float64) float64 // Округление до точки устройства, чтобы штрихи были одинаковой ширины
+}
+
+// Адрес сервиса для ссылок в QR-кодах этикеток (LABEL_BASE_URL).
+// Заголовки запроса для этого не используются: Host и X-Forwarded-Proto задает клиент,
+// и напечатанная этикетка вела бы на чужой адрес.
+var labelBaseURL string
+
+// Чтение адреса для этикеток при запуске сервиса; без него печать этикеток недоступна
+func initLabelBaseURL() error {
+	base := strings.TrimRight(os.Getenv("LABEL_BASE_URL"), "/")
+	if base == "" {
+		log.Printf("Warning: LABEL_BASE_URL is not set, item labels are disabled")
+		return nil
+	}
+	parsed, err := url.Parse(base)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid LABEL_BASE_URL %q (expected http(s)://host)", base)
+	}
+	labelBaseURL = base
+	return nil
+}
+
+// Ссылка на оборудование для QR-кода
+func itemLabelURL(id primitive.ObjectID) (string, error) {
+	if labelBaseURL == "" {
+		return "", &requestError{http.StatusServiceUnavailable, "Labels are not configured: set LABEL_BASE_URL"}
+	}
+	return labelBaseURL + "/items/" + id.Hex(), nil
+}
+
+// Подготовка этикетки: кодирование серийного номера и ссылки
+func newItemLabel(item WarehouseItem, url string) (itemLabel, error) {
+	label := itemLabel{Name: item.Name, Serial: item.SerialNumber, QRText: url}
+
+	var caption []string
+	for _, value := range []string{item.Category, item.Location} {
+		if value != "" {
+			caption = append(caption, value)
+		}
+	}
+	label.Caption = strings.Join(caption, " · ")
+
+	var err error
+	if label.code128, err = code128.Encode(item.SerialNumber); err != nil {
+		return label, &requestError{http.StatusUnprocessableEntity, "Serial number '" + item.SerialNumber + "' cannot be encoded in Code128 (ASCII only)"}
+	}
+	if label.qrMatrix, err = qr.Encode(url, qr.M, qr.Auto); err != nil {
+		return label, err
+	}
+	return label, nil
+}
+
+// Черный ли модуль штрихкода
+func barcodeModule(code barcode.Barcode, x, y int) bool {
+	r, _, _, _ := code.At(x, y).RGBA()
+	return r < 0x8000
+}
+
+// Проверка, что серийный номер помещается на этикетку заданной ширины
+func checkLabelBarcode(label itemLabel, width float64) error {
+	modules := label.code128.Bounds().Dx() + 20 // Штрихи и тихие зоны по 10 модулей
+	if (width-2*labelPadding(width, 0))/float64(modules) < minBarcodeModule {
+		return &requestError{http.StatusUnprocessableEntity, fmt.Sprintf("Serial number '%s' is too long for a %.0f mm wide label", label.Serial, width)}
+	}
+	return nil
+}
+
+// Отступ от края этикетки
+func labelPadding(width, height float64) float64 {
+	size := width
+	if height > 0 && height < size {
+		size = height
+	}
+	return math.Max(1.5, size*0.05)
+}
+
+// Текст, обрезанный по ширине с многоточием
+func fitLabelText(canvas labelCanvas, size float64, bold bool, text string, width float64) string {
+	if canvas.TextWidth(size, bold, text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := strings.TrimSpace(string(runes)) + "…"
+		if canvas.TextWidth(size, bold, candidate) <= width {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// Перенос текста по словам не более чем на maxLines строк
+func wrapLabelText(canvas labelCanvas, size float64, bold bool, text string, width float64, maxLines int) []string {
+	var lines []string
+	words := strings.Fields(text)
+	for len(words) > 0 && len(lines) < maxLines {
+		line := words[0]
+		used := 1
+		for used < len(words) && canvas.TextWidth(size, bold, line+" "+words[used]) <= width {
+			line += " " + words[used]
+			used++
+		}
+		words = words[used:]
+		if len(lines) == maxLines-1 && len(words) > 0 {
+			line += " " + strings.Join(words, " ")
+			words = nil
+		}
+		lines = append(lines, fitLabelText(canvas, size, bold, line, width))
+	}
+	return lines
+}
+
+// Отрисовка этикетки в прямоугольнике (x, y, w, h):
+// сверху QR-код и наименование, снизу штрихкод Code128 серийного номера во всю ширину
+func drawItemLabel(canvas labelCanvas, label itemLabel, x, y, w, h float64) {
+	pad := labelPadding(w, h)
+	innerW := w - 2*pad
+
+	// Верхняя часть: QR-код слева, текст справа
+	topH := (h - 2*pad) * 0.55
+	qrSize := label.qrMatrix.Bounds().Dx()
+	qrSide := math.Min(topH, innerW*0.45)
+	module := canvas.Snap(qrSide / float64(qrSize))
+	if module <= 0 {
+		module = qrSide / float64(qrSize)
+	}
+	qrX, qrY := canvas.Snap(x+pad), canvas.Snap(y+pad)
+	for row := 0; row < qrSize; row++ {
+		for col := 0; col < qrSize; col++ {
+			if barcodeModule(label.qrMatrix, col, row) {
+				canvas.Rect(qrX+float64(col)*module, qrY+float64(row)*module, module, module)
+			}
+		}
+	}
+
+	textX := x + pad + float64(qrSize)*module + pad
+	textW := x + w - pad - textX
+	nameSize := math.Min(11, math.Max(6, h/4))
+	lineH := nameSize / pointsPerMM * 1.15
+	baseline := y + pad + lineH*0.85
+	for _, line := range wrapLabelText(canvas, nameSize, true, label.Name, textW, 2) {
+		canvas.Text(textX, baseline, nameSize, true, line)
+		baseline += lineH
+	}
+	if label.Caption != "" {
+		captionSize := nameSize * 0.75
+		canvas.Text(textX, baseline+lineH*0.1, captionSize, false, fitLabelText(canvas, captionSize, false, label.Caption, textW))
+	}
+
+	// Нижняя часть: штрихкод и серийный номер
+	serialSize := math.Min(9, math.Max(5, h/5))
+	serialH := serialSize / pointsPerMM
+	bars := label.code128.Bounds().Dx()
+	barModule := canvas.Snap(innerW / float64(bars+20))
+	if barModule <= 0 {
+		barModule = innerW / float64(bars+20)
+	}
+	barTop := y + pad + topH + pad*0.5
+	barH := y + h - pad - serialH*1.2 - barTop
+	barX := canvas.Snap(x + (w-float64(bars)*barModule)/2)
+	for col := 0; col < bars; col++ {
+		if barcodeModule(label.code128, col, 0) {
+			// Соседние черные модули рисуются одним штрихом
+			start := col
+			for col+1 < bars && barcodeModule(label.code128, col+1, 0) {
+				col++
+			}
+			canvas.Rect(barX+float64(start)*barModule, barTop, float64(col-start+1)*barModule, barH)
+		}
+	}
+
+	serial := fitLabelText(canvas, serialSize, false, label.Serial, innerW)
+	serialW := canvas.TextWidth(serialSize, false, serial)
+	canvas.Text(x+(w-serialW)/2, y+h-pad, serialSize, false, serial)
+}
+
+// pdfLabelCanvas рисует этикетки в PDF векторно
+type pdfLabelCanvas struct {
+	pdf *gofpdf.Fpdf
+}
+
+func newPDFLabelCanvas(width, height float64) *pdfLabelCanvas {
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{UnitStr: "mm", Size: gofpdf.SizeType{Wd: width, Ht: height}})
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddUTF8FontFromBytes("DejaVu", "", labelFontRegular)
+	pdf.AddUTF8FontFromBytes("DejaVu", "B", labelFontBold)
+	pdf.SetFillColor(0, 0, 0)
+	pdf.SetCreator("warehouse-service", true)
+	return &pdfLabelCanvas{pdf: pdf}
+}
+
+func (p *pdfLabelCanvas) setFont(size float64, bold bool) {
+	style := ""
+	if bold {
+		style = "B"
+	}
+	p.pdf.SetFont("DejaVu", style, size)
+}
+
+func (p *pdfLabelCanvas) Rect(x, y, w, h float64) {
+	p.pdf.Rect(x, y, w, h, "F")
+}
+
+func (p *pdfLabelCanvas) Text(x, baseline float64, size float64, bold bool, text string) {
+	p.setFont(size, bold)
+	p.pdf.Text(x, baseline, text)
+}
+
+func (p *pdfLabelCanvas) TextWidth(size float64, bold bool, text string) float64 {
+	p.setFont(size, bold)
+	return p.pdf.GetStringWidth(text)
+}
+
+func (p *pdfLabelCanvas) Snap(value float64) float64 {
+	return value
+}
+
+func (p *pdfLabelCanvas) Write(w io.Writer) error {
+	return p.pdf.Output(w)
+}
+
+// pngLabelCanvas рисует этикетку в растровое изображение с заданным разрешением
+type pngLabelCanvas struct {
+	img   *image.Gray
+	scale float64 // Точек на миллиметр
+	dpi   float64
+	fonts map[bool]*opentype.Font
+	faces map[[2]float64]font.Face
+}
+
+func newPNGLabelCanvas(width, height float64, dpi int) (*pngLabelCanvas, error) {
+	scale := float64(dpi) / 25.4
+	img := image.NewGray(image.Rect(0, 0, int(math.Round(width*scale)), int(math.Round(height*scale))))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	regular, err := opentype.Parse(labelFontRegular)
+	if err != nil {
+		return nil, err
+	}
+	bold, err := opentype.Parse(labelFontBold)
+	if err != nil {
+		return nil, err
+	}
+	return &pngLabelCanvas{
+		img:   img,
+		scale: scale,
+		dpi:   float64(dpi),
+		fonts: map[bool]*opentype.Font{false: regular, true: bold},
+		faces: map[[2]float64]font.Face{},
+	}, nil
+}
+
+func (p *pngLabelCanvas) face(size float64, bold bool) font.Face {
+	key := [2]float64{size, 0}
+	if bold {
+		key[1] = 1
+	}
+	if face, ok := p.faces[key]; ok {
+		return face
+	}
+	face, err := opentype.NewFace(p.fonts[bold], &opentype.FaceOptions{Size: size, DPI: p.dpi, Hinting: font.HintingFull})
+	if err != nil {
+		face = nil
+	}
+	p.faces[key] = face
+	return face
+}
+
+func (p *pngLabelCanvas) Rect(x, y, w, h float64) {
+	rect := image.Rect(
+		int(math.Round(x*p.scale)), int(math.Round(y*p.scale)),
+		int(math.Round((x+w)*p.scale)), int(math.Round((y+h)*p.scale)),
+	)
+	draw.Draw(p.img, rect, image.Black, image.Point{}, draw.Src)
+}
+
+func (p *pngLabelCanvas) Text(x, baseline float64, size float64, bold bool, text string) {
+	face := p.face(size, bold)
+	if face == nil {
+		return
+	}
+	drawer := font.Drawer{
+		Dst:  p.img,
+		Src:  image.NewUniform(color.Black),
+		Face: face,
+		Dot:  fixed.P(int(math.Round(x*p.scale)), int(math.Round(baseline*p.scale))),
+	}
+	drawer.DrawString(text)
+}
+
+func (p *pngLabelCanvas) TextWidth(size float64, bold bool, text string) float64 {
+	face := p.face(size, bold)
+	if face == nil {
+		return 0
+	}
+	return float64(font.MeasureString(face, text)) / 64 / p.scale
+}
+
+func (p *pngLabelCanvas) Snap(value float64) float64 {
+	return math.Floor(value*p.scale) / p.scale
+}
+
+func (p *pngLabelCanvas) Write(w io.Writer) error {
+	for _, face := range p.faces {
+		if face != nil {
+			face.Close()
+		}
+	}
+	return png.Encode(w, p.img)
+}
+
+// Размер в миллиметрах из параметра запроса
+func parseLabelSize(c *gin.Context, param string, defaultValue, minValue float64) (float64, error) {
+	value := c.Query(param)
+	if value == "" {
+		return defaultValue, nil
+	}
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil || size < minValue || size > maxLabelSize {
+		return 0, &requestError{http.StatusBadRequest, fmt.Sprintf("%s must be between %.0f and %.0f mm", param, minValue, maxLabelSize)}
+	}
+	return size, nil
+}
+
+// Этикетка оборудования в PDF или PNG: Code128 серийного номера и QR-код со ссылкой на оборудование.
+// Размер задается параметрами width и height (мм), разрешение PNG - параметром dpi.
+func getItemLabel(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	format := strings.ToLower(c.DefaultQuery("format", LabelFormatPDF))
+	if format != LabelFormatPDF && format != LabelFormatPNG {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format parameter (pdf or png)"})
+		return
+	}
+	width, err := parseLabelSize(c, "width", defaultLabelWidth, minLabelWidth)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+	height, err := parseLabelSize(c, "height", defaultLabelHeight, minLabelHeight)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+	dpi := defaultLabelDPI
+	if value := c.Query("dpi"); value != "" {
+		dpi, err = strconv.Atoi(value)
+		if err != nil || dpi < 72 || dpi > maxLabelDPI {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dpi must be between 72 and " + strconv.Itoa(maxLabelDPI)})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var item WarehouseItem
+	if err := warehouseCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&item); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch item: " + err.Error()})
+		}
+		return
+	}
+
+	link, err := itemLabelURL(item.ID)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+	label, err := newItemLabel(item, link)
+	if err == nil {
+		err = checkLabelBarcode(label, width)
+	}
+	if err != nil {
+		respondError(c, err, "Failed to prepare label: ")
+		return
+	}
+
+	var buf bytes.Buffer
+	contentType := "application/pdf"
+	if format == LabelFormatPNG {
+		canvas, err := newPNGLabelCanvas(width, height, dpi)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render label: " + err.Error()})
+			return
+		}
+		drawItemLabel(canvas, label, 0, 0, width, height)
+		err = canvas.Write(&buf)
+		contentType = "image/png"
+	} else {
+		canvas := newPDFLabelCanvas(width, height)
+		canvas.pdf.AddPage()
+		drawItemLabel(canvas, label, 0, 0, width, height)
+		err = canvas.Write(&buf)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render label: " + err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("label-%s.%s", item.ID.Hex(), format)
+	c.Header("Content-Disposition", `inline; filename="`+filename+`"`)
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// Проверка сетки этикеток и расчет размера этикетки по сетке
+func (req *LabelSheetRequest) normalize() error {
+	if req.Copies == 0 {
+		req.Copies = 1
+	}
+	if req.Columns == 0 && req.Rows == 0 {
+		req.Columns, req.Rows = 3, 8
+	}
+	if req.Copies < 1 || req.Columns < 1 || req.Rows < 1 || req.Skip < 0 {
+		return &requestError{http.StatusBadRequest, "copies, columns and rows must be positive, skip cannot be negative"}
+	}
+	if req.MarginTop < 0 || req.MarginLeft < 0 || req.GapX < 0 || req.GapY < 0 {
+		return &requestError{http.StatusBadRequest, "Margins and gaps cannot be negative"}
+	}
+	if req.Skip >= req.Columns*req.Rows {
+		return &requestError{http.StatusBadRequest, "skip must be less than the number of labels on a sheet"}
+	}
+	if len(req.ItemIDs)*req.Copies > maxBatchLabels {
+		return &requestError{http.StatusBadRequest, "Too many labels (max " + strconv.Itoa(maxBatchLabels) + ")"}
+	}
+
+	columns, rows := float64(req.Columns), float64(req.Rows)
+	if req.LabelWidth == 0 {
+		req.LabelWidth = (a4Width - 2*req.MarginLeft - (columns-1)*req.GapX) / columns
+	}
+	if req.LabelHeight == 0 {
+		req.LabelHeight = (a4Height - 2*req.MarginTop - (rows-1)*req.GapY) / rows
+	}
+	if req.LabelWidth < minLabelWidth || req.LabelHeight < minLabelHeight {
+		return &requestError{http.StatusBadRequest, fmt.Sprintf("Label is too small (%.1fx%.1f mm, min %.0fx%.0f mm)", req.LabelWidth, req.LabelHeight, minLabelWidth, minLabelHeight)}
+	}
+	if req.MarginLeft+columns*req.LabelWidth+(columns-1)*req.GapX > a4Width+0.01 ||
+		req.MarginTop+rows*req.LabelHeight+(rows-1)*req.GapY > a4Height+0.01 {
+		return &requestError{http.StatusBadRequest, "Label grid does not fit on an A4 sheet"}
+	}
+	return nil
+}
+
+// Печать этикеток оборудования на листах A4 по сетке.
+// Этикетки идут в порядке item_ids, каждая повторяется copies раз.
+func printItemLabelSheets(c *gin.Context) {
+	var req LabelSheetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.ItemIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "item_ids must not be empty"})
+		return
+	}
+	if err := req.normalize(); err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ids := make([]primitive.ObjectID, len(req.ItemIDs))
+	for i, value := range req.ItemIDs {
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID: " + value})
+			return
+		}
+		ids[i] = id
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	items, err := loadAll[WarehouseItem](ctx, warehouseCollection, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items: " + err.Error()})
+		return
+	}
+	byID := map[primitive.ObjectID]WarehouseItem{}
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+
+	// Все ошибки собираются сразу, чтобы исправить список за один раз
+	var labels []itemLabel
+	var problems []gin.H
+	for _, id := range ids {
+		item, ok := byID[id]
+		if !ok {
+			problems = append(problems, gin.H{"item_id": id.Hex(), "error": "Item not found"})
+			continue
+		}
+		link, err := itemLabelURL(item.ID)
+		if err != nil {
+			respondError(c, err, "")
+			return
+		}
+		label, err := newItemLabel(item, link)
+		if err == nil {
+			err = checkLabelBarcode(label, req.LabelWidth)
+		}
+		if err != nil {
+			problems = append(problems, gin.H{"item_id": id.Hex(), "error": err.Error()})
+			continue
+		}
+		for i := 0; i < req.Copies; i++ {
+			labels = append(labels, label)
+		}
+	}
+	if len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Some labels cannot be printed", "items": problems})
+		return
+	}
+
+	canvas := newPDFLabelCanvas(a4Width, a4Height)
+	perSheet := req.Columns * req.Rows
+	for i, label := range labels {
+		cell := i + req.Skip
+		if cell%perSheet == 0 || i == 0 {
+			canvas.pdf.AddPage()
+		}
+		column, row := cell%perSheet%req.Columns, cell%perSheet/req.Columns
+		x := req.MarginLeft + float64(column)*(req.LabelWidth+req.GapX)
+		y := req.MarginTop + float64(row)*(req.LabelHeight+req.GapY)
+		if req.Border {
+			canvas.pdf.SetLineWidth(0.1)
+			canvas.pdf.SetDrawColor(160, 160, 160)
+			canvas.pdf.Rect(x, y, req.LabelWidth, req.LabelHeight, "D")
+		}
+		drawItemLabel(canvas, label, x, y, req.LabelWidth, req.LabelHeight)
+	}
+
+	var buf bytes.Buffer
+	if err := canvas.Write(&buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render labels: " + err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `inline; filename="labels-`+time.Now().Format("20060102-150405")+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
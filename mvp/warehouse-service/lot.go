@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Окно отчета об истекающих партиях по умолчанию (в днях)
+const defaultLotExpiringDays = 30
+
+// ExpiringLot представляет партию с истекающим или истекшим сроком годности
+type ExpiringLot struct {
+	Lot
+	ItemName     string `json:"item_name"`
+	SerialNumber string `json:"serial_number"`
+	Category     string `json:"category"`
+	Warehouse    string `json:"warehouse,omitempty"`
+	Location     string `json:"location"`
+	Unit         string `json:"unit"`
+	DaysLeft     int    `json:"days_left"` // Отрицательное значение - дней после истечения
+}
+
+// Ошибка расхода без указания партии: клиенту возвращается предложение по FEFO
+type lotRequiredError struct {
+	Suggestion []LotAllocation
+	Shortage   float64 // Количество, которое не покрывается партиями
+}
+
+func (e *lotRequiredError) Error() string {
+	return "lot_number is required for lot-tracked items"
+}
+
+// Движение по партиям одной транзакции, применяется в транзакции MongoDB
+type lotMovement struct {
+	Allocations []LotAllocation
+	NewLot      *Lot    // Партия, создаваемая приходом
+	Sign        float64 // +1 - поступление, -1 - расход
+	Intake      bool    // Приход увеличивает и принятое по партии количество
+}
+
+// Срок годности хранится как дата без времени
+func expiryDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// Партия годна до конца дня срока годности
+func lotExpired(expiry, now time.Time) bool {
+	return !expiry.IsZero() && !now.Before(expiry.AddDate(0, 0, 1))
+}
+
+// Количество полных дней до истечения срока годности (отрицательное, если истек)
+func lotDaysLeft(expiry, now time.Time) int {
+	return warrantyDaysLeft(expiry.AddDate(0, 0, 1), now)
+}
+
+// Порядок FEFO: сначала партии с ближайшим сроком годности,
+// партии без срока годности - последними в порядке поступления
+func sortLotsFEFO(lots []Lot) {
+	sort.SliceStable(lots, func(i, j int) bool {
+		a, b := lots[i], lots[j]
+		if a.ExpiryDate.IsZero() != b.ExpiryDate.IsZero() {
+			return !a.ExpiryDate.IsZero()
+		}
+		if !a.ExpiryDate.Equal(b.ExpiryDate) {
+			return a.ExpiryDate.Before(b.ExpiryDate)
+		}
+		return a.ReceivedAt.Before(b.ReceivedAt)
+	})
+}
+
+// Партии оборудования в порядке FEFO; depleted включает израсходованные партии
+func loadItemLots(ctx context.Context, itemID primitive.ObjectID, depleted bool) ([]Lot, error) {
+	filter := bson.M{"item_id": itemID}
+	if !depleted {
+		filter["quantity"] = bson.M{"$gt": 0}
+	}
+	lots, err := loadAll[Lot](ctx, lotCollection, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range lots {
+		lots[i].IsExpired = lotExpired(lots[i].ExpiryDate, now)
+	}
+	sortLotsFEFO(lots)
+	return lots, nil
+}
+
+// Распределение количества по партиям в порядке FEFO.
+// Возвращает распределение и количество, которое не покрывается партиями.
+func allocateFEFO(lots []Lot, quantity float64, includeExpired bool) ([]LotAllocation, float64) {
+	allocations := []LotAllocation{}
+	left := quantity
+	for _, lot := range lots {
+		if left <= 0 {
+			break
+		}
+		if lot.Quantity <= 0 || (lot.IsExpired && !includeExpired) {
+			continue
+		}
+		taken := min(left, lot.Quantity)
+		allocations = append(allocations, LotAllocation{
+			LotID:      lot.ID,
+			Number:     lot.Number,
+			ExpiryDate: lot.ExpiryDate,
+			Quantity:   taken,
+		})
+		left = roundQuantity(left - taken)
+	}
+	return allocations, left
+}
+
+// Поиск партии оборудования по номеру
+func findLot(ctx context.Context, itemID primitive.ObjectID, number string) (*Lot, error) {
+	var lot Lot
+	err := lotCollection.FindOne(ctx, bson.M{"item_id": itemID, "number": number}).Decode(&lot)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lot.IsExpired = lotExpired(lot.ExpiryDate, time.Now())
+	return &lot, nil
+}
+
+// Подготовка движения по партиям для транзакции оборудования.
+// Для оборудования без учета партий возвращает nil. Расход без номера партии:
+// списание распределяется по FEFO (включая просроченные), остальные операции
+// возвращают lotRequiredError с предложением партий.
+func prepareLotMovement(ctx context.Context, item WarehouseItem, transactionType, lotNumber string, expiryDate *time.Time, quantity float64) (*lotMovement, error) {
+	lotNumber = strings.TrimSpace(lotNumber)
+	if !item.TrackLots {
+		if lotNumber != "" || expiryDate != nil {
+			return nil, &requestError{http.StatusBadRequest, "Item '" + item.Name + "' does not track lots"}
+		}
+		return nil, nil
+	}
+	if expiryDate != nil && transactionType != "intake" {
+		return nil, &requestError{http.StatusBadRequest, "expiry_date is only allowed for intake transactions"}
+	}
+
+	now := time.Now()
+	movement := &lotMovement{Sign: transactionSign(transactionType), Intake: transactionType == "intake"}
+
+	if lotNumber == "" {
+		if movement.Sign > 0 {
+			return nil, &requestError{http.StatusBadRequest, "lot_number is required for lot-tracked items"}
+		}
+		lots, err := loadItemLots(ctx, item.ID, false)
+		if err != nil {
+			return nil, err
+		}
+		if transactionType == TransactionTypeWriteOff {
+			movement.Allocations, _ = allocateFEFO(lots, quantity, true)
+			return movement, nil
+		}
+		suggestion, shortage := allocateFEFO(lots, quantity, transactionType != "issue")
+		return nil, &lotRequiredError{Suggestion: suggestion, Shortage: shortage}
+	}
+
+	lot, err := findLot(ctx, item.ID, lotNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if movement.Intake {
+		if lot == nil {
+			return newLotMovement(item, lotNumber, expiryDate, quantity, now)
+		}
+		if expiryDate != nil && !expiryDay(*expiryDate).Equal(lot.ExpiryDate) {
+			return nil, &requestError{http.StatusConflict, "Lot " + lotNumber + " already has a different expiry date" + formatLotExpiry(lot.ExpiryDate)}
+		}
+	}
+
+	if lot == nil {
+		return nil, &requestError{http.StatusNotFound, "Lot " + lotNumber + " not found"}
+	}
+	if movement.Sign < 0 {
+		// Просроченные партии можно только списать или вернуть поставщику
+		if lot.IsExpired && (transactionType == "issue" || transactionType == "adjustment") {
+			return nil, &requestError{http.StatusConflict, "Lot " + lotNumber + " expired on " + lot.ExpiryDate.Format("2006-01-02") + " and is blocked; only write-off or supplier return is allowed"}
+		}
+		if quantity > lot.Quantity {
+			return nil, &requestError{http.StatusBadRequest, fmt.Sprintf("Insufficient quantity in lot %s (%s available)", lotNumber, formatQuantity(lot.Quantity))}
+		}
+	}
+	movement.Allocations = []LotAllocation{{LotID: lot.ID, Number: lot.Number, ExpiryDate: lot.ExpiryDate, Quantity: quantity}}
+	return movement, nil
+}
+
+// Приход в новую партию
+func newLotMovement(item WarehouseItem, lotNumber string, expiryDate *time.Time, quantity float64, now time.Time) (*lotMovement, error) {
+	var expiry time.Time
+	if expiryDate != nil {
+		expiry = expiryDay(*expiryDate)
+		if lotExpired(expiry, now) {
+			return nil, &requestError{http.StatusBadRequest, "Cannot receive lot " + lotNumber + ": it expired on " + expiry.Format("2006-01-02")}
+		}
+	}
+
+	lot := &Lot{
+		ID:               primitive.NewObjectID(),
+		ItemID:           item.ID,
+		Number:           lotNumber,
+		ExpiryDate:       expiry,
+		Quantity:         quantity,
+		ReceivedQuantity: quantity,
+		ReceivedAt:       now,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	return &lotMovement{
+		Allocations: []LotAllocation{{LotID: lot.ID, Number: lotNumber, ExpiryDate: expiry, Quantity: quantity}},
+		NewLot:      lot,
+		Sign:        1,
+		Intake:      true,
+	}, nil
+}
+
+// Партия начального остатка нового оборудования; nil, если партия не нужна
+func initialLotMovement(item WarehouseItem, lotNumber string, expiryDate *time.Time) (*lotMovement, error) {
+	lotNumber = strings.TrimSpace(lotNumber)
+	if item.Quantity <= 0 {
+		if lotNumber != "" || expiryDate != nil {
+			return nil, &requestError{http.StatusBadRequest, "lot_number and expiry_date require an initial quantity"}
+		}
+		return nil, nil
+	}
+	if !item.TrackLots {
+		if lotNumber != "" || expiryDate != nil {
+			return nil, &requestError{http.StatusBadRequest, "Item '" + item.Name + "' does not track lots"}
+		}
+		return nil, nil
+	}
+	if lotNumber == "" {
+		return nil, &requestError{http.StatusBadRequest, "lot_number is required for lot-tracked items"}
+	}
+	return newLotMovement(item, lotNumber, expiryDate, item.Quantity, time.Now())
+}
+
+// Дата срока годности для сообщений об ошибках
+func formatLotExpiry(expiry time.Time) string {
+	if expiry.IsZero() {
+		return " (none)"
+	}
+	return " (" + expiry.Format("2006-01-02") + ")"
+}
+
+// Применение движения по партиям в транзакции MongoDB; nil ничего не меняет
+func (m *lotMovement) apply(sessCtx mongo.SessionContext) error {
+	if m == nil {
+		return nil
+	}
+	now := time.Now()
+	if m.NewLot != nil {
+		if _, err := lotCollection.InsertOne(sessCtx, m.NewLot); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return &requestError{http.StatusConflict, "Lot " + m.NewLot.Number + " was created concurrently, retry the transaction"}
+			}
+			return err
+		}
+		return nil
+	}
+
+	for _, allocation := range m.Allocations {
+		delta := m.Sign * allocation.Quantity
+		filter := bson.M{"_id": allocation.LotID}
+		if delta < 0 {
+			filter["quantity"] = bson.M{"$gte": allocation.Quantity}
+		}
+		set := bson.M{
+			"quantity":   bson.M{"$round": bson.A{bson.M{"$add": bson.A{"$quantity", delta}}, quantityScale}},
+			"updated_at": now,
+		}
+		if m.Intake {
+			set["received_quantity"] = bson.M{"$round": bson.A{bson.M{"$add": bson.A{"$received_quantity", delta}}, quantityScale}}
+		}
+
+		result, err := lotCollection.UpdateOne(sessCtx, filter, bson.A{bson.M{"$set": set}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return &requestError{http.StatusConflict, "Lot " + allocation.Number + " was modified concurrently, retry the transaction"}
+		}
+	}
+	return nil
+}
+
+// Ответ на расход без номера партии: ошибка и предложение партий по FEFO
+func respondLotError(c *gin.Context, err error) {
+	if lotErr, ok := err.(*lotRequiredError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":           lotErr.Error(),
+			"fefo_suggestion": lotErr.Suggestion,
+			"shortage":        lotErr.Shortage,
+		})
+		return
+	}
+	respondError(c, err, "Failed to process lots: ")
+}
+
+// Остатки оборудования по партиям
+func getItemLots(c *gin.Context) {
+	itemID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var item WarehouseItem
+	if err := warehouseCollection.FindOne(ctx, bson.M{"_id": itemID}).Decode(&item); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	lots, err := loadItemLots(ctx, itemID, c.Query("all") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lots: " + err.Error()})
+		return
+	}
+
+	var lotted float64
+	for _, lot := range lots {
+		lotted += lot.Quantity
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"item_id":    item.ID,
+		"track_lots": item.TrackLots,
+		"unit":       itemUnit(item),
+		"quantity":   item.Quantity,
+		"lots":       lots,
+		// Остаток без партии (поступил до включения учета партий)
+		"unlotted_quantity": max(roundQuantity(item.Quantity-lotted), 0),
+	})
+}
+
+// Предложение партий для выдачи по FEFO
+func getItemLotSuggestion(c *gin.Context) {
+	itemID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID format"})
+		return
+	}
+	quantity, err := strconv.ParseFloat(c.Query("quantity"), 64)
+	if err != nil || quantity <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quantity must be a positive number"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var item WarehouseItem
+	if err := warehouseCollection.FindOne(ctx, bson.M{"_id": itemID}).Decode(&item); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	if !item.TrackLots {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Item does not track lots"})
+		return
+	}
+
+	units, err := loadUnits(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load units: " + err.Error()})
+		return
+	}
+	if quantity, err = units.toBase(item, quantity, c.Query("unit")); err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	lots, err := loadItemLots(ctx, itemID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lots: " + err.Error()})
+		return
+	}
+	allocations, shortage := allocateFEFO(lots, quantity, false)
+
+	c.JSON(http.StatusOK, gin.H{
+		"item_id":     item.ID,
+		"unit":        itemUnit(item),
+		"quantity":    quantity,
+		"allocations": allocations,
+		"shortage":    shortage,
+	})
+}
+
+// Отчет о партиях с истекающим и истекшим сроком годности
+func listExpiringLots(c *gin.Context) {
+	days := defaultLotExpiringDays
+	if daysParam := c.Query("days"); daysParam != "" {
+		parsed, err := strconv.Atoi(daysParam)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days parameter"})
+			return
+		}
+		days = parsed
+	}
+	includeExpired := c.DefaultQuery("include_expired", "true") != "false"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Партия с датой expiry годна до конца этого дня
+	now := time.Now()
+	expiryFilter := bson.M{"$gt": time.Time{}, "$lt": now.AddDate(0, 0, days)}
+	if !includeExpired {
+		expiryFilter["$gt"] = now.AddDate(0, 0, -1)
+	}
+	filter := bson.M{"quantity": bson.M{"$gt": 0}, "expiry_date": expiryFilter}
+
+	// Фильтры по оборудованию: склад и категория с подкатегориями
+	itemFilter := bson.M{}
+	if warehouse := c.Query("warehouse"); warehouse != "" {
+		itemFilter["warehouse"] = warehouse
+	}
+	if category := c.Query("category"); category != "" {
+		categories, err := categoryFilter(c, ctx, strings.Split(category, ","))
+		if err != nil {
+			respondError(c, err, "Failed to resolve categories: ")
+			return
+		}
+		itemFilter["category"] = categories
+	}
+	items, err := loadAll[WarehouseItem](ctx, warehouseCollection, itemFilter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items: " + err.Error()})
+		return
+	}
+	itemsByID := map[primitive.ObjectID]WarehouseItem{}
+	itemIDs := make([]primitive.ObjectID, 0, len(items))
+	for _, item := range items {
+		itemsByID[item.ID] = item
+		itemIDs = append(itemIDs, item.ID)
+	}
+	if len(itemFilter) > 0 {
+		filter["item_id"] = bson.M{"$in": itemIDs}
+	}
+
+	lots, err := loadAll[Lot](ctx, lotCollection, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lots: " + err.Error()})
+		return
+	}
+	sortLotsFEFO(lots)
+
+	result := []ExpiringLot{}
+	summary := map[string]int{"expired": 0, "expiring": 0}
+	for _, lot := range lots {
+		item, ok := itemsByID[lot.ItemID]
+		if !ok {
+			continue
+		}
+		lot.IsExpired = lotExpired(lot.ExpiryDate, now)
+		if lot.IsExpired {
+			summary["expired"]++
+		} else {
+			summary["expiring"]++
+		}
+		result = append(result, ExpiringLot{
+			Lot:          lot,
+			ItemName:     item.Name,
+			SerialNumber: item.SerialNumber,
+			Category:     item.Category,
+			Warehouse:    item.Warehouse,
+			Location:     item.Location,
+			Unit:         itemUnit(item),
+			DaysLeft:     lotDaysLeft(lot.ExpiryDate, now),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lots":          result,
+		"summary":       summary,
+		"expiring_days": days,
+	})
+}
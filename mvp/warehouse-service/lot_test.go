@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAllocateFEFO(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 6, d, 0, 0, 0, 0, time.UTC) }
+	lots := []Lot{
+		{Number: "no-expiry", Quantity: 10, ReceivedAt: day(1)},
+		{Number: "late", Quantity: 5, ExpiryDate: day(20), ReceivedAt: day(2)},
+		{Number: "expired", Quantity: 3, ExpiryDate: day(5), ReceivedAt: day(1), IsExpired: true},
+		{Number: "early", Quantity: 2.5, ExpiryDate: day(10), ReceivedAt: day(3)},
+		{Number: "empty", Quantity: 0, ExpiryDate: day(8), ReceivedAt: day(1)},
+		{Number: "early-second", Quantity: 1, ExpiryDate: day(10), ReceivedAt: day(4)},
+	}
+	sortLotsFEFO(lots)
+
+	tests := []struct {
+		name           string
+		quantity       float64
+		includeExpired bool
+		numbers        []string
+		quantities     []float64
+		left           float64
+	}{
+		{"nearest expiry first", 2, false, []string{"early"}, []float64{2}, 0},
+		{"same expiry in receipt order", 3, false, []string{"early", "early-second"}, []float64{2.5, 0.5}, 0},
+		{"lots without expiry last", 12, false, []string{"early", "early-second", "late", "no-expiry"}, []float64{2.5, 1, 5, 3.5}, 0},
+		{"expired lots skipped", 1, false, []string{"early"}, []float64{1}, 0},
+		{"expired lots first for write-off", 4, true, []string{"expired", "early"}, []float64{3, 1}, 0},
+		{"shortfall", 20, false, []string{"early", "early-second", "late", "no-expiry"}, []float64{2.5, 1, 5, 10}, 1.5},
+		{"nothing to allocate", 0, false, []string{}, []float64{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allocations, left := allocateFEFO(lots, tt.quantity, tt.includeExpired)
+			numbers := []string{}
+			quantities := []float64{}
+			for _, allocation := range allocations {
+				numbers = append(numbers, allocation.Number)
+				quantities = append(quantities, allocation.Quantity)
+			}
+			if !reflect.DeepEqual(numbers, tt.numbers) || !reflect.DeepEqual(quantities, tt.quantities) {
+				t.Errorf("allocations = %v %v, want %v %v", numbers, quantities, tt.numbers, tt.quantities)
+			}
+			if left != tt.left {
+				t.Errorf("left = %v, want %v", left, tt.left)
+			}
+		})
+	}
+}
+
+func TestLotExpired(t *testing.T) {
+	expiry := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		expiry time.Time
+		now    time.Time
+		want   bool
+	}{
+		{"before expiry date", expiry, expiry.Add(-time.Hour), false},
+		{"usable through expiry date", expiry, expiry.Add(23 * time.Hour), false},
+		{"expired next day", expiry, expiry.AddDate(0, 0, 1), true},
+		{"no expiry date", time.Time{}, expiry, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lotExpired(tt.expiry, tt.now); got != tt.want {
+				t.Errorf("lotExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"os"
 	"runtime"
-	"strconv"
 	"strings"
 	"time"
 
@@ -63,36 +62,88 @@ func isRabbitConnected() bool {
 }
 
 type WarehouseItemRequest struct {
-	Name           string    `json:"name" binding:"required"`
-	SerialNumber   string    `json:"serial_number" binding:"required"`
-	Category       string    `json:"category" binding:"required"`
-	Description    string    `json:"description"`
-	Manufacturer   string    `json:"manufacturer"`
-	Price          float64   `json:"price"`
-	Quantity       int       `json:"quantity" binding:"required"`
-	MinQuantity    int       `json:"min_quantity"`
-	Location       string    `json:"location" binding:"required"`
-	PurchaseDate   time.Time `json:"purchase_date"`
-	WarrantyExpiry time.Time `json:"warranty_expiry"`
+	Name           string          `json:"name" binding:"required"`
+	SerialNumber   string          `json:"serial_number" binding:"required"`
+	Category       string          `json:"category" binding:"required"`
+	Description    string          `json:"description"`
+	Manufacturer   string          `json:"manufacturer"`
+	Price          Money           `json:"price"`
+	Currency       string          `json:"currency"`                    // По умолчанию RUB
+	Quantity       float64         `json:"quantity" binding:"required"` // В базовой единице
+	MinQuantity    float64         `json:"min_quantity"`
+	Unit           string          `json:"unit"`                        // Базовая единица, по умолчанию pcs
+	Packagings     []ItemPackaging `json:"packagings"`
+	TrackLots      bool            `json:"track_lots"`  // Учет по партиям и срокам годности
+	LotNumber      string          `json:"lot_number"`  // Партия начального остатка (при учете партий)
+	ExpiryDate     *time.Time      `json:"expiry_date"` // Срок годности партии начального остатка
+	Location       string          `json:"location" binding:"required"`
+	Warehouse      string          `json:"warehouse"`
+	SupplierID     string          `json:"supplier_id"`
+	Attributes     map[string]interface{} `json:"attributes"` // Значения атрибутов по схеме категории
+	PurchaseDate   time.Time       `json:"purchase_date"`
+	WarrantyExpiry time.Time       `json:"warranty_expiry"`
 }
 
 type TransactionRequest struct {
-	ItemID          string `json:"item_id" binding:"required"`
-	TransactionType string `json:"transaction_type" binding:"required"` // intake, issue, return, adjustment
-	Quantity        int    `json:"quantity" binding:"required"`
-	ResponsibleUser string `json:"responsible_user" binding:"required"`
-	DestinationUser string `json:"destination_user"`
-	Reason          string `json:"reason"`
-	Notes           string `json:"notes"`
-	ReceivedByName  string `json:"received_by_name"` // ФИО пользователя, который заполняет накладную
+	ItemID          string     `json:"item_id" binding:"required"`
+	TransactionType string     `json:"transaction_type" binding:"required"` // intake, issue, return, adjustment, supplier_return
+	Quantity        float64    `json:"quantity" binding:"required"`
+	Unit            string     `json:"unit"` // Единица ввода количества; по умолчанию базовая единица оборудования
+	ResponsibleUser string     `json:"responsible_user" binding:"required"`
+	DestinationUser string     `json:"destination_user"`
+	Reason          string     `json:"reason"`
+	Notes           string     `json:"notes"`
+	ReceivedByName  string     `json:"received_by_name"` // ФИО пользователя, который заполняет накладную
+	DueDate         *time.Time `json:"due_date"`         // Ожидаемая дата возврата при выдаче сотруднику
+	CheckoutID      string     `json:"checkout_id"`      // Выдача, которую закрывает возврат; по умолчанию самая ранняя открытая
+	// Приемка по заказу поставщику (только для прихода)
+	PurchaseOrderID     string `json:"purchase_order_id"`
+	PurchaseOrderLineID string `json:"purchase_order_line_id"`
+	AllowOverDelivery   bool   `json:"allow_over_delivery"` // Разрешить приемку сверх заказанного количества
+	SupplierID          string `json:"supplier_id"`         // Поставщик прихода или возврата (по умолчанию из карточки оборудования)
+	// Партия для оборудования с учетом партий; возврат по выдаче по умолчанию в партию выдачи
+	LotNumber  string     `json:"lot_number"`
+	ExpiryDate *time.Time `json:"expiry_date"` // Срок годности партии (только для прихода)
+}
+
+// Ошибка обработки запроса с HTTP-статусом для ответа клиенту
+type requestError struct {
+	Status  int
+	Message string
+}
+
+func (e *requestError) Error() string {
+	return e.Message
+}
+
+// Отправка ошибки клиенту: requestError со своим статусом, остальные как 500
+func respondError(c *gin.Context, err error, prefix string) {
+	if reqErr, ok := err.(*requestError); ok {
+		c.JSON(reqErr.Status, gin.H{"error": reqErr.Message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": prefix + err.Error()})
 }
 
 func main() {
+	// Метод оценки запасов нужен уже при заполнении слоев себестоимости
+	if err := initCostingMethod(); err != nil {
+		log.Fatalf("Failed to configure inventory costing: %v", err)
+	}
+	if err := initLabelBaseURL(); err != nil {
+		log.Fatalf("Failed to configure item labels: %v", err)
+	}
+
 	// Initialize MongoDB connection
 	if err := initMongo(); err != nil {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
 	
+	// Хранилище содержимого вложений
+	if err := initBlobStore(); err != nil {
+		log.Fatalf("Failed to initialize attachment storage: %v", err)
+	}
+
 	// Initialize RabbitMQ connection
 	if err := initRabbitMQ(); err != nil {
 		log.Printf("Warning: Failed to initialize RabbitMQ: %v", err)
@@ -100,6 +151,12 @@ func main() {
 	}
 	// Закрываем соединение с RabbitMQ при завершении
 	defer closeRabbitMQ()
+
+	// Запускаем фоновую проверку просроченных возвратов
+	startOverdueMonitor()
+
+	// Запускаем фоновую проверку окончания гарантии
+	startWarrantyMonitor()
 	
 	r := gin.Default()
 
@@ -107,8 +164,9 @@ func main() {
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, If-Match")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -177,42 +235,141 @@ func main() {
 
 	// Endpoints для работы с оборудованием на складе
 	r.POST("/items", createWarehouseItem)
+	r.POST("/items/import", importWarehouseItems)
+	r.POST("/items/labels", printItemLabelSheets)
 	r.GET("/items/:id", getWarehouseItem)
 	r.GET("/items", listWarehouseItems)
+	r.GET("/items/export", exportWarehouseItems)
+	r.GET("/items/lookup", lookupWarehouseItem)
+	r.GET("/items/search", searchWarehouseItems)
+	r.GET("/items/warranty", listItemsByWarranty)
 	r.PUT("/items/:id", updateWarehouseItem)
+	r.PATCH("/items/:id", updateWarehouseItem)
 	r.DELETE("/items/:id", deleteWarehouseItem)
+	r.GET("/items/:id/revisions", listRevisions(RevisionResourceItem))
+	r.GET("/items/:id/revisions/:version", getRevision(RevisionResourceItem))
+	r.POST("/items/:id/revisions/:version/restore", restoreRevision(RevisionResourceItem))
+	r.GET("/items/:id/as-of", getResourceAsOf(RevisionResourceItem))
+	r.POST("/items/:id/archive", archiveItem)
+	r.POST("/items/:id/unarchive", unarchiveItem)
+	r.POST("/items/:id/decommission", decommissionItem)
+	r.GET("/items/:id/cost-layers", getItemCostLayers)
+	r.PUT("/items/:id/units", updateItemUnits)
+	r.GET("/items/:id/lots", getItemLots)
+	r.GET("/items/:id/lots/fefo", getItemLotSuggestion)
+	r.GET("/items/:id/label", getItemLabel)
+	r.PUT("/items/:id/barcodes", updateItemBarcodes)
+	r.GET("/items/:id/attachments", listAttachments(AttachmentOwnerItem))
+	r.POST("/items/:id/attachments", uploadAttachment(AttachmentOwnerItem))
 
 	// Endpoints для работы с транзакциями
 	r.POST("/transactions", createTransaction)
 	r.GET("/transactions", listTransactions)
+	r.GET("/transactions/export", exportTransactions)
 	r.GET("/transactions/item/:item_id", getItemTransactions)
 
+	// Вложения оборудования и накладных: фотографии, паспорта, сертификаты, руководства
+	r.GET("/attachments/:id", getAttachment)
+	r.GET("/attachments/:id/content", downloadAttachment)
+	r.GET("/attachments/:id/thumbnail", downloadAttachmentThumbnail)
+	r.DELETE("/attachments/:id", deleteAttachment)
+
+	// Сессии сканирования: последовательность сканов проводится одной накладной
+	r.POST("/scan-sessions", createScanSession)
+	r.GET("/scan-sessions", listScanSessions)
+	r.GET("/scan-sessions/:id", getScanSession)
+	r.POST("/scan-sessions/:id/scans", scanToSession)
+	r.PUT("/scan-sessions/:id/lines/:line_id", updateScanSessionLine)
+	r.DELETE("/scan-sessions/:id/lines/:line_id", deleteScanSessionLine)
+	r.POST("/scan-sessions/:id/complete", completeScanSession)
+	r.POST("/scan-sessions/:id/cancel", cancelScanSession)
+
+	// Endpoints для работы с выдачами оборудования сотрудникам
+	r.GET("/checkouts", listCheckouts)
+	r.GET("/checkouts/:id", getCheckout)
+	r.GET("/checkouts/holder/:holder", getHolderCheckouts)
+
 	// Endpoints для работы с накладными
 	r.POST("/invoices", createInvoice)
 	r.GET("/invoices", listInvoices)
+	r.GET("/invoices/export", exportInvoices)
 	r.GET("/invoices/:id", getInvoice)
+	r.GET("/invoices/:id/attachments", listAttachments(AttachmentOwnerInvoice))
+	r.POST("/invoices/:id/attachments", uploadAttachment(AttachmentOwnerInvoice))
 	r.GET("/transactions/without-invoices", getTransactionsWithoutInvoices)
 
+	// Endpoints для работы с заказами поставщикам
+	r.POST("/purchase-orders", createPurchaseOrder)
+	r.GET("/purchase-orders", listPurchaseOrders)
+	r.GET("/purchase-orders/outstanding", listOutstandingPurchaseOrderLines)
+	r.GET("/purchase-orders/:id", getPurchaseOrder)
+	r.PUT("/purchase-orders/:id", updatePurchaseOrder)
+	r.DELETE("/purchase-orders/:id", deletePurchaseOrder)
+	r.POST("/purchase-orders/:id/send", sendPurchaseOrder)
+	r.POST("/purchase-orders/:id/receive", receivePurchaseOrder)
+	r.POST("/purchase-orders/:id/close", closePurchaseOrder)
+
+	// Endpoints для планирования закупок
+	r.GET("/reorder/suggestions", getReorderSuggestions)
+	r.POST("/reorder/purchase-orders", createReorderPurchaseOrders)
+
+	// Endpoints для оценки запасов
+	r.GET("/valuation", getInventoryValuation)
+	r.GET("/valuation/issues", getIssuedCost)
+
+	// Endpoints для справочника единиц измерения
+	r.GET("/units", listUnits)
+	r.POST("/units", createUnit)
+
+	// Партии и сроки годности
+	r.GET("/lots/expiring", listExpiringLots)
+
+	// Обмен с 1С в формате CommerceML
+	r.GET("/exchange/1c/state", listExchangeState)
+	r.GET("/exchange/1c/catalog", exportCatalogCommerceML)
+	r.POST("/exchange/1c/catalog", importCatalogCommerceML)
+	r.GET("/exchange/1c/suppliers", exportSuppliersCommerceML)
+	r.GET("/exchange/1c/documents", exportInvoicesCommerceML)
+	r.POST("/exchange/1c/:kind/confirm", confirmExchange)
+
 	// Endpoints для работы с категориями
 	r.POST("/categories", createCategory)
 	r.GET("/categories", listCategories)
+	r.GET("/categories/tree", getCategoryTree)
 	r.GET("/categories/:id", getCategory)
 	r.PUT("/categories/:id", updateCategory)
+	r.PATCH("/categories/:id", updateCategory)
 	r.DELETE("/categories/:id", deleteCategory)
+	r.POST("/categories/:id/activate", activateCategory)
+	r.GET("/categories/:id/revisions", listRevisions(RevisionResourceCategory))
+	r.GET("/categories/:id/revisions/:version", getRevision(RevisionResourceCategory))
+	r.POST("/categories/:id/revisions/:version/restore", restoreRevision(RevisionResourceCategory))
+	r.GET("/categories/:id/as-of", getResourceAsOf(RevisionResourceCategory))
 
 	// Endpoints для работы со складами
 	r.POST("/warehouses", createWarehouse)
 	r.GET("/warehouses", listWarehouses)
 	r.GET("/warehouses/:id", getWarehouse)
 	r.PUT("/warehouses/:id", updateWarehouse)
+	r.PATCH("/warehouses/:id", updateWarehouse)
 	r.DELETE("/warehouses/:id", deleteWarehouse)
+	r.POST("/warehouses/:id/activate", activateWarehouse)
 
 	// Endpoints для работы с поставщиками
 	r.POST("/suppliers", createSupplier)
 	r.GET("/suppliers", listSuppliers)
+	r.GET("/suppliers/duplicates", checkSupplierDuplicates)
+	r.GET("/suppliers/ranking", getSupplierRanking)
+	r.GET("/suppliers/:id/scorecard", getSupplierScorecard)
 	r.GET("/suppliers/:id", getSupplier)
 	r.PUT("/suppliers/:id", updateSupplier)
+	r.PATCH("/suppliers/:id", updateSupplier)
 	r.DELETE("/suppliers/:id", deleteSupplier)
+	r.POST("/suppliers/:id/activate", activateSupplier)
+	r.GET("/suppliers/:id/revisions", listRevisions(RevisionResourceSupplier))
+	r.GET("/suppliers/:id/revisions/:version", getRevision(RevisionResourceSupplier))
+	r.POST("/suppliers/:id/revisions/:version/restore", restoreRevision(RevisionResourceSupplier))
+	r.GET("/suppliers/:id/as-of", getResourceAsOf(RevisionResourceSupplier))
 
 	log.Println("Starting warehouse service on port 8001...")
 	r.Run(":8001")
@@ -226,7 +383,137 @@ func createWarehouseItem(c *gin.Context) {
 		return
 	}
 
+	var supplierID primitive.ObjectID
+	if req.SupplierID != "" {
+		id, err := primitive.ObjectIDFromHex(req.SupplierID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID format"})
+			return
+		}
+		supplierID = id
+	}
+
+	if err := validatePrice(req.Price, "price"); err != nil {
+		respondError(c, err, "")
+		return
+	}
+	currency, err := normalizeCurrency(req.Currency)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
 	// Создаем новую запись об оборудовании
+	item := newWarehouseItem(req, currency, supplierID)
+
+	// Сохраняем в MongoDB
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Оборудование ссылается на существующие активные категорию, склад и поставщика
+	if err := validateItemCategory(ctx, item.Category); err != nil {
+		respondError(c, err, "Failed to validate category: ")
+		return
+	}
+	if err := validateNewItemAttributes(ctx, &item); err != nil {
+		respondError(c, err, "Failed to validate attributes: ")
+		return
+	}
+	if item.Warehouse != "" {
+		if err := validateItemWarehouse(ctx, item.Warehouse); err != nil {
+			respondError(c, err, "Failed to validate warehouse: ")
+			return
+		}
+	}
+	if !item.SupplierID.IsZero() {
+		if err := validateItemSupplier(ctx, item.SupplierID); err != nil {
+			respondError(c, err, "Failed to validate supplier: ")
+			return
+		}
+	}
+
+	// Остатки хранятся в базовой единице с допустимой для нее точностью
+	units, err := loadUnits(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load units: " + err.Error()})
+		return
+	}
+	if err := units.validateItemUnits(item.Unit, item.Packagings); err != nil {
+		respondError(c, err, "")
+		return
+	}
+	if err := units.checkBaseQuantity(item, item.Quantity, "quantity"); err != nil {
+		respondError(c, err, "")
+		return
+	}
+	if err := units.checkBaseQuantity(item, item.MinQuantity, "min_quantity"); err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	// Начальный остаток оборудования с учетом партий приходуется в партию
+	lots, err := initialLotMovement(item, req.LotNumber, req.ExpiryDate)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	session, err := mongoClient.StartSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session: " + err.Error()})
+		return
+	}
+	defer session.EndSession(ctx)
+
+	// Карточка, ее ревизия, начальный приход, партия и слой себестоимости сохраняются вместе
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if _, err := warehouseCollection.InsertOne(sessCtx, item); err != nil {
+			return nil, err
+		}
+
+		err := recordRevision(sessCtx, Revision{
+			ResourceType: RevisionResourceItem,
+			ResourceID:   item.ID,
+			Action:       RevisionActionCreate,
+			ChangedBy:    requestUser(c),
+		}, nil, item)
+		if err != nil {
+			return nil, err
+		}
+
+		// Создаем начальную транзакцию прихода оборудования
+		transaction := initialIntakeTransaction(item, "admin", lots) // В реальной системе будет использоваться авторизованный пользователь
+		if lots != nil {
+			if _, err := lotCollection.InsertOne(sessCtx, lots.NewLot); err != nil {
+				return nil, err
+			}
+		}
+		if err := postTransactionCost(sessCtx, item, &transaction); err != nil {
+			return nil, err
+		}
+		_, err = transactionCollection.InsertOne(sessCtx, transaction)
+		return nil, err
+	})
+	if err != nil {
+		respondError(c, err, "Failed to create warehouse item: ")
+		return
+	}
+
+	// Отправляем сообщение в RabbitMQ
+	if err := publishEquipmentCreated(item); err != nil {
+		log.Printf("Warning: Failed to publish message to RabbitMQ: %v", err)
+		// Продолжаем работу даже если не удалось отправить сообщение
+	}
+
+	setETag(c, item.Version)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Warehouse item created successfully",
+		"item": item,
+	})
+}
+
+// Новая запись об оборудовании из запроса на создание
+func newWarehouseItem(req WarehouseItemRequest, currency string, supplierID primitive.ObjectID) WarehouseItem {
 	item := WarehouseItem{
 		ID:             primitive.NewObjectID(),
 		Name:           req.Name,
@@ -235,53 +522,45 @@ func createWarehouseItem(c *gin.Context) {
 		Description:    req.Description,
 		Manufacturer:   req.Manufacturer,
 		Price:          req.Price,
+		Currency:       currency,
 		Quantity:       req.Quantity,
 		MinQuantity:    req.MinQuantity,
+		Unit:           req.Unit,
+		Packagings:     req.Packagings,
+		TrackLots:      req.TrackLots,
 		Location:       req.Location,
+		Warehouse:      req.Warehouse,
+		SupplierID:     supplierID,
+		Attributes:     req.Attributes,
 		PurchaseDate:   req.PurchaseDate,
 		WarrantyExpiry: req.WarrantyExpiry,
 		Status:         "available",
 		LastInventory:  time.Now(),
+		Version:        1,
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	}
-
-	// Сохраняем в MongoDB
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	
-	_, err := warehouseCollection.InsertOne(ctx, item)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create warehouse item: " + err.Error()})
-		return
-	}
-
-	// Отправляем сообщение в RabbitMQ
-	if err := publishEquipmentCreated(item); err != nil {
-		log.Printf("Warning: Failed to publish message to RabbitMQ: %v", err)
-		// Продолжаем работу даже если не удалось отправить сообщение
+	if item.Unit == "" {
+		item.Unit = defaultUnit
 	}
+	return item
+}
 
-	// Создаем начальную транзакцию прихода оборудования
+// Начальная транзакция прихода нового оборудования
+func initialIntakeTransaction(item WarehouseItem, user string, lots *lotMovement) InventoryTransaction {
 	transaction := InventoryTransaction{
 		ID:              primitive.NewObjectID(),
 		ItemID:          item.ID,
 		TransactionType: "intake",
-		Quantity:        req.Quantity,
-		ResponsibleUser: "admin", // В реальной системе будет использоваться авторизованный пользователь
+		Quantity:        item.Quantity,
+		ResponsibleUser: user,
 		Reason:          "Initial registration",
 		Date:            time.Now(),
 	}
-
-	_, err = transactionCollection.InsertOne(ctx, transaction)
-	if err != nil {
-		log.Printf("Warning: Failed to record initial transaction: %v", err)
+	if lots != nil {
+		transaction.Lots = lots.Allocations
 	}
-
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "Warehouse item created successfully",
-		"item": item,
-	})
+	return transaction
 }
 
 // Получение информации об оборудовании
@@ -306,6 +585,7 @@ func getWarehouseItem(c *gin.Context) {
 		return
 	}
 
+	setETag(c, item.Version)
 	c.JSON(http.StatusOK, item)
 }
 
@@ -315,13 +595,26 @@ func listWarehouseItems(c *gin.Context) {
 	category := c.Query("category")
 	location := c.Query("location")
 	status := c.Query("status")
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
-	skip, _ := strconv.Atoi(c.DefaultQuery("skip", "0"))
+
+	// Постраничный вывод: новые записи первыми
+	page, err := parsePageQuery(c, "created_at", -1)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
 	
-	// Создаем фильтр
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Создаем фильтр; категория включает все подкатегории
 	filter := bson.M{}
 	if category != "" {
-		filter["category"] = category
+		categories, err := categoryFilter(c, ctx, strings.Split(category, ","))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve categories: " + err.Error()})
+			return
+		}
+		filter["category"] = categories
 	}
 	if location != "" {
 		filter["location"] = location
@@ -329,29 +622,19 @@ func listWarehouseItems(c *gin.Context) {
 	if status != "" {
 		filter["status"] = status
 	}
-
-	// Настраиваем опции запроса
-	findOptions := options.Find()
-	findOptions.SetLimit(int64(limit))
-	findOptions.SetSkip(int64(skip))
-	findOptions.SetSort(bson.M{"created_at": -1})
+	// Архивное оборудование по умолчанию скрыто
+	if err := applyArchivedFilter(c, filter); err != nil {
+		respondError(c, err, "")
+		return
+	}
 
 	// Находим оборудование по фильтру
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 
-	cursor, err := warehouseCollection.Find(ctx, filter, findOptions)
+	items, pagination, err := findPage[WarehouseItem](ctx, warehouseCollection, filter, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items: " + err.Error()})
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var items []WarehouseItem
-	if err := cursor.All(ctx, &items); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode items data: " + err.Error()})
-		return
-	}
 
 	// Получаем общее количество записей для пагинации
 	total, err := warehouseCollection.CountDocuments(ctx, filter)
@@ -361,17 +644,16 @@ func listWarehouseItems(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"items": items,
-		"total": total,
-		"limit": limit,
-		"skip": skip,
+		"items":      items,
+		"total":      total,
+		"pagination": pagination,
 	})
 }
 
 // Обновление информации об оборудовании
 func updateWarehouseItem(c *gin.Context) {
 	id := c.Param("id")
-	
+
 	// Проверяем валидность ID
 	itemID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -379,35 +661,73 @@ func updateWarehouseItem(c *gin.Context) {
 		return
 	}
 
-	// Получаем данные для обновления
-	var updateData map[string]interface{}
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// Изменение возможно только для версии, которую видел клиент
+	version, err := parseIfMatch(c)
+	if err != nil {
+		respondError(c, err, "")
 		return
 	}
 
-	// Добавляем поле updated_at
-	updateData["updated_at"] = time.Now()
-
-	// Создаем документ обновления
-	update := bson.M{"$set": updateData}
+	// Получаем изменения в формате JSON Merge Patch
+	patch, err := readMergePatch(c)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
 
-	// Обновляем оборудование в базе
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := warehouseCollection.UpdateOne(ctx, bson.M{"_id": itemID}, update)
+	var item WarehouseItem
+	before, ok := loadForUpdate(c, ctx, warehouseCollection, itemID, version, "Item not found", &item)
+	if !ok {
+		return
+	}
+
+	// Количество и статус меняются только транзакциями
+	if err := checkStockFields(patch, item); err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	update, err := buildMergeUpdate(patch, warehouseItemPatchSchema)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update item: " + err.Error()})
+		respondError(c, err, "")
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+	// Новые категория, склад и поставщик должны существовать и быть активными
+	if err := validateItemReferenceUpdate(ctx, item, update); err != nil {
+		respondError(c, err, "Failed to validate references: ")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Item updated successfully"})
+	// Значения атрибутов проверяются по схеме текущей или новой категории
+	if err := validateItemAttributeUpdate(ctx, item, update); err != nil {
+		respondError(c, err, "Failed to validate attributes: ")
+		return
+	}
+	applyMinQuantityStatus(update, item)
+
+	// Обновляем оборудование в базе вместе с ревизией в истории изменений
+	var updated WarehouseItem
+	_, err = applyRevisionedUpdate(ctx, warehouseCollection, versionFilter(itemID, item.Version), update, Revision{
+		ResourceType: RevisionResourceItem,
+		ResourceID:   itemID,
+		Action:       RevisionActionUpdate,
+		ChangedBy:    requestUser(c),
+	}, before, &updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			respondVersionConflict(c, ctx, warehouseCollection, itemID, "Item not found")
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update item: " + err.Error()})
+		}
+		return
+	}
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, gin.H{"message": "Item updated successfully", "item": updated})
 }
 
 // Удаление оборудования
@@ -421,6 +741,12 @@ func deleteWarehouseItem(c *gin.Context) {
 		return
 	}
 
+	version, err := parseIfMatch(c)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
 	// Удаляем оборудование из базы
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -433,21 +759,42 @@ func deleteWarehouseItem(c *gin.Context) {
 	}
 	
 	if count > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete item with existing transactions. Archive it instead."})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete item with existing transactions. Archive it instead (POST /items/:id/archive)."})
 		return
 	}
 
-	result, err := warehouseCollection.DeleteOne(ctx, bson.M{"_id": itemID})
+	var item WarehouseItem
+	before, ok := loadForUpdate(c, ctx, warehouseCollection, itemID, version, "Item not found", &item)
+	if !ok {
+		return
+	}
+
+	result, err := warehouseCollection.DeleteOne(ctx, versionFilter(itemID, item.Version))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete item: " + err.Error()})
 		return
 	}
 
 	if result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		respondVersionConflict(c, ctx, warehouseCollection, itemID, "Item not found")
 		return
 	}
 
+	err = recordRevision(ctx, Revision{
+		ResourceType: RevisionResourceItem,
+		ResourceID:   itemID,
+		Action:       RevisionActionDelete,
+		ChangedBy:    requestUser(c),
+	}, before, nil)
+	if err != nil {
+		log.Printf("Warning: failed to record revision for item %s: %v", itemID.Hex(), err)
+	}
+
+	// Вложения удаленного оборудования больше не нужны
+	if err := deleteOwnerAttachments(ctx, AttachmentOwnerItem, itemID); err != nil {
+		log.Printf("Warning: failed to delete attachments of item %s: %v", itemID.Hex(), err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Item deleted successfully"})
 }
 
@@ -459,6 +806,14 @@ func createTransaction(c *gin.Context) {
 		return
 	}
 
+	// Тип проверяется до выдач и партий, которые от него зависят
+	switch req.TransactionType {
+	case "intake", "issue", "return", "adjustment", TransactionTypeSupplierReturn:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction type"})
+		return
+	}
+
 	// Проверяем валидность ID оборудования
 	itemID, err := primitive.ObjectIDFromHex(req.ItemID)
 	if err != nil {
@@ -477,8 +832,31 @@ func createTransaction(c *gin.Context) {
 		return
 	}
 
+	// Архивное оборудование доступно только для просмотра истории
+	if item.Archived {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item is archived. Unarchive it before creating transactions."})
+		return
+	}
+
+	// Количество можно ввести в любой единице, пересчитываемой в базовую единицу оборудования
+	units, err := loadUnits(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load units: " + err.Error()})
+		return
+	}
+	enteredQuantity := req.Quantity
+	req.Quantity, err = units.toBase(item, req.Quantity, req.Unit)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+	if req.Quantity <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be positive"})
+		return
+	}
+
 	// Проверяем достаточность количества для расхода или возврата
-	if (req.TransactionType == "issue" || req.TransactionType == "adjustment") && req.Quantity > item.Quantity {
+	if (req.TransactionType == "issue" || req.TransactionType == "adjustment" || req.TransactionType == TransactionTypeSupplierReturn) && req.Quantity > item.Quantity {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient quantity available"})
 		return
 	}
@@ -495,28 +873,59 @@ func createTransaction(c *gin.Context) {
 		Notes:           req.Notes,
 		Date:            time.Now(),
 	}
+	if req.Unit != "" && req.Unit != itemUnit(item) {
+		transaction.Unit = req.Unit
+		transaction.UnitQuantity = enteredQuantity
+	}
+
+	// Связываем транзакцию с выдачей сотруднику, если требуется
+	checkout, err := prepareCheckout(ctx, req, item, &transaction)
+	if err != nil {
+		respondError(c, err, "Failed to process checkout: ")
+		return
+	}
+
+	// Движение по партиям; возврат по выдаче по умолчанию поступает в партию выдачи
+	lotNumber := req.LotNumber
+	if lotNumber == "" && checkout != nil && req.TransactionType == "return" {
+		lotNumber = checkout.LotNumber
+	}
+	lots, err := prepareLotMovement(ctx, item, req.TransactionType, lotNumber, req.ExpiryDate, req.Quantity)
+	if err != nil {
+		respondLotError(c, err)
+		return
+	}
+	if lots != nil {
+		transaction.Lots = lots.Allocations
+		if checkout != nil && req.TransactionType == "issue" {
+			checkout.LotNumber = lots.Allocations[0].Number
+		}
+	}
 
 	// Обновляем количество оборудования на складе
-	var newQuantity int
+	var newQuantity float64
 	switch req.TransactionType {
 	case "intake", "return":
-		newQuantity = item.Quantity + req.Quantity
-	case "issue", "adjustment":
-		newQuantity = item.Quantity - req.Quantity
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction type"})
-		return
+		newQuantity = roundQuantity(item.Quantity + req.Quantity)
+	case "issue", "adjustment", TransactionTypeSupplierReturn:
+		newQuantity = roundQuantity(item.Quantity - req.Quantity)
 	}
 
 	// Обновляем статус, если количество стало 0 или меньше минимального
-	var newStatus string
-	if newQuantity <= 0 {
-		newStatus = "unavailable"
-	} else if newQuantity < item.MinQuantity {
-		newStatus = "low"
-	} else {
-		newStatus = "available"
+	newStatus := itemStockStatus(newQuantity, item.MinQuantity)
+
+	// Приход может закрывать позицию заказа поставщику
+	if err := preparePurchaseOrderReceipt(req, &transaction); err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	// Приход и возврат поставщику учитываются в оценке поставщика
+	if err := prepareSupplierAttribution(req, item, &transaction); err != nil {
+		respondError(c, err, "")
+		return
 	}
+	var purchaseOrder *PurchaseOrder
 
 	// Начинаем транзакцию MongoDB
 	session, err := mongoClient.StartSession()
@@ -528,6 +937,26 @@ func createTransaction(c *gin.Context) {
 
 	// Выполняем операции в транзакции
 	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// Приемка по позиции заказа поставщику; приход относится к поставщику заказа
+		if transaction.PurchaseOrderID != primitive.NilObjectID {
+			order, err := receivePurchaseOrderLines(sessCtx, transaction.PurchaseOrderID, []purchaseOrderReceipt{{
+				LineID:        transaction.PurchaseOrderLineID,
+				ItemID:        itemID,
+				TransactionID: transaction.ID,
+				Quantity:      transaction.Quantity,
+			}}, req.AllowOverDelivery)
+			if err != nil {
+				return nil, err
+			}
+			purchaseOrder = &order
+			transaction.SupplierID = order.SupplierID
+		}
+
+		// Себестоимость: приход по цене заказа поставщику или карточки, расход - по слоям
+		if err := postTransactionCost(sessCtx, item, &transaction, intakeReceipt(item, transaction, purchaseOrder)); err != nil {
+			return nil, err
+		}
+
 		// Сохраняем транзакцию
 		_, err := transactionCollection.InsertOne(sessCtx, transaction)
 		if err != nil {
@@ -535,22 +964,24 @@ func createTransaction(c *gin.Context) {
 		}
 
 		// Обновляем количество и статус оборудования
-		update := bson.M{
-			"$set": bson.M{
-				"quantity":  newQuantity,
-				"status":    newStatus,
-				"updated_at": time.Now(),
-			},
+		if _, err := updateItemStock(sessCtx, item, newQuantity, transaction.ResponsibleUser); err != nil {
+			return nil, err
 		}
-		_, err = warehouseCollection.UpdateOne(sessCtx, bson.M{"_id": itemID}, update)
-		if err != nil {
+		if err := lots.apply(sessCtx); err != nil {
 			return nil, err
 		}
+
+		// Сохраняем выдачу или отмечаем возврат по ней
+		if checkout != nil {
+			if err := saveCheckout(sessCtx, checkout, transaction); err != nil {
+				return nil, err
+			}
+		}
 		return nil, nil
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process transaction: " + err.Error()})
+		respondError(c, err, "Failed to process transaction: ")
 		return
 	}
 
@@ -574,24 +1005,107 @@ func createTransaction(c *gin.Context) {
 		}
 	}(transaction.ID, req.TransactionType)
 
-	c.JSON(http.StatusCreated, gin.H{
+	response := gin.H{
 		"message": "Transaction created successfully",
 		"transaction": transaction,
 		"new_quantity": newQuantity,
 		"new_status": newStatus,
+	}
+	if checkout != nil {
+		response["checkout"] = checkout
+	}
+	if purchaseOrder != nil {
+		response["purchase_order"] = purchaseOrder
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// Изменение остатка оборудования в транзакции MongoDB.
+// Фильтр по версии защищает от одновременного изменения остатка; изменение попадает в историю.
+func updateItemStock(sessCtx mongo.SessionContext, item WarehouseItem, newQuantity float64, user string) (WarehouseItem, error) {
+	updatedItem := item
+	updatedItem.Quantity = newQuantity
+	updatedItem.Status = itemStockStatus(newQuantity, item.MinQuantity)
+	updatedItem.Version = item.Version + 1
+	updatedItem.UpdatedAt = time.Now()
+
+	result, err := warehouseCollection.UpdateOne(sessCtx, bson.M{"_id": item.ID, "version": item.Version}, bson.M{
+		"$set": bson.M{
+			"quantity":   updatedItem.Quantity,
+			"status":     updatedItem.Status,
+			"updated_at": updatedItem.UpdatedAt,
+		},
+		"$inc": bson.M{"version": 1},
 	})
+	if err != nil {
+		return item, err
+	}
+	if result.MatchedCount == 0 {
+		return item, &requestError{http.StatusConflict, "Item was modified concurrently, retry the transaction"}
+	}
+
+	err = recordRevision(sessCtx, Revision{
+		ResourceType: RevisionResourceItem,
+		ResourceID:   item.ID,
+		Action:       RevisionActionStock,
+		ChangedBy:    user,
+	}, item, updatedItem)
+	return updatedItem, err
+}
+
+// Статус оборудования по остатку: 0 - недоступно, ниже минимума - мало
+func itemStockStatus(quantity, minQuantity float64) string {
+	if quantity <= 0 {
+		return "unavailable"
+	} else if quantity < minQuantity {
+		return "low"
+	}
+	return "available"
 }
 
 // Список всех транзакций
 func listTransactions(c *gin.Context) {
+	// Постраничный вывод: последние операции первыми
+	page, err := parsePageQuery(c, "date", -1)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+	filter := transactionFilter(c)
+
+	// Получаем транзакции
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	transactions, pagination, err := findPage[InventoryTransaction](ctx, transactionCollection, filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions: " + err.Error()})
+		return
+	}
+
+	// Получаем общее количество записей для пагинации
+	total, err := transactionCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count transactions: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transactions": transactions,
+		"total":        total,
+		"pagination":   pagination,
+	})
+}
+
+// Фильтр транзакций по параметрам запроса: тип, ответственный и период (RFC3339)
+func transactionFilter(c *gin.Context) bson.M {
 	// Получаем параметры фильтрации
 	transactionType := c.Query("type")
 	fromDate := c.Query("from")
 	toDate := c.Query("to")
 	responsibleUser := c.Query("user")
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
-	skip, _ := strconv.Atoi(c.DefaultQuery("skip", "0"))
-	
+
 	// Создаем фильтр
 	filter := bson.M{}
 	if transactionType != "" {
@@ -620,43 +1134,7 @@ func listTransactions(c *gin.Context) {
 			filter["date"] = dateFilter
 		}
 	}
-
-	// Настраиваем опции запроса
-	findOptions := options.Find()
-	findOptions.SetLimit(int64(limit))
-	findOptions.SetSkip(int64(skip))
-	findOptions.SetSort(bson.M{"date": -1})
-
-	// Получаем транзакции
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	cursor, err := transactionCollection.Find(ctx, filter, findOptions)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions: " + err.Error()})
-		return
-	}
-	defer cursor.Close(ctx)
-
-	var transactions []InventoryTransaction
-	if err := cursor.All(ctx, &transactions); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode transactions data: " + err.Error()})
-		return
-	}
-
-	// Получаем общее количество записей для пагинации
-	total, err := transactionCollection.CountDocuments(ctx, filter)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count transactions: " + err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"transactions": transactions,
-		"total": total,
-		"limit": limit,
-		"skip": skip,
-	})
+	return filter
 }
 
 // Получение транзакций для конкретного оборудования
@@ -706,21 +1184,46 @@ func createCategory(c *gin.Context) {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Проверяем уникальность кода и родительскую категорию
+	if err := validateNewCategory(ctx, &category); err != nil {
+		respondError(c, err, "Failed to validate category: ")
+		return
+	}
+
 	// Устанавливаем временные метки
+	category.ID = primitive.NilObjectID
+	category.IsActive = true
+	category.Version = 1
 	category.CreatedAt = time.Now()
 	category.UpdatedAt = time.Now()
 
 	// Сохраняем в базе данных
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	result, err := categoryCollection.InsertOne(ctx, category)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Category with code '" + category.Code + "' already exists"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category: " + err.Error()})
 		return
 	}
 
 	category.ID = result.InsertedID.(primitive.ObjectID)
+
+	err = recordRevision(ctx, Revision{
+		ResourceType: RevisionResourceCategory,
+		ResourceID:   category.ID,
+		Action:       RevisionActionCreate,
+		ChangedBy:    requestUser(c),
+	}, nil, category)
+	if err != nil {
+		log.Printf("Warning: failed to record revision for category %s: %v", category.ID.Hex(), err)
+	}
+
+	setETag(c, category.Version)
 	c.JSON(http.StatusCreated, category)
 }
 
@@ -732,20 +1235,20 @@ func listCategories(c *gin.Context) {
 	// Создаем фильтр для активных категорий
 	filter := bson.M{"is_active": true}
 	
-	cursor, err := categoryCollection.Find(ctx, filter)
+	// Постраничный вывод в алфавитном порядке
+	page, err := parsePageQuery(c, "name", 1)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories: " + err.Error()})
+		respondError(c, err, "")
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var categories []Category
-	if err := cursor.All(ctx, &categories); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode categories: " + err.Error()})
+	categories, pagination, err := findPage[Category](ctx, categoryCollection, filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"categories": categories})
+	c.JSON(http.StatusOK, gin.H{"categories": categories, "pagination": pagination})
 }
 
 // Получение категории по ID
@@ -770,6 +1273,7 @@ func getCategory(c *gin.Context) {
 		return
 	}
 
+	setETag(c, category.Version)
 	c.JSON(http.StatusOK, category)
 }
 
@@ -781,60 +1285,71 @@ func updateCategory(c *gin.Context) {
 		return
 	}
 
-	var updateData Category
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	updateData.UpdatedAt = time.Now()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	result, err := categoryCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": updateData})
+	// Изменение возможно только для версии, которую видел клиент
+	version, err := parseIfMatch(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category: " + err.Error()})
+		respondError(c, err, "")
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+	// Получаем изменения в формате JSON Merge Patch
+	patch, err := readMergePatch(c)
+	if err != nil {
+		respondError(c, err, "")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Category updated successfully"})
-}
-
-// Удаление категории (мягкое удаление)
-func deleteCategory(c *gin.Context) {
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	update, err := buildMergeUpdate(patch, categoryPatchSchema)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		respondError(c, err, "")
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Мягкое удаление - устанавливаем is_active = false
-	result, err := categoryCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
-		"$set": bson.M{
-			"is_active":  false,
-			"updated_at": time.Now(),
-		},
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category: " + err.Error()})
+	var current Category
+	before, ok := loadForUpdate(c, ctx, categoryCollection, id, version, "Category not found", &current)
+	if !ok {
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+	// Проверяем код и родителя, чтобы дерево оставалось корректным
+	if err := validateCategoryUpdate(ctx, current, update); err != nil {
+		respondError(c, err, "Failed to validate category: ")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+	var updated Category
+	_, err = applyRevisionedUpdate(ctx, categoryCollection, versionFilter(id, current.Version), update, Revision{
+		ResourceType: RevisionResourceCategory,
+		ResourceID:   id,
+		Action:       RevisionActionUpdate,
+		ChangedBy:    requestUser(c),
+	}, before, &updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			respondVersionConflict(c, ctx, categoryCollection, id, "Category not found")
+		} else if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Category code already exists"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category: " + err.Error()})
+		}
+		return
+	}
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, gin.H{"message": "Category updated successfully", "category": updated})
+}
+
+// Удаление категории (мягкое удаление с проверкой зависимостей)
+func deleteCategory(c *gin.Context) {
+	deactivateResource(c, categoryDeactivation())
+}
+
+// Повторная активация категории
+func activateCategory(c *gin.Context) {
+	activateResource(c, categoryDeactivation())
 }
 
 // ================================
@@ -849,19 +1364,39 @@ func createWarehouse(c *gin.Context) {
 		return
 	}
 
-	warehouse.CreatedAt = time.Now()
-	warehouse.UpdatedAt = time.Now()
+	// Оборудование ссылается на склад по коду
+	warehouse.Code = strings.TrimSpace(warehouse.Code)
+	if warehouse.Code == "" || strings.TrimSpace(warehouse.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Warehouse code and name are required"})
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if err := checkWarehouseCodeUnique(ctx, warehouse.Code, primitive.NilObjectID); err != nil {
+		respondError(c, err, "Failed to validate warehouse: ")
+		return
+	}
+
+	warehouse.ID = primitive.NilObjectID
+	warehouse.IsActive = true
+	warehouse.Version = 1
+	warehouse.CreatedAt = time.Now()
+	warehouse.UpdatedAt = time.Now()
+
 	result, err := warehouseLocationCollection.InsertOne(ctx, warehouse)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Warehouse with code '" + warehouse.Code + "' already exists"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create warehouse: " + err.Error()})
 		return
 	}
 
 	warehouse.ID = result.InsertedID.(primitive.ObjectID)
+	setETag(c, warehouse.Version)
 	c.JSON(http.StatusCreated, warehouse)
 }
 
@@ -872,20 +1407,20 @@ func listWarehouses(c *gin.Context) {
 
 	filter := bson.M{"is_active": true}
 	
-	cursor, err := warehouseLocationCollection.Find(ctx, filter)
+	// Постраничный вывод в алфавитном порядке
+	page, err := parsePageQuery(c, "name", 1)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch warehouses: " + err.Error()})
+		respondError(c, err, "")
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var warehouses []Warehouse
-	if err := cursor.All(ctx, &warehouses); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode warehouses: " + err.Error()})
+	warehouses, pagination, err := findPage[Warehouse](ctx, warehouseLocationCollection, filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch warehouses: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"warehouses": warehouses})
+	c.JSON(http.StatusOK, gin.H{"warehouses": warehouses, "pagination": pagination})
 }
 
 // Получение склада по ID
@@ -910,6 +1445,7 @@ func getWarehouse(c *gin.Context) {
 		return
 	}
 
+	setETag(c, warehouse.Version)
 	c.JSON(http.StatusOK, warehouse)
 }
 
@@ -921,59 +1457,65 @@ func updateWarehouse(c *gin.Context) {
 		return
 	}
 
-	var updateData Warehouse
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	updateData.UpdatedAt = time.Now()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	result, err := warehouseLocationCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": updateData})
+	// Изменение возможно только для версии, которую видел клиент
+	version, err := parseIfMatch(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update warehouse: " + err.Error()})
+		respondError(c, err, "")
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Warehouse not found"})
+	// Получаем изменения в формате JSON Merge Patch
+	patch, err := readMergePatch(c)
+	if err != nil {
+		respondError(c, err, "")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Warehouse updated successfully"})
-}
-
-// Удаление склада (мягкое удаление)
-func deleteWarehouse(c *gin.Context) {
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	update, err := buildMergeUpdate(patch, warehousePatchSchema)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warehouse ID"})
+		respondError(c, err, "")
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := warehouseLocationCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
-		"$set": bson.M{
-			"is_active":  false,
-			"updated_at": time.Now(),
-		},
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete warehouse: " + err.Error()})
+	var current Warehouse
+	if _, ok := loadForUpdate(c, ctx, warehouseLocationCollection, id, version, "Warehouse not found", &current); !ok {
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Warehouse not found"})
+	// Оборудование ссылается на склад по коду
+	if err := validateWarehouseUpdate(ctx, current, update); err != nil {
+		respondError(c, err, "Failed to validate warehouse: ")
+		return
+	}
+
+	var updated Warehouse
+	_, err = applyMergeUpdate(ctx, warehouseLocationCollection, versionFilter(id, current.Version), update, &updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			respondVersionConflict(c, ctx, warehouseLocationCollection, id, "Warehouse not found")
+		} else if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Warehouse with this code already exists"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update warehouse: " + err.Error()})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Warehouse deleted successfully"})
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, gin.H{"message": "Warehouse updated successfully", "warehouse": updated})
+}
+
+// Удаление склада (мягкое удаление с проверкой зависимостей)
+func deleteWarehouse(c *gin.Context) {
+	deactivateResource(c, warehouseDeactivation())
+}
+
+// Повторная активация склада
+func activateWarehouse(c *gin.Context) {
+	activateResource(c, warehouseDeactivation())
 }
 
 // ================================
@@ -988,19 +1530,60 @@ func createSupplier(c *gin.Context) {
 		return
 	}
 
-	supplier.CreatedAt = time.Now()
-	supplier.UpdatedAt = time.Now()
-
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// Проверяем ИНН, КПП, ОГРН и уникальность ИНН среди активных поставщиков
+	if err := validateNewSupplier(ctx, &supplier); err != nil {
+		respondError(c, err, "Failed to validate supplier: ")
+		return
+	}
+
+	// Похожие поставщики возвращаются как предупреждение; force=true создает поставщика несмотря на них
+	if c.Query("force") != "true" {
+		duplicates, err := findSupplierDuplicates(ctx, supplier.CompanyName, supplier.TaxID, primitive.NilObjectID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check duplicates: " + err.Error()})
+			return
+		}
+		if len(duplicates) > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":      "Possible duplicate suppliers found; pass force=true to create anyway",
+				"duplicates": duplicates,
+			})
+			return
+		}
+	}
+
+	supplier.ID = primitive.NilObjectID
+	supplier.IsActive = true
+	supplier.Version = 1
+	supplier.CreatedAt = time.Now()
+	supplier.UpdatedAt = time.Now()
+
 	result, err := supplierCollection.InsertOne(ctx, supplier)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Active supplier with INN '" + supplier.TaxID + "' already exists"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create supplier: " + err.Error()})
 		return
 	}
 
 	supplier.ID = result.InsertedID.(primitive.ObjectID)
+
+	err = recordRevision(ctx, Revision{
+		ResourceType: RevisionResourceSupplier,
+		ResourceID:   supplier.ID,
+		Action:       RevisionActionCreate,
+		ChangedBy:    requestUser(c),
+	}, nil, supplier)
+	if err != nil {
+		log.Printf("Warning: failed to record revision for supplier %s: %v", supplier.ID.Hex(), err)
+	}
+
+	setETag(c, supplier.Version)
 	c.JSON(http.StatusCreated, supplier)
 }
 
@@ -1011,20 +1594,20 @@ func listSuppliers(c *gin.Context) {
 
 	filter := bson.M{"is_active": true}
 	
-	cursor, err := supplierCollection.Find(ctx, filter)
+	// Постраничный вывод в алфавитном порядке
+	page, err := parsePageQuery(c, "company_name", 1)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suppliers: " + err.Error()})
+		respondError(c, err, "")
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var suppliers []Supplier
-	if err := cursor.All(ctx, &suppliers); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode suppliers: " + err.Error()})
+	suppliers, pagination, err := findPage[Supplier](ctx, supplierCollection, filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suppliers: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"suppliers": suppliers})
+	c.JSON(http.StatusOK, gin.H{"suppliers": suppliers, "pagination": pagination})
 }
 
 // Получение поставщика по ID
@@ -1049,6 +1632,7 @@ func getSupplier(c *gin.Context) {
 		return
 	}
 
+	setETag(c, supplier.Version)
 	c.JSON(http.StatusOK, supplier)
 }
 
@@ -1060,57 +1644,69 @@ func updateSupplier(c *gin.Context) {
 		return
 	}
 
-	var updateData Supplier
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	updateData.UpdatedAt = time.Now()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	result, err := supplierCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": updateData})
+	// Изменение возможно только для версии, которую видел клиент
+	version, err := parseIfMatch(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update supplier: " + err.Error()})
+		respondError(c, err, "")
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+	// Получаем изменения в формате JSON Merge Patch
+	patch, err := readMergePatch(c)
+	if err != nil {
+		respondError(c, err, "")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Supplier updated successfully"})
-}
-
-// Удаление поставщика (мягкое удаление)
-func deleteSupplier(c *gin.Context) {
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	update, err := buildMergeUpdate(patch, supplierPatchSchema)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+		respondError(c, err, "")
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := supplierCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
-		"$set": bson.M{
-			"is_active":  false,
-			"updated_at": time.Now(),
-		},
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete supplier: " + err.Error()})
+	var current Supplier
+	before, ok := loadForUpdate(c, ctx, supplierCollection, id, version, "Supplier not found", &current)
+	if !ok {
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+	// Реквизиты проверяются вместе с неизмененными значениями
+	if err := validateSupplierUpdate(ctx, current, update); err != nil {
+		respondError(c, err, "Failed to validate supplier: ")
+		return
+	}
+
+	var updated Supplier
+	_, err = applyRevisionedUpdate(ctx, supplierCollection, versionFilter(id, current.Version), update, Revision{
+		ResourceType: RevisionResourceSupplier,
+		ResourceID:   id,
+		Action:       RevisionActionUpdate,
+		ChangedBy:    requestUser(c),
+	}, before, &updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			respondVersionConflict(c, ctx, supplierCollection, id, "Supplier not found")
+		} else if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Active supplier with this INN already exists"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update supplier: " + err.Error()})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Supplier deleted successfully"})
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, gin.H{"message": "Supplier updated successfully", "supplier": updated})
+}
+
+// Удаление поставщика (мягкое удаление с проверкой зависимостей)
+func deleteSupplier(c *gin.Context) {
+	deactivateResource(c, supplierDeactivation())
+}
+
+// Повторная активация поставщика
+func activateSupplier(c *gin.Context) {
+	activateResource(c, supplierDeactivation())
 }
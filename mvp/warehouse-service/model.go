@@ -4,40 +4,198 @@ package main
 import (
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // WarehouseItem представляет единицу оборудования на складе
 type WarehouseItem struct {
-	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name            string             `bson:"name" json:"name"`
-	SerialNumber    string             `bson:"serial_number" json:"serial_number"`
-	Category        string             `bson:"category" json:"category"`
-	Description     string             `bson:"description" json:"description"`
-	Manufacturer    string             `bson:"manufacturer" json:"manufacturer"`
-	Price          float64            `bson:"price" json:"price"`
-	Quantity        int                `bson:"quantity" json:"quantity"`
-	MinQuantity     int                `bson:"min_quantity" json:"min_quantity"`
-	Location        string             `bson:"location" json:"location"`
-	PurchaseDate    time.Time          `bson:"purchase_date" json:"purchase_date"`
-	WarrantyExpiry  time.Time          `bson:"warranty_expiry" json:"warranty_expiry"`
-	Status          string             `bson:"status" json:"status"` // available, reserved, unavailable
-	LastInventory   time.Time          `bson:"last_inventory" json:"last_inventory"`
-	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name           string             `bson:"name" json:"name"`
+	SerialNumber   string             `bson:"serial_number" json:"serial_number"`
+	Category       string             `bson:"category" json:"category"`
+	Description    string             `bson:"description" json:"description"`
+	Manufacturer   string             `bson:"manufacturer" json:"manufacturer"`
+	Price          Money              `bson:"price" json:"price"`
+	Currency       string             `bson:"currency,omitempty" json:"currency,omitempty"` // Валюта цены (ISO 4217), по умолчанию RUB
+	Quantity       float64            `bson:"quantity" json:"quantity"`                       // Остаток в базовой единице
+	MinQuantity    float64            `bson:"min_quantity" json:"min_quantity"`               // Минимальный остаток в базовой единице
+	Unit           string             `bson:"unit,omitempty" json:"unit"`                     // Базовая единица измерения, по умолчанию pcs
+	Packagings     []ItemPackaging    `bson:"packagings,omitempty" json:"packagings,omitempty"` // Упаковки оборудования (коробка, рулон)
+	TrackLots      bool               `bson:"track_lots,omitempty" json:"track_lots"`           // Учет по партиям и срокам годности
+	Location       string             `bson:"location" json:"location"`
+	Warehouse      string             `bson:"warehouse,omitempty" json:"warehouse,omitempty"`     // Код склада
+	SupplierID     primitive.ObjectID `bson:"supplier_id,omitempty" json:"supplier_id,omitempty"` // Поставщик
+	ExternalID     string             `bson:"external_id,omitempty" json:"external_id,omitempty"` // Ид номенклатуры в 1С
+	Barcodes       []ItemBarcode      `bson:"barcodes,omitempty" json:"barcodes,omitempty"`       // Дополнительные штрихкоды (EAN, Code128) для сканирования
+	Attributes     map[string]interface{} `bson:"attributes,omitempty" json:"attributes,omitempty"` // Значения атрибутов по схеме категории (код атрибута -> значение)
+	PurchaseDate   time.Time          `bson:"purchase_date" json:"purchase_date"`
+	WarrantyExpiry time.Time          `bson:"warranty_expiry" json:"warranty_expiry"`
+	Status         string             `bson:"status" json:"status"` // available, reserved, unavailable
+	LastInventory  time.Time          `bson:"last_inventory" json:"last_inventory"`
+	WarrantyAlert  *WarrantyAlert     `bson:"warranty_alert,omitempty" json:"warranty_alert,omitempty"` // Последнее отправленное предупреждение о гарантии
+	Archived       bool               `bson:"archived,omitempty" json:"archived"`                       // Оборудование в архиве (скрыто из списков, транзакции запрещены)
+	ArchivedAt     time.Time          `bson:"archived_at,omitempty" json:"archived_at,omitempty"`       // Время архивации
+	ArchiveReason  string             `bson:"archive_reason,omitempty" json:"archive_reason,omitempty"` // Причина архивации
+	Decommission   *Decommission      `bson:"decommission,omitempty" json:"decommission,omitempty"`     // Сведения о списании
+	Version        int64              `bson:"version" json:"version"`                                   // Версия документа для оптимистичной блокировки
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Decommission хранит сведения о списании оборудования
+type Decommission struct {
+	Reason           string             `bson:"reason" json:"reason"`                 // Причина списания
+	Quantity         float64            `bson:"quantity" json:"quantity"`             // Списанное количество
+	TransactionID    primitive.ObjectID `bson:"transaction_id" json:"transaction_id"` // Транзакция списания
+	DecommissionedBy string             `bson:"decommissioned_by" json:"decommissioned_by"`
+	DecommissionedAt time.Time          `bson:"decommissioned_at" json:"decommissioned_at"`
+}
+
+// ItemPackaging описывает упаковку оборудования: сколько базовых единиц в одной упаковке
+type ItemPackaging struct {
+	Unit   string  `bson:"unit" json:"unit"`     // Код единицы упаковки (box, roll)
+	Factor float64 `bson:"factor" json:"factor"` // Количество базовых единиц в упаковке
+}
+
+// ItemBarcode - дополнительный штрихкод оборудования.
+// Штрихкод упаковки указывает единицу: одно сканирование добавляет целую упаковку.
+type ItemBarcode struct {
+	Code string `bson:"code" json:"code"`                     // Значение штрихкода
+	Unit string `bson:"unit,omitempty" json:"unit,omitempty"` // Единица сканирования; по умолчанию базовая единица
+}
+
+// UnitOfMeasure представляет единицу измерения
+type UnitOfMeasure struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Code      string             `bson:"code" json:"code"`                               // Уникальный код (pcs, m, kg)
+	Name      string             `bson:"name" json:"name"`                               // Обозначение (шт, м, кг)
+	Dimension string             `bson:"dimension,omitempty" json:"dimension,omitempty"` // Величина (count, length, mass, volume); пусто - упаковка
+	Factor    float64            `bson:"factor,omitempty" json:"factor,omitempty"`       // Множитель к основной единице величины (г = 0.001 кг)
+	Precision int                `bson:"precision" json:"precision"`                     // Допустимое число знаков после запятой
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// WarrantyAlert хранит последнее окно, за которое отправлено предупреждение об окончании гарантии
+type WarrantyAlert struct {
+	WindowDays     int       `bson:"window_days" json:"window_days"`         // Окно предупреждения (90/30/7 дней)
+	WarrantyExpiry time.Time `bson:"warranty_expiry" json:"warranty_expiry"` // Дата гарантии, для которой отправлено предупреждение
+	NotifiedAt     time.Time `bson:"notified_at" json:"notified_at"`
 }
 
 // InventoryTransaction представляет операцию с оборудованием (приход/расход)
 type InventoryTransaction struct {
 	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	ItemID          primitive.ObjectID `bson:"item_id" json:"item_id"`
-	TransactionType string             `bson:"transaction_type" json:"transaction_type"` // intake, issue, return, adjustment
-	Quantity        int                `bson:"quantity" json:"quantity"`
+	TransactionType string             `bson:"transaction_type" json:"transaction_type"` // intake, issue, return, adjustment, write_off, supplier_return
+	Quantity        float64            `bson:"quantity" json:"quantity"`                             // Количество в базовой единице оборудования
+	Unit            string             `bson:"unit,omitempty" json:"unit,omitempty"`                   // Единица, в которой введено количество
+	UnitQuantity    float64            `bson:"unit_quantity,omitempty" json:"unit_quantity,omitempty"` // Количество в единице ввода
 	ResponsibleUser string             `bson:"responsible_user" json:"responsible_user"`
 	DestinationUser string             `bson:"destination_user,omitempty" json:"destination_user,omitempty"`
 	Reason          string             `bson:"reason" json:"reason"`
 	Date            time.Time          `bson:"date" json:"date"`
 	Notes           string             `bson:"notes,omitempty" json:"notes,omitempty"`
+	DueDate         time.Time          `bson:"due_date,omitempty" json:"due_date,omitempty"`       // Ожидаемая дата возврата (для выдачи сотруднику)
+	CheckoutID      primitive.ObjectID `bson:"checkout_id,omitempty" json:"checkout_id,omitempty"` // Связь с выдачей
+	// Приемка по заказу поставщику
+	PurchaseOrderID     primitive.ObjectID `bson:"purchase_order_id,omitempty" json:"purchase_order_id,omitempty"`
+	PurchaseOrderLineID primitive.ObjectID `bson:"purchase_order_line_id,omitempty" json:"purchase_order_line_id,omitempty"`
+	SupplierID          primitive.ObjectID `bson:"supplier_id,omitempty" json:"supplier_id,omitempty"` // Поставщик прихода или возврата
+	Lots                []LotAllocation    `bson:"lots,omitempty" json:"lots,omitempty"`               // Партии, по которым прошло движение
+	Costs               []CostAllocation   `bson:"costs,omitempty" json:"costs,omitempty"`             // Себестоимость движения по слоям
+}
+
+// CostAllocation представляет часть движения, оцененную по одному слою себестоимости
+type CostAllocation struct {
+	LayerID  primitive.ObjectID `bson:"layer_id,omitempty" json:"layer_id,omitempty"` // Не указан - расход сверх остатка слоев
+	Quantity float64            `bson:"quantity" json:"quantity"`                     // Количество в базовой единице
+	UnitCost Money              `bson:"unit_cost" json:"unit_cost"`
+	Amount   Money              `bson:"amount" json:"amount"` // Сумма, округленная до копеек
+	Currency string             `bson:"currency" json:"currency"`
+}
+
+// CostLayer представляет поступление оборудования с зафиксированной себестоимостью
+type CostLayer struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ItemID         primitive.ObjectID `bson:"item_id" json:"item_id"`
+	TransactionID  primitive.ObjectID `bson:"transaction_id,omitempty" json:"transaction_id,omitempty"` // Не указан - начальный остаток
+	ReceivedAt     time.Time          `bson:"received_at" json:"received_at"`
+	Quantity       float64            `bson:"quantity" json:"quantity"`               // Поступившее количество в базовой единице
+	Remaining      float64            `bson:"remaining" json:"remaining"`             // Неизрасходованный остаток
+	UnitCost       Money              `bson:"unit_cost" json:"unit_cost"`             // Текущая стоимость единицы остатка
+	Amount         Money              `bson:"amount" json:"amount"`                   // Стоимость поступления
+	RemainingValue Money              `bson:"remaining_value" json:"remaining_value"` // Стоимость остатка с учетом переоценок
+	Currency       string             `bson:"currency" json:"currency"`
+	Source         string             `bson:"source" json:"source"` // invoice, purchase_order, item_price, opening, return
+	Revaluations   []CostRevaluation  `bson:"revaluations,omitempty" json:"revaluations,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// CostRevaluation представляет изменение стоимости остатка слоя по приходной накладной
+type CostRevaluation struct {
+	Date      time.Time          `bson:"date" json:"date"`
+	InvoiceID primitive.ObjectID `bson:"invoice_id" json:"invoice_id"`
+	Amount    Money              `bson:"amount" json:"amount"` // Изменение стоимости остатка
+}
+
+// Lot представляет партию оборудования с остатком и сроком годности
+type Lot struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ItemID           primitive.ObjectID `bson:"item_id" json:"item_id"`
+	Number           string             `bson:"number" json:"number"`                               // Номер партии, уникален в пределах оборудования
+	ExpiryDate       time.Time          `bson:"expiry_date,omitempty" json:"expiry_date,omitempty"` // Годен до (включительно); не указан - без срока годности
+	Quantity         float64            `bson:"quantity" json:"quantity"`                           // Остаток партии в базовой единице
+	ReceivedQuantity float64            `bson:"received_quantity" json:"received_quantity"`         // Всего принято по партии
+	ReceivedAt       time.Time          `bson:"received_at" json:"received_at"`                     // Первое поступление партии
+	IsExpired        bool               `bson:"-" json:"is_expired"`                                // Вычисляется при выдаче ответа
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// LotAllocation описывает количество, прошедшее по одной партии
+type LotAllocation struct {
+	LotID      primitive.ObjectID `bson:"lot_id" json:"lot_id"`
+	Number     string             `bson:"number" json:"number"`
+	ExpiryDate time.Time          `bson:"expiry_date,omitempty" json:"expiry_date,omitempty"`
+	Quantity   float64            `bson:"quantity" json:"quantity"` // В базовой единице оборудования
+}
+
+// Статусы выдачи оборудования сотруднику
+const (
+	CheckoutStatusOpen              = "open"               // Оборудование у сотрудника
+	CheckoutStatusPartiallyReturned = "partially_returned" // Возвращена часть оборудования
+	CheckoutStatusReturned          = "returned"           // Оборудование возвращено полностью
+)
+
+// Checkout представляет выдачу оборудования сотруднику с ожидаемой датой возврата
+type Checkout struct {
+	ID                   primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	ItemID               primitive.ObjectID   `bson:"item_id" json:"item_id"`
+	ItemName             string               `bson:"item_name" json:"item_name"`
+	SerialNumber         string               `bson:"serial_number" json:"serial_number"`
+	Holder               string               `bson:"holder" json:"holder"`                     // Сотрудник, у которого находится оборудование
+	ResponsibleUser      string               `bson:"responsible_user" json:"responsible_user"` // Кто выдал
+	Quantity             float64              `bson:"quantity" json:"quantity"`                 // Выданное количество
+	ReturnedQuantity     float64              `bson:"returned_quantity" json:"returned_quantity"`
+	Unit                 string               `bson:"unit,omitempty" json:"unit,omitempty"` // Базовая единица оборудования на момент выдачи
+	LotNumber            string               `bson:"lot_number,omitempty" json:"lot_number,omitempty"` // Партия, из которой выдано оборудование
+	IssueTransactionID   primitive.ObjectID   `bson:"issue_transaction_id" json:"issue_transaction_id"`
+	ReturnTransactionIDs []primitive.ObjectID `bson:"return_transaction_ids" json:"return_transaction_ids"`
+	IssuedAt             time.Time            `bson:"issued_at" json:"issued_at"`
+	DueDate              time.Time            `bson:"due_date" json:"due_date"`
+	ReturnedAt           time.Time            `bson:"returned_at,omitempty" json:"returned_at,omitempty"` // Дата полного возврата
+	Status               string               `bson:"status" json:"status"`                               // open, partially_returned, returned
+	OverdueNotifiedAt    time.Time            `bson:"overdue_notified_at,omitempty" json:"overdue_notified_at,omitempty"`
+	IsOverdue            bool                 `bson:"-" json:"is_overdue"` // Вычисляется при выдаче ответа
+	CreatedAt            time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt            time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// Outstanding возвращает количество, которое еще не возвращено
+func (ch Checkout) Outstanding() float64 {
+	return roundQuantity(ch.Quantity - ch.ReturnedQuantity)
 }
 
 // InvoiceType определяет тип накладной
@@ -55,9 +213,16 @@ type InvoiceItem struct {
 	SerialNumber string             `bson:"serial_number" json:"serialNumber"`
 	Category     string             `bson:"category" json:"category"`
 	Manufacturer string             `bson:"manufacturer" json:"manufacturer"`
-	Quantity     int                `bson:"quantity" json:"quantity"`
-	Price        float64            `bson:"price" json:"price"`
-	TotalAmount  float64            `bson:"total_amount" json:"totalAmount"`
+	Quantity     float64            `bson:"quantity" json:"quantity"`                        // Количество в единице позиции
+	Unit         string             `bson:"unit,omitempty" json:"unit,omitempty"`            // Единица позиции; по умолчанию базовая единица оборудования
+	BaseQuantity float64            `bson:"base_quantity,omitempty" json:"baseQuantity"`     // Количество в базовой единице оборудования
+	LotNumber    string             `bson:"lot_number,omitempty" json:"lotNumber,omitempty"` // Партия (для оборудования с учетом партий)
+	ExpiryDate   time.Time          `bson:"expiry_date,omitempty" json:"expiryDate,omitempty"` // Срок годности партии
+	Price        Money              `bson:"price" json:"price"`                              // Цена за единицу (с НДС, если в накладной цены указаны с НДС)
+	VatRate      *int               `bson:"vat_rate,omitempty" json:"vatRate,omitempty"`     // Ставка НДС в процентах; не указана - без НДС
+	NetAmount    Money              `bson:"net_amount" json:"netAmount"`                     // Стоимость без НДС
+	VatAmount    Money              `bson:"vat_amount" json:"vatAmount"`                     // Сумма НДС
+	TotalAmount  Money              `bson:"total_amount" json:"totalAmount"`                 // Стоимость с НДС
 }
 
 // PersonInfo содержит информацию о человеке в накладной
@@ -76,9 +241,16 @@ type Invoice struct {
 	Items         []InvoiceItem      `bson:"items" json:"items"`           // Позиции
 	ReceivedBy    PersonInfo         `bson:"received_by" json:"receivedBy"` // Кто получил
 	IssuedBy      PersonInfo         `bson:"issued_by" json:"issuedBy"`     // Кто выдал
-	TotalAmount   float64            `bson:"total_amount" json:"totalAmount"` // Общая стоимость
+	Currency      string             `bson:"currency" json:"currency"`                    // Валюта накладной (ISO 4217)
+	VatIncluded   bool               `bson:"vat_included" json:"vatIncluded"`             // Цены позиций указаны с НДС
+	NetAmount     Money              `bson:"net_amount" json:"netAmount"`                 // Итого без НДС
+	VatAmount     Money              `bson:"vat_amount" json:"vatAmount"`                 // Итого НДС
+	TotalAmount   Money              `bson:"total_amount" json:"totalAmount"` // Общая стоимость
 	Notes         string             `bson:"notes,omitempty" json:"notes,omitempty"` // Дополнительные заметки
 	TransactionID primitive.ObjectID `bson:"transaction_id,omitempty" json:"transactionId,omitempty"` // Связь с транзакцией
+	TransactionIDs []primitive.ObjectID `bson:"transaction_ids,omitempty" json:"transactionIds,omitempty"` // Транзакции накладной, оформленной по сессии сканирования
+	ScanSessionID primitive.ObjectID `bson:"scan_session_id,omitempty" json:"scanSessionId,omitempty"` // Сессия сканирования
+	PurchaseOrderID primitive.ObjectID `bson:"purchase_order_id,omitempty" json:"purchaseOrderId,omitempty"` // Заказ поставщику (для приходной накладной)
 	CreatedAt     time.Time          `bson:"created_at" json:"createdAt"` // Время сохранения накладной
 }
 
@@ -89,11 +261,37 @@ type Category struct {
 	Name           string             `bson:"name" json:"name"`                                   // Название категории
 	Description    string             `bson:"description,omitempty" json:"description,omitempty"` // Описание
 	ParentCategory *string            `bson:"parent_category,omitempty" json:"parent_category,omitempty"` // Родительская категория
+	ExternalID     string             `bson:"external_id,omitempty" json:"external_id,omitempty"` // Ид группы номенклатуры в 1С
+	Attributes     []CategoryAttribute `bson:"attributes,omitempty" json:"attributes,omitempty"`  // Схема атрибутов оборудования; наследуется подкатегориями
 	IsActive       bool               `bson:"is_active" json:"is_active"`                         // Активна ли категория
+	Version        int64              `bson:"version" json:"version"`                             // Версия документа
 	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt      time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
+// Типы значений атрибутов оборудования
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeNumber  = "number"
+	AttributeTypeInteger = "integer"
+	AttributeTypeBoolean = "boolean"
+	AttributeTypeDate    = "date" // Хранится как строка YYYY-MM-DD
+	AttributeTypeEnum    = "enum"
+)
+
+// CategoryAttribute описывает атрибут оборудования категории (расход насоса, диапазон измерений анализатора).
+// Атрибут подкатегории с тем же кодом переопределяет атрибут родительской категории.
+type CategoryAttribute struct {
+	Code     string   `bson:"code" json:"code"`                         // Код атрибута (flow_rate)
+	Name     string   `bson:"name" json:"name"`                         // Название (Расход)
+	Type     string   `bson:"type" json:"type"`                         // string, number, integer, boolean, date, enum
+	Unit     string   `bson:"unit,omitempty" json:"unit,omitempty"`     // Единица измерения значения (м³/ч, бар)
+	Required bool     `bson:"required,omitempty" json:"required"`       // Значение обязательно для оборудования категории
+	Values   []string `bson:"values,omitempty" json:"values,omitempty"` // Допустимые значения (для enum)
+	Min      *float64 `bson:"min,omitempty" json:"min,omitempty"`       // Минимальное значение (для number и integer)
+	Max      *float64 `bson:"max,omitempty" json:"max,omitempty"`       // Максимальное значение (для number и integer)
+}
+
 // Address представляет адрес
 type Address struct {
 	Street     string `bson:"street" json:"street"`
@@ -121,6 +319,7 @@ type Warehouse struct {
 	AreaSqm   float64            `bson:"area_sqm" json:"area_sqm"`   // Площадь в кв.м
 	Capacity  int                `bson:"capacity" json:"capacity"`   // Вместимость
 	IsActive  bool               `bson:"is_active" json:"is_active"` // Активен ли склад
+	Version   int64              `bson:"version" json:"version"`     // Версия документа
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
 }
@@ -137,12 +336,220 @@ type ContactPerson struct {
 type Supplier struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	CompanyName   string             `bson:"company_name" json:"company_name"`       // Название компании
-	TaxID         string             `bson:"tax_id" json:"tax_id"`                   // ИНН/Налоговый номер
+	TaxID         string             `bson:"tax_id" json:"tax_id"`                   // ИНН (10 или 12 цифр)
+	KPP           string             `bson:"kpp,omitempty" json:"kpp,omitempty"`     // КПП (только для организаций)
+	OGRN          string             `bson:"ogrn,omitempty" json:"ogrn,omitempty"`   // ОГРН или ОГРНИП
 	Contact       Contact            `bson:"contact" json:"contact"`                 // Основная контактная информация
 	ContactPerson ContactPerson      `bson:"contact_person" json:"contact_person"`   // Контактное лицо
 	PaymentTerms  string             `bson:"payment_terms,omitempty" json:"payment_terms,omitempty"` // Условия оплаты
 	DeliveryTerms string             `bson:"delivery_terms,omitempty" json:"delivery_terms,omitempty"` // Условия поставки
+	LeadTimeDays  int                `bson:"lead_time_days,omitempty" json:"lead_time_days,omitempty"` // Срок поставки в днях (если нет истории заказов)
 	IsActive      bool               `bson:"is_active" json:"is_active"`             // Активен ли поставщик
+	Version       int64              `bson:"version" json:"version"`                 // Версия документа
 	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
 }
+
+// Статусы заказа поставщику
+const (
+	PurchaseOrderStatusDraft             = "draft"              // Черновик, можно редактировать
+	PurchaseOrderStatusSent              = "sent"               // Отправлен поставщику
+	PurchaseOrderStatusPartiallyReceived = "partially_received" // Получена часть заказа
+	PurchaseOrderStatusReceived          = "received"           // Все позиции получены
+	PurchaseOrderStatusClosed            = "closed"             // Закрыт, приемка невозможна
+)
+
+// PurchaseOrderLine представляет позицию заказа поставщику
+type PurchaseOrderLine struct {
+	ID                    primitive.ObjectID   `bson:"_id" json:"id"`
+	ItemID                primitive.ObjectID   `bson:"item_id" json:"item_id"`
+	ItemName              string               `bson:"item_name" json:"item_name"`
+	SerialNumber          string               `bson:"serial_number" json:"serial_number"`
+	Quantity              float64              `bson:"quantity" json:"quantity"`                               // Заказанное количество в базовой единице
+	UnitPrice             Money                `bson:"unit_price" json:"unit_price"`                           // Цена за единицу
+	TotalAmount           Money                `bson:"total_amount" json:"total_amount"`                       // Стоимость позиции
+	ExpectedDate          time.Time            `bson:"expected_date,omitempty" json:"expected_date,omitempty"` // Ожидаемая дата поставки
+	ReceivedQuantity      float64              `bson:"received_quantity" json:"received_quantity"`             // Принятое количество
+	ReceiptTransactionIDs []primitive.ObjectID `bson:"receipt_transaction_ids" json:"receipt_transaction_ids"` // Транзакции прихода по позиции
+	OutstandingQuantity   float64              `bson:"-" json:"outstanding_quantity"`                          // Вычисляется при выдаче ответа
+	OverDeliveredQuantity float64              `bson:"-" json:"over_delivered_quantity"`                       // Вычисляется при выдаче ответа
+}
+
+// Outstanding возвращает количество, которое еще не поставлено
+func (line PurchaseOrderLine) Outstanding() float64 {
+	if line.ReceivedQuantity >= line.Quantity {
+		return 0
+	}
+	return roundQuantity(line.Quantity - line.ReceivedQuantity)
+}
+
+// OverDelivered возвращает количество, принятое сверх заказанного
+func (line PurchaseOrderLine) OverDelivered() float64 {
+	if line.ReceivedQuantity <= line.Quantity {
+		return 0
+	}
+	return roundQuantity(line.ReceivedQuantity - line.Quantity)
+}
+
+// PurchaseOrder представляет заказ поставщику
+type PurchaseOrder struct {
+	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Number        string              `bson:"number" json:"number"` // Уникальный номер заказа
+	SupplierID    primitive.ObjectID  `bson:"supplier_id" json:"supplier_id"`
+	SupplierName  string              `bson:"supplier_name" json:"supplier_name"`
+	Status        string              `bson:"status" json:"status"` // draft, sent, partially_received, received, closed
+	Lines         []PurchaseOrderLine `bson:"lines" json:"lines"`
+	ExpectedDate  time.Time           `bson:"expected_date,omitempty" json:"expected_date,omitempty"`   // Ожидаемая дата поставки заказа
+	PaymentTerms  string              `bson:"payment_terms,omitempty" json:"payment_terms,omitempty"`   // По умолчанию из карточки поставщика
+	DeliveryTerms string              `bson:"delivery_terms,omitempty" json:"delivery_terms,omitempty"` // По умолчанию из карточки поставщика
+	Currency      string              `bson:"currency" json:"currency"` // Валюта заказа (ISO 4217)
+	TotalAmount   Money               `bson:"total_amount" json:"total_amount"`
+	Notes         string              `bson:"notes,omitempty" json:"notes,omitempty"`
+	CreatedBy     string              `bson:"created_by" json:"created_by"`
+	SentAt        time.Time           `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+	ReceivedAt    time.Time           `bson:"received_at,omitempty" json:"received_at,omitempty"` // Дата полной приемки
+	ClosedAt      time.Time           `bson:"closed_at,omitempty" json:"closed_at,omitempty"`
+	IsOverdue     bool                `bson:"-" json:"is_overdue"` // Вычисляется при выдаче ответа
+	Version       int64               `bson:"version" json:"version"`
+	CreatedAt     time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// Типы ресурсов, для которых ведется история изменений
+const (
+	RevisionResourceItem     = "item"
+	RevisionResourceCategory = "category"
+	RevisionResourceSupplier = "supplier"
+)
+
+// Действия, создающие ревизию
+const (
+	RevisionActionBaseline     = "baseline" // Состояние до начала ведения истории
+	RevisionActionCreate       = "create"
+	RevisionActionUpdate       = "update"
+	RevisionActionStock        = "stock" // Изменение остатка транзакцией
+	RevisionActionDelete       = "delete"
+	RevisionActionRestore      = "restore"
+	RevisionActionArchive      = "archive"
+	RevisionActionUnarchive    = "unarchive"
+	RevisionActionDecommission = "decommission"
+)
+
+// FieldChange описывает изменение одного поля (вложенные поля через точку: contact.phone)
+type FieldChange struct {
+	Field string      `bson:"field" json:"field"`
+	Old   interface{} `bson:"old,omitempty" json:"old,omitempty"`
+	New   interface{} `bson:"new,omitempty" json:"new,omitempty"`
+}
+
+// Revision представляет ревизию ресурса: кто, когда и что изменил
+type Revision struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ResourceType string             `bson:"resource_type" json:"resource_type"`                     // item, category, supplier
+	ResourceID   primitive.ObjectID `bson:"resource_id" json:"resource_id"`                         // ID ресурса
+	Version      int64              `bson:"version" json:"version"`                                 // Версия ресурса после изменения
+	Action       string             `bson:"action" json:"action"`                                   // baseline, create, update, stock, delete, restore
+	ChangedBy    string             `bson:"changed_by" json:"changed_by"`                           // Пользователь, внесший изменение
+	ChangedAt    time.Time          `bson:"changed_at" json:"changed_at"`                           // Время изменения
+	Changes      []FieldChange      `bson:"changes" json:"changes"`                                 // Измененные поля
+	Snapshot     bson.M             `bson:"snapshot,omitempty" json:"snapshot,omitempty"`           // Состояние ресурса после изменения
+	RestoredFrom int64              `bson:"restored_from,omitempty" json:"restored_from,omitempty"` // Версия, из которой восстановлен ресурс
+}
+
+// ExchangeState хранит границу последней подтвержденной выгрузки в 1С
+type ExchangeState struct {
+	ID            string    `bson:"_id" json:"kind"`                      // catalog, suppliers, documents
+	ExportedUntil time.Time `bson:"exported_until" json:"exported_until"` // Изменения до этого момента уже загружены в 1С
+	ConfirmedBy   string    `bson:"confirmed_by" json:"confirmed_by"`
+	UpdatedAt     time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Типы и статусы сессии сканирования
+const (
+	ScanSessionTypeIntake = "intake" // Приемка: сканы оформляются приходной накладной
+	ScanSessionTypeIssue  = "issue"  // Выдача: сканы оформляются расходной накладной
+
+	ScanSessionStatusOpen      = "open"      // Идет сканирование
+	ScanSessionStatusCompleted = "completed" // Проведена: созданы транзакции и накладная
+	ScanSessionStatusCancelled = "cancelled" // Отменена без движения остатков
+)
+
+// ScanSessionLine - позиция сессии сканирования: оборудование (и партия) с накопленным количеством
+type ScanSessionLine struct {
+	ID           primitive.ObjectID `bson:"_id" json:"id"`
+	ItemID       primitive.ObjectID `bson:"item_id" json:"item_id"`
+	ItemName     string             `bson:"item_name" json:"item_name"`
+	SerialNumber string             `bson:"serial_number" json:"serial_number"`
+	Unit         string             `bson:"unit" json:"unit"`                                     // Базовая единица оборудования
+	Quantity     float64            `bson:"quantity" json:"quantity"`                             // Количество в базовой единице
+	LotNumber    string             `bson:"lot_number,omitempty" json:"lot_number,omitempty"`     // Партия (для оборудования с учетом партий)
+	ExpiryDate   *time.Time         `bson:"expiry_date,omitempty" json:"expiry_date,omitempty"`   // Срок годности партии (только для приемки)
+	Scans        int                `bson:"scans" json:"scans"`                                   // Число сканирований позиции
+}
+
+// ScanEvent - запись журнала сканирований
+type ScanEvent struct {
+	Code      string             `bson:"code" json:"code"`             // Отсканированное значение
+	MatchedBy string             `bson:"matched_by" json:"matched_by"` // id, url, serial_number, barcode
+	ItemID    primitive.ObjectID `bson:"item_id" json:"item_id"`
+	LineID    primitive.ObjectID `bson:"line_id" json:"line_id"`
+	Quantity  float64            `bson:"quantity" json:"quantity"`                 // Количество в базовой единице
+	Unit      string             `bson:"unit,omitempty" json:"unit,omitempty"`     // Единица сканирования, если отличается от базовой
+	ScannedBy string             `bson:"scanned_by" json:"scanned_by"`
+	ScannedAt time.Time          `bson:"scanned_at" json:"scanned_at"`
+}
+
+// ScanSession - сессия сканирования: последовательность сканов, которая проводится одним документом
+type ScanSession struct {
+	ID              primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Number          string               `bson:"number" json:"number"` // Номер сессии, он же номер накладной
+	Type            string               `bson:"type" json:"type"`     // intake, issue
+	Status          string               `bson:"status" json:"status"` // open, completed, cancelled
+	ResponsibleUser string               `bson:"responsible_user" json:"responsible_user"`
+	DestinationUser string               `bson:"destination_user,omitempty" json:"destination_user,omitempty"` // Получатель (для выдачи)
+	SupplierID      primitive.ObjectID   `bson:"supplier_id,omitempty" json:"supplier_id,omitempty"`           // Поставщик (для приемки)
+	Reason          string               `bson:"reason,omitempty" json:"reason,omitempty"`
+	Notes           string               `bson:"notes,omitempty" json:"notes,omitempty"`
+	Lines           []ScanSessionLine    `bson:"lines" json:"lines"`
+	Scans           []ScanEvent          `bson:"scans" json:"scans"` // Журнал сканирований
+	TransactionIDs  []primitive.ObjectID `bson:"transaction_ids,omitempty" json:"transaction_ids,omitempty"` // Транзакции, созданные при проведении
+	InvoiceID       primitive.ObjectID   `bson:"invoice_id,omitempty" json:"invoice_id,omitempty"`           // Накладная, созданная при проведении
+	CreatedBy       string               `bson:"created_by" json:"created_by"`
+	CompletedAt     time.Time            `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	CancelledAt     time.Time            `bson:"cancelled_at,omitempty" json:"cancelled_at,omitempty"`
+	Version         int64                `bson:"version" json:"version"`
+	CreatedAt       time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// Владельцы и виды вложений
+const (
+	AttachmentOwnerItem    = "item"
+	AttachmentOwnerInvoice = "invoice"
+
+	AttachmentKindPhoto       = "photo"       // Фотография оборудования
+	AttachmentKindPassport    = "passport"    // Скан паспорта изделия
+	AttachmentKindCertificate = "certificate" // Сертификат, свидетельство о поверке или калибровке
+	AttachmentKindManual      = "manual"      // Руководство по эксплуатации
+	AttachmentKindOther       = "other"
+)
+
+// Attachment - метаданные вложения; содержимое хранится в хранилище файлов по ключу
+type Attachment struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OwnerType    string             `bson:"owner_type" json:"owner_type"` // item, invoice
+	OwnerID      primitive.ObjectID `bson:"owner_id" json:"owner_id"`
+	Kind         string             `bson:"kind" json:"kind"` // photo, passport, certificate, manual, other
+	FileName     string             `bson:"file_name" json:"file_name"`
+	ContentType  string             `bson:"content_type" json:"content_type"` // Определяется по содержимому файла
+	Size         int64              `bson:"size" json:"size"`
+	SHA256       string             `bson:"sha256" json:"sha256"`
+	Width        int                `bson:"width,omitempty" json:"width,omitempty"`   // Размеры изображения
+	Height       int                `bson:"height,omitempty" json:"height,omitempty"`
+	Description  string             `bson:"description,omitempty" json:"description,omitempty"`
+	StorageKey   string             `bson:"storage_key" json:"-"`
+	ThumbnailKey string             `bson:"thumbnail_key,omitempty" json:"-"`
+	HasThumbnail bool               `bson:"-" json:"has_thumbnail"` // Вычисляется при выдаче ответа
+	UploadedBy   string             `bson:"uploaded_by" json:"uploaded_by"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
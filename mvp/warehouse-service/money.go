@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Валюта по умолчанию для цен и документов
+const defaultCurrency = "RUB"
+
+// Денежные суммы хранятся с точностью до копеек
+const moneyScale = 2
+
+// Допустимые ставки НДС в процентах; отсутствие ставки означает "без НДС"
+var allowedVatRates = []int{0, 5, 7, 10, 20, 22}
+
+// Money представляет денежную сумму с точной десятичной арифметикой.
+// В MongoDB хранится как Decimal128, в JSON выводится числом.
+//
+// Правила округления (арифметическое, половина - от нуля):
+//   - цены округляются до копеек при вводе;
+//   - стоимость позиции = округление(цена * количество);
+//   - НДС считается и округляется по каждой позиции;
+//   - итоги документа - сумма уже округленных значений позиций.
+type Money struct {
+	value decimal.Decimal
+}
+
+// Сумма из целого числа рублей
+func MoneyFromInt(value int64) Money {
+	return Money{decimal.NewFromInt(value)}
+}
+
+// Сумма из числа с плавающей точкой (для старых данных), округленная до копеек
+func MoneyFromFloat(value float64) Money {
+	return Money{decimal.NewFromFloat(value).Round(moneyScale)}
+}
+
+// Разбор суммы из строки
+func ParseMoney(value string) (Money, error) {
+	d, err := decimal.NewFromString(strings.TrimSpace(value))
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{d}, nil
+}
+
+func (m Money) Add(other Money) Money { return Money{m.value.Add(other.value)} }
+
+func (m Money) Sub(other Money) Money { return Money{m.value.Sub(other.value)} }
+
+// Умножение на количество без округления
+func (m Money) MulQuantity(quantity float64) Money {
+	return Money{m.value.Mul(decimal.NewFromFloat(quantity))}
+}
+
+// Округление до копеек
+func (m Money) Round() Money { return Money{m.value.Round(moneyScale)} }
+
+// Доля суммы part/whole, округленная до копеек (списание части остатка слоя)
+func (m Money) MulRatio(part, whole float64) Money {
+	return Money{m.value.Mul(decimal.NewFromFloat(part)).Div(decimal.NewFromFloat(whole)).Round(moneyScale)}
+}
+
+// Стоимость единицы: сумма, деленная на количество, с точностью до копеек
+func (m Money) DivQuantity(quantity float64) Money {
+	return Money{m.value.Div(decimal.NewFromFloat(quantity)).Round(moneyScale)}
+}
+
+func (m Money) Neg() Money { return Money{m.value.Neg()} }
+
+// Доля суммы в процентах, округленная до копеек
+func (m Money) Percent(rate int) Money {
+	return Money{m.value.Mul(decimal.NewFromInt(int64(rate))).Div(decimal.NewFromInt(100)).Round(moneyScale)}
+}
+
+func (m Money) Cmp(other Money) int { return m.value.Cmp(other.value) }
+
+func (m Money) Equal(other Money) bool { return m.value.Equal(other.value) }
+
+func (m Money) IsZero() bool { return m.value.IsZero() }
+
+func (m Money) IsNegative() bool { return m.value.IsNegative() }
+
+// Приближенное значение для аналитики (оценка запасов, рейтинги)
+func (m Money) Float64() float64 { return m.value.InexactFloat64() }
+
+func (m Money) String() string { return m.value.String() }
+
+// Строка с двумя знаками после запятой
+func (m Money) StringFixed() string { return m.value.StringFixed(moneyScale) }
+
+// MarshalJSON выводит сумму числом, чтобы клиенты работали с ценами как раньше
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.value.String()), nil
+}
+
+// UnmarshalJSON принимает число или строку
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if err := m.value.UnmarshalJSON(data); err != nil {
+		return fmt.Errorf("invalid money amount %s", string(data))
+	}
+	return nil
+}
+
+// MarshalBSONValue сохраняет сумму как Decimal128
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	d, err := primitive.ParseDecimal128(m.value.String())
+	if err != nil {
+		return 0, nil, err
+	}
+	return bsontype.Decimal128, bsoncore.AppendDecimal128(nil, d), nil
+}
+
+// UnmarshalBSONValue читает Decimal128, а также числа, сохраненные до перехода на Decimal128
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.Decimal128:
+		d, _, ok := bsoncore.ReadDecimal128(data)
+		if !ok {
+			return fmt.Errorf("invalid decimal128 value")
+		}
+		parsed, err := ParseMoney(d.String())
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case bsontype.Double:
+		value, _, ok := bsoncore.ReadDouble(data)
+		if !ok {
+			return fmt.Errorf("invalid double value")
+		}
+		*m = MoneyFromFloat(value)
+	case bsontype.Int32:
+		value, _, ok := bsoncore.ReadInt32(data)
+		if !ok {
+			return fmt.Errorf("invalid int32 value")
+		}
+		*m = MoneyFromInt(int64(value))
+	case bsontype.Int64:
+		value, _, ok := bsoncore.ReadInt64(data)
+		if !ok {
+			return fmt.Errorf("invalid int64 value")
+		}
+		*m = MoneyFromInt(value)
+	case bsontype.Null, bsontype.Undefined:
+		*m = Money{}
+	default:
+		return fmt.Errorf("cannot decode %s into money", t)
+	}
+	return nil
+}
+
+// Нормализация и проверка кода валюты (ISO 4217, три латинские буквы)
+func normalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return defaultCurrency, nil
+	}
+	if len(currency) != 3 {
+		return "", &requestError{http.StatusBadRequest, "Currency must be a 3-letter ISO 4217 code"}
+	}
+	for _, r := range currency {
+		if r < 'A' || r > 'Z' {
+			return "", &requestError{http.StatusBadRequest, "Currency must be a 3-letter ISO 4217 code"}
+		}
+	}
+	return currency, nil
+}
+
+// Проверка цены: неотрицательная, не точнее копейки
+func validatePrice(price Money, field string) error {
+	if price.IsNegative() {
+		return &requestError{http.StatusBadRequest, field + " must be non-negative"}
+	}
+	if !price.Round().Equal(price) {
+		return &requestError{http.StatusBadRequest, field + " must not have more than 2 decimal places"}
+	}
+	return nil
+}
+
+func isAllowedVatRate(rate int) bool {
+	for _, allowed := range allowedVatRates {
+		if rate == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Расчет стоимости позиции накладной.
+// Если цены указаны с НДС, налог выделяется из суммы: НДС = сумма * ставка / (100 + ставка).
+func calculateInvoiceLine(item *InvoiceItem, vatIncluded bool) {
+	amount := item.Price.MulQuantity(item.Quantity).Round()
+	item.VatAmount = Money{}
+	if item.VatRate != nil && *item.VatRate > 0 {
+		rate := decimal.NewFromInt(int64(*item.VatRate))
+		if vatIncluded {
+			item.VatAmount = Money{amount.value.Mul(rate).Div(rate.Add(decimal.NewFromInt(100))).Round(moneyScale)}
+		} else {
+			item.VatAmount = amount.Percent(*item.VatRate)
+		}
+	}
+
+	if vatIncluded {
+		item.TotalAmount = amount
+		item.NetAmount = amount.Sub(item.VatAmount)
+	} else {
+		item.NetAmount = amount
+		item.TotalAmount = amount.Add(item.VatAmount)
+	}
+}
+
+// Проверка позиций и расчет итогов накладной по правилам округления
+func calculateInvoiceTotals(invoice *Invoice) error {
+	invoice.NetAmount, invoice.VatAmount, invoice.TotalAmount = Money{}, Money{}, Money{}
+	for i := range invoice.Items {
+		item := &invoice.Items[i]
+		if item.Quantity <= 0 {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Количество в позиции %d должно быть больше нуля", i+1)}
+		}
+		if item.Price.IsNegative() {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Цена в позиции %d не может быть отрицательной", i+1)}
+		}
+		if !item.Price.Round().Equal(item.Price) {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Цена в позиции %d указывается с точностью до копеек", i+1)}
+		}
+		if item.VatRate != nil && !isAllowedVatRate(*item.VatRate) {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Недопустимая ставка НДС в позиции %d: %d%%", i+1, *item.VatRate)}
+		}
+
+		calculateInvoiceLine(item, invoice.VatIncluded)
+		invoice.NetAmount = invoice.NetAmount.Add(item.NetAmount)
+		invoice.VatAmount = invoice.VatAmount.Add(item.VatAmount)
+		invoice.TotalAmount = invoice.TotalAmount.Add(item.TotalAmount)
+	}
+	return nil
+}
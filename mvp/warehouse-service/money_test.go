@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+func TestMoneyRounding(t *testing.T) {
+	tests := []struct {
+		name string
+		got  func() Money
+		want string
+	}{
+		{"round half up", func() Money { return mustMoney(t, "10.005").Round() }, "10.01"},
+		{"round half away from zero", func() Money { return mustMoney(t, "-10.005").Round() }, "-10.01"},
+		{"round down", func() Money { return mustMoney(t, "10.004").Round() }, "10"},
+		{"float to kopecks", func() Money { return MoneyFromFloat(0.1 + 0.2) }, "0.3"},
+		{"price times quantity", func() Money { return mustMoney(t, "33.33").MulQuantity(3).Round() }, "99.99"},
+		{"fractional quantity", func() Money { return mustMoney(t, "19.99").MulQuantity(0.125).Round() }, "2.5"},
+		{"percent", func() Money { return mustMoney(t, "99.99").Percent(20) }, "20"},
+		{"percent half kopeck", func() Money { return mustMoney(t, "0.25").Percent(10) }, "0.03"},
+		{"ratio of remaining value", func() Money { return MoneyFromInt(100).MulRatio(1, 3) }, "33.33"},
+		{"ratio rounds up", func() Money { return MoneyFromInt(100).MulRatio(2, 3) }, "66.67"},
+		{"unit cost", func() Money { return MoneyFromInt(100).DivQuantity(3) }, "33.33"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.got(); !got.Equal(mustMoney(t, tt.want)) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateInvoiceLine(t *testing.T) {
+	rate := func(value int) *int { return &value }
+
+	tests := []struct {
+		name        string
+		price       string
+		quantity    float64
+		vatRate     *int
+		vatIncluded bool
+		net         string
+		vat         string
+		total       string
+	}{
+		{"without vat", "100.10", 3, nil, false, "300.3", "0", "300.3"},
+		{"vat on top", "33.33", 3, rate(20), false, "99.99", "20", "119.99"},
+		{"vat included", "120", 1, rate(20), true, "100", "20", "120"},
+		{"vat included rounds per line", "100", 1, rate(22), true, "81.97", "18.03", "100"},
+		{"zero rate", "10", 2, rate(0), false, "20", "0", "20"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := InvoiceItem{Price: mustMoney(t, tt.price), Quantity: tt.quantity, VatRate: tt.vatRate}
+			calculateInvoiceLine(&line, tt.vatIncluded)
+			if !line.NetAmount.Equal(mustMoney(t, tt.net)) {
+				t.Errorf("net = %s, want %s", line.NetAmount, tt.net)
+			}
+			if !line.VatAmount.Equal(mustMoney(t, tt.vat)) {
+				t.Errorf("vat = %s, want %s", line.VatAmount, tt.vat)
+			}
+			if !line.TotalAmount.Equal(mustMoney(t, tt.total)) {
+				t.Errorf("total = %s, want %s", line.TotalAmount, tt.total)
+			}
+		})
+	}
+}
+
+func TestValidatePrice(t *testing.T) {
+	tests := []struct {
+		price   string
+		wantErr bool
+	}{
+		{"0", false},
+		{"10.5", false},
+		{"10.55", false},
+		{"10.555", true},
+		{"-1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.price, func(t *testing.T) {
+			err := validatePrice(mustMoney(t, tt.price), "price")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validatePrice(%s) error = %v, wantErr %v", tt.price, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -4,8 +4,10 @@ package main
 import (
 	"context"
 	"log"
+	"strings"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -18,6 +20,15 @@ var invoiceCollection *mongo.Collection
 var categoryCollection *mongo.Collection
 var warehouseLocationCollection *mongo.Collection
 var supplierCollection *mongo.Collection
+var checkoutCollection *mongo.Collection
+var revisionCollection *mongo.Collection
+var purchaseOrderCollection *mongo.Collection
+var unitCollection *mongo.Collection
+var lotCollection *mongo.Collection
+var exchangeStateCollection *mongo.Collection
+var scanSessionCollection *mongo.Collection
+var attachmentCollection *mongo.Collection
+var costLayerCollection *mongo.Collection
 
 func initMongo() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -46,10 +57,333 @@ func initMongo() error {
 	categoryCollection = db.Collection("categories")
 	warehouseLocationCollection = db.Collection("warehouses")
 	supplierCollection = db.Collection("suppliers")
+	checkoutCollection = db.Collection("checkouts")
+	revisionCollection = db.Collection("revisions")
+	purchaseOrderCollection = db.Collection("purchase_orders")
+	unitCollection = db.Collection("units")
+	lotCollection = db.Collection("lots")
+	exchangeStateCollection = db.Collection("exchange_state")
+	scanSessionCollection = db.Collection("scan_sessions")
+	attachmentCollection = db.Collection("attachments")
+	costLayerCollection = db.Collection("cost_layers")
+
+	// Создаем индексы (ошибки не критичны для запуска сервиса)
+	ensureIndexes()
+	migrateDocumentVersions()
+	migrateWarehouseActivity()
+	migrateMoneyFields()
+	migrateCostLayers()
+	migrateItemCategories()
+	seedUnits()
 	
 	return nil
 }
 
+// Создание индексов коллекций
+func ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Полнотекстовый поиск по оборудованию с русской морфологией
+	_, err := warehouseCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "name", Value: "text"},
+				{Key: "serial_number", Value: "text"},
+				{Key: "manufacturer", Value: "text"},
+				{Key: "description", Value: "text"},
+			},
+			Options: options.Index().
+				SetName("items_text").
+				SetDefaultLanguage("russian").
+				SetWeights(bson.D{
+					{Key: "name", Value: 10},
+					{Key: "serial_number", Value: 5},
+					{Key: "manufacturer", Value: 3},
+					{Key: "description", Value: 1},
+				}),
+		},
+		{Keys: bson.D{{Key: "serial_number", Value: 1}}},
+		{Keys: bson.D{{Key: "category", Value: 1}}},
+		{Keys: bson.D{{Key: "manufacturer", Value: 1}}},
+		{Keys: bson.D{{Key: "supplier_id", Value: 1}}},
+		{Keys: bson.D{{Key: "updated_at", Value: 1}}},
+		{Keys: bson.D{{Key: "external_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+		// Поиск по атрибутам категорий: набор кодов заранее неизвестен
+		{Keys: bson.D{{Key: "attributes.$**", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create items indexes: %v", err)
+	}
+
+	// Штрихкод привязан не более чем к одной единице оборудования
+	ensureBarcodeIndex(ctx)
+
+	// Уникальный код категории и поиск подкатегорий по родителю
+	_, err = categoryCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "parent_category", Value: 1}}},
+		{Keys: bson.D{{Key: "external_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create categories indexes: %v", err)
+	}
+
+	// История изменений: ревизии ресурса по версии и по времени
+	_, err = revisionCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "resource_type", Value: 1}, {Key: "resource_id", Value: 1}, {Key: "version", Value: -1}}},
+		{Keys: bson.D{{Key: "resource_type", Value: 1}, {Key: "resource_id", Value: 1}, {Key: "changed_at", Value: -1}}},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create revisions indexes: %v", err)
+	}
+
+	// Оборудование ссылается на склад по коду, поэтому код уникален
+	_, err = warehouseLocationCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "code", Value: 1}},
+		Options: options.Index().
+			SetName("warehouses_code").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"code": bson.M{"$gt": ""}}),
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create warehouses indexes: %v", err)
+	}
+
+	// ИНН уникален среди активных поставщиков
+	_, err = supplierCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tax_id", Value: 1}},
+		Options: options.Index().
+			SetName("suppliers_active_tax_id").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"is_active": true, "tax_id": bson.M{"$gt": ""}}),
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create suppliers indexes: %v", err)
+	}
+
+	// Уникальный номер заказа, заказы поставщика и заказы по оборудованию
+	_, err = purchaseOrderCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "number", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "supplier_id", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "lines.item_id", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create purchase orders indexes: %v", err)
+	}
+
+	// Уникальный код единицы измерения
+	_, err = unitCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "code", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create units indexes: %v", err)
+	}
+
+	// Уникальный номер партии в пределах оборудования и отчет по срокам годности
+	_, err = lotCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "item_id", Value: 1}, {Key: "number", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiry_date", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create lots indexes: %v", err)
+	}
+
+	// Слои себестоимости оборудования в порядке поступления и слой транзакции прихода
+	_, err = costLayerCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "item_id", Value: 1}, {Key: "received_at", Value: 1}}},
+		{Keys: bson.D{{Key: "transaction_id", Value: 1}, {Key: "item_id", Value: 1}}},
+		{Keys: bson.D{{Key: "received_at", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create cost layers indexes: %v", err)
+	}
+
+	// Движения оборудования, себестоимость расхода и приходы поставщика за период
+	_, err = transactionCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "item_id", Value: 1}, {Key: "date", Value: 1}}},
+		{Keys: bson.D{{Key: "transaction_type", Value: 1}, {Key: "date", Value: 1}}},
+		{Keys: bson.D{{Key: "supplier_id", Value: 1}, {Key: "date", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create transactions indexes: %v", err)
+	}
+
+	// Накладные для инкрементальной выгрузки в 1С и поиск накладной по транзакции
+	_, err = invoiceCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "transaction_ids", Value: 1}}, Options: options.Index().SetSparse(true)},
+		// Цены поставщика в оценке поставщиков
+		{Keys: bson.D{{Key: "purchase_order_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "items.item_id", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create invoices indexes: %v", err)
+	}
+
+	// Уникальный номер сессии сканирования и открытые сессии
+	_, err = scanSessionCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "number", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create scan sessions indexes: %v", err)
+	}
+
+	// Вложения владельца в порядке загрузки
+	_, err = attachmentCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "owner_type", Value: 1}, {Key: "owner_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create attachments indexes: %v", err)
+	}
+}
+
+// Уникальный индекс штрихкодов создается отдельно: если в базе уже есть штрихкод,
+// привязанный к нескольким единицам оборудования, индекс не создается, а остальные
+// индексы оборудования не страдают. Такие штрихкоды нужно исправить вручную,
+// до этого уникальность проверяется только при привязке штрихкода.
+func ensureBarcodeIndex(ctx context.Context) {
+	cursor, err := warehouseCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$unwind", Value: "$barcodes"}},
+		{{Key: "$group", Value: bson.M{"_id": "$barcodes.code", "items": bson.M{"$addToSet": "$_id"}}}},
+		{{Key: "$match", Value: bson.M{"items.1": bson.M{"$exists": true}}}},
+		{{Key: "$limit", Value: 20}},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to check duplicate barcodes: %v", err)
+		return
+	}
+	var duplicates []struct {
+		Code string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		log.Printf("Warning: failed to check duplicate barcodes: %v", err)
+		return
+	}
+	if len(duplicates) > 0 {
+		codes := make([]string, 0, len(duplicates))
+		for _, duplicate := range duplicates {
+			codes = append(codes, duplicate.Code)
+		}
+		log.Printf("Warning: barcodes index not created, barcodes used by several items: %s", strings.Join(codes, ", "))
+		return
+	}
+
+	_, err = warehouseCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "barcodes.code", Value: 1}},
+		Options: options.Index().SetUnique(true).SetSparse(true),
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create barcodes index: %v", err)
+	}
+}
+
+// Проставление начальной версии документам, созданным до появления поля version
+func migrateDocumentVersions() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, collection := range []*mongo.Collection{
+		warehouseCollection,
+		categoryCollection,
+		warehouseLocationCollection,
+		supplierCollection,
+	} {
+		_, err := collection.UpdateMany(ctx,
+			bson.M{"version": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"version": int64(1)}},
+		)
+		if err != nil {
+			log.Printf("Warning: failed to set document versions in %s: %v", collection.Name(), err)
+		}
+	}
+}
+
+// Склады создавались без is_active и не попадали в список активных складов.
+// Деактивированные склады хранят is_active=false, поэтому отсутствие поля означает активный склад.
+func migrateWarehouseActivity() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := warehouseLocationCollection.UpdateMany(ctx,
+		bson.M{"is_active": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"is_active": true}},
+	)
+	if err != nil {
+		log.Printf("Warning: failed to activate warehouses: %v", err)
+	}
+}
+
+// Перевод денежных полей из double в Decimal128 с округлением до копеек.
+// Суммы старых накладных сохраняются как были (без НДС), пересчет не выполняется.
+func migrateMoneyFields() {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	legacyNumber := bson.M{"$type": bson.A{"double", "int", "long"}}
+	decimal := func(field string) bson.M {
+		return bson.M{"$round": bson.A{bson.M{"$toDecimal": bson.M{"$ifNull": bson.A{field, 0}}}, moneyScale}}
+	}
+	zero := bson.M{"$toDecimal": 0}
+	currency := bson.M{"$ifNull": bson.A{"$currency", defaultCurrency}}
+
+	migrations := []struct {
+		collection *mongo.Collection
+		filter     bson.M
+		update     bson.A
+	}{
+		{warehouseCollection, bson.M{"price": legacyNumber}, bson.A{
+			bson.M{"$set": bson.M{"price": decimal("$price"), "currency": currency}},
+		}},
+		{invoiceCollection, bson.M{"total_amount": legacyNumber}, bson.A{
+			bson.M{"$set": bson.M{
+				"currency":     currency,
+				"vat_included": bson.M{"$ifNull": bson.A{"$vat_included", false}},
+				"net_amount":   decimal("$total_amount"),
+				"vat_amount":   zero,
+				"total_amount": decimal("$total_amount"),
+				"items": bson.M{"$map": bson.M{
+					"input": bson.M{"$ifNull": bson.A{"$items", bson.A{}}},
+					"as":    "item",
+					"in": bson.M{"$mergeObjects": bson.A{"$$item", bson.M{
+						"price":        decimal("$$item.price"),
+						"net_amount":   decimal("$$item.total_amount"),
+						"vat_amount":   zero,
+						"total_amount": decimal("$$item.total_amount"),
+					}}},
+				}},
+			}},
+		}},
+		{purchaseOrderCollection, bson.M{"total_amount": legacyNumber}, bson.A{
+			bson.M{"$set": bson.M{
+				"currency":     currency,
+				"total_amount": decimal("$total_amount"),
+				"lines": bson.M{"$map": bson.M{
+					"input": bson.M{"$ifNull": bson.A{"$lines", bson.A{}}},
+					"as":    "line",
+					"in": bson.M{"$mergeObjects": bson.A{"$$line", bson.M{
+						"unit_price":   decimal("$$line.unit_price"),
+						"total_amount": decimal("$$line.total_amount"),
+					}}},
+				}},
+			}},
+		}},
+	}
+
+	for _, migration := range migrations {
+		result, err := migration.collection.UpdateMany(ctx, migration.filter, migration.update)
+		if err != nil {
+			log.Printf("Warning: failed to migrate money fields in %s: %v", migration.collection.Name(), err)
+			continue
+		}
+		if result.ModifiedCount > 0 {
+			log.Printf("Migrated money fields to Decimal128 in %d documents of %s", result.ModifiedCount, migration.collection.Name())
+		}
+	}
+}
+
 // Закрываем подключение к MongoDB при завершении работы
 func closeMongo(ctx context.Context) error {
 	if mongoClient != nil {
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Размеры страниц для списков
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// pageQuery описывает запрос страницы списка с сортировкой по ключу (keyset).
+// Порядок всегда стабилен: по полю SortField, затем по _id в том же направлении.
+type pageQuery struct {
+	Limit     int
+	SortField string
+	SortDir   int // 1 - по возрастанию, -1 - по убыванию
+	after     *pageCursor
+}
+
+// pageCursor - позиция последнего документа предыдущей страницы.
+// Key - поле сортировки, для которого выдан курсор.
+// Отсутствующее поле сортировки хранится как null.
+type pageCursor struct {
+	Key   string             `bson:"k"`
+	Value bson.RawValue      `bson:"v,omitempty"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+// Пустое значение поля сортировки: null или отсутствующее поле
+func (c pageCursor) isNull() bool {
+	return c.Value.Type == 0 || c.Value.Type == bsontype.Null || c.Value.Type == bsontype.Undefined
+}
+
+// Позиция документа для курсора следующей страницы
+func cursorPosition(doc bson.Raw, sortField string) pageCursor {
+	position := pageCursor{Key: sortField, ID: doc.Lookup("_id").ObjectID()}
+	if sortField != "_id" {
+		value, err := doc.LookupErr(sortField)
+		if err != nil {
+			value = bson.RawValue{Type: bsontype.Null}
+		}
+		position.Value = value
+	}
+	return position
+}
+
+// Разбор параметров limit и cursor из запроса
+func parsePageQuery(c *gin.Context, sortField string, sortDir int) (pageQuery, error) {
+	page := pageQuery{Limit: defaultPageSize, SortField: sortField, SortDir: sortDir}
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit <= 0 {
+			return page, &requestError{http.StatusBadRequest, "Invalid limit parameter"}
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+		page.Limit = limit
+	}
+
+	if cursorParam := c.Query("cursor"); cursorParam != "" {
+		cursor, err := decodePageCursor(cursorParam)
+		if err != nil {
+			return page, &requestError{http.StatusBadRequest, "Invalid cursor parameter"}
+		}
+		// Курсор другого списка или другой сортировки указывает на чужую позицию
+		if cursor.Key != sortField {
+			return page, &requestError{http.StatusBadRequest, "Cursor does not match sort field"}
+		}
+		page.after = cursor
+	}
+
+	return page, nil
+}
+
+// Кодирование позиции в непрозрачную строку
+func encodePageCursor(cursor pageCursor) (string, error) {
+	data, err := bson.MarshalExtJSON(cursor, true, false)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Декодирование позиции из строки курсора
+func decodePageCursor(value string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor pageCursor
+	if err := bson.UnmarshalExtJSON(data, true, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// Сортировка, соответствующая курсору
+func (p pageQuery) sort() bson.D {
+	if p.SortField == "_id" {
+		return bson.D{{Key: "_id", Value: p.SortDir}}
+	}
+	return bson.D{{Key: p.SortField, Value: p.SortDir}, {Key: "_id", Value: p.SortDir}}
+}
+
+// Добавление к фильтру условия "после курсора"
+func (p pageQuery) filter(filter bson.M) bson.M {
+	if p.after == nil {
+		return filter
+	}
+
+	op := "$gt"
+	if p.SortDir < 0 {
+		op = "$lt"
+	}
+
+	// В MongoDB пустые значения сортируются раньше остальных, а сравнения $gt/$lt
+	// их не находят, поэтому для них нужны отдельные условия
+	var keyset bson.M
+	switch {
+	case p.SortField == "_id":
+		keyset = bson.M{"_id": bson.M{op: p.after.ID}}
+	case p.after.isNull():
+		conditions := []bson.M{{p.SortField: nil, "_id": bson.M{op: p.after.ID}}}
+		if p.SortDir > 0 {
+			conditions = append(conditions, bson.M{p.SortField: bson.M{"$ne": nil}})
+		}
+		keyset = bson.M{"$or": conditions}
+	default:
+		conditions := []bson.M{
+			{p.SortField: bson.M{op: p.after.Value}},
+			{p.SortField: p.after.Value, "_id": bson.M{op: p.after.ID}},
+		}
+		if p.SortDir < 0 {
+			conditions = append(conditions, bson.M{p.SortField: nil})
+		}
+		keyset = bson.M{"$or": conditions}
+	}
+
+	if len(filter) == 0 {
+		return keyset
+	}
+	return bson.M{"$and": []bson.M{filter, keyset}}
+}
+
+// Получение одной страницы документов коллекции.
+// Возвращает документы и описание пагинации для ответа клиенту.
+func findPage[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, page pageQuery) ([]T, gin.H, error) {
+	findOptions := options.Find()
+	findOptions.SetSort(page.sort())
+	findOptions.SetLimit(int64(page.Limit + 1)) // Лишний документ показывает, есть ли следующая страница
+
+	cursor, err := collection.Find(ctx, page.filter(filter), findOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var raws []bson.Raw
+	if err := cursor.All(ctx, &raws); err != nil {
+		return nil, nil, err
+	}
+
+	hasMore := len(raws) > page.Limit
+	if hasMore {
+		raws = raws[:page.Limit]
+	}
+
+	results := make([]T, 0, len(raws))
+	for _, raw := range raws {
+		var result T
+		if err := bson.Unmarshal(raw, &result); err != nil {
+			return nil, nil, err
+		}
+		results = append(results, result)
+	}
+
+	var next *string
+	if hasMore {
+		encoded, err := encodePageCursor(cursorPosition(raws[len(raws)-1], page.SortField))
+		if err != nil {
+			return nil, nil, err
+		}
+		next = &encoded
+	}
+
+	return results, gin.H{
+		"limit":    page.Limit,
+		"next":     next,
+		"has_more": hasMore,
+	}, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	date := time.Date(2025, 3, 14, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		doc   bson.D
+		field string
+	}{
+		{"string", bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "Ноутбук"}}, "name"},
+		{"date", bson.D{{Key: "_id", Value: id}, {Key: "created_at", Value: date}}, "created_at"},
+		{"int64", bson.D{{Key: "_id", Value: id}, {Key: "version", Value: int64(7)}}, "version"},
+		{"explicit null", bson.D{{Key: "_id", Value: id}, {Key: "due_date", Value: nil}}, "due_date"},
+		{"missing field", bson.D{{Key: "_id", Value: id}}, "due_date"},
+		{"id only", bson.D{{Key: "_id", Value: id}}, "_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := bson.Marshal(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			position := cursorPosition(raw, tt.field)
+
+			encoded, err := encodePageCursor(position)
+			if err != nil {
+				t.Fatalf("encodePageCursor: %v", err)
+			}
+			decoded, err := decodePageCursor(encoded)
+			if err != nil {
+				t.Fatalf("decodePageCursor: %v", err)
+			}
+			if decoded.Key != tt.field {
+				t.Errorf("key = %q, want %q", decoded.Key, tt.field)
+			}
+			if decoded.ID != id {
+				t.Errorf("id = %s, want %s", decoded.ID.Hex(), id.Hex())
+			}
+			if tt.field == "_id" {
+				return
+			}
+			if position.isNull() != decoded.isNull() {
+				t.Errorf("null = %v after round trip, want %v", decoded.isNull(), position.isNull())
+			}
+			if !position.isNull() && !decoded.Value.Equal(position.Value) {
+				t.Errorf("value = %s, want %s", decoded.Value, position.Value)
+			}
+		})
+	}
+}
+
+func TestCursorPositionMissingField(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{{Key: "_id", Value: primitive.NewObjectID()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	position := cursorPosition(raw, "due_date")
+	if position.Value.Type != bsontype.Null {
+		t.Errorf("missing field encoded as %s, want null", position.Value.Type)
+	}
+}
+
+func TestDecodePageCursorInvalid(t *testing.T) {
+	for _, value := range []string{"not base64!", "bm90IGpzb24"} {
+		t.Run(value, func(t *testing.T) {
+			if _, err := decodePageCursor(value); err == nil {
+				t.Errorf("decodePageCursor(%q) succeeded, want error", value)
+			}
+		})
+	}
+}
+
+func TestParsePageQueryCursorKey(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "name", Value: "Склад"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := encodePageCursor(cursorPosition(raw, "name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		sortField string
+		wantErr   bool
+	}{
+		{"same sort field", "name", false},
+		{"other sort field", "created_at", true},
+		{"id sort", "_id", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/?cursor="+url.QueryEscape(encoded), nil)
+			page, err := parsePageQuery(c, tt.sortField, 1)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("parsePageQuery: %v", err)
+				}
+				if page.after == nil {
+					t.Error("cursor ignored")
+				}
+				return
+			}
+			var reqErr *requestError
+			if !errors.As(err, &reqErr) || reqErr.Status != http.StatusBadRequest {
+				t.Errorf("error = %v, want 400", err)
+			}
+		})
+	}
+}
+
+func TestPageQueryFilterNulls(t *testing.T) {
+	id := primitive.NewObjectID()
+	null := pageCursor{ID: id, Value: bson.RawValue{Type: bsontype.Null}}
+	_, data, err := bson.MarshalValue("Ноутбук")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := pageCursor{ID: id, Value: bson.RawValue{Type: bsontype.String, Value: data}}
+
+	tests := []struct {
+		name       string
+		after      pageCursor
+		dir        int
+		conditions int
+		nullBranch bool // Есть условие, находящее пустые значения после курсора
+	}{
+		{"null ascending continues to values", null, 1, 2, true},
+		{"null descending stays in nulls", null, -1, 1, true},
+		{"value ascending", value, 1, 2, false},
+		{"value descending continues to nulls", value, -1, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := pageQuery{Limit: 10, SortField: "due_date", SortDir: tt.dir, after: &tt.after}
+			filter := page.filter(bson.M{})
+			conditions, ok := filter["$or"].([]bson.M)
+			if !ok {
+				t.Fatalf("filter = %v, want $or", filter)
+			}
+			if len(conditions) != tt.conditions {
+				t.Errorf("got %d conditions, want %d: %v", len(conditions), tt.conditions, conditions)
+			}
+			nullBranch := false
+			for _, condition := range conditions {
+				if v, ok := condition["due_date"]; ok && v == nil {
+					nullBranch = true
+				}
+			}
+			if nullBranch != tt.nullBranch {
+				t.Errorf("null branch = %v, want %v: %v", nullBranch, tt.nullBranch, conditions)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Тип значения редактируемого поля
+type patchFieldType int
+
+const (
+	patchString patchFieldType = iota
+	patchNumber
+	patchInteger
+	patchTime
+	patchBool
+	patchObject
+	patchObjectID
+	patchMoney
+	patchCurrency
+	patchAttributes      // Значения атрибутов: поля объекта произвольные, проверяются по схеме категории
+	patchAttributeSchema // Схема атрибутов категории: массив заменяется целиком
+)
+
+// patchField описывает поле, которое разрешено изменять частичным обновлением
+type patchField struct {
+	Type        patchFieldType
+	Required    bool        // Поле нельзя удалить (null) или оставить пустым
+	NonNegative bool        // Для чисел: значение не может быть отрицательным
+	Fields      patchSchema // Для объектов: разрешенные вложенные поля
+}
+
+// patchSchema - список разрешенных полей ресурса (имя в JSON совпадает с именем в BSON)
+type patchSchema map[string]patchField
+
+// Разрешенные для изменения поля оборудования.
+// Количество и статус меняются только транзакциями, единицы измерения - через PUT /items/:id/units,
+// штрихкоды - через PUT /items/:id/barcodes. Атрибуты объединяются по кодам, null удаляет значение.
+var warehouseItemPatchSchema = patchSchema{
+	"name":            {Type: patchString, Required: true},
+	"serial_number":   {Type: patchString, Required: true},
+	"category":        {Type: patchString, Required: true},
+	"description":     {Type: patchString},
+	"manufacturer":    {Type: patchString},
+	"price":           {Type: patchMoney, NonNegative: true},
+	"currency":        {Type: patchCurrency},
+	"min_quantity":    {Type: patchNumber, NonNegative: true},
+	"track_lots":      {Type: patchBool},
+	"location":        {Type: patchString, Required: true},
+	"warehouse":       {Type: patchString},
+	"supplier_id":     {Type: patchObjectID},
+	"external_id":     {Type: patchString},
+	"purchase_date":   {Type: patchTime},
+	"warranty_expiry": {Type: patchTime},
+	"attributes":      {Type: patchAttributes},
+}
+
+// Разрешенные для изменения поля категории
+var categoryPatchSchema = patchSchema{
+	"code":            {Type: patchString, Required: true},
+	"name":            {Type: patchString, Required: true},
+	"description":     {Type: patchString},
+	"parent_category": {Type: patchString},
+	"external_id":     {Type: patchString},
+	"attributes":      {Type: patchAttributeSchema},
+}
+
+var addressPatchSchema = patchSchema{
+	"street":      {Type: patchString},
+	"city":        {Type: patchString},
+	"region":      {Type: patchString},
+	"postal_code": {Type: patchString},
+	"country":     {Type: patchString},
+}
+
+var contactPatchSchema = patchSchema{
+	"phone":   {Type: patchString},
+	"email":   {Type: patchString},
+	"website": {Type: patchString},
+	"manager": {Type: patchString},
+}
+
+// Разрешенные для изменения поля склада
+var warehousePatchSchema = patchSchema{
+	"code":     {Type: patchString, Required: true},
+	"name":     {Type: patchString, Required: true},
+	"address":  {Type: patchObject, Fields: addressPatchSchema},
+	"contact":  {Type: patchObject, Fields: contactPatchSchema},
+	"area_sqm": {Type: patchNumber, NonNegative: true},
+	"capacity": {Type: patchInteger, NonNegative: true},
+}
+
+// Разрешенные для изменения поля поставщика
+var supplierPatchSchema = patchSchema{
+	"company_name": {Type: patchString, Required: true},
+	"tax_id":       {Type: patchString},
+	"kpp":          {Type: patchString},
+	"ogrn":         {Type: patchString},
+	"contact":      {Type: patchObject, Fields: contactPatchSchema},
+	"contact_person": {Type: patchObject, Required: true, Fields: patchSchema{
+		"name":     {Type: patchString, Required: true},
+		"position": {Type: patchString},
+		"phone":    {Type: patchString},
+		"email":    {Type: patchString},
+	}},
+	"payment_terms":  {Type: patchString},
+	"delivery_terms": {Type: patchString},
+	"lead_time_days": {Type: patchInteger, NonNegative: true},
+}
+
+// Чтение тела запроса как JSON Merge Patch (RFC 7386)
+func readMergePatch(c *gin.Context) (map[string]json.RawMessage, error) {
+	body, err := c.GetRawData()
+	if err != nil {
+		return nil, &requestError{http.StatusBadRequest, "Failed to read request body"}
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		return nil, &requestError{http.StatusBadRequest, "Request body must be a JSON object"}
+	}
+	return patch, nil
+}
+
+// Построение обновления MongoDB ($set/$unset) из merge patch.
+// Вложенные объекты объединяются по полям, null удаляет поле.
+func buildMergeUpdate(patch map[string]json.RawMessage, schema patchSchema) (bson.M, error) {
+	set := bson.M{}
+	unset := bson.M{}
+	if err := collectMergePatch(patch, schema, "", set, unset); err != nil {
+		return nil, err
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update, nil
+}
+
+// Рекурсивный разбор merge patch с проверкой полей и типов
+func collectMergePatch(patch map[string]json.RawMessage, schema patchSchema, prefix string, set, unset bson.M) error {
+	for name, raw := range patch {
+		path := prefix + name
+		field, ok := schema[name]
+		if !ok {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Field '%s' cannot be updated", path)}
+		}
+
+		// null удаляет поле
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			if field.Required {
+				return &requestError{http.StatusBadRequest, fmt.Sprintf("Field '%s' cannot be removed", path)}
+			}
+			unset[path] = ""
+			continue
+		}
+
+		if field.Type == patchObject {
+			var nested map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &nested); err != nil {
+				return &requestError{http.StatusBadRequest, fmt.Sprintf("Field '%s' must be an object", path)}
+			}
+			if err := collectMergePatch(nested, field.Fields, path+".", set, unset); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Значения атрибутов разбираются как есть: тип известен только из схемы категории
+		if field.Type == patchAttributes {
+			var nested map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &nested); err != nil {
+				return &requestError{http.StatusBadRequest, fmt.Sprintf("Field '%s' must be an object", path)}
+			}
+			for code, rawValue := range nested {
+				if bytes.Equal(bytes.TrimSpace(rawValue), []byte("null")) {
+					unset[path+"."+code] = ""
+					continue
+				}
+				decoder := json.NewDecoder(bytes.NewReader(rawValue))
+				decoder.UseNumber()
+				var value interface{}
+				if err := decoder.Decode(&value); err != nil {
+					return &requestError{http.StatusBadRequest, fmt.Sprintf("Field '%s.%s' must be a JSON value", path, code)}
+				}
+				set[path+"."+code] = value
+			}
+			continue
+		}
+
+		value, err := decodePatchValue(raw, field, path)
+		if err != nil {
+			return err
+		}
+		set[path] = value
+	}
+	return nil
+}
+
+// Проверка и преобразование значения поля в тип, сохраняемый в MongoDB
+func decodePatchValue(raw json.RawMessage, field patchField, path string) (interface{}, error) {
+	invalid := func(expected string) error {
+		return &requestError{http.StatusBadRequest, fmt.Sprintf("Field '%s' must be %s", path, expected)}
+	}
+
+	switch field.Type {
+	case patchString:
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, invalid("a string")
+		}
+		if field.Required && strings.TrimSpace(value) == "" {
+			return nil, invalid("a non-empty string")
+		}
+		return value, nil
+
+	case patchNumber, patchInteger:
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		var number json.Number
+		if err := decoder.Decode(&number); err != nil {
+			return nil, invalid("a number")
+		}
+		if field.Type == patchInteger {
+			value, err := number.Int64()
+			if err != nil {
+				return nil, invalid("an integer")
+			}
+			if field.NonNegative && value < 0 {
+				return nil, invalid("non-negative")
+			}
+			return int(value), nil
+		}
+		value, err := number.Float64()
+		if err != nil {
+			return nil, invalid("a number")
+		}
+		if field.NonNegative && value < 0 {
+			return nil, invalid("non-negative")
+		}
+		return value, nil
+
+	case patchMoney:
+		var value Money
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, invalid("a decimal amount")
+		}
+		if field.NonNegative && value.IsNegative() {
+			return nil, invalid("non-negative")
+		}
+		if !value.Round().Equal(value) {
+			return nil, invalid("rounded to 2 decimal places")
+		}
+		return value, nil
+
+	case patchCurrency:
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, invalid("a currency code")
+		}
+		currency, err := normalizeCurrency(value)
+		if err != nil {
+			return nil, invalid("a 3-letter ISO 4217 currency code")
+		}
+		return currency, nil
+
+	case patchTime:
+		var value time.Time
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, invalid("an RFC 3339 date-time")
+		}
+		return value, nil
+
+	case patchBool:
+		var value bool
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, invalid("a boolean")
+		}
+		return value, nil
+
+	case patchObjectID:
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, invalid("an ID string")
+		}
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return nil, invalid("a valid ID")
+		}
+		return id, nil
+
+	case patchAttributeSchema:
+		var value []CategoryAttribute
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, invalid("an array of attribute definitions")
+		}
+		return value, nil
+	}
+
+	return nil, invalid("a supported value")
+}
+
+// Проверка полей, которые меняются только транзакциями.
+// Совпадающее с текущим значение допускается (клиенты часто отправляют форму целиком) и отбрасывается.
+func checkStockFields(patch map[string]json.RawMessage, item WarehouseItem) error {
+	if raw, ok := patch["quantity"]; ok {
+		var quantity float64
+		if err := json.Unmarshal(raw, &quantity); err != nil || roundQuantity(quantity) != item.Quantity {
+			return &requestError{http.StatusConflict, "quantity can only be changed via transactions"}
+		}
+		delete(patch, "quantity")
+	}
+	if raw, ok := patch["status"]; ok {
+		var status string
+		if err := json.Unmarshal(raw, &status); err != nil || status != item.Status {
+			return &requestError{http.StatusConflict, "status is derived from stock and can only be changed via transactions"}
+		}
+		delete(patch, "status")
+	}
+	// Учет партий включается и выключается только без остатка: остаток должен совпадать с партиями
+	if raw, ok := patch["track_lots"]; ok {
+		var trackLots bool
+		if err := json.Unmarshal(raw, &trackLots); err == nil && trackLots != item.TrackLots && item.Quantity != 0 {
+			return &requestError{http.StatusConflict, "track_lots can only be changed while the item has no stock"}
+		}
+	}
+	return nil
+}
+
+// Пересчет статуса при изменении минимального остатка: статус производный от остатка и минимума.
+// Удаленный минимальный остаток считается нулевым.
+func applyMinQuantityStatus(update bson.M, item WarehouseItem) {
+	set, _ := update["$set"].(bson.M)
+	unset, _ := update["$unset"].(bson.M)
+
+	minQuantity := item.MinQuantity
+	switch value := set["min_quantity"].(type) {
+	case float64:
+		minQuantity = value
+	case int32:
+		minQuantity = float64(value)
+	case int64:
+		minQuantity = float64(value)
+	case int:
+		minQuantity = float64(value)
+	default:
+		if _, removed := unset["min_quantity"]; !removed {
+			return
+		}
+		minQuantity = 0
+	}
+
+	if set == nil {
+		set = bson.M{}
+		update["$set"] = set
+	}
+	set["status"] = itemStockStatus(item.Quantity, minQuantity)
+}
+
+// Применение обновления к документу коллекции с записью времени изменения и увеличением версии.
+// Обновленный документ декодируется в result и возвращается для истории изменений;
+// если документ с указанной версией не найден, возвращается mongo.ErrNoDocuments.
+func applyMergeUpdate(ctx context.Context, collection *mongo.Collection, filter bson.M, update bson.M, result interface{}) (bson.Raw, error) {
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+		update["$set"] = set
+	}
+	set["updated_at"] = time.Now()
+	update["$inc"] = bson.M{"version": 1}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	raw, err := collection.FindOneAndUpdate(ctx, filter, update, opts).Raw()
+	if err != nil {
+		return nil, err
+	}
+	return raw, bson.Unmarshal(raw, result)
+}
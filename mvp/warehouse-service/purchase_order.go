@@ -0,0 +1,844 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Статусы заказов, по которым еще возможна поставка
+var openPurchaseOrderStatuses = []string{
+	PurchaseOrderStatusDraft,
+	PurchaseOrderStatusSent,
+	PurchaseOrderStatusPartiallyReceived,
+}
+
+// Статусы заказов, по которым разрешена приемка
+var receivablePurchaseOrderStatuses = []string{
+	PurchaseOrderStatusSent,
+	PurchaseOrderStatusPartiallyReceived,
+}
+
+// PurchaseOrderLineRequest представляет позицию в запросе на создание заказа
+type PurchaseOrderLineRequest struct {
+	ItemID       string     `json:"item_id" binding:"required"`
+	Quantity     float64    `json:"quantity" binding:"required"`
+	Unit         string     `json:"unit"`       // Единица количества; в заказе хранится в базовой единице оборудования
+	UnitPrice    *Money     `json:"unit_price"` // Цена базовой единицы; по умолчанию цена из карточки оборудования
+	ExpectedDate *time.Time `json:"expected_date"`
+}
+
+// PurchaseOrderRequest представляет запрос на создание или изменение заказа поставщику
+type PurchaseOrderRequest struct {
+	Number        string                     `json:"number"` // Генерируется, если не указан
+	SupplierID    string                     `json:"supplier_id" binding:"required"`
+	Lines         []PurchaseOrderLineRequest `json:"lines" binding:"required"`
+	ExpectedDate  *time.Time                 `json:"expected_date"`
+	PaymentTerms  string                     `json:"payment_terms"`
+	DeliveryTerms string                     `json:"delivery_terms"`
+	Currency      string                     `json:"currency"` // По умолчанию RUB
+	Notes         string                     `json:"notes"`
+}
+
+// PurchaseOrderReceiptRequest представляет приемку нескольких позиций заказа
+type PurchaseOrderReceiptRequest struct {
+	ResponsibleUser string `json:"responsible_user" binding:"required"`
+	Lines           []struct {
+		LineID   string  `json:"line_id" binding:"required"`
+		Quantity float64 `json:"quantity" binding:"required"`
+		Unit     string  `json:"unit"` // По умолчанию базовая единица оборудования
+		// Партия и срок годности (для оборудования с учетом партий)
+		LotNumber  string     `json:"lot_number"`
+		ExpiryDate *time.Time `json:"expiry_date"`
+	} `json:"lines" binding:"required"`
+	AllowOverDelivery bool   `json:"allow_over_delivery"` // Разрешить приемку сверх заказанного количества
+	Notes             string `json:"notes"`
+}
+
+// purchaseOrderReceipt описывает принятое количество по позиции заказа
+type purchaseOrderReceipt struct {
+	LineID        primitive.ObjectID
+	ItemID        primitive.ObjectID
+	TransactionID primitive.ObjectID
+	Quantity      float64 // В базовой единице оборудования
+}
+
+// OutstandingPurchaseOrderLine представляет непоставленную позицию открытого заказа
+type OutstandingPurchaseOrderLine struct {
+	PurchaseOrderLine
+	PurchaseOrderID primitive.ObjectID `json:"purchase_order_id"`
+	Number          string             `json:"number"`
+	SupplierID      primitive.ObjectID `json:"supplier_id"`
+	SupplierName    string             `json:"supplier_name"`
+	Status          string             `json:"status"`
+	IsOverdue       bool               `json:"is_overdue"`
+}
+
+// Заполнение вычисляемых полей заказа: остаток, перепоставка и просрочка
+func fillPurchaseOrder(order *PurchaseOrder, now time.Time) {
+	order.IsOverdue = false
+	receivable := containsString(receivablePurchaseOrderStatuses, order.Status)
+	for i := range order.Lines {
+		line := &order.Lines[i]
+		line.OutstandingQuantity = line.Outstanding()
+		line.OverDeliveredQuantity = line.OverDelivered()
+		if receivable && line.OutstandingQuantity > 0 && lineOverdue(*line, *order, now) {
+			order.IsOverdue = true
+		}
+	}
+}
+
+// Просрочена ли поставка позиции (дата позиции или, если ее нет, дата заказа)
+func lineOverdue(line PurchaseOrderLine, order PurchaseOrder, now time.Time) bool {
+	expected := line.ExpectedDate
+	if expected.IsZero() {
+		expected = order.ExpectedDate
+	}
+	return !expected.IsZero() && expected.Before(now)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Генерация номера заказа: PO-ГГГГММДД-XXXXXX
+func generatePurchaseOrderNumber(id primitive.ObjectID, now time.Time) string {
+	hex := id.Hex()
+	return fmt.Sprintf("PO-%s-%s", now.Format("20060102"), strings.ToUpper(hex[len(hex)-6:]))
+}
+
+// Заполнение заказа из запроса: проверка поставщика и позиций, расчет сумм
+func preparePurchaseOrder(ctx context.Context, req PurchaseOrderRequest, order *PurchaseOrder) error {
+	supplierID, err := primitive.ObjectIDFromHex(req.SupplierID)
+	if err != nil {
+		return &requestError{http.StatusBadRequest, "Invalid supplier ID"}
+	}
+	var supplier Supplier
+	err = supplierCollection.FindOne(ctx, bson.M{"_id": supplierID}).Decode(&supplier)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &requestError{http.StatusBadRequest, "Supplier '" + req.SupplierID + "' not found"}
+		}
+		return err
+	}
+	if !supplier.IsActive {
+		return &requestError{http.StatusBadRequest, "Supplier '" + req.SupplierID + "' is inactive"}
+	}
+	if len(req.Lines) == 0 {
+		return &requestError{http.StatusBadRequest, "Purchase order must contain at least one line"}
+	}
+
+	currency, err := normalizeCurrency(req.Currency)
+	if err != nil {
+		return err
+	}
+
+	units, err := loadUnits(ctx)
+	if err != nil {
+		return err
+	}
+
+	lines := make([]PurchaseOrderLine, 0, len(req.Lines))
+	var total Money
+	for i, lineReq := range req.Lines {
+		itemID, err := primitive.ObjectIDFromHex(lineReq.ItemID)
+		if err != nil {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Invalid item ID in line %d", i+1)}
+		}
+		if lineReq.Quantity <= 0 {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Quantity in line %d must be positive", i+1)}
+		}
+
+		var item WarehouseItem
+		err = warehouseCollection.FindOne(ctx, bson.M{"_id": itemID}).Decode(&item)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return &requestError{http.StatusBadRequest, fmt.Sprintf("Item '%s' in line %d not found", lineReq.ItemID, i+1)}
+			}
+			return err
+		}
+		if item.Archived {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Item '%s' in line %d is archived", lineReq.ItemID, i+1)}
+		}
+
+		quantity, err := units.toBase(item, lineReq.Quantity, lineReq.Unit)
+		if err != nil {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Line %d: %s", i+1, err.Error())}
+		}
+
+		price := item.Price
+		if lineReq.UnitPrice != nil {
+			if err := validatePrice(*lineReq.UnitPrice, fmt.Sprintf("Unit price in line %d", i+1)); err != nil {
+				return err
+			}
+			price = *lineReq.UnitPrice
+		} else if itemCurrency := item.Currency; itemCurrency != "" && itemCurrency != currency {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Item price in line %d is in %s, unit_price in %s is required", i+1, itemCurrency, currency)}
+		}
+
+		line := PurchaseOrderLine{
+			ID:                    primitive.NewObjectID(),
+			ItemID:                itemID,
+			ItemName:              item.Name,
+			SerialNumber:          item.SerialNumber,
+			Quantity:              quantity,
+			UnitPrice:             price,
+			TotalAmount:           price.MulQuantity(quantity).Round(),
+			ReceiptTransactionIDs: []primitive.ObjectID{},
+		}
+		if lineReq.ExpectedDate != nil {
+			line.ExpectedDate = *lineReq.ExpectedDate
+		}
+		lines = append(lines, line)
+		total = total.Add(line.TotalAmount)
+	}
+
+	order.SupplierID = supplierID
+	order.SupplierName = supplier.CompanyName
+	order.Lines = lines
+	order.Currency = currency
+	order.TotalAmount = total
+	order.Notes = req.Notes
+	order.ExpectedDate = time.Time{}
+	if req.ExpectedDate != nil {
+		order.ExpectedDate = *req.ExpectedDate
+	}
+
+	// Условия оплаты и поставки по умолчанию берутся из карточки поставщика
+	order.PaymentTerms = req.PaymentTerms
+	if order.PaymentTerms == "" {
+		order.PaymentTerms = supplier.PaymentTerms
+	}
+	order.DeliveryTerms = req.DeliveryTerms
+	if order.DeliveryTerms == "" {
+		order.DeliveryTerms = supplier.DeliveryTerms
+	}
+	return nil
+}
+
+// Создание заказа поставщику (в статусе черновика)
+func createPurchaseOrder(c *gin.Context) {
+	var req PurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	order := PurchaseOrder{
+		ID:        primitive.NewObjectID(),
+		Number:    strings.TrimSpace(req.Number),
+		Status:    PurchaseOrderStatusDraft,
+		CreatedBy: requestUser(c),
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if order.Number == "" {
+		order.Number = generatePurchaseOrderNumber(order.ID, now)
+	}
+	if err := preparePurchaseOrder(ctx, req, &order); err != nil {
+		respondError(c, err, "Failed to validate purchase order: ")
+		return
+	}
+
+	if _, err := purchaseOrderCollection.InsertOne(ctx, order); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Purchase order with number '" + order.Number + "' already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase order: " + err.Error()})
+		return
+	}
+
+	fillPurchaseOrder(&order, now)
+	setETag(c, order.Version)
+	c.JSON(http.StatusCreated, gin.H{"message": "Purchase order created successfully", "purchase_order": order})
+}
+
+// Список заказов поставщикам
+func listPurchaseOrders(c *gin.Context) {
+	filter := bson.M{}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = bson.M{"$in": strings.Split(status, ",")}
+	}
+	if supplierID := c.Query("supplier_id"); supplierID != "" {
+		id, err := primitive.ObjectIDFromHex(supplierID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+			return
+		}
+		filter["supplier_id"] = id
+	}
+	if itemID := c.Query("item_id"); itemID != "" {
+		id, err := primitive.ObjectIDFromHex(itemID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID format"})
+			return
+		}
+		filter["lines.item_id"] = id
+	}
+
+	// Постраничный вывод: новые заказы первыми
+	page, err := parsePageQuery(c, "created_at", -1)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	orders, pagination, err := findPage[PurchaseOrder](ctx, purchaseOrderCollection, filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase orders: " + err.Error()})
+		return
+	}
+	now := time.Now()
+	for i := range orders {
+		fillPurchaseOrder(&orders[i], now)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"purchase_orders": orders, "pagination": pagination})
+}
+
+// Непоставленные позиции открытых заказов (для контроля поставок)
+func listOutstandingPurchaseOrderLines(c *gin.Context) {
+	filter := bson.M{"status": bson.M{"$in": receivablePurchaseOrderStatuses}}
+	if supplierID := c.Query("supplier_id"); supplierID != "" {
+		id, err := primitive.ObjectIDFromHex(supplierID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+			return
+		}
+		filter["supplier_id"] = id
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := purchaseOrderCollection.Find(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase orders: " + err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var orders []PurchaseOrder
+	if err := cursor.All(ctx, &orders); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode purchase orders: " + err.Error()})
+		return
+	}
+
+	now := time.Now()
+	overdueOnly := c.Query("overdue") == "true"
+	lines := []OutstandingPurchaseOrderLine{}
+	for _, order := range orders {
+		fillPurchaseOrder(&order, now)
+		for _, line := range order.Lines {
+			if line.OutstandingQuantity == 0 {
+				continue
+			}
+			overdue := lineOverdue(line, order, now)
+			if overdueOnly && !overdue {
+				continue
+			}
+			lines = append(lines, OutstandingPurchaseOrderLine{
+				PurchaseOrderLine: line,
+				PurchaseOrderID:   order.ID,
+				Number:            order.Number,
+				SupplierID:        order.SupplierID,
+				SupplierName:      order.SupplierName,
+				Status:            order.Status,
+				IsOverdue:         overdue,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lines": lines, "total": len(lines)})
+}
+
+// Получение заказа поставщику по ID
+func getPurchaseOrder(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var order PurchaseOrder
+	if err := purchaseOrderCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&order); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order: " + err.Error()})
+		return
+	}
+
+	fillPurchaseOrder(&order, time.Now())
+	setETag(c, order.Version)
+	c.JSON(http.StatusOK, order)
+}
+
+// Загрузка заказа для изменения с проверкой ID и If-Match
+func loadPurchaseOrderForUpdate(c *gin.Context, ctx context.Context, order *PurchaseOrder) bool {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return false
+	}
+	version, err := parseIfMatch(c)
+	if err != nil {
+		respondError(c, err, "")
+		return false
+	}
+	_, ok := loadForUpdate(c, ctx, purchaseOrderCollection, id, version, "Purchase order not found", order)
+	return ok
+}
+
+// Применение изменения заказа с проверкой версии
+func savePurchaseOrderUpdate(c *gin.Context, ctx context.Context, order PurchaseOrder, update bson.M, message string) {
+	var updated PurchaseOrder
+	if _, err := applyMergeUpdate(ctx, purchaseOrderCollection, versionFilter(order.ID, order.Version), update, &updated); err != nil {
+		if err == mongo.ErrNoDocuments {
+			respondVersionConflict(c, ctx, purchaseOrderCollection, order.ID, "Purchase order not found")
+		} else if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Purchase order with this number already exists"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase order: " + err.Error()})
+		}
+		return
+	}
+
+	fillPurchaseOrder(&updated, time.Now())
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, gin.H{"message": message, "purchase_order": updated})
+}
+
+// Изменение заказа поставщику (только черновик)
+func updatePurchaseOrder(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var order PurchaseOrder
+	if !loadPurchaseOrderForUpdate(c, ctx, &order) {
+		return
+	}
+	if order.Status != PurchaseOrderStatusDraft {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only draft purchase orders can be edited"})
+		return
+	}
+
+	var req PurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := preparePurchaseOrder(ctx, req, &order); err != nil {
+		respondError(c, err, "Failed to validate purchase order: ")
+		return
+	}
+	if number := strings.TrimSpace(req.Number); number != "" {
+		order.Number = number
+	}
+
+	set := bson.M{
+		"number":         order.Number,
+		"supplier_id":    order.SupplierID,
+		"supplier_name":  order.SupplierName,
+		"lines":          order.Lines,
+		"currency":       order.Currency,
+		"total_amount":   order.TotalAmount,
+		"payment_terms":  order.PaymentTerms,
+		"delivery_terms": order.DeliveryTerms,
+		"notes":          order.Notes,
+	}
+	update := bson.M{"$set": set}
+	if order.ExpectedDate.IsZero() {
+		update["$unset"] = bson.M{"expected_date": ""}
+	} else {
+		set["expected_date"] = order.ExpectedDate
+	}
+
+	savePurchaseOrderUpdate(c, ctx, order, update, "Purchase order updated successfully")
+}
+
+// Удаление черновика заказа
+func deletePurchaseOrder(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var order PurchaseOrder
+	if !loadPurchaseOrderForUpdate(c, ctx, &order) {
+		return
+	}
+	if order.Status != PurchaseOrderStatusDraft {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only draft purchase orders can be deleted. Close it instead."})
+		return
+	}
+
+	result, err := purchaseOrderCollection.DeleteOne(ctx, versionFilter(order.ID, order.Version))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete purchase order: " + err.Error()})
+		return
+	}
+	if result.DeletedCount == 0 {
+		respondVersionConflict(c, ctx, purchaseOrderCollection, order.ID, "Purchase order not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Purchase order deleted successfully"})
+}
+
+// Отправка заказа поставщику: после отправки заказ нельзя редактировать
+func sendPurchaseOrder(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var order PurchaseOrder
+	if !loadPurchaseOrderForUpdate(c, ctx, &order) {
+		return
+	}
+	if order.Status != PurchaseOrderStatusDraft {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only draft purchase orders can be sent"})
+		return
+	}
+
+	savePurchaseOrderUpdate(c, ctx, order, bson.M{"$set": bson.M{
+		"status":  PurchaseOrderStatusSent,
+		"sent_at": time.Now(),
+	}}, "Purchase order sent successfully")
+}
+
+// Закрытие заказа: недопоставленные позиции больше не ожидаются
+func closePurchaseOrder(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var order PurchaseOrder
+	if !loadPurchaseOrderForUpdate(c, ctx, &order) {
+		return
+	}
+	if order.Status == PurchaseOrderStatusDraft || order.Status == PurchaseOrderStatusClosed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Purchase order in status '" + order.Status + "' cannot be closed"})
+		return
+	}
+
+	savePurchaseOrderUpdate(c, ctx, order, bson.M{"$set": bson.M{
+		"status":    PurchaseOrderStatusClosed,
+		"closed_at": time.Now(),
+	}}, "Purchase order closed successfully")
+}
+
+// Проверка прихода по заказу в запросе транзакции
+func preparePurchaseOrderReceipt(req TransactionRequest, transaction *InventoryTransaction) error {
+	if req.PurchaseOrderID == "" {
+		if req.PurchaseOrderLineID != "" {
+			return &requestError{http.StatusBadRequest, "purchase_order_id is required with purchase_order_line_id"}
+		}
+		return nil
+	}
+	if req.TransactionType != "intake" {
+		return &requestError{http.StatusBadRequest, "purchase_order_id is only allowed for intake transactions"}
+	}
+
+	orderID, err := primitive.ObjectIDFromHex(req.PurchaseOrderID)
+	if err != nil {
+		return &requestError{http.StatusBadRequest, "Invalid purchase order ID"}
+	}
+	lineID, err := primitive.ObjectIDFromHex(req.PurchaseOrderLineID)
+	if err != nil {
+		return &requestError{http.StatusBadRequest, "Invalid or missing purchase_order_line_id"}
+	}
+	transaction.PurchaseOrderID = orderID
+	transaction.PurchaseOrderLineID = lineID
+	return nil
+}
+
+// Учет принятого количества по позициям заказа в транзакции MongoDB.
+// Приемка сверх остатка допускается только с allowOverDelivery; статус заказа пересчитывается.
+func receivePurchaseOrderLines(sessCtx mongo.SessionContext, orderID primitive.ObjectID, receipts []purchaseOrderReceipt, allowOverDelivery bool) (PurchaseOrder, error) {
+	var order PurchaseOrder
+	if err := purchaseOrderCollection.FindOne(sessCtx, bson.M{"_id": orderID}).Decode(&order); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return order, &requestError{http.StatusBadRequest, "Purchase order not found"}
+		}
+		return order, err
+	}
+	if !containsString(receivablePurchaseOrderStatuses, order.Status) {
+		return order, &requestError{http.StatusConflict, "Purchase order in status '" + order.Status + "' cannot be received"}
+	}
+
+	for _, receipt := range receipts {
+		index := -1
+		for i, line := range order.Lines {
+			if line.ID == receipt.LineID {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return order, &requestError{http.StatusBadRequest, "Purchase order line '" + receipt.LineID.Hex() + "' not found"}
+		}
+
+		line := &order.Lines[index]
+		if !receipt.ItemID.IsZero() && receipt.ItemID != line.ItemID {
+			return order, &requestError{http.StatusBadRequest, "Item does not match purchase order line '" + receipt.LineID.Hex() + "'"}
+		}
+		if !allowOverDelivery && receipt.Quantity > line.Outstanding() {
+			return order, &requestError{http.StatusConflict, fmt.Sprintf(
+				"Received quantity exceeds outstanding quantity %s for line '%s'; pass allow_over_delivery to accept",
+				formatQuantity(line.Outstanding()), receipt.LineID.Hex())}
+		}
+		line.ReceivedQuantity = roundQuantity(line.ReceivedQuantity + receipt.Quantity)
+		line.ReceiptTransactionIDs = append(line.ReceiptTransactionIDs, receipt.TransactionID)
+	}
+
+	// Заказ получен, когда по всем позициям не осталось непоставленного количества
+	now := time.Now()
+	order.Status = PurchaseOrderStatusReceived
+	for _, line := range order.Lines {
+		if line.Outstanding() > 0 {
+			order.Status = PurchaseOrderStatusPartiallyReceived
+			break
+		}
+	}
+	set := bson.M{
+		"lines":      order.Lines,
+		"status":     order.Status,
+		"updated_at": now,
+	}
+	if order.Status == PurchaseOrderStatusReceived {
+		order.ReceivedAt = now
+		set["received_at"] = now
+	}
+
+	result, err := purchaseOrderCollection.UpdateOne(sessCtx, versionFilter(order.ID, order.Version), bson.M{
+		"$set": set,
+		"$inc": bson.M{"version": 1},
+	})
+	if err != nil {
+		return order, err
+	}
+	if result.MatchedCount == 0 {
+		return order, &requestError{http.StatusConflict, "Purchase order was modified concurrently, retry the receipt"}
+	}
+
+	order.Version++
+	order.UpdatedAt = now
+	fillPurchaseOrder(&order, now)
+	return order, nil
+}
+
+// Приемка нескольких позиций заказа: по каждой позиции создается транзакция прихода
+func receivePurchaseOrder(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	var req PurchaseOrderReceiptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Lines) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Receipt must contain at least one line"})
+		return
+	}
+
+	receipts := make([]purchaseOrderReceipt, 0, len(req.Lines))
+	for _, line := range req.Lines {
+		lineID, err := primitive.ObjectIDFromHex(line.LineID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order line ID"})
+			return
+		}
+		if line.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Received quantity must be positive"})
+			return
+		}
+		receipts = append(receipts, purchaseOrderReceipt{LineID: lineID, Quantity: line.Quantity})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	units, err := loadUnits(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load units: " + err.Error()})
+		return
+	}
+
+	session, err := mongoClient.StartSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session: " + err.Error()})
+		return
+	}
+	defer session.EndSession(ctx)
+
+	var order PurchaseOrder
+	var transactions []InventoryTransaction
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		transactions = nil
+
+		var current PurchaseOrder
+		if err := purchaseOrderCollection.FindOne(sessCtx, bson.M{"_id": orderID}).Decode(&current); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, &requestError{http.StatusNotFound, "Purchase order not found"}
+			}
+			return nil, err
+		}
+		lines := map[primitive.ObjectID]PurchaseOrderLine{}
+		for _, line := range current.Lines {
+			lines[line.ID] = line
+		}
+
+		for i := range receipts {
+			line, ok := lines[receipts[i].LineID]
+			if !ok {
+				return nil, &requestError{http.StatusBadRequest, "Purchase order line '" + receipts[i].LineID.Hex() + "' not found"}
+			}
+
+			// Оборудование перечитывается для каждой позиции: одна позиция может встречаться несколько раз
+			var item WarehouseItem
+			if err := warehouseCollection.FindOne(sessCtx, bson.M{"_id": line.ItemID}).Decode(&item); err != nil {
+				if err == mongo.ErrNoDocuments {
+					return nil, &requestError{http.StatusBadRequest, "Item '" + line.ItemID.Hex() + "' not found"}
+				}
+				return nil, err
+			}
+			if item.Archived {
+				return nil, &requestError{http.StatusConflict, "Item '" + item.Name + "' is archived"}
+			}
+			quantity, err := units.toBase(item, req.Lines[i].Quantity, req.Lines[i].Unit)
+			if err != nil {
+				return nil, err
+			}
+			receipts[i].Quantity = quantity
+
+			transaction := InventoryTransaction{
+				ID:                  primitive.NewObjectID(),
+				ItemID:              item.ID,
+				TransactionType:     "intake",
+				Quantity:            quantity,
+				ResponsibleUser:     req.ResponsibleUser,
+				Reason:              "Приемка по заказу " + current.Number,
+				Notes:               req.Notes,
+				Date:                time.Now(),
+				PurchaseOrderID:     current.ID,
+				PurchaseOrderLineID: line.ID,
+				SupplierID:          current.SupplierID,
+			}
+			if unit := req.Lines[i].Unit; unit != "" && unit != itemUnit(item) {
+				transaction.Unit = unit
+				transaction.UnitQuantity = req.Lines[i].Quantity
+			}
+			lots, err := prepareLotMovement(sessCtx, item, "intake", req.Lines[i].LotNumber, req.Lines[i].ExpiryDate, quantity)
+			if err != nil {
+				return nil, err
+			}
+			if lots != nil {
+				transaction.Lots = lots.Allocations
+			}
+			if err := postTransactionCost(sessCtx, item, &transaction, intakeReceipt(item, transaction, &current)); err != nil {
+				return nil, err
+			}
+			if _, err := transactionCollection.InsertOne(sessCtx, transaction); err != nil {
+				return nil, err
+			}
+			if _, err := updateItemStock(sessCtx, item, roundQuantity(item.Quantity+transaction.Quantity), req.ResponsibleUser); err != nil {
+				return nil, err
+			}
+			if err := lots.apply(sessCtx); err != nil {
+				return nil, err
+			}
+
+			receipts[i].ItemID = item.ID
+			receipts[i].TransactionID = transaction.ID
+			transactions = append(transactions, transaction)
+		}
+
+		var err error
+		order, err = receivePurchaseOrderLines(sessCtx, orderID, receipts, req.AllowOverDelivery)
+		return nil, err
+	})
+	if err != nil {
+		respondError(c, err, "Failed to receive purchase order: ")
+		return
+	}
+
+	// По каждому приходу требуется приходная накладная
+	go func(transactions []InventoryTransaction) {
+		for _, transaction := range transactions {
+			if err := sendInvoiceRequiredNotification(transaction.ID, transaction.TransactionType); err != nil {
+				log.Printf("Failed to send invoice required notification: %v", err)
+			}
+		}
+	}(transactions)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":        "Purchase order received successfully",
+		"purchase_order": order,
+		"transactions":   transactions,
+	})
+}
+
+// Проверка приходной накладной по заказу: позиции накладной должны входить в заказ
+func validateInvoicePurchaseOrder(ctx context.Context, orderID primitive.ObjectID, invoice Invoice) error {
+	if invoice.Type != InvoiceTypeReceipt {
+		return &requestError{http.StatusBadRequest, "Заказ поставщику можно указать только в приходной накладной"}
+	}
+
+	var order PurchaseOrder
+	if err := purchaseOrderCollection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &requestError{http.StatusBadRequest, "Заказ поставщику не найден"}
+		}
+		return err
+	}
+	if order.Status == PurchaseOrderStatusDraft {
+		return &requestError{http.StatusConflict, "Заказ поставщику еще не отправлен"}
+	}
+
+	ordered := map[primitive.ObjectID]bool{}
+	for _, line := range order.Lines {
+		ordered[line.ItemID] = true
+	}
+	for _, item := range invoice.Items {
+		if !ordered[item.ItemID] {
+			return &requestError{http.StatusBadRequest, "Позиция '" + item.Name + "' отсутствует в заказе " + order.Number}
+		}
+	}
+
+	// Транзакция накладной должна относиться к тому же заказу
+	if !invoice.TransactionID.IsZero() {
+		var transaction InventoryTransaction
+		err := transactionCollection.FindOne(ctx, bson.M{"_id": invoice.TransactionID}).Decode(&transaction)
+		if err == nil && !transaction.PurchaseOrderID.IsZero() && transaction.PurchaseOrderID != orderID {
+			return &requestError{http.StatusBadRequest, "Транзакция накладной относится к другому заказу поставщику"}
+		}
+	}
+	return nil
+}
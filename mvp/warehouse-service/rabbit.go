@@ -25,6 +25,9 @@ const (
 	InvoiceCreatedKey   = "invoice.created"
 	InvoiceRequiredKey  = "invoice.required"
 	InvoiceQueueName    = "invoice_notifications_queue"
+	CheckoutOverdueKey  = "checkout.overdue"
+	WarrantyExpiringKey = "warranty.expiring"
+	AlertsQueueName     = "warehouse_alerts_queue"
 )
 
 // Сообщение о создании оборудования
@@ -43,6 +46,32 @@ type EquipmentCreatedMessage struct {
 	CreatedAt       time.Time `json:"created_at"`
 }
 
+// Сообщение о просроченном возврате оборудования
+type CheckoutOverdueMessage struct {
+	CheckoutID          string    `json:"checkout_id"`
+	ItemID              string    `json:"item_id"`
+	ItemName            string    `json:"item_name"`
+	SerialNumber        string    `json:"serial_number"`
+	Holder              string    `json:"holder"`
+	ResponsibleUser     string    `json:"responsible_user"`
+	OutstandingQuantity float64   `json:"outstanding_quantity"`
+	Unit                string    `json:"unit"` // Обозначение единицы (шт, м)
+	DueDate             time.Time `json:"due_date"`
+	DaysOverdue         int       `json:"days_overdue"`
+}
+
+// Сообщение о скором окончании гарантии
+type WarrantyExpiringMessage struct {
+	ItemID         string    `json:"item_id"`
+	Name           string    `json:"name"`
+	SerialNumber   string    `json:"serial_number"`
+	Category       string    `json:"category"`
+	Location       string    `json:"location"`
+	WarrantyExpiry time.Time `json:"warranty_expiry"`
+	DaysLeft       int       `json:"days_left"`
+	WindowDays     int       `json:"window_days"`
+}
+
 // Инициализация подключения к RabbitMQ
 func initRabbitMQ() error {
 	// Получаем URI из переменной окружения или используем значение по умолчанию
@@ -150,6 +179,46 @@ func initRabbitMQ() error {
 		return err
 	}
 
+	// Объявление очереди для предупреждений склада (просрочки и т.п.)
+	alertsQueue, err := ch.QueueDeclare(
+		AlertsQueueName, // name
+		true,            // durable
+		false,           // delete when unused
+		false,           // exclusive
+		false,           // no-wait
+		nil,             // arguments
+	)
+	if err != nil {
+		log.Printf("Failed to declare alerts queue: %v", err)
+		return err
+	}
+
+	// Связывание очереди предупреждений с обменом для просроченных выдач
+	err = ch.QueueBind(
+		alertsQueue.Name,   // queue name
+		CheckoutOverdueKey, // routing key
+		ExchangeName,       // exchange
+		false,              // no-wait
+		nil,                // arguments
+	)
+	if err != nil {
+		log.Printf("Failed to bind checkout overdue queue: %v", err)
+		return err
+	}
+
+	// Связывание очереди предупреждений с обменом для окончания гарантии
+	err = ch.QueueBind(
+		alertsQueue.Name,    // queue name
+		WarrantyExpiringKey, // routing key
+		ExchangeName,        // exchange
+		false,               // no-wait
+		nil,                 // arguments
+	)
+	if err != nil {
+		log.Printf("Failed to bind warranty expiring queue: %v", err)
+		return err
+	}
+
 	return nil
 }
 
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Параметры планирования закупок по умолчанию
+const (
+	defaultReorderHistoryDays  = 90   // Период истории расхода
+	defaultReorderCoverageDays = 30   // На сколько дней расхода заказывать сверх точки заказа
+	defaultReorderSafetyFactor = 1.65 // Коэффициент страхового запаса (уровень сервиса ~95%)
+	defaultReorderLeadTimeDays = 14   // Срок поставки, если нет истории и он не указан у поставщика
+)
+
+// Источники срока поставки
+const (
+	LeadTimeSourceHistory  = "history"  // Среднее по полученным заказам поставщика
+	LeadTimeSourceSupplier = "supplier" // Указан в карточке поставщика
+	LeadTimeSourceDefault  = "default"  // Значение по умолчанию
+)
+
+// Параметры расчета рекомендаций к заказу
+type reorderParams struct {
+	HistoryDays  int     `json:"history_days"`
+	CoverageDays int     `json:"coverage_days"`
+	SafetyFactor float64 `json:"safety_factor"`
+}
+
+// ReorderSuggestion представляет рекомендацию к заказу оборудования
+type ReorderSuggestion struct {
+	ItemID              primitive.ObjectID `json:"item_id"`
+	Name                string             `json:"name"`
+	SerialNumber        string             `json:"serial_number"`
+	Category            string             `json:"category"`
+	SupplierID          primitive.ObjectID `json:"supplier_id,omitempty"`
+	SupplierName        string             `json:"supplier_name,omitempty"`
+	Unit                string             `json:"unit"`                  // Базовая единица, в которой указаны количества
+	Quantity            float64            `json:"quantity"`              // Текущий остаток
+	OnOrder             float64            `json:"on_order"`              // Ожидается по открытым заказам
+	MinQuantity         float64            `json:"min_quantity"`          // Минимальный остаток
+	AvgDailyConsumption float64            `json:"avg_daily_consumption"` // Средний расход в день
+	ConsumptionStdDev   float64            `json:"consumption_std_dev"`   // Стандартное отклонение дневного расхода
+	LeadTimeDays        float64            `json:"lead_time_days"`
+	LeadTimeSource      string             `json:"lead_time_source"` // history, supplier, default
+	SafetyStock         float64            `json:"safety_stock"`
+	ReorderPoint        float64            `json:"reorder_point"`
+	SuggestedQuantity   float64            `json:"suggested_quantity"`
+	UnitPrice           Money              `json:"unit_price"`
+	Currency            string             `json:"currency,omitempty"`
+	NeedsReorder        bool               `json:"needs_reorder"`
+}
+
+// ReorderPurchaseOrderRequest представляет принятые рекомендации для создания заказов
+type ReorderPurchaseOrderRequest struct {
+	Lines []struct {
+		ItemID     string  `json:"item_id" binding:"required"`
+		Quantity   float64 `json:"quantity" binding:"required"`
+		Unit       string  `json:"unit"`        // По умолчанию базовая единица оборудования
+		SupplierID string  `json:"supplier_id"` // По умолчанию поставщик из карточки оборудования
+		UnitPrice  *Money  `json:"unit_price"`
+	} `json:"lines" binding:"required"`
+	Notes string `json:"notes"`
+}
+
+// Статистика расхода оборудования
+type consumptionStats struct {
+	AvgDaily float64
+	StdDev   float64
+}
+
+// Срок поставки по умолчанию из REORDER_DEFAULT_LEAD_TIME_DAYS
+func defaultLeadTimeDays() float64 {
+	value := os.Getenv("REORDER_DEFAULT_LEAD_TIME_DAYS")
+	if value == "" {
+		return defaultReorderLeadTimeDays
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days <= 0 {
+		log.Printf("Warning: invalid REORDER_DEFAULT_LEAD_TIME_DAYS %q, using default", value)
+		return defaultReorderLeadTimeDays
+	}
+	return float64(days)
+}
+
+// Разбор параметров расчета из запроса
+func parseReorderParams(c *gin.Context) (reorderParams, error) {
+	params := reorderParams{
+		HistoryDays:  defaultReorderHistoryDays,
+		CoverageDays: defaultReorderCoverageDays,
+		SafetyFactor: defaultReorderSafetyFactor,
+	}
+	if value := c.Query("history_days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 || days > 3650 {
+			return params, &requestError{http.StatusBadRequest, "Invalid history_days parameter"}
+		}
+		params.HistoryDays = days
+	}
+	if value := c.Query("coverage_days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return params, &requestError{http.StatusBadRequest, "Invalid coverage_days parameter"}
+		}
+		params.CoverageDays = days
+	}
+	if value := c.Query("safety_factor"); value != "" {
+		factor, err := strconv.ParseFloat(value, 64)
+		if err != nil || factor < 0 {
+			return params, &requestError{http.StatusBadRequest, "Invalid safety_factor parameter"}
+		}
+		params.SafetyFactor = factor
+	}
+	return params, nil
+}
+
+// Расход оборудования по дням за период: выдача, корректировка и списание за вычетом возвратов
+func consumptionByItem(ctx context.Context, from time.Time, days int) (map[primitive.ObjectID]consumptionStats, error) {
+	cursor, err := transactionCollection.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{
+			"transaction_type": bson.M{"$in": []string{"issue", "adjustment", TransactionTypeWriteOff, "return"}},
+			"date":             bson.M{"$gte": from},
+		}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"item_id": "$item_id",
+				"day":     bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$date"}},
+			},
+			"quantity": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$transaction_type", "return"}},
+				bson.M{"$multiply": bson.A{"$quantity", -1}},
+				"$quantity",
+			}}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var buckets []struct {
+		ID struct {
+			ItemID primitive.ObjectID `bson:"item_id"`
+		} `bson:"_id"`
+		Quantity float64 `bson:"quantity"`
+	}
+	if err := cursor.All(ctx, &buckets); err != nil {
+		return nil, err
+	}
+
+	daily := map[primitive.ObjectID][]float64{}
+	for _, bucket := range buckets {
+		daily[bucket.ID.ItemID] = append(daily[bucket.ID.ItemID], math.Max(bucket.Quantity, 0))
+	}
+
+	// Дни без расхода учитываются как нулевые
+	stats := map[primitive.ObjectID]consumptionStats{}
+	for itemID, values := range daily {
+		var sum, squares float64
+		for _, value := range values {
+			sum += value
+			squares += value * value
+		}
+		mean := sum / float64(days)
+		variance := squares/float64(days) - mean*mean
+		stats[itemID] = consumptionStats{AvgDaily: mean, StdDev: math.Sqrt(math.Max(variance, 0))}
+	}
+	return stats, nil
+}
+
+// Средний фактический срок поставки (от отправки до полной приемки) по поставщикам
+func historicalLeadTimes(ctx context.Context) (map[primitive.ObjectID]float64, error) {
+	cursor, err := purchaseOrderCollection.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{
+			"sent_at":     bson.M{"$gt": time.Time{}},
+			"received_at": bson.M{"$gt": time.Time{}},
+		}},
+		{"$group": bson.M{
+			"_id":     "$supplier_id",
+			"average": bson.M{"$avg": bson.M{"$subtract": bson.A{"$received_at", "$sent_at"}}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		SupplierID primitive.ObjectID `bson:"_id"`
+		Average    float64            `bson:"average"` // В миллисекундах
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	leadTimes := map[primitive.ObjectID]float64{}
+	for _, result := range results {
+		leadTimes[result.SupplierID] = math.Round(result.Average/float64(24*time.Hour/time.Millisecond)*10) / 10
+	}
+	return leadTimes, nil
+}
+
+// Количество, ожидаемое по открытым заказам
+func onOrderByItem(ctx context.Context) (map[primitive.ObjectID]float64, error) {
+	cursor, err := purchaseOrderCollection.Find(ctx, bson.M{"status": bson.M{"$in": openPurchaseOrderStatuses}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var orders []PurchaseOrder
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+
+	onOrder := map[primitive.ObjectID]float64{}
+	for _, order := range orders {
+		for _, line := range order.Lines {
+			onOrder[line.ItemID] = roundQuantity(onOrder[line.ItemID] + line.Outstanding())
+		}
+	}
+	return onOrder, nil
+}
+
+// Планировщик закупок: данные, общие для всех позиций
+type reorderPlanner struct {
+	params      reorderParams
+	consumption map[primitive.ObjectID]consumptionStats
+	leadTimes   map[primitive.ObjectID]float64
+	onOrder     map[primitive.ObjectID]float64
+	suppliers   map[primitive.ObjectID]Supplier
+	defaultLead float64
+}
+
+// Загрузка истории расхода, сроков поставки, открытых заказов и поставщиков
+func newReorderPlanner(ctx context.Context, params reorderParams) (*reorderPlanner, error) {
+	planner := &reorderPlanner{params: params, defaultLead: defaultLeadTimeDays()}
+
+	from := time.Now().AddDate(0, 0, -params.HistoryDays)
+	var err error
+	if planner.consumption, err = consumptionByItem(ctx, from, params.HistoryDays); err != nil {
+		return nil, err
+	}
+	if planner.leadTimes, err = historicalLeadTimes(ctx); err != nil {
+		return nil, err
+	}
+	if planner.onOrder, err = onOrderByItem(ctx); err != nil {
+		return nil, err
+	}
+
+	cursor, err := supplierCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var suppliers []Supplier
+	if err := cursor.All(ctx, &suppliers); err != nil {
+		return nil, err
+	}
+	planner.suppliers = map[primitive.ObjectID]Supplier{}
+	for _, supplier := range suppliers {
+		planner.suppliers[supplier.ID] = supplier
+	}
+	return planner, nil
+}
+
+// Срок поставки поставщика: история заказов, карточка поставщика или значение по умолчанию
+func (p *reorderPlanner) leadTime(supplierID primitive.ObjectID) (float64, string) {
+	if days, ok := p.leadTimes[supplierID]; ok && days > 0 {
+		return days, LeadTimeSourceHistory
+	}
+	if supplier, ok := p.suppliers[supplierID]; ok && supplier.LeadTimeDays > 0 {
+		return float64(supplier.LeadTimeDays), LeadTimeSourceSupplier
+	}
+	return p.defaultLead, LeadTimeSourceDefault
+}
+
+// Рекомендация по оборудованию.
+// Точка заказа = расход за срок поставки + страховой запас (не ниже минимального остатка);
+// заказ предлагается, когда остаток с учетом ожидаемых поставок не выше точки заказа.
+func (p *reorderPlanner) suggest(item WarehouseItem) ReorderSuggestion {
+	stats := p.consumption[item.ID]
+	leadTime, source := p.leadTime(item.SupplierID)
+
+	// Запас и точка заказа округляются вверх до целых базовых единиц
+	safetyStock := math.Ceil(p.params.SafetyFactor * stats.StdDev * math.Sqrt(leadTime))
+	reorderPoint := math.Max(math.Ceil(stats.AvgDaily*leadTime)+safetyStock, item.MinQuantity)
+
+	suggestion := ReorderSuggestion{
+		ItemID:              item.ID,
+		Name:                item.Name,
+		SerialNumber:        item.SerialNumber,
+		Category:            item.Category,
+		SupplierID:          item.SupplierID,
+		Unit:                itemUnit(item),
+		Quantity:            item.Quantity,
+		OnOrder:             p.onOrder[item.ID],
+		MinQuantity:         item.MinQuantity,
+		AvgDailyConsumption: math.Round(stats.AvgDaily*1000) / 1000,
+		ConsumptionStdDev:   math.Round(stats.StdDev*1000) / 1000,
+		LeadTimeDays:        leadTime,
+		LeadTimeSource:      source,
+		SafetyStock:         safetyStock,
+		ReorderPoint:        reorderPoint,
+		UnitPrice:           item.Price,
+		Currency:            item.Currency,
+	}
+	if supplier, ok := p.suppliers[item.SupplierID]; ok {
+		suggestion.SupplierName = supplier.CompanyName
+	}
+
+	position := roundQuantity(item.Quantity + suggestion.OnOrder)
+	if reorderPoint > 0 && position <= reorderPoint {
+		target := reorderPoint + math.Ceil(stats.AvgDaily*float64(p.params.CoverageDays))
+		suggestion.SuggestedQuantity = math.Ceil(target - position)
+		if suggestion.SuggestedQuantity < 1 {
+			suggestion.SuggestedQuantity = 1
+		}
+		suggestion.NeedsReorder = true
+	}
+	return suggestion
+}
+
+// Рекомендации к заказу оборудования
+func getReorderSuggestions(c *gin.Context) {
+	params, err := parseReorderParams(c)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Архивное оборудование не закупается
+	filter := bson.M{"archived": bson.M{"$ne": true}}
+	if category := c.Query("category"); category != "" {
+		categories, err := categoryFilter(c, ctx, strings.Split(category, ","))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve categories: " + err.Error()})
+			return
+		}
+		filter["category"] = categories
+	}
+	if supplierID := c.Query("supplier_id"); supplierID != "" {
+		id, err := primitive.ObjectIDFromHex(supplierID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+			return
+		}
+		filter["supplier_id"] = id
+	}
+
+	cursor, err := warehouseCollection.Find(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items: " + err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var items []WarehouseItem
+	if err := cursor.All(ctx, &items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode items data: " + err.Error()})
+		return
+	}
+
+	planner, err := newReorderPlanner(ctx, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load reorder data: " + err.Error()})
+		return
+	}
+
+	// По умолчанию только оборудование, которое нужно заказать; all=true - все позиции
+	suggestions := []ReorderSuggestion{}
+	for _, item := range items {
+		suggestion := planner.suggest(item)
+		if suggestion.NeedsReorder || c.Query("all") == "true" {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+
+	// Сначала позиции с наименьшим запасом относительно точки заказа
+	sort.Slice(suggestions, func(i, j int) bool {
+		left := suggestions[i].Quantity + suggestions[i].OnOrder - suggestions[i].ReorderPoint
+		right := suggestions[j].Quantity + suggestions[j].OnOrder - suggestions[j].ReorderPoint
+		if left != right {
+			return left < right
+		}
+		return suggestions[i].Name < suggestions[j].Name
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"suggestions": suggestions,
+		"parameters":  params,
+	})
+}
+
+// Создание черновиков заказов из принятых рекомендаций (по одному заказу на поставщика)
+func createReorderPurchaseOrders(c *gin.Context) {
+	var req ReorderPurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Lines) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one line is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Группируем позиции по поставщикам, сохраняя порядок запроса
+	groups := map[string][]PurchaseOrderLineRequest{}
+	var supplierOrder []string
+	for i, line := range req.Lines {
+		supplierID := line.SupplierID
+		if supplierID == "" {
+			itemID, err := primitive.ObjectIDFromHex(line.ItemID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID in line " + strconv.Itoa(i+1)})
+				return
+			}
+			var item WarehouseItem
+			if err := warehouseCollection.FindOne(ctx, bson.M{"_id": itemID}).Decode(&item); err != nil {
+				if err == mongo.ErrNoDocuments {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Item '" + line.ItemID + "' not found"})
+				} else {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch item: " + err.Error()})
+				}
+				return
+			}
+			if item.SupplierID.IsZero() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Item '" + item.Name + "' has no supplier; pass supplier_id for line " + strconv.Itoa(i+1)})
+				return
+			}
+			supplierID = item.SupplierID.Hex()
+		}
+
+		if _, ok := groups[supplierID]; !ok {
+			supplierOrder = append(supplierOrder, supplierID)
+		}
+		groups[supplierID] = append(groups[supplierID], PurchaseOrderLineRequest{
+			ItemID:    line.ItemID,
+			Quantity:  line.Quantity,
+			Unit:      line.Unit,
+			UnitPrice: line.UnitPrice,
+		})
+	}
+
+	planner := &reorderPlanner{defaultLead: defaultLeadTimeDays(), suppliers: map[primitive.ObjectID]Supplier{}}
+	var err error
+	if planner.leadTimes, err = historicalLeadTimes(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load lead times: " + err.Error()})
+		return
+	}
+
+	now := time.Now()
+	user := requestUser(c)
+	orders := make([]PurchaseOrder, 0, len(supplierOrder))
+	for _, supplierID := range supplierOrder {
+		order := PurchaseOrder{
+			ID:        primitive.NewObjectID(),
+			Status:    PurchaseOrderStatusDraft,
+			CreatedBy: user,
+			Version:   1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		order.Number = generatePurchaseOrderNumber(order.ID, now)
+
+		err := preparePurchaseOrder(ctx, PurchaseOrderRequest{
+			SupplierID: supplierID,
+			Lines:      groups[supplierID],
+			Notes:      req.Notes,
+		}, &order)
+		if err != nil {
+			respondError(c, err, "Failed to validate purchase order: ")
+			return
+		}
+
+		// Ожидаемая дата поставки - по сроку поставки поставщика
+		var supplier Supplier
+		if err := supplierCollection.FindOne(ctx, bson.M{"_id": order.SupplierID}).Decode(&supplier); err == nil {
+			planner.suppliers[supplier.ID] = supplier
+		}
+		leadTime, _ := planner.leadTime(order.SupplierID)
+		order.ExpectedDate = now.Add(time.Duration(leadTime * float64(24*time.Hour)))
+		orders = append(orders, order)
+	}
+
+	session, err := mongoClient.StartSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session: " + err.Error()})
+		return
+	}
+	defer session.EndSession(ctx)
+
+	// Заказы создаются вместе или не создаются совсем
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		for _, order := range orders {
+			if _, err := purchaseOrderCollection.InsertOne(sessCtx, order); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		respondError(c, err, "Failed to create purchase orders: ")
+		return
+	}
+
+	for i := range orders {
+		fillPurchaseOrder(&orders[i], now)
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message":         "Purchase orders created successfully",
+		"purchase_orders": orders,
+	})
+}
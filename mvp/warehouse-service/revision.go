@@ -0,0 +1,498 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Служебные поля, которые не попадают в список изменений ревизии
+var revisionIgnoredFields = map[string]bool{
+	"_id":            true,
+	"version":        true,
+	"updated_at":     true,
+	"warranty_alert": true,
+}
+
+// revisionTarget описывает ресурс с историей изменений
+type revisionTarget struct {
+	Collection *mongo.Collection
+	Schema     patchSchema        // Поля, которые восстанавливаются из ревизии
+	NotFound   string             // Сообщение, если ресурс не найден
+	NewDoc     func() interface{} // Пустой документ для ответа клиенту
+}
+
+// Получение описания ресурса по типу
+func revisionTargetFor(resourceType string) revisionTarget {
+	switch resourceType {
+	case RevisionResourceCategory:
+		return revisionTarget{categoryCollection, categoryPatchSchema, "Category not found", func() interface{} { return &Category{} }}
+	case RevisionResourceSupplier:
+		return revisionTarget{supplierCollection, supplierPatchSchema, "Supplier not found", func() interface{} { return &Supplier{} }}
+	default:
+		return revisionTarget{warehouseCollection, warehouseItemPatchSchema, "Item not found", func() interface{} { return &WarehouseItem{} }}
+	}
+}
+
+// Ключ, которым auth-service подписывает токены доступа.
+// Без него токены не проверяются, и изменения записываются от имени anonymous.
+var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+
+// Данные токена auth-service, нужные для журнала изменений
+type requestClaims struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	jwt.RegisteredClaims
+}
+
+// Имя пользователя, выполняющего запрос.
+// Берется только из токена с проверенной подписью auth-service и используется для журнала изменений.
+func requestUser(c *gin.Context) string {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" || len(jwtSecret) == 0 {
+		return "anonymous"
+	}
+	claims := &requestClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !parsed.Valid {
+		return "anonymous"
+	}
+	if claims.Username != "" {
+		return claims.Username
+	}
+	if claims.UserID != "" {
+		return claims.UserID
+	}
+	return "anonymous"
+}
+
+// Преобразование документа (структуры или bson.Raw) в bson.M
+func toBSONMap(doc interface{}) (bson.M, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	data, ok := doc.(bson.Raw)
+	if !ok {
+		marshaled, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		data = marshaled
+	}
+	var result bson.M
+	if err := bson.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Раскрытие вложенных документов в плоский список полей (contact.phone)
+func flattenDocument(prefix string, doc bson.M, out map[string]interface{}) {
+	for key, value := range doc {
+		path := prefix + key
+		switch nested := value.(type) {
+		case bson.M:
+			flattenDocument(path+".", nested, out)
+		case bson.D:
+			flattenDocument(path+".", nested.Map(), out)
+		default:
+			out[path] = value
+		}
+	}
+}
+
+// Список изменившихся полей между двумя состояниями документа
+func diffDocuments(before, after bson.M) []FieldChange {
+	oldFields := map[string]interface{}{}
+	newFields := map[string]interface{}{}
+	flattenDocument("", before, oldFields)
+	flattenDocument("", after, newFields)
+
+	var paths []string
+	for path := range oldFields {
+		paths = append(paths, path)
+	}
+	for path := range newFields {
+		if _, ok := oldFields[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	changes := []FieldChange{}
+	for _, path := range paths {
+		if revisionIgnoredFields[strings.SplitN(path, ".", 2)[0]] {
+			continue
+		}
+		if !reflect.DeepEqual(oldFields[path], newFields[path]) {
+			changes = append(changes, FieldChange{Field: path, Old: oldFields[path], New: newFields[path]})
+		}
+	}
+	return changes
+}
+
+// Версия документа из bson.M
+func documentVersion(doc bson.M) int64 {
+	switch version := doc["version"].(type) {
+	case int64:
+		return version
+	case int32:
+		return int64(version)
+	}
+	return 0
+}
+
+// Применение изменения документа вместе с записью ревизии в одной транзакции MongoDB:
+// изменение, которое не попало в историю, не сохраняется. Ошибки applyMergeUpdate
+// (mongo.ErrNoDocuments, нарушение уникальности) возвращаются без изменений.
+func applyRevisionedUpdate(ctx context.Context, collection *mongo.Collection, filter bson.M, update bson.M, rev Revision, before bson.Raw, result interface{}) (bson.Raw, error) {
+	session, err := mongoClient.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	var after bson.Raw
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		raw, err := applyMergeUpdate(sessCtx, collection, filter, update, result)
+		if err != nil {
+			return nil, err
+		}
+		after = raw
+		return nil, recordRevision(sessCtx, rev, before, after)
+	})
+	return after, err
+}
+
+// Сохранение ревизии ресурса.
+// rev задает тип, ID ресурса, действие и автора; before и after - состояние до и после изменения
+// (nil для создания и удаления соответственно). Для ресурса без истории сначала
+// сохраняется базовая ревизия с состоянием до изменения.
+func recordRevision(ctx context.Context, rev Revision, before, after interface{}) error {
+	beforeDoc, err := toBSONMap(before)
+	if err != nil {
+		return err
+	}
+	afterDoc, err := toBSONMap(after)
+	if err != nil {
+		return err
+	}
+
+	if beforeDoc != nil {
+		count, err := revisionCollection.CountDocuments(ctx, bson.M{
+			"resource_type": rev.ResourceType,
+			"resource_id":   rev.ResourceID,
+		})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			changedAt := time.Time{}
+			if updatedAt, ok := beforeDoc["updated_at"].(primitive.DateTime); ok {
+				changedAt = updatedAt.Time()
+			}
+			_, err := revisionCollection.InsertOne(ctx, Revision{
+				ID:           primitive.NewObjectID(),
+				ResourceType: rev.ResourceType,
+				ResourceID:   rev.ResourceID,
+				Version:      documentVersion(beforeDoc),
+				Action:       RevisionActionBaseline,
+				ChangedBy:    "system",
+				ChangedAt:    changedAt,
+				Changes:      []FieldChange{},
+				Snapshot:     beforeDoc,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	rev.ID = primitive.NewObjectID()
+	rev.ChangedAt = time.Now()
+	rev.Snapshot = afterDoc
+	if afterDoc != nil {
+		rev.Version = documentVersion(afterDoc)
+	} else {
+		rev.Version = documentVersion(beforeDoc) + 1
+	}
+	if beforeDoc != nil && afterDoc != nil {
+		rev.Changes = diffDocuments(beforeDoc, afterDoc)
+	} else {
+		rev.Changes = []FieldChange{}
+	}
+
+	_, err = revisionCollection.InsertOne(ctx, rev)
+	return err
+}
+
+// Разбор ID ресурса из пути
+func parseResourceID(c *gin.Context) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return id, false
+	}
+	return id, true
+}
+
+// Поиск ревизии ресурса по номеру версии из пути
+func findRevision(c *gin.Context, ctx context.Context, resourceType string, id primitive.ObjectID) (Revision, bool) {
+	var revision Revision
+	version, err := strconv.ParseInt(c.Param("version"), 10, 64)
+	if err != nil || version < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return revision, false
+	}
+
+	err = revisionCollection.FindOne(ctx, bson.M{
+		"resource_type": resourceType,
+		"resource_id":   id,
+		"version":       version,
+	}).Decode(&revision)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch revision: " + err.Error()})
+		}
+		return revision, false
+	}
+	return revision, true
+}
+
+// Список ревизий ресурса (новые первыми)
+func listRevisions(resourceType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseResourceID(c)
+		if !ok {
+			return
+		}
+
+		page, err := parsePageQuery(c, "version", -1)
+		if err != nil {
+			respondError(c, err, "")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		revisions, pagination, err := findPage[Revision](ctx, revisionCollection, bson.M{
+			"resource_type": resourceType,
+			"resource_id":   id,
+		}, page)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch revisions: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"revisions": revisions, "pagination": pagination})
+	}
+}
+
+// Получение ревизии ресурса по версии
+func getRevision(resourceType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseResourceID(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		revision, ok := findRevision(c, ctx, resourceType, id)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, revision)
+	}
+}
+
+// Состояние ресурса на момент времени (?at=RFC3339 или YYYY-MM-DD)
+func getResourceAsOf(resourceType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseResourceID(c)
+		if !ok {
+			return
+		}
+
+		at, err := parseDateParam(c.Query("at"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or missing at parameter"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Последняя ревизия, сделанная не позже указанного времени
+		findOptions := options.FindOne().SetSort(bson.D{{Key: "changed_at", Value: -1}, {Key: "version", Value: -1}})
+		var revision Revision
+		err = revisionCollection.FindOne(ctx, bson.M{
+			"resource_type": resourceType,
+			"resource_id":   id,
+			"changed_at":    bson.M{"$lte": at},
+		}, findOptions).Decode(&revision)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "No history for the requested time"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch revision: " + err.Error()})
+			}
+			return
+		}
+		if revision.Snapshot == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Resource did not exist at the requested time"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"at":          at,
+			"version":     revision.Version,
+			"revision_id": revision.ID,
+			"changed_by":  revision.ChangedBy,
+			"changed_at":  revision.ChangedAt,
+			"snapshot":    revision.Snapshot,
+		})
+	}
+}
+
+// Восстановление ресурса из ревизии.
+// Восстанавливаются только редактируемые поля; остаток оборудования меняется только транзакциями.
+func restoreRevision(resourceType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseResourceID(c)
+		if !ok {
+			return
+		}
+
+		version, err := parseIfMatch(c)
+		if err != nil {
+			respondError(c, err, "")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		revision, ok := findRevision(c, ctx, resourceType, id)
+		if !ok {
+			return
+		}
+		if revision.Snapshot == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Revision has no state to restore"})
+			return
+		}
+
+		target := revisionTargetFor(resourceType)
+		var current struct {
+			Version int64 `bson:"version"`
+		}
+		before, ok := loadForUpdate(c, ctx, target.Collection, id, version, target.NotFound, &current)
+		if !ok {
+			return
+		}
+
+		set := bson.M{}
+		unset := bson.M{}
+		for field := range target.Schema {
+			if value, exists := revision.Snapshot[field]; exists {
+				set[field] = value
+			} else {
+				unset[field] = ""
+			}
+		}
+		update := bson.M{"$set": set}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+
+		// Восстановленные ссылки на категории проверяются так же, как при обычном изменении
+		if err := validateRestoredReferences(ctx, resourceType, before, update); err != nil {
+			respondError(c, err, "Failed to validate revision: ")
+			return
+		}
+
+		restored := target.NewDoc()
+		after, err := applyRevisionedUpdate(ctx, target.Collection, versionFilter(id, current.Version), update, Revision{
+			ResourceType: resourceType,
+			ResourceID:   id,
+			Action:       RevisionActionRestore,
+			ChangedBy:    requestUser(c),
+			RestoredFrom: revision.Version,
+		}, before, restored)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				respondVersionConflict(c, ctx, target.Collection, id, target.NotFound)
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore revision: " + err.Error()})
+			}
+			return
+		}
+
+		setETag(c, rawVersion(after))
+		c.JSON(http.StatusOK, gin.H{"message": "Revision restored successfully", "restored_from": revision.Version, "resource": restored})
+	}
+}
+
+// Проверка восстанавливаемой ревизии: код, родитель и атрибуты категории, ссылки и атрибуты оборудования, реквизиты поставщика
+func validateRestoredReferences(ctx context.Context, resourceType string, before bson.Raw, update bson.M) error {
+	switch resourceType {
+	case RevisionResourceCategory:
+		var current Category
+		if err := bson.Unmarshal(before, &current); err != nil {
+			return err
+		}
+		return validateCategoryUpdate(ctx, current, update)
+	case RevisionResourceItem:
+		var current WarehouseItem
+		if err := bson.Unmarshal(before, &current); err != nil {
+			return err
+		}
+		// Восстановление не должно переключать учет партий у оборудования с остатком
+		if err := checkStockFields(restoredStockPatch(update), current); err != nil {
+			return err
+		}
+		if err := validateItemReferenceUpdate(ctx, current, update); err != nil {
+			return err
+		}
+		if err := validateItemAttributeUpdate(ctx, current, update); err != nil {
+			return err
+		}
+		applyMinQuantityStatus(update, current)
+		return nil
+	case RevisionResourceSupplier:
+		var current Supplier
+		if err := bson.Unmarshal(before, &current); err != nil {
+			return err
+		}
+		return validateSupplierUpdate(ctx, current, update)
+	}
+	return nil
+}
+
+// Поля восстанавливаемого состояния, влияющие на остаток, в виде патча для checkStockFields.
+// Отсутствующий в ревизии track_lots снимается с документа и означает false.
+func restoredStockPatch(update bson.M) map[string]json.RawMessage {
+	set, _ := update["$set"].(bson.M)
+	trackLots, _ := set["track_lots"].(bool)
+	raw, _ := json.Marshal(trackLots)
+	return map[string]json.RawMessage{"track_lots": raw}
+}
@@ -0,0 +1,1016 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Ограничения штрихкодов и сканирования
+const (
+	maxItemBarcodes    = 20
+	maxBarcodeLength   = 128
+	maxScanCodeLength  = 2048 // QR-код может содержать ссылку на карточку
+	scanUpdateAttempts = 5    // Повторы добавления скана при одновременном сканировании с нескольких терминалов
+)
+
+// Ссылка на карточку оборудования из QR-кода этикетки: .../items/<id>
+var itemURLPattern = regexp.MustCompile(`/items/([0-9a-fA-F]{24})(?:[/?#]|$)`)
+
+// ItemBarcodesRequest представляет замену списка штрихкодов оборудования
+type ItemBarcodesRequest struct {
+	Barcodes []ItemBarcode `json:"barcodes"`
+}
+
+// ScanSessionRequest представляет создание сессии сканирования
+type ScanSessionRequest struct {
+	Type            string `json:"type" binding:"required"` // intake, issue
+	ResponsibleUser string `json:"responsible_user" binding:"required"`
+	DestinationUser string `json:"destination_user"` // Получатель, обязателен для выдачи
+	SupplierID      string `json:"supplier_id"`      // Поставщик приемки (по умолчанию из карточек оборудования)
+	Reason          string `json:"reason"`
+	Notes           string `json:"notes"`
+}
+
+// ScanRequest представляет одно сканирование
+type ScanRequest struct {
+	Code       string     `json:"code" binding:"required"`
+	Quantity   float64    `json:"quantity"`    // По умолчанию 1 единица сканирования
+	Unit       string     `json:"unit"`        // По умолчанию единица штрихкода или базовая единица оборудования
+	LotNumber  string     `json:"lot_number"`  // Партия для оборудования с учетом партий
+	ExpiryDate *time.Time `json:"expiry_date"` // Срок годности партии (только для приемки)
+}
+
+// ScanLineRequest представляет исправление количества позиции сессии
+type ScanLineRequest struct {
+	Quantity float64 `json:"quantity"` // 0 удаляет позицию
+	Unit     string  `json:"unit"`
+}
+
+// scanMatch - оборудование, найденное по отсканированному значению
+type scanMatch struct {
+	Item      WarehouseItem
+	MatchedBy string // id, url, serial_number, barcode
+	Unit      string // Единица штрихкода упаковки
+}
+
+// ambiguousCodeError - значение соответствует нескольким единицам оборудования
+type ambiguousCodeError struct {
+	Code  string
+	Items []WarehouseItem
+}
+
+func (e *ambiguousCodeError) Error() string {
+	return "Code '" + e.Code + "' matches several items"
+}
+
+// Проверка, что значение - код GTIN (EAN-8, UPC-A, EAN-13, GTIN-14)
+func isGTIN(code string) bool {
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Проверка контрольной цифры GTIN: веса 3 и 1 справа налево без контрольной цифры
+func validGTINCheckDigit(code string) bool {
+	sum := 0
+	for i := len(code) - 2; i >= 0; i-- {
+		digit := int(code[i] - '0')
+		if (len(code)-2-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return int(code[len(code)-1]-'0') == (10-sum%10)%10
+}
+
+// Варианты записи штрихкода: сканеры читают UPC-A и как EAN-13 с ведущим нулем
+func barcodeVariants(code string) []string {
+	variants := []string{code}
+	if isGTIN(code) {
+		switch {
+		case len(code) == 12:
+			variants = append(variants, "0"+code)
+		case len(code) == 13 && code[0] == '0':
+			variants = append(variants, code[1:])
+		}
+	}
+	return variants
+}
+
+// Поиск оборудования по отсканированному значению.
+// Порядок: ссылка из QR-кода этикетки или ID, затем серийный номер и дополнительные штрихкоды.
+func resolveScanCode(ctx context.Context, code string) (*scanMatch, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, &requestError{http.StatusBadRequest, "code is required"}
+	}
+	if len(code) > maxScanCodeLength {
+		return nil, &requestError{http.StatusBadRequest, fmt.Sprintf("code must be at most %d characters", maxScanCodeLength)}
+	}
+
+	matchedBy, hex := "id", code
+	if m := itemURLPattern.FindStringSubmatch(code); m != nil {
+		matchedBy, hex = "url", m[1]
+	}
+	if id, err := primitive.ObjectIDFromHex(hex); err == nil {
+		var item WarehouseItem
+		err := warehouseCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&item)
+		if err == nil {
+			return &scanMatch{Item: item, MatchedBy: matchedBy}, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		if matchedBy == "url" {
+			return nil, &requestError{http.StatusNotFound, "Item from the label link not found"}
+		}
+		// 24 шестнадцатеричных символа могут быть и серийным номером
+	}
+
+	variants := barcodeVariants(code)
+	items, err := loadAll[WarehouseItem](ctx, warehouseCollection, bson.M{"$or": bson.A{
+		bson.M{"serial_number": code},
+		bson.M{"barcodes.code": bson.M{"$in": variants}},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	switch len(items) {
+	case 0:
+		return nil, &requestError{http.StatusNotFound, "No item found for code '" + code + "'"}
+	case 1:
+	default:
+		return nil, &ambiguousCodeError{Code: code, Items: items}
+	}
+
+	item := items[0]
+	if item.SerialNumber == code {
+		return &scanMatch{Item: item, MatchedBy: "serial_number"}, nil
+	}
+	match := &scanMatch{Item: item, MatchedBy: "barcode"}
+	for _, barcode := range item.Barcodes {
+		if containsString(variants, barcode.Code) {
+			match.Unit = barcode.Unit
+			break
+		}
+	}
+	return match, nil
+}
+
+// Ответ на ошибку сканирования: неоднозначное значение с кандидатами,
+// партия с предложением по FEFO, остальные через respondError
+func respondScanError(c *gin.Context, err error, prefix string) {
+	if ambiguous, ok := err.(*ambiguousCodeError); ok {
+		candidates := make([]gin.H, 0, len(ambiguous.Items))
+		for _, item := range ambiguous.Items {
+			candidates = append(candidates, gin.H{
+				"id":            item.ID,
+				"name":          item.Name,
+				"serial_number": item.SerialNumber,
+				"location":      item.Location,
+				"archived":      item.Archived,
+			})
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": ambiguous.Error(), "candidates": candidates})
+		return
+	}
+	if _, ok := err.(*lotRequiredError); ok {
+		respondLotError(c, err)
+		return
+	}
+	respondError(c, err, prefix)
+}
+
+// Поиск оборудования по ID, ссылке из QR-кода, серийному номеру или штрихкоду
+func lookupWarehouseItem(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	match, err := resolveScanCode(ctx, c.Query("code"))
+	if err != nil {
+		respondScanError(c, err, "Failed to look up item: ")
+		return
+	}
+
+	response := gin.H{"item": match.Item, "matched_by": match.MatchedBy}
+	if match.Unit != "" {
+		response["unit"] = match.Unit
+	}
+	setETag(c, match.Item.Version)
+	c.JSON(http.StatusOK, response)
+}
+
+// Проверка штрихкодов оборудования: формат, контрольная цифра EAN/UPC, единица упаковки
+// и уникальность среди серийных номеров и штрихкодов другого оборудования
+func validateItemBarcodes(ctx context.Context, catalog unitCatalog, item WarehouseItem, barcodes []ItemBarcode) ([]ItemBarcode, error) {
+	if len(barcodes) > maxItemBarcodes {
+		return nil, &requestError{http.StatusBadRequest, fmt.Sprintf("Item can have at most %d barcodes", maxItemBarcodes)}
+	}
+
+	result := make([]ItemBarcode, 0, len(barcodes))
+	seen := map[string]bool{}
+	var variants []string
+	for i, barcode := range barcodes {
+		code := strings.TrimSpace(barcode.Code)
+		if code == "" {
+			return nil, &requestError{http.StatusBadRequest, fmt.Sprintf("Barcode %d is empty", i+1)}
+		}
+		if len(code) > maxBarcodeLength {
+			return nil, &requestError{http.StatusBadRequest, fmt.Sprintf("Barcode %d must be at most %d characters", i+1, maxBarcodeLength)}
+		}
+		for _, r := range code {
+			if !unicode.IsPrint(r) {
+				return nil, &requestError{http.StatusBadRequest, fmt.Sprintf("Barcode %d contains non-printable characters", i+1)}
+			}
+		}
+		if isGTIN(code) && !validGTINCheckDigit(code) {
+			return nil, &requestError{http.StatusBadRequest, "Barcode '" + code + "' has an invalid check digit"}
+		}
+
+		unit := ""
+		if barcode.Unit != "" {
+			unit = catalog.resolve(barcode.Unit)
+			if _, err := catalog.toBase(item, 1, unit); err != nil {
+				return nil, &requestError{http.StatusBadRequest, "Barcode '" + code + "': " + err.Error()}
+			}
+			if unit == itemUnit(item) {
+				unit = ""
+			}
+		}
+
+		codeVariants := barcodeVariants(code)
+		for _, variant := range codeVariants {
+			if seen[variant] {
+				return nil, &requestError{http.StatusBadRequest, "Barcode '" + code + "' is specified more than once"}
+			}
+		}
+		for _, variant := range codeVariants {
+			seen[variant] = true
+		}
+		variants = append(variants, codeVariants...)
+		result = append(result, ItemBarcode{Code: code, Unit: unit})
+	}
+	if len(variants) == 0 {
+		return result, nil
+	}
+
+	var other WarehouseItem
+	err := warehouseCollection.FindOne(ctx, bson.M{
+		"_id": bson.M{"$ne": item.ID},
+		"$or": bson.A{
+			bson.M{"serial_number": bson.M{"$in": variants}},
+			bson.M{"barcodes.code": bson.M{"$in": variants}},
+		},
+	}).Decode(&other)
+	if err == nil {
+		return nil, &requestError{http.StatusConflict, fmt.Sprintf("Barcode is already used by item '%s' (%s)", other.Name, other.SerialNumber)}
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Замена дополнительных штрихкодов оборудования
+func updateItemBarcodes(c *gin.Context) {
+	itemID, version, ok := parseItemVersionRequest(c)
+	if !ok {
+		return
+	}
+
+	var req ItemBarcodesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var item WarehouseItem
+	before, ok := loadForUpdate(c, ctx, warehouseCollection, itemID, version, "Item not found", &item)
+	if !ok {
+		return
+	}
+
+	catalog, err := loadUnits(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load units: " + err.Error()})
+		return
+	}
+	barcodes, err := validateItemBarcodes(ctx, catalog, item, req.Barcodes)
+	if err != nil {
+		respondError(c, err, "Failed to validate barcodes: ")
+		return
+	}
+
+	update := bson.M{}
+	if len(barcodes) > 0 {
+		update["$set"] = bson.M{"barcodes": barcodes}
+	} else {
+		update["$unset"] = bson.M{"barcodes": ""}
+	}
+
+	var updated WarehouseItem
+	_, err = applyRevisionedUpdate(ctx, warehouseCollection, versionFilter(itemID, item.Version), update, Revision{
+		ResourceType: RevisionResourceItem,
+		ResourceID:   itemID,
+		Action:       RevisionActionUpdate,
+		ChangedBy:    requestUser(c),
+	}, before, &updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			respondVersionConflict(c, ctx, warehouseCollection, itemID, "Item not found")
+		} else if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Barcode is already used by another item"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update item barcodes: " + err.Error()})
+		}
+		return
+	}
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, updated)
+}
+
+// Генерация номера сессии сканирования: SC-ГГГГММДД-XXXXXX
+func generateScanSessionNumber(id primitive.ObjectID, now time.Time) string {
+	hex := id.Hex()
+	return fmt.Sprintf("SC-%s-%s", now.Format("20060102"), strings.ToUpper(hex[len(hex)-6:]))
+}
+
+// Тип транзакций, которыми проводится сессия
+func (s ScanSession) transactionType() string {
+	if s.Type == ScanSessionTypeIssue {
+		return "issue"
+	}
+	return "intake"
+}
+
+// Основание транзакций сессии: указанное при создании или номер сессии
+func (s ScanSession) transactionReason() string {
+	if s.Reason != "" {
+		return s.Reason
+	}
+	if s.Type == ScanSessionTypeIssue {
+		return "Выдача по сессии сканирования " + s.Number
+	}
+	return "Приемка по сессии сканирования " + s.Number
+}
+
+// Индекс позиции сессии по ID; -1, если позиции нет
+func (s ScanSession) lineIndex(lineID primitive.ObjectID) int {
+	for i, line := range s.Lines {
+		if line.ID == lineID {
+			return i
+		}
+	}
+	return -1
+}
+
+// Проверка количества позиции сессии: партия и, для выдачи, остаток оборудования
+// с учетом других позиций того же оборудования (другие партии)
+func (s ScanSession) checkLine(ctx context.Context, item WarehouseItem, lotNumber string, expiryDate *time.Time, quantity float64, exclude int) error {
+	if s.Type == ScanSessionTypeIssue {
+		total := quantity
+		for i, line := range s.Lines {
+			if i != exclude && line.ItemID == item.ID {
+				total += line.Quantity
+			}
+		}
+		if roundQuantity(total) > item.Quantity {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Insufficient quantity of '%s' available (%s)", item.Name, formatQuantity(item.Quantity))}
+		}
+	}
+	_, err := prepareLotMovement(ctx, item, s.transactionType(), lotNumber, expiryDate, quantity)
+	return err
+}
+
+// Добавление отсканированного количества к позиции сессии; позиция определяется оборудованием и партией
+func (s *ScanSession) addScan(ctx context.Context, item WarehouseItem, quantity float64, lotNumber string, expiryDate *time.Time) (int, error) {
+	index := -1
+	for i, line := range s.Lines {
+		if line.ItemID == item.ID && line.LotNumber == lotNumber {
+			index = i
+			break
+		}
+	}
+
+	total := quantity
+	if index >= 0 {
+		line := s.Lines[index]
+		total = roundQuantity(line.Quantity + quantity)
+		if expiryDate != nil && line.ExpiryDate != nil && !expiryDay(*expiryDate).Equal(expiryDay(*line.ExpiryDate)) {
+			return -1, &requestError{http.StatusConflict, "Lot " + lotNumber + " was already scanned with a different expiry date"}
+		}
+		if expiryDate == nil {
+			expiryDate = line.ExpiryDate
+		}
+	}
+	if err := s.checkLine(ctx, item, lotNumber, expiryDate, total, index); err != nil {
+		return -1, err
+	}
+
+	if index < 0 {
+		s.Lines = append(s.Lines, ScanSessionLine{
+			ID:           primitive.NewObjectID(),
+			ItemID:       item.ID,
+			ItemName:     item.Name,
+			SerialNumber: item.SerialNumber,
+			Unit:         itemUnit(item),
+			LotNumber:    lotNumber,
+		})
+		index = len(s.Lines) - 1
+	}
+	line := &s.Lines[index]
+	line.Quantity = total
+	line.ExpiryDate = expiryDate
+	line.Scans++
+	return index, nil
+}
+
+// Загрузка сессии сканирования
+func loadScanSession(ctx context.Context, id primitive.ObjectID) (ScanSession, error) {
+	var session ScanSession
+	if err := scanSessionCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&session); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return session, &requestError{http.StatusNotFound, "Scan session not found"}
+		}
+		return session, err
+	}
+	return session, nil
+}
+
+// Загрузка открытой сессии для изменения с проверкой ID и If-Match
+func loadScanSessionForUpdate(c *gin.Context, ctx context.Context, session *ScanSession) bool {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scan session ID"})
+		return false
+	}
+	version, err := parseIfMatch(c)
+	if err != nil {
+		respondError(c, err, "")
+		return false
+	}
+	if _, ok := loadForUpdate(c, ctx, scanSessionCollection, id, version, "Scan session not found", session); !ok {
+		return false
+	}
+	if session.Status != ScanSessionStatusOpen {
+		c.JSON(http.StatusConflict, gin.H{"error": "Scan session is " + session.Status})
+		return false
+	}
+	return true
+}
+
+// Фильтр открытой сессии с ожидаемой версией
+func openScanSessionFilter(session ScanSession) bson.M {
+	filter := versionFilter(session.ID, session.Version)
+	filter["status"] = ScanSessionStatusOpen
+	return filter
+}
+
+// Применение изменения открытой сессии с проверкой версии
+func saveScanSessionUpdate(c *gin.Context, ctx context.Context, session ScanSession, update bson.M) {
+	var updated ScanSession
+	if _, err := applyMergeUpdate(ctx, scanSessionCollection, openScanSessionFilter(session), update, &updated); err != nil {
+		if err == mongo.ErrNoDocuments {
+			respondVersionConflict(c, ctx, scanSessionCollection, session.ID, "Scan session not found")
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scan session: " + err.Error()})
+		}
+		return
+	}
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, updated)
+}
+
+// Создание сессии сканирования приемки или выдачи
+func createScanSession(c *gin.Context) {
+	var req ScanSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	session := ScanSession{
+		ID:              primitive.NewObjectID(),
+		Type:            strings.TrimSpace(req.Type),
+		Status:          ScanSessionStatusOpen,
+		ResponsibleUser: strings.TrimSpace(req.ResponsibleUser),
+		DestinationUser: strings.TrimSpace(req.DestinationUser),
+		Reason:          strings.TrimSpace(req.Reason),
+		Notes:           req.Notes,
+		Lines:           []ScanSessionLine{},
+		Scans:           []ScanEvent{},
+		CreatedBy:       requestUser(c),
+		Version:         1,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	session.Number = generateScanSessionNumber(session.ID, now)
+
+	switch session.Type {
+	case ScanSessionTypeIntake:
+		if req.SupplierID != "" {
+			supplierID, err := primitive.ObjectIDFromHex(req.SupplierID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+				return
+			}
+			if err := validateItemSupplier(ctx, supplierID); err != nil {
+				respondError(c, err, "Failed to validate supplier: ")
+				return
+			}
+			session.SupplierID = supplierID
+		}
+	case ScanSessionTypeIssue:
+		if session.DestinationUser == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "destination_user is required for issue sessions"})
+			return
+		}
+		if req.SupplierID != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "supplier_id is only allowed for intake sessions"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be intake or issue"})
+		return
+	}
+
+	if _, err := scanSessionCollection.InsertOne(ctx, session); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Scan session with this number already exists"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create scan session: " + err.Error()})
+		}
+		return
+	}
+
+	setETag(c, session.Version)
+	c.JSON(http.StatusCreated, session)
+}
+
+// Список сессий сканирования
+func listScanSessions(c *gin.Context) {
+	filter := bson.M{}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = bson.M{"$in": strings.Split(status, ",")}
+	}
+	if sessionType := c.Query("type"); sessionType != "" {
+		filter["type"] = sessionType
+	}
+	if user := c.Query("responsible_user"); user != "" {
+		filter["responsible_user"] = user
+	}
+
+	// Постраничный вывод: новые сессии первыми
+	page, err := parsePageQuery(c, "created_at", -1)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sessions, pagination, err := findPage[ScanSession](ctx, scanSessionCollection, filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scan sessions: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scan_sessions": sessions, "pagination": pagination})
+}
+
+// Получение сессии сканирования
+func getScanSession(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scan session ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := loadScanSession(ctx, id)
+	if err != nil {
+		respondError(c, err, "Failed to fetch scan session: ")
+		return
+	}
+
+	setETag(c, session.Version)
+	c.JSON(http.StatusOK, session)
+}
+
+// Сканирование в сессии: значение распознается, количество добавляется к позиции оборудования.
+// If-Match не требуется: сканы с нескольких терминалов применяются по очереди с повтором при конфликте версий.
+func scanToSession(c *gin.Context) {
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scan session ID"})
+		return
+	}
+
+	var req ScanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be positive"})
+		return
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	match, err := resolveScanCode(ctx, req.Code)
+	if err != nil {
+		respondScanError(c, err, "Failed to look up item: ")
+		return
+	}
+	item := match.Item
+	if item.Archived {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item '" + item.Name + "' is archived"})
+		return
+	}
+
+	// Штрихкод упаковки добавляет целую упаковку, если единица не указана явно
+	unit := req.Unit
+	if unit == "" {
+		unit = match.Unit
+	}
+	units, err := loadUnits(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load units: " + err.Error()})
+		return
+	}
+	quantity, err := units.toBase(item, req.Quantity, unit)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+	lotNumber := strings.TrimSpace(req.LotNumber)
+
+	for attempt := 0; attempt < scanUpdateAttempts; attempt++ {
+		session, err := loadScanSession(ctx, sessionID)
+		if err != nil {
+			respondError(c, err, "Failed to fetch scan session: ")
+			return
+		}
+		if session.Status != ScanSessionStatusOpen {
+			c.JSON(http.StatusConflict, gin.H{"error": "Scan session is " + session.Status})
+			return
+		}
+
+		index, err := session.addScan(ctx, item, quantity, lotNumber, req.ExpiryDate)
+		if err != nil {
+			respondScanError(c, err, "Failed to add scan: ")
+			return
+		}
+		event := ScanEvent{
+			Code:      strings.TrimSpace(req.Code),
+			MatchedBy: match.MatchedBy,
+			ItemID:    item.ID,
+			LineID:    session.Lines[index].ID,
+			Quantity:  quantity,
+			ScannedBy: requestUser(c),
+			ScannedAt: time.Now(),
+		}
+		if unit != "" && unit != itemUnit(item) {
+			event.Unit = unit
+		}
+
+		var updated ScanSession
+		update := bson.M{
+			"$set":  bson.M{"lines": session.Lines},
+			"$push": bson.M{"scans": event},
+		}
+		if _, err := applyMergeUpdate(ctx, scanSessionCollection, openScanSessionFilter(session), update, &updated); err != nil {
+			if err == mongo.ErrNoDocuments {
+				// Сессию изменил другой скан - повторяем с актуальной версией
+				continue
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save scan: " + err.Error()})
+			return
+		}
+
+		setETag(c, updated.Version)
+		c.JSON(http.StatusOK, gin.H{
+			"session": updated,
+			"scan":    event,
+			"line":    updated.Lines[index],
+			"item":    item,
+		})
+		return
+	}
+
+	c.JSON(http.StatusConflict, gin.H{"error": "Scan session is being modified concurrently, retry the scan"})
+}
+
+// Исправление количества позиции сессии; нулевое количество удаляет позицию
+func updateScanSessionLine(c *gin.Context) {
+	var req ScanLineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be non-negative"})
+		return
+	}
+	changeScanSessionLine(c, req)
+}
+
+// Удаление позиции сессии
+func deleteScanSessionLine(c *gin.Context) {
+	changeScanSessionLine(c, ScanLineRequest{})
+}
+
+// Изменение или удаление позиции открытой сессии с проверкой If-Match
+func changeScanSessionLine(c *gin.Context, req ScanLineRequest) {
+	lineID, err := primitive.ObjectIDFromHex(c.Param("line_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scan session line ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var session ScanSession
+	if !loadScanSessionForUpdate(c, ctx, &session) {
+		return
+	}
+	index := session.lineIndex(lineID)
+	if index < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scan session line not found"})
+		return
+	}
+
+	if req.Quantity == 0 {
+		session.Lines = append(session.Lines[:index], session.Lines[index+1:]...)
+		saveScanSessionUpdate(c, ctx, session, bson.M{"$set": bson.M{"lines": session.Lines}})
+		return
+	}
+
+	line := &session.Lines[index]
+	var item WarehouseItem
+	if err := warehouseCollection.FindOne(ctx, bson.M{"_id": line.ItemID}).Decode(&item); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch item: " + err.Error()})
+		}
+		return
+	}
+	units, err := loadUnits(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load units: " + err.Error()})
+		return
+	}
+	quantity, err := units.toBase(item, req.Quantity, req.Unit)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+	if err := session.checkLine(ctx, item, line.LotNumber, line.ExpiryDate, quantity, index); err != nil {
+		respondScanError(c, err, "Failed to update line: ")
+		return
+	}
+	line.Quantity = quantity
+
+	saveScanSessionUpdate(c, ctx, session, bson.M{"$set": bson.M{"lines": session.Lines}})
+}
+
+// Позиция накладной по позиции сессии.
+// Цена берется из карточки оборудования, если ее валюта совпадает с валютой накладной.
+func scanInvoiceLine(item WarehouseItem, line ScanSessionLine, lots *lotMovement, currency string) InvoiceItem {
+	invoiceLine := InvoiceItem{
+		ItemID:       item.ID,
+		Name:         item.Name,
+		SerialNumber: item.SerialNumber,
+		Category:     item.Category,
+		Manufacturer: item.Manufacturer,
+		Quantity:     line.Quantity,
+		Unit:         line.Unit,
+		BaseQuantity: line.Quantity,
+		LotNumber:    line.LotNumber,
+	}
+	if lots != nil && len(lots.Allocations) > 0 {
+		invoiceLine.ExpiryDate = lots.Allocations[0].ExpiryDate
+	}
+	if itemCurrency, err := normalizeCurrency(item.Currency); err == nil && itemCurrency == currency {
+		invoiceLine.Price = item.Price
+	}
+	return invoiceLine
+}
+
+// Проведение сессии: по каждой позиции создается транзакция прихода или расхода,
+// все позиции оформляются одной приходной или расходной накладной
+func completeScanSession(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var session ScanSession
+	if !loadScanSessionForUpdate(c, ctx, &session) {
+		return
+	}
+	if len(session.Lines) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Scan session has no scanned items"})
+		return
+	}
+
+	now := time.Now()
+	invoice := Invoice{
+		ID:            primitive.NewObjectID(),
+		Number:        session.Number,
+		Type:          InvoiceTypeReceipt,
+		Date:          now,
+		ReceivedBy:    PersonInfo{FullName: session.ResponsibleUser},
+		Currency:      defaultCurrency,
+		Notes:         session.Notes,
+		ScanSessionID: session.ID,
+	}
+	if session.Type == ScanSessionTypeIssue {
+		invoice.Type = InvoiceTypeExpense
+		invoice.IssuedBy = PersonInfo{FullName: session.ResponsibleUser}
+		invoice.ReceivedBy = PersonInfo{FullName: session.DestinationUser}
+	} else if !session.SupplierID.IsZero() {
+		var supplier Supplier
+		if err := supplierCollection.FindOne(ctx, bson.M{"_id": session.SupplierID}).Decode(&supplier); err == nil {
+			invoice.IssuedBy = PersonInfo{FullName: supplier.CompanyName}
+		}
+	}
+
+	mongoSession, err := mongoClient.StartSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session: " + err.Error()})
+		return
+	}
+	defer mongoSession.EndSession(ctx)
+
+	transactionType := session.transactionType()
+	var transactions []InventoryTransaction
+	var updated ScanSession
+	_, err = mongoSession.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		transactions = nil
+		invoice.Items = nil
+		invoice.TransactionIDs = nil
+
+		for _, line := range session.Lines {
+			// Оборудование перечитывается для каждой позиции: разные партии одного оборудования - разные позиции
+			var item WarehouseItem
+			if err := warehouseCollection.FindOne(sessCtx, bson.M{"_id": line.ItemID}).Decode(&item); err != nil {
+				if err == mongo.ErrNoDocuments {
+					return nil, &requestError{http.StatusBadRequest, "Item '" + line.ItemName + "' not found"}
+				}
+				return nil, err
+			}
+			if item.Archived {
+				return nil, &requestError{http.StatusConflict, "Item '" + item.Name + "' is archived"}
+			}
+
+			newQuantity := roundQuantity(item.Quantity + line.Quantity)
+			if transactionType == "issue" {
+				if line.Quantity > item.Quantity {
+					return nil, &requestError{http.StatusBadRequest, fmt.Sprintf("Insufficient quantity of '%s' available (%s)", item.Name, formatQuantity(item.Quantity))}
+				}
+				newQuantity = roundQuantity(item.Quantity - line.Quantity)
+			}
+
+			transaction := InventoryTransaction{
+				ID:              primitive.NewObjectID(),
+				ItemID:          item.ID,
+				TransactionType: transactionType,
+				Quantity:        line.Quantity,
+				ResponsibleUser: session.ResponsibleUser,
+				DestinationUser: session.DestinationUser,
+				Reason:          session.transactionReason(),
+				Notes:           session.Notes,
+				Date:            now,
+			}
+			// Приход относится к поставщику сессии или поставщику из карточки оборудования
+			if transactionType == "intake" {
+				transaction.SupplierID = item.SupplierID
+				if !session.SupplierID.IsZero() {
+					transaction.SupplierID = session.SupplierID
+				}
+			}
+			lots, err := prepareLotMovement(sessCtx, item, transactionType, line.LotNumber, line.ExpiryDate, line.Quantity)
+			if err != nil {
+				return nil, err
+			}
+			if lots != nil {
+				transaction.Lots = lots.Allocations
+			}
+
+			// Приход оценивается по позиции накладной сессии, позиция без цены - по карточке оборудования
+			invoiceLine := scanInvoiceLine(item, line, lots, invoice.Currency)
+			calculateInvoiceLine(&invoiceLine, invoice.VatIncluded)
+			receipt, ok := invoiceLineReceipt(invoiceLine, invoice.Currency, line.Quantity)
+			if !ok {
+				receipt = itemPriceReceipt(item, line.Quantity)
+			}
+			if err := postTransactionCost(sessCtx, item, &transaction, receipt); err != nil {
+				return nil, err
+			}
+
+			if _, err := transactionCollection.InsertOne(sessCtx, transaction); err != nil {
+				return nil, err
+			}
+			if _, err := updateItemStock(sessCtx, item, newQuantity, session.ResponsibleUser); err != nil {
+				return nil, err
+			}
+			if err := lots.apply(sessCtx); err != nil {
+				return nil, err
+			}
+
+			transactions = append(transactions, transaction)
+			invoice.TransactionIDs = append(invoice.TransactionIDs, transaction.ID)
+			invoice.Items = append(invoice.Items, invoiceLine)
+		}
+
+		if err := calculateInvoiceTotals(&invoice); err != nil {
+			return nil, err
+		}
+		invoice.CreatedAt = time.Now()
+		if _, err := invoiceCollection.InsertOne(sessCtx, invoice); err != nil {
+			return nil, err
+		}
+
+		update := bson.M{"$set": bson.M{
+			"status":          ScanSessionStatusCompleted,
+			"transaction_ids": invoice.TransactionIDs,
+			"invoice_id":      invoice.ID,
+			"completed_at":    now,
+		}}
+		if _, err := applyMergeUpdate(sessCtx, scanSessionCollection, openScanSessionFilter(session), update, &updated); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, &requestError{http.StatusPreconditionFailed, "Scan session was modified by another request"}
+			}
+			return nil, err
+		}
+		return nil, nil
+	})
+	if err != nil {
+		respondScanError(c, err, "Failed to complete scan session: ")
+		return
+	}
+
+	// Накладная создана вместе с транзакциями - уведомление о необходимости накладной не требуется
+	if err := sendInvoiceNotification(invoice); err != nil {
+		log.Printf("Failed to send invoice notification: %v", err)
+	}
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Scan session completed successfully",
+		"session":      updated,
+		"transactions": transactions,
+		"invoice":      invoice,
+	})
+}
+
+// Отмена открытой сессии без движения остатков
+func cancelScanSession(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var session ScanSession
+	if !loadScanSessionForUpdate(c, ctx, &session) {
+		return
+	}
+	saveScanSessionUpdate(c, ctx, session, bson.M{"$set": bson.M{
+		"status":       ScanSessionStatusCancelled,
+		"cancelled_at": time.Now(),
+	}})
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Тип транзакции возврата бракованного оборудования поставщику
+const TransactionTypeSupplierReturn = "supplier_return"
+
+// Веса показателей в итоговой оценке поставщика
+const (
+	scoreWeightOnTime   = 0.4
+	scoreWeightAccuracy = 0.3
+	scoreWeightPrice    = 0.15
+	scoreWeightDefects  = 0.15
+)
+
+// SupplierScorecard представляет показатели работы поставщика за период
+type SupplierScorecard struct {
+	SupplierID          primitive.ObjectID `json:"supplier_id"`
+	SupplierName        string             `json:"supplier_name"`
+	IsActive            bool               `json:"is_active"`
+	Receipts            int                `json:"receipts"`               // Количество приходов
+	ReceivedQuantity    float64            `json:"received_quantity"`      // Принятое количество в базовых единицах
+	ReceiptsWithDueDate int                `json:"receipts_with_due_date"` // Приходы по заказам с ожидаемой датой
+	OnTimeReceipts      int                `json:"on_time_receipts"`
+	OnTimeRate          *float64           `json:"on_time_rate"`    // Доля приходов в срок
+	CompletedLines      int                `json:"completed_lines"` // Позиции полученных и закрытых заказов
+	OverDeliveredLines  int                `json:"over_delivered_lines"`
+	UnderDeliveredLines int                `json:"under_delivered_lines"`
+	QuantityAccuracy    *float64           `json:"quantity_accuracy"`  // Среднее соответствие количества заказу
+	PriceComparisons    int                `json:"price_comparisons"`  // Позиций накладных с предыдущей ценой
+	AvgPriceVariance    *float64           `json:"avg_price_variance"` // Среднее изменение цены к предыдущему приходу
+	DefectReturns       float64            `json:"defect_returns"`     // Количество, возвращенное поставщику
+	DefectRate          *float64           `json:"defect_rate"`        // Доля возвращенного от принятого
+	Score               *float64           `json:"score"`              // Итоговая оценка от 0 до 100
+	Rank                int                `json:"rank,omitempty"`
+
+	accuracySum    float64
+	priceChangeSum float64
+}
+
+// Построитель оценок поставщиков за период с ограничением по оборудованию
+type scorecardBuilder struct {
+	from, to   time.Time
+	supplierID primitive.ObjectID // Нулевой ID - оценка всех поставщиков
+	items      map[primitive.ObjectID]WarehouseItem
+	allowed    map[primitive.ObjectID]bool // nil - все оборудование
+	cards      map[primitive.ObjectID]*SupplierScorecard
+	suppliers  map[primitive.ObjectID]Supplier
+}
+
+// Округление доли до тысячных
+func roundRate(value float64) *float64 {
+	rounded := math.Round(value*1000) / 1000
+	return &rounded
+}
+
+// Попадает ли дата в период оценки
+func (b *scorecardBuilder) inPeriod(date time.Time) bool {
+	return (b.from.IsZero() || !date.Before(b.from)) && (b.to.IsZero() || !date.After(b.to))
+}
+
+// Учитывается ли оборудование в оценке (ограничение по категории)
+func (b *scorecardBuilder) itemAllowed(itemID primitive.ObjectID) bool {
+	return b.allowed == nil || b.allowed[itemID]
+}
+
+// Оценка поставщика (создается при первом обращении)
+func (b *scorecardBuilder) card(supplierID primitive.ObjectID) *SupplierScorecard {
+	card, ok := b.cards[supplierID]
+	if !ok {
+		supplier := b.suppliers[supplierID]
+		card = &SupplierScorecard{
+			SupplierID:   supplierID,
+			SupplierName: supplier.CompanyName,
+			IsActive:     supplier.IsActive,
+		}
+		b.cards[supplierID] = card
+	}
+	return card
+}
+
+// Поставщик транзакции: указанный в транзакции или из карточки оборудования
+func (b *scorecardBuilder) transactionSupplier(transaction InventoryTransaction) primitive.ObjectID {
+	if !transaction.SupplierID.IsZero() {
+		return transaction.SupplierID
+	}
+	return b.items[transaction.ItemID].SupplierID
+}
+
+// Загрузка коллекции целиком
+func loadAll[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, opts ...*options.FindOptions) ([]T, error) {
+	cursor, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []T
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// Загрузка оборудования и поставщиков; categories ограничивает оценку оборудованием категорий,
+// supplierID - одним поставщиком (нулевой ID - все поставщики)
+func newScorecardBuilder(ctx context.Context, from, to time.Time, categories []string, supplierID primitive.ObjectID) (*scorecardBuilder, error) {
+	b := &scorecardBuilder{
+		from:       from,
+		to:         to,
+		supplierID: supplierID,
+		items:      map[primitive.ObjectID]WarehouseItem{},
+		cards:      map[primitive.ObjectID]*SupplierScorecard{},
+		suppliers:  map[primitive.ObjectID]Supplier{},
+	}
+
+	// Оборудование нужно для поставщика по умолчанию и ограничения по категории
+	itemFilter := bson.M{}
+	if categories != nil {
+		itemFilter["category"] = bson.M{"$in": categories}
+		b.allowed = map[primitive.ObjectID]bool{}
+	}
+	if !supplierID.IsZero() {
+		itemFilter["supplier_id"] = supplierID
+	}
+	items, err := loadAll[WarehouseItem](ctx, warehouseCollection, itemFilter,
+		options.Find().SetProjection(bson.M{"_id": 1, "category": 1, "supplier_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		b.items[item.ID] = item
+		if b.allowed != nil {
+			b.allowed[item.ID] = true
+		}
+	}
+
+	supplierFilter := bson.M{}
+	if !supplierID.IsZero() {
+		supplierFilter["_id"] = supplierID
+	}
+	suppliers, err := loadAll[Supplier](ctx, supplierCollection, supplierFilter)
+	if err != nil {
+		return nil, err
+	}
+	for _, supplier := range suppliers {
+		b.suppliers[supplier.ID] = supplier
+	}
+	return b, nil
+}
+
+// Фильтр по периоду оценки
+func (b *scorecardBuilder) periodFilter() bson.M {
+	dateRange := bson.M{}
+	if !b.from.IsZero() {
+		dateRange["$gte"] = b.from
+	}
+	if !b.to.IsZero() {
+		dateRange["$lte"] = b.to
+	}
+	return dateRange
+}
+
+// ID загруженного оборудования
+func (b *scorecardBuilder) itemIDs() []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, 0, len(b.items))
+	for id := range b.items {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Расчет показателей по заказам, транзакциям и приходным накладным
+func (b *scorecardBuilder) build(ctx context.Context) error {
+	orderFilter := bson.M{"status": bson.M{"$ne": PurchaseOrderStatusDraft}}
+	if !b.supplierID.IsZero() {
+		orderFilter["supplier_id"] = b.supplierID
+	}
+	if !b.to.IsZero() {
+		orderFilter["created_at"] = bson.M{"$lte": b.to}
+	}
+	orders, err := loadAll[PurchaseOrder](ctx, purchaseOrderCollection, orderFilter)
+	if err != nil {
+		return err
+	}
+
+	// Ожидаемая дата по позициям заказов и точность количества по завершенным заказам
+	dueDates := map[primitive.ObjectID]time.Time{}
+	for _, order := range orders {
+		completed := order.Status == PurchaseOrderStatusReceived || order.Status == PurchaseOrderStatusClosed
+		for _, line := range order.Lines {
+			expected := line.ExpectedDate
+			if expected.IsZero() {
+				expected = order.ExpectedDate
+			}
+			if !expected.IsZero() {
+				dueDates[line.ID] = expected
+			}
+
+			if !completed || !b.itemAllowed(line.ItemID) || line.Quantity <= 0 {
+				continue
+			}
+			completedAt := order.ReceivedAt
+			if completedAt.IsZero() {
+				completedAt = order.ClosedAt
+			}
+			if !b.inPeriod(completedAt) {
+				continue
+			}
+
+			card := b.card(order.SupplierID)
+			card.CompletedLines++
+			deviation := math.Abs(line.ReceivedQuantity-line.Quantity) / line.Quantity
+			card.accuracySum += math.Max(0, 1-deviation)
+			if line.OverDelivered() > 0 {
+				card.OverDeliveredLines++
+			} else if line.Outstanding() > 0 {
+				card.UnderDeliveredLines++
+			}
+		}
+	}
+
+	// Приходы и возвраты поставщику за период
+	transactionFilter := bson.M{"transaction_type": bson.M{"$in": []string{"intake", TransactionTypeSupplierReturn}}}
+	if dateRange := b.periodFilter(); len(dateRange) > 0 {
+		transactionFilter["date"] = dateRange
+	}
+	if b.allowed != nil {
+		transactionFilter["item_id"] = bson.M{"$in": b.itemIDs()}
+	}
+	if !b.supplierID.IsZero() {
+		// Поставщик указан в транзакции или берется из карточки оборудования
+		transactionFilter["$or"] = bson.A{
+			bson.M{"supplier_id": b.supplierID},
+			bson.M{"supplier_id": bson.M{"$exists": false}, "item_id": bson.M{"$in": b.itemIDs()}},
+		}
+	}
+	transactions, err := loadAll[InventoryTransaction](ctx, transactionCollection, transactionFilter)
+	if err != nil {
+		return err
+	}
+	for _, transaction := range transactions {
+		supplierID := b.transactionSupplier(transaction)
+		if supplierID.IsZero() || !b.itemAllowed(transaction.ItemID) {
+			continue
+		}
+		card := b.card(supplierID)
+
+		if transaction.TransactionType == TransactionTypeSupplierReturn {
+			card.DefectReturns = roundQuantity(card.DefectReturns + transaction.Quantity)
+			continue
+		}
+		card.Receipts++
+		card.ReceivedQuantity = roundQuantity(card.ReceivedQuantity + transaction.Quantity)
+
+		// Приход в срок - не позже конца дня ожидаемой поставки
+		if due, ok := dueDates[transaction.PurchaseOrderLineID]; ok {
+			card.ReceiptsWithDueDate++
+			endOfDay := time.Date(due.Year(), due.Month(), due.Day(), 23, 59, 59, 0, due.Location())
+			if !transaction.Date.After(endOfDay) {
+				card.OnTimeReceipts++
+			}
+		}
+	}
+
+	// Изменение цены относительно предыдущего прихода того же оборудования от того же поставщика.
+	// Накладные до начала периода нужны для предыдущей цены, поэтому ограничивается только конец периода.
+	orderSuppliers := map[primitive.ObjectID]primitive.ObjectID{}
+	orderIDs := []primitive.ObjectID{}
+	for _, order := range orders {
+		orderSuppliers[order.ID] = order.SupplierID
+		orderIDs = append(orderIDs, order.ID)
+	}
+	invoiceFilter := bson.M{"type": InvoiceTypeReceipt}
+	if !b.to.IsZero() {
+		invoiceFilter["date"] = bson.M{"$lte": b.to}
+	}
+	if !b.supplierID.IsZero() {
+		invoiceFilter["$or"] = bson.A{
+			bson.M{"purchase_order_id": bson.M{"$in": orderIDs}},
+			bson.M{"items.item_id": bson.M{"$in": b.itemIDs()}},
+		}
+	}
+	invoices, err := loadAll[Invoice](ctx, invoiceCollection, invoiceFilter,
+		options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "created_at", Value: 1}}))
+	if err != nil {
+		return err
+	}
+
+	// Цены сравниваются в пределах поставщика и валюты
+	type priceKey struct {
+		supplierID primitive.ObjectID
+		itemID     primitive.ObjectID
+		currency   string
+	}
+	previousPrices := map[priceKey]Money{}
+	for _, invoice := range invoices {
+		currency := invoice.Currency
+		if currency == "" {
+			currency = defaultCurrency
+		}
+		for _, line := range invoice.Items {
+			price := line.Price
+			if price.IsNegative() || price.IsZero() || line.ItemID.IsZero() {
+				continue
+			}
+			// Поставщик заказа, по которому принят товар, иначе поставщик из карточки оборудования
+			supplierID := b.items[line.ItemID].SupplierID
+			if !invoice.PurchaseOrderID.IsZero() {
+				orderSupplier, ok := orderSuppliers[invoice.PurchaseOrderID]
+				if ok {
+					supplierID = orderSupplier
+				} else if !b.supplierID.IsZero() {
+					continue // Заказ другого поставщика
+				}
+			}
+			if supplierID.IsZero() || (!b.supplierID.IsZero() && supplierID != b.supplierID) {
+				continue
+			}
+
+			key := priceKey{supplierID, line.ItemID, currency}
+			previous, seen := previousPrices[key]
+			previousPrices[key] = price
+			if !seen || !b.inPeriod(invoice.Date) || !b.itemAllowed(line.ItemID) {
+				continue
+			}
+			card := b.card(supplierID)
+			card.PriceComparisons++
+			card.priceChangeSum += price.Sub(previous).Float64() / previous.Float64()
+		}
+	}
+
+	for _, card := range b.cards {
+		card.finish()
+	}
+	return nil
+}
+
+// Итоговые доли и оценка; веса отсутствующих показателей перераспределяются
+func (card *SupplierScorecard) finish() {
+	var score, weights float64
+	if card.ReceiptsWithDueDate > 0 {
+		rate := float64(card.OnTimeReceipts) / float64(card.ReceiptsWithDueDate)
+		card.OnTimeRate = roundRate(rate)
+		score += scoreWeightOnTime * rate
+		weights += scoreWeightOnTime
+	}
+	if card.CompletedLines > 0 {
+		accuracy := card.accuracySum / float64(card.CompletedLines)
+		card.QuantityAccuracy = roundRate(accuracy)
+		score += scoreWeightAccuracy * accuracy
+		weights += scoreWeightAccuracy
+	}
+	if card.PriceComparisons > 0 {
+		variance := card.priceChangeSum / float64(card.PriceComparisons)
+		card.AvgPriceVariance = roundRate(variance)
+		// Рост цены снижает оценку, снижение цены не дает преимущества
+		score += scoreWeightPrice * (1 - math.Min(math.Max(variance, 0), 1))
+		weights += scoreWeightPrice
+	}
+	if card.ReceivedQuantity > 0 {
+		rate := card.DefectReturns / card.ReceivedQuantity
+		card.DefectRate = roundRate(rate)
+		score += scoreWeightDefects * (1 - math.Min(rate, 1))
+		weights += scoreWeightDefects
+	}
+	if weights > 0 {
+		value := math.Round(score/weights*1000) / 10
+		card.Score = &value
+	}
+}
+
+// Разбор периода оценки (from, to)
+func parseScorecardPeriod(c *gin.Context) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = parseDateParam(value); err != nil {
+			return from, to, &requestError{http.StatusBadRequest, "Invalid from parameter"}
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = parseDateParam(value); err != nil {
+			return from, to, &requestError{http.StatusBadRequest, "Invalid to parameter"}
+		}
+	}
+	return from, to, nil
+}
+
+// Оценка работы поставщика
+func getSupplierScorecard(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+		return
+	}
+	from, to, err := parseScorecardPeriod(c)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	builder, err := newScorecardBuilder(ctx, from, to, nil, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load scorecard data: " + err.Error()})
+		return
+	}
+	if _, ok := builder.suppliers[id]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+	if err := builder.build(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute scorecard: " + err.Error()})
+		return
+	}
+
+	card := builder.card(id)
+	c.JSON(http.StatusOK, card)
+}
+
+// Рейтинг поставщиков по категории оборудования (с подкатегориями)
+func getSupplierRanking(c *gin.Context) {
+	from, to, err := parseScorecardPeriod(c)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var categories []string
+	if category := c.Query("category"); category != "" {
+		for _, code := range strings.Split(category, ",") {
+			codes := []string{code}
+			if c.Query("descendants") != "false" {
+				if codes, err = categoryWithDescendants(ctx, code); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve categories: " + err.Error()})
+					return
+				}
+			}
+			categories = append(categories, codes...)
+		}
+	}
+
+	builder, err := newScorecardBuilder(ctx, from, to, categories, primitive.NilObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load scorecard data: " + err.Error()})
+		return
+	}
+	if err := builder.build(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute scorecards: " + err.Error()})
+		return
+	}
+
+	// Поставщики без оценки (нет данных) идут в конце
+	ranking := []*SupplierScorecard{}
+	for _, card := range builder.cards {
+		if c.Query("include_inactive") != "true" && !card.IsActive {
+			continue
+		}
+		ranking = append(ranking, card)
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		left, right := ranking[i].Score, ranking[j].Score
+		if (left == nil) != (right == nil) {
+			return left != nil
+		}
+		if left != nil && *left != *right {
+			return *left > *right
+		}
+		return ranking[i].SupplierName < ranking[j].SupplierName
+	})
+	for i, card := range ranking {
+		if card.Score != nil {
+			card.Rank = i + 1
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"category": c.Query("category"), "suppliers": ranking})
+}
+
+// Поставщик прихода или возврата поставщику: из запроса или из карточки оборудования.
+// Возврат поставщику требует причину (например, брак).
+func prepareSupplierAttribution(req TransactionRequest, item WarehouseItem, transaction *InventoryTransaction) error {
+	if req.TransactionType != "intake" && req.TransactionType != TransactionTypeSupplierReturn {
+		if req.SupplierID != "" {
+			return &requestError{http.StatusBadRequest, "supplier_id is only allowed for intake and supplier_return transactions"}
+		}
+		return nil
+	}
+	if req.TransactionType == TransactionTypeSupplierReturn && strings.TrimSpace(req.Reason) == "" {
+		return &requestError{http.StatusBadRequest, "reason is required for supplier_return transactions"}
+	}
+
+	transaction.SupplierID = item.SupplierID
+	if req.SupplierID != "" {
+		supplierID, err := primitive.ObjectIDFromHex(req.SupplierID)
+		if err != nil {
+			return &requestError{http.StatusBadRequest, "Invalid supplier ID"}
+		}
+		transaction.SupplierID = supplierID
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Поиск постранично использует skip/limit, а не курсоры findPage: результаты сортируются
+// по релевантности ($meta: textScore) и произвольному набору полей, включая атрибуты,
+// и позицию в такой сортировке нельзя выразить фильтром по последнему документу.
+// Кроме того, страница, общее количество и фасеты считаются одной агрегацией $facet.
+// Глубина пропуска ограничена, чтобы дальние страницы не сканировали всю коллекцию;
+// для полной выгрузки предназначены /items с курсором и экспорт.
+const (
+	maxSearchLimit = 200   // Максимальный размер страницы результатов поиска
+	maxSearchSkip  = 10000 // Максимальное число пропускаемых результатов
+)
+
+// Поля оборудования, по которым разрешена сортировка
+var itemSortFields = map[string]bool{
+	"name":            true,
+	"serial_number":   true,
+	"category":        true,
+	"manufacturer":    true,
+	"location":        true,
+	"status":          true,
+	"price":           true,
+	"quantity":        true,
+	"purchase_date":   true,
+	"warranty_expiry": true,
+	"created_at":      true,
+	"updated_at":      true,
+}
+
+// Поля, по которым считаются фасеты
+var itemFacetFields = []string{"category", "manufacturer", "status"}
+
+// FacetBucket представляет значение фасета и количество оборудования с ним
+type FacetBucket struct {
+	Value string `bson:"_id" json:"value"`
+	Count int    `bson:"count" json:"count"`
+}
+
+// Построение фильтра поиска оборудования из параметров запроса
+func buildItemSearchFilter(c *gin.Context, ctx context.Context) (bson.M, error) {
+	filter := bson.M{}
+
+	// Полнотекстовый поиск (название, серийный номер, производитель, описание)
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		filter["$text"] = bson.M{"$search": q, "$language": "russian"}
+	}
+
+	// Поиск по началу серийного номера (использует индекс serial_number)
+	if prefix := strings.TrimSpace(c.Query("serial_prefix")); prefix != "" {
+		filter["serial_number"] = bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}
+	}
+
+	// Категория включает все подкатегории; несколько значений передаются через запятую
+	if value := c.Query("category"); value != "" {
+		categories, err := categoryFilter(c, ctx, strings.Split(value, ","))
+		if err != nil {
+			return nil, err
+		}
+		filter["category"] = categories
+	}
+
+	// Точные фильтры; несколько значений передаются через запятую
+	for _, field := range []string{"manufacturer", "status", "location"} {
+		if value := c.Query(field); value != "" {
+			values := strings.Split(value, ",")
+			if len(values) == 1 {
+				filter[field] = values[0]
+			} else {
+				filter[field] = bson.M{"$in": values}
+			}
+		}
+	}
+
+	// Диапазоны по цене, количеству и дате покупки
+	if err := addFloatRange(c, filter, "price", "price_min", "price_max"); err != nil {
+		return nil, err
+	}
+	if err := addFloatRange(c, filter, "quantity", "quantity_min", "quantity_max"); err != nil {
+		return nil, err
+	}
+	if err := addDateRange(c, filter, "purchase_date", "purchased_from", "purchased_to"); err != nil {
+		return nil, err
+	}
+
+	// Атрибуты категорий: attr.<код>=значение, attr.<код>.min, attr.<код>.max
+	if err := addAttributeFilters(c, ctx, filter); err != nil {
+		return nil, err
+	}
+	if err := applyArchivedFilter(c, filter); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// Добавление диапазона чисел с плавающей точкой в фильтр
+func addFloatRange(c *gin.Context, filter bson.M, field, minParam, maxParam string) error {
+	rangeFilter := bson.M{}
+	if value := c.Query(minParam); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return &requestError{http.StatusBadRequest, "Invalid " + minParam + " parameter"}
+		}
+		rangeFilter["$gte"] = parsed
+	}
+	if value := c.Query(maxParam); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return &requestError{http.StatusBadRequest, "Invalid " + maxParam + " parameter"}
+		}
+		rangeFilter["$lte"] = parsed
+	}
+	if len(rangeFilter) > 0 {
+		filter[field] = rangeFilter
+	}
+	return nil
+}
+
+// Добавление диапазона дат (RFC3339 или YYYY-MM-DD) в фильтр
+func addDateRange(c *gin.Context, filter bson.M, field, fromParam, toParam string) error {
+	rangeFilter := bson.M{}
+	if value := c.Query(fromParam); value != "" {
+		parsed, err := parseDateParam(value)
+		if err != nil {
+			return &requestError{http.StatusBadRequest, "Invalid " + fromParam + " parameter"}
+		}
+		rangeFilter["$gte"] = parsed
+	}
+	if value := c.Query(toParam); value != "" {
+		parsed, err := parseDateParam(value)
+		if err != nil {
+			return &requestError{http.StatusBadRequest, "Invalid " + toParam + " parameter"}
+		}
+		rangeFilter["$lte"] = parsed
+	}
+	if len(rangeFilter) > 0 {
+		filter[field] = rangeFilter
+	}
+	return nil
+}
+
+// Разбор даты из параметра запроса
+func parseDateParam(value string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// Разбор параметра сортировки вида "name,-price".
+// При полнотекстовом поиске без явной сортировки результаты упорядочены по релевантности.
+func buildItemSort(sortParam string, textSearch bool) (bson.D, error) {
+	sortDoc := bson.D{}
+	if sortParam == "" {
+		if textSearch {
+			sortDoc = append(sortDoc, bson.E{Key: "score", Value: bson.M{"$meta": "textScore"}})
+		} else {
+			sortDoc = append(sortDoc, bson.E{Key: "created_at", Value: -1})
+		}
+	}
+
+	for _, field := range strings.Split(sortParam, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		direction := 1
+		if strings.HasPrefix(field, "-") {
+			direction = -1
+			field = field[1:]
+		}
+
+		if field == "relevance" {
+			if !textSearch {
+				return nil, &requestError{http.StatusBadRequest, "Sorting by relevance requires the q parameter"}
+			}
+			sortDoc = append(sortDoc, bson.E{Key: "score", Value: bson.M{"$meta": "textScore"}})
+			continue
+		}
+		// Сортировка по значению атрибута: attr.<код>
+		if code, ok := strings.CutPrefix(field, attributeQueryPrefix); ok && attributeCodePattern.MatchString(code) {
+			sortDoc = append(sortDoc, bson.E{Key: "attributes." + code, Value: direction})
+			continue
+		}
+		if !itemSortFields[field] {
+			return nil, &requestError{http.StatusBadRequest, "Unsupported sort field: " + field}
+		}
+		sortDoc = append(sortDoc, bson.E{Key: field, Value: direction})
+	}
+
+	// Стабильный порядок для одинаковых значений
+	return append(sortDoc, bson.E{Key: "_id", Value: 1}), nil
+}
+
+// Поиск оборудования с фасетами
+func searchWarehouseItems(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter, err := buildItemSearchFilter(c, ctx)
+	if err != nil {
+		respondError(c, err, "Failed to build search filter: ")
+		return
+	}
+
+	_, textSearch := filter["$text"]
+	sortDoc, err := buildItemSort(c.Query("sort"), textSearch)
+	if err != nil {
+		respondError(c, err, "Failed to build sort: ")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > maxSearchLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxSearchLimit)})
+		return
+	}
+	skip, err := strconv.Atoi(c.DefaultQuery("skip", "0"))
+	if err != nil || skip < 0 || skip > maxSearchSkip {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "skip must be between 0 and " + strconv.Itoa(maxSearchSkip)})
+		return
+	}
+
+	// Одна агрегация возвращает страницу, общее количество и фасеты
+	resultsPipeline := mongo.Pipeline{}
+	if textSearch {
+		resultsPipeline = append(resultsPipeline, bson.D{{Key: "$addFields", Value: bson.M{"score": bson.M{"$meta": "textScore"}}}})
+	}
+	resultsPipeline = append(resultsPipeline,
+		bson.D{{Key: "$sort", Value: sortDoc}},
+		bson.D{{Key: "$skip", Value: skip}},
+		bson.D{{Key: "$limit", Value: limit}},
+	)
+
+	facetStage := bson.M{
+		"items": resultsPipeline,
+		"total": bson.A{bson.M{"$count": "count"}},
+	}
+	for _, field := range itemFacetFields {
+		facetStage[field] = bson.A{
+			bson.M{"$group": bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: filter}},
+		bson.D{{Key: "$facet", Value: facetStage}},
+	}
+
+	cursor, err := warehouseCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search items: " + err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Items []WarehouseItem `bson:"items"`
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+		Category     []FacetBucket `bson:"category"`
+		Manufacturer []FacetBucket `bson:"manufacturer"`
+		Status       []FacetBucket `bson:"status"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode search results: " + err.Error()})
+		return
+	}
+
+	items := []WarehouseItem{}
+	var total int64
+	facets := gin.H{"category": []FacetBucket{}, "manufacturer": []FacetBucket{}, "status": []FacetBucket{}}
+	if len(results) > 0 {
+		result := results[0]
+		if result.Items != nil {
+			items = result.Items
+		}
+		if len(result.Total) > 0 {
+			total = result.Total[0].Count
+		}
+		facets = gin.H{
+			"category":     nonNilBuckets(result.Category),
+			"manufacturer": nonNilBuckets(result.Manufacturer),
+			"status":       nonNilBuckets(result.Status),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":  items,
+		"total":  total,
+		"limit":  limit,
+		"skip":   skip,
+		"facets": facets,
+	})
+}
+
+// Пустой срез вместо nil, чтобы в JSON был массив
+func nonNilBuckets(buckets []FacetBucket) []FacetBucket {
+	if buckets == nil {
+		return []FacetBucket{}
+	}
+	return buckets
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Порог сходства названий, начиная с которого поставщик считается возможным дубликатом
+const supplierNameSimilarityThreshold = 0.85
+
+// Организационно-правовые формы, которые не учитываются при сравнении названий
+var legalFormWords = map[string]bool{
+	"ооо": true, "оао": true, "зао": true, "пао": true, "ао": true, "нао": true,
+	"ип": true, "фгуп": true, "гуп": true, "муп": true, "ано": true,
+	"llc": true, "ltd": true, "inc": true, "gmbh": true, "corp": true, "co": true,
+}
+
+// SupplierDuplicate представляет возможный дубликат поставщика
+type SupplierDuplicate struct {
+	ID          primitive.ObjectID `json:"id"`
+	CompanyName string             `json:"company_name"`
+	TaxID       string             `json:"tax_id,omitempty"`
+	IsActive    bool               `json:"is_active"`
+	Similarity  float64            `json:"similarity"` // 1 - совпадение названия или ИНН
+	Reason      string             `json:"reason"`     // tax_id или company_name
+}
+
+// Цифры строки; false, если встречаются другие символы
+func parseDigits(value string) ([]int, bool) {
+	digits := make([]int, 0, len(value))
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return nil, false
+		}
+		digits = append(digits, int(r-'0'))
+	}
+	return digits, true
+}
+
+// Контрольная цифра ИНН по весовым коэффициентам
+func innCheckDigit(digits []int, weights []int) int {
+	sum := 0
+	for i, weight := range weights {
+		sum += digits[i] * weight
+	}
+	return sum % 11 % 10
+}
+
+// Проверка ИНН: 10 цифр для организаций, 12 цифр для физических лиц и ИП
+func validateINN(inn string) error {
+	digits, ok := parseDigits(inn)
+	if !ok || (len(digits) != 10 && len(digits) != 12) {
+		return &requestError{http.StatusBadRequest, "INN must contain 10 or 12 digits"}
+	}
+
+	if len(digits) == 10 {
+		if innCheckDigit(digits, []int{2, 4, 10, 3, 5, 9, 4, 6, 8}) != digits[9] {
+			return &requestError{http.StatusBadRequest, "INN checksum is invalid"}
+		}
+		return nil
+	}
+
+	if innCheckDigit(digits, []int{7, 2, 4, 10, 3, 5, 9, 4, 6, 8}) != digits[10] ||
+		innCheckDigit(digits, []int{3, 7, 2, 4, 10, 3, 5, 9, 4, 6, 8}) != digits[11] {
+		return &requestError{http.StatusBadRequest, "INN checksum is invalid"}
+	}
+	return nil
+}
+
+// Проверка КПП: 4 цифры, 2 цифры или заглавные латинские буквы, 3 цифры
+func validateKPP(kpp string) error {
+	if len(kpp) != 9 {
+		return &requestError{http.StatusBadRequest, "KPP must contain 9 characters"}
+	}
+	for i, r := range kpp {
+		digit := r >= '0' && r <= '9'
+		if i == 4 || i == 5 {
+			if !digit && !(r >= 'A' && r <= 'Z') {
+				return &requestError{http.StatusBadRequest, "KPP format is invalid"}
+			}
+		} else if !digit {
+			return &requestError{http.StatusBadRequest, "KPP format is invalid"}
+		}
+	}
+	return nil
+}
+
+// Проверка ОГРН (13 цифр) или ОГРНИП (15 цифр) по контрольной цифре
+func validateOGRN(ogrn string) error {
+	digits, ok := parseDigits(ogrn)
+	if !ok || (len(digits) != 13 && len(digits) != 15) {
+		return &requestError{http.StatusBadRequest, "OGRN must contain 13 digits (15 for OGRNIP)"}
+	}
+
+	// Остаток от деления числа без контрольной цифры на 11 (ОГРН) или 13 (ОГРНИП)
+	divisor := 11
+	if len(digits) == 15 {
+		divisor = 13
+	}
+	remainder := 0
+	for _, digit := range digits[:len(digits)-1] {
+		remainder = (remainder*10 + digit) % divisor
+	}
+	if remainder%10 != digits[len(digits)-1] {
+		return &requestError{http.StatusBadRequest, "OGRN checksum is invalid"}
+	}
+	return nil
+}
+
+// Проверка реквизитов поставщика и их согласованности:
+// КПП и 13-значный ОГРН есть только у организаций (ИНН из 10 цифр), ОГРНИП - у ИП (ИНН из 12 цифр)
+func validateSupplierRequisites(taxID, kpp, ogrn string) error {
+	if taxID != "" {
+		if err := validateINN(taxID); err != nil {
+			return err
+		}
+	}
+	if kpp != "" {
+		if err := validateKPP(kpp); err != nil {
+			return err
+		}
+		if len(taxID) == 12 {
+			return &requestError{http.StatusBadRequest, "KPP is only allowed for organizations (10-digit INN)"}
+		}
+	}
+	if ogrn != "" {
+		if err := validateOGRN(ogrn); err != nil {
+			return err
+		}
+		if taxID != "" && (len(taxID) == 10) != (len(ogrn) == 13) {
+			return &requestError{http.StatusBadRequest, "OGRN does not match INN type (13 digits for organizations, 15 for individual entrepreneurs)"}
+		}
+	}
+	return nil
+}
+
+// Проверка, что ИНН не используется другим активным поставщиком
+func checkSupplierTaxIDUnique(ctx context.Context, taxID string, selfID primitive.ObjectID) error {
+	if taxID == "" {
+		return nil
+	}
+	filter := bson.M{"tax_id": taxID, "is_active": true}
+	if !selfID.IsZero() {
+		filter["_id"] = bson.M{"$ne": selfID}
+	}
+	count, err := supplierCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return &requestError{http.StatusConflict, "Active supplier with INN '" + taxID + "' already exists"}
+	}
+	return nil
+}
+
+// Проверка нового поставщика перед сохранением
+func validateNewSupplier(ctx context.Context, supplier *Supplier) error {
+	supplier.TaxID = strings.TrimSpace(supplier.TaxID)
+	supplier.KPP = strings.ToUpper(strings.TrimSpace(supplier.KPP))
+	supplier.OGRN = strings.TrimSpace(supplier.OGRN)
+	if strings.TrimSpace(supplier.CompanyName) == "" {
+		return &requestError{http.StatusBadRequest, "Company name is required"}
+	}
+	if supplier.LeadTimeDays < 0 {
+		return &requestError{http.StatusBadRequest, "lead_time_days must be non-negative"}
+	}
+	if err := validateSupplierRequisites(supplier.TaxID, supplier.KPP, supplier.OGRN); err != nil {
+		return err
+	}
+	return checkSupplierTaxIDUnique(ctx, supplier.TaxID, primitive.NilObjectID)
+}
+
+// Проверка изменения реквизитов поставщика с учетом текущих значений
+func validateSupplierUpdate(ctx context.Context, current Supplier, update bson.M) error {
+	set, _ := update["$set"].(bson.M)
+	unset, _ := update["$unset"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+	}
+
+	changed := false
+	value := func(field, currentValue string, normalize func(string) string) string {
+		if _, ok := unset[field]; ok {
+			changed = true
+			return ""
+		}
+		if v, ok := set[field].(string); ok {
+			v = normalize(strings.TrimSpace(v))
+			set[field] = v
+			changed = changed || v != currentValue
+			return v
+		}
+		return currentValue
+	}
+	keep := func(s string) string { return s }
+
+	taxID := value("tax_id", current.TaxID, keep)
+	kpp := value("kpp", current.KPP, strings.ToUpper)
+	ogrn := value("ogrn", current.OGRN, keep)
+
+	// Реквизиты, заведенные до появления проверки, не мешают изменять другие поля
+	if !changed {
+		return nil
+	}
+	if err := validateSupplierRequisites(taxID, kpp, ogrn); err != nil {
+		return err
+	}
+	if current.IsActive && taxID != current.TaxID {
+		return checkSupplierTaxIDUnique(ctx, taxID, current.ID)
+	}
+	return nil
+}
+
+// Нормализация названия компании для сравнения:
+// регистр, кавычки и пунктуация, организационно-правовая форма, ё
+func normalizeCompanyName(name string) string {
+	name = strings.ReplaceAll(strings.ToLower(name), "ё", "е")
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	kept := make([]string, 0, len(words))
+	for _, word := range words {
+		if !legalFormWords[word] {
+			kept = append(kept, word)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// Расстояние Левенштейна между строками (по символам)
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Сходство нормализованных названий от 0 до 1
+func companyNameSimilarity(a, b string) float64 {
+	left, right := []rune(a), []rune(b)
+	longest := max(len(left), len(right))
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(left, right))/float64(longest)
+}
+
+// Поиск возможных дубликатов поставщика по ИНН и похожему названию
+func findSupplierDuplicates(ctx context.Context, companyName, taxID string, selfID primitive.ObjectID) ([]SupplierDuplicate, error) {
+	cursor, err := supplierCollection.Find(ctx, bson.M{"_id": bson.M{"$ne": selfID}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var suppliers []Supplier
+	if err := cursor.All(ctx, &suppliers); err != nil {
+		return nil, err
+	}
+
+	name := normalizeCompanyName(companyName)
+	duplicates := []SupplierDuplicate{}
+	for _, supplier := range suppliers {
+		duplicate := SupplierDuplicate{
+			ID:          supplier.ID,
+			CompanyName: supplier.CompanyName,
+			TaxID:       supplier.TaxID,
+			IsActive:    supplier.IsActive,
+		}
+		if taxID != "" && supplier.TaxID == taxID {
+			duplicate.Similarity = 1
+			duplicate.Reason = "tax_id"
+		} else if name != "" {
+			similarity := companyNameSimilarity(name, normalizeCompanyName(supplier.CompanyName))
+			if similarity < supplierNameSimilarityThreshold {
+				continue
+			}
+			duplicate.Similarity = float64(int(similarity*100)) / 100
+			duplicate.Reason = "company_name"
+		} else {
+			continue
+		}
+		duplicates = append(duplicates, duplicate)
+	}
+
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i].Similarity > duplicates[j].Similarity })
+	return duplicates, nil
+}
+
+// Проверка возможных дубликатов перед созданием поставщика
+func checkSupplierDuplicates(c *gin.Context) {
+	companyName := c.Query("company_name")
+	taxID := strings.TrimSpace(c.Query("tax_id"))
+	if strings.TrimSpace(companyName) == "" && taxID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "company_name or tax_id is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	duplicates, err := findSupplierDuplicates(ctx, companyName, taxID, primitive.NilObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check duplicates: " + err.Error()})
+		return
+	}
+
+	response := gin.H{"duplicates": duplicates}
+	if taxID != "" {
+		if err := validateINN(taxID); err != nil {
+			response["tax_id_error"] = err.Error()
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
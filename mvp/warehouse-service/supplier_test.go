@@ -0,0 +1,101 @@
+package main
+
+import "testing"
+
+func TestValidateINN(t *testing.T) {
+	tests := []struct {
+		inn     string
+		wantErr bool
+	}{
+		{"7707083893", false},   // Организация
+		{"500100732259", false}, // ИП
+		{"7707083894", true},    // Неверная контрольная цифра
+		{"500100732258", true},  // Неверная вторая контрольная цифра
+		{"500100732269", true},  // Неверная первая контрольная цифра
+		{"770708389", true},
+		{"77070838930", true},
+		{"77070838a3", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.inn, func(t *testing.T) {
+			err := validateINN(tt.inn)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateINN(%q) error = %v, wantErr %v", tt.inn, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateOGRN(t *testing.T) {
+	tests := []struct {
+		ogrn    string
+		wantErr bool
+	}{
+		{"1027700132195", false},   // ОГРН
+		{"304500116000157", false}, // ОГРНИП
+		{"1027700132196", true},
+		{"304500116000158", true},
+		{"10277001321", true},
+		{"10277001321a5", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ogrn, func(t *testing.T) {
+			err := validateOGRN(tt.ogrn)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateOGRN(%q) error = %v, wantErr %v", tt.ogrn, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateKPP(t *testing.T) {
+	tests := []struct {
+		kpp     string
+		wantErr bool
+	}{
+		{"773601001", false},
+		{"7736AB001", false},
+		{"7736ab001", true},
+		{"77360100", true},
+		{"77A601001", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kpp, func(t *testing.T) {
+			err := validateKPP(tt.kpp)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateKPP(%q) error = %v, wantErr %v", tt.kpp, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSupplierRequisites(t *testing.T) {
+	tests := []struct {
+		name    string
+		taxID   string
+		kpp     string
+		ogrn    string
+		wantErr bool
+	}{
+		{"organization", "7707083893", "773601001", "1027700132195", false},
+		{"entrepreneur", "500100732259", "", "304500116000157", false},
+		{"empty", "", "", "", false},
+		{"kpp for entrepreneur", "500100732259", "773601001", "", true},
+		{"ogrnip for organization", "7707083893", "", "304500116000157", true},
+		{"ogrn for entrepreneur", "500100732259", "", "1027700132195", true},
+		{"invalid inn", "7707083894", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSupplierRequisites(tt.taxID, tt.kpp, tt.ogrn)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSupplierRequisites() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Базовая единица оборудования по умолчанию
+const defaultUnit = "pcs"
+
+// Максимальная точность количества; остатки округляются до нее после каждой операции
+const quantityScale = 6
+
+// Величины, между единицами которых возможен пересчет без данных об оборудовании
+var unitDimensions = map[string]bool{"count": true, "length": true, "mass": true, "volume": true}
+
+// Единицы измерения, создаваемые при запуске сервиса
+var defaultUnits = []UnitOfMeasure{
+	{Code: "pcs", Name: "шт", Dimension: "count", Factor: 1, Precision: 0},
+	{Code: "mm", Name: "мм", Dimension: "length", Factor: 0.001, Precision: 0},
+	{Code: "cm", Name: "см", Dimension: "length", Factor: 0.01, Precision: 1},
+	{Code: "m", Name: "м", Dimension: "length", Factor: 1, Precision: 3},
+	{Code: "km", Name: "км", Dimension: "length", Factor: 1000, Precision: 3},
+	{Code: "g", Name: "г", Dimension: "mass", Factor: 0.001, Precision: 1},
+	{Code: "kg", Name: "кг", Dimension: "mass", Factor: 1, Precision: 3},
+	{Code: "t", Name: "т", Dimension: "mass", Factor: 1000, Precision: 3},
+	{Code: "ml", Name: "мл", Dimension: "volume", Factor: 0.001, Precision: 0},
+	{Code: "l", Name: "л", Dimension: "volume", Factor: 1, Precision: 3},
+	{Code: "box", Name: "кор", Precision: 0},
+	{Code: "pack", Name: "уп", Precision: 0},
+	{Code: "roll", Name: "рул", Precision: 0},
+	{Code: "set", Name: "компл", Precision: 0},
+}
+
+// ItemUnitsRequest представляет изменение единиц измерения оборудования
+type ItemUnitsRequest struct {
+	Unit       string          `json:"unit" binding:"required"`
+	Packagings []ItemPackaging `json:"packagings"`
+}
+
+// Округление количества для устранения погрешности вычислений с плавающей точкой
+func roundQuantity(value float64) float64 {
+	scale := math.Pow10(quantityScale)
+	return math.Round(value*scale) / scale
+}
+
+// Проверка, что количество не точнее допустимого для единицы
+func fitsPrecision(value float64, precision int) bool {
+	scale := math.Pow10(precision)
+	return math.Abs(value*scale-math.Round(value*scale)) < 1e-6
+}
+
+// Форматирование количества без лишних нулей
+func formatQuantity(value float64) string {
+	return fmt.Sprintf("%g", roundQuantity(value))
+}
+
+// Базовая единица оборудования с учетом карточек, созданных до появления единиц
+func itemUnit(item WarehouseItem) string {
+	if item.Unit == "" {
+		return defaultUnit
+	}
+	return item.Unit
+}
+
+// unitCatalog - справочник единиц измерения по коду
+type unitCatalog map[string]UnitOfMeasure
+
+// Обозначение единицы для документов и уведомлений
+func unitName(catalog unitCatalog, code string) string {
+	if code == "" {
+		code = defaultUnit
+	}
+	if unit, ok := catalog[code]; ok {
+		return unit.Name
+	}
+	return code
+}
+
+// Код единицы по коду (pcs) или обозначению (шт); неизвестное значение возвращается как есть
+func (catalog unitCatalog) resolve(value string) string {
+	if _, ok := catalog[value]; ok {
+		return value
+	}
+	for code, unit := range catalog {
+		if strings.EqualFold(unit.Name, value) {
+			return code
+		}
+	}
+	return value
+}
+
+// Загрузка справочника единиц измерения
+func loadUnits(ctx context.Context) (unitCatalog, error) {
+	units, err := loadAll[UnitOfMeasure](ctx, unitCollection, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	catalog := unitCatalog{}
+	for _, unit := range units {
+		catalog[unit.Code] = unit
+	}
+	// Справочник мог еще не заполниться - стандартные единицы доступны всегда
+	for _, unit := range defaultUnits {
+		if _, ok := catalog[unit.Code]; !ok {
+			catalog[unit.Code] = unit
+		}
+	}
+	return catalog, nil
+}
+
+// Пересчет количества из единицы ввода в базовую единицу оборудования.
+// Пересчет возможен через упаковку оборудования или между единицами одной величины.
+func (catalog unitCatalog) toBase(item WarehouseItem, quantity float64, unitCode string) (float64, error) {
+	baseCode := itemUnit(item)
+	if unitCode == "" {
+		unitCode = baseCode
+	}
+	unit, ok := catalog[unitCode]
+	if !ok {
+		return 0, &requestError{http.StatusBadRequest, "Unknown unit '" + unitCode + "'"}
+	}
+	if !fitsPrecision(quantity, unit.Precision) {
+		return 0, &requestError{http.StatusBadRequest, fmt.Sprintf("Quantity in '%s' allows at most %d decimal places", unitCode, unit.Precision)}
+	}
+
+	var base float64
+	switch {
+	case unitCode == baseCode:
+		base = quantity
+	case packagingFactor(item, unitCode) > 0:
+		base = quantity * packagingFactor(item, unitCode)
+	default:
+		baseUnit, ok := catalog[baseCode]
+		if !ok || unit.Dimension == "" || unit.Dimension != baseUnit.Dimension {
+			return 0, &requestError{http.StatusBadRequest, fmt.Sprintf("Unit '%s' cannot be converted to '%s' for this item", unitCode, baseCode)}
+		}
+		base = quantity * unit.Factor / baseUnit.Factor
+	}
+
+	base = roundQuantity(base)
+	if baseUnit, ok := catalog[baseCode]; ok && !fitsPrecision(base, baseUnit.Precision) {
+		return 0, &requestError{http.StatusBadRequest, fmt.Sprintf("%s %s is not a whole amount of '%s'", formatQuantity(quantity), unitCode, baseCode)}
+	}
+	return base, nil
+}
+
+// Количество базовых единиц в упаковке оборудования; 0, если упаковки нет
+func packagingFactor(item WarehouseItem, unitCode string) float64 {
+	for _, packaging := range item.Packagings {
+		if packaging.Unit == unitCode {
+			return packaging.Factor
+		}
+	}
+	return 0
+}
+
+// Проверка количества в базовой единице оборудования (остатки, минимальный остаток)
+func (catalog unitCatalog) checkBaseQuantity(item WarehouseItem, quantity float64, field string) error {
+	if quantity < 0 {
+		return &requestError{http.StatusBadRequest, field + " must be non-negative"}
+	}
+	unit, ok := catalog[itemUnit(item)]
+	if ok && !fitsPrecision(quantity, unit.Precision) {
+		return &requestError{http.StatusBadRequest, fmt.Sprintf("%s allows at most %d decimal places in '%s'", field, unit.Precision, unit.Code)}
+	}
+	return nil
+}
+
+// Проверка базовой единицы и упаковок оборудования
+func (catalog unitCatalog) validateItemUnits(unitCode string, packagings []ItemPackaging) error {
+	if _, ok := catalog[unitCode]; !ok {
+		return &requestError{http.StatusBadRequest, "Unknown unit '" + unitCode + "'"}
+	}
+	seen := map[string]bool{}
+	for i, packaging := range packagings {
+		if _, ok := catalog[packaging.Unit]; !ok {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Unknown unit '%s' in packaging %d", packaging.Unit, i+1)}
+		}
+		if packaging.Unit == unitCode {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Packaging %d duplicates the base unit", i+1)}
+		}
+		if seen[packaging.Unit] {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Packaging '%s' is specified more than once", packaging.Unit)}
+		}
+		if packaging.Factor <= 0 {
+			return &requestError{http.StatusBadRequest, fmt.Sprintf("Factor of packaging '%s' must be positive", packaging.Unit)}
+		}
+		seen[packaging.Unit] = true
+	}
+	return nil
+}
+
+// Заполнение справочника стандартными единицами (существующие записи не изменяются)
+func seedUnits() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, unit := range defaultUnits {
+		unit.CreatedAt = time.Now()
+		_, err := unitCollection.UpdateOne(ctx,
+			bson.M{"code": unit.Code},
+			bson.M{"$setOnInsert": unit},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			log.Printf("Warning: failed to seed unit %s: %v", unit.Code, err)
+		}
+	}
+}
+
+// Получение справочника единиц измерения
+func listUnits(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if dimension := c.Query("dimension"); dimension != "" {
+		filter["dimension"] = dimension
+	}
+	units, err := loadAll[UnitOfMeasure](ctx, unitCollection, filter,
+		options.Find().SetSort(bson.D{{Key: "dimension", Value: 1}, {Key: "factor", Value: 1}, {Key: "code", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch units: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, units)
+}
+
+// Создание единицы измерения
+func createUnit(c *gin.Context) {
+	var unit UnitOfMeasure
+	if err := c.ShouldBindJSON(&unit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	unit.Code = strings.TrimSpace(unit.Code)
+	unit.Name = strings.TrimSpace(unit.Name)
+	if unit.Code == "" || unit.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unit code and name are required"})
+		return
+	}
+	if unit.Precision < 0 || unit.Precision > quantityScale {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Precision must be between 0 and %d", quantityScale)})
+		return
+	}
+	// Единицы величины пересчитываются через множитель, упаковки - через карточку оборудования
+	if unit.Dimension != "" {
+		if !unitDimensions[unit.Dimension] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown dimension '" + unit.Dimension + "'"})
+			return
+		}
+		if unit.Factor <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Factor must be positive for units with a dimension"})
+			return
+		}
+	} else {
+		unit.Factor = 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	unit.ID = primitive.NilObjectID
+	unit.CreatedAt = time.Now()
+	result, err := unitCollection.InsertOne(ctx, unit)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Unit with code '" + unit.Code + "' already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create unit: " + err.Error()})
+		return
+	}
+	unit.ID = result.InsertedID.(primitive.ObjectID)
+	c.JSON(http.StatusCreated, unit)
+}
+
+// Изменение базовой единицы и упаковок оборудования.
+// Базовую единицу можно сменить только до первой транзакции: история хранится в базовых единицах.
+func updateItemUnits(c *gin.Context) {
+	itemID, version, ok := parseItemVersionRequest(c)
+	if !ok {
+		return
+	}
+
+	var req ItemUnitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var item WarehouseItem
+	before, ok := loadForUpdate(c, ctx, warehouseCollection, itemID, version, "Item not found", &item)
+	if !ok {
+		return
+	}
+
+	catalog, err := loadUnits(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load units: " + err.Error()})
+		return
+	}
+	if err := catalog.validateItemUnits(req.Unit, req.Packagings); err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	if req.Unit != itemUnit(item) {
+		count, err := transactionCollection.CountDocuments(ctx, bson.M{"item_id": itemID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check transactions: " + err.Error()})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Base unit cannot be changed after transactions were recorded"})
+			return
+		}
+		updatedItem := item
+		updatedItem.Unit = req.Unit
+		if err := catalog.checkBaseQuantity(updatedItem, item.Quantity, "quantity"); err != nil {
+			respondError(c, err, "")
+			return
+		}
+	}
+
+	set := bson.M{"unit": req.Unit}
+	update := bson.M{"$set": set}
+	if len(req.Packagings) > 0 {
+		set["packagings"] = req.Packagings
+	} else {
+		update["$unset"] = bson.M{"packagings": ""}
+	}
+
+	var updated WarehouseItem
+	_, err = applyRevisionedUpdate(ctx, warehouseCollection, versionFilter(itemID, item.Version), update, Revision{
+		ResourceType: RevisionResourceItem,
+		ResourceID:   itemID,
+		Action:       RevisionActionUpdate,
+		ChangedBy:    requestUser(c),
+	}, before, &updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			respondVersionConflict(c, ctx, warehouseCollection, itemID, "Item not found")
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update item units: " + err.Error()})
+		}
+		return
+	}
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, updated)
+}
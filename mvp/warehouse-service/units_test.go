@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestUnitCatalogToBase(t *testing.T) {
+	catalog := unitCatalog{}
+	for _, unit := range defaultUnits {
+		catalog[unit.Code] = unit
+	}
+	pieces := WarehouseItem{Packagings: []ItemPackaging{{Unit: "box", Factor: 12}, {Unit: "pack", Factor: 2.5}}}
+	cable := WarehouseItem{Unit: "m", Packagings: []ItemPackaging{{Unit: "roll", Factor: 305}}}
+	bolts := WarehouseItem{Unit: "kg"}
+
+	tests := []struct {
+		name     string
+		item     WarehouseItem
+		quantity float64
+		unit     string
+		want     float64
+		wantErr  bool
+	}{
+		{"base unit by default", pieces, 5, "", 5, false},
+		{"legacy item counts pieces", WarehouseItem{}, 3, "pcs", 3, false},
+		{"packaging", pieces, 2, "box", 24, false},
+		{"packaging of measured item", cable, 2, "roll", 610, false},
+		{"same dimension", cable, 150, "cm", 1.5, false},
+		{"larger unit", cable, 0.25, "km", 250, false},
+		{"float error is rounded", bolts, 0.1, "t", 100, false},
+		{"grams to kilograms", bolts, 1500, "g", 1.5, false},
+		{"fraction of piece", pieces, 1.5, "pcs", 0, true},
+		{"too precise for unit", cable, 1.5, "mm", 0, true},
+		{"result is not a whole piece", pieces, 1, "pack", 0, true},
+		{"whole pieces from packs", pieces, 2, "pack", 5, false},
+		{"different dimension", cable, 1, "kg", 0, true},
+		{"packaging of another item", pieces, 1, "roll", 0, true},
+		{"unknown unit", pieces, 1, "barrel", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := catalog.toBase(tt.item, tt.quantity, tt.unit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toBase() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("toBase() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
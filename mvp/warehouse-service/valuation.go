@@ -0,0 +1,625 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Тип движения для начального остатка и переоценки слоя
+const (
+	CostMovementOpening     = "opening"
+	CostMovementRevaluation = "revaluation"
+)
+
+// CostMovement представляет движение оборудования с себестоимостью в одной валюте
+type CostMovement struct {
+	TransactionID   primitive.ObjectID `json:"transaction_id,omitempty"`
+	ItemID          primitive.ObjectID `json:"item_id"`
+	TransactionType string             `json:"transaction_type"` // Тип транзакции, opening или revaluation
+	Date            time.Time          `json:"date"`
+	Quantity        float64            `json:"quantity"` // Положительное - поступление, отрицательное - расход
+	Currency        string             `json:"currency"`
+	UnitCost        Money              `json:"unit_cost"`
+	TotalCost       Money              `json:"total_cost"`
+	BalanceQuantity float64            `json:"balance_quantity"`
+	BalanceValue    Money              `json:"balance_value"` // Стоимость остатка в валюте движения
+}
+
+// ItemValuation представляет стоимость остатка оборудования в одной валюте на дату
+type ItemValuation struct {
+	ItemID       primitive.ObjectID `json:"item_id"`
+	Name         string             `json:"name"`
+	SerialNumber string             `json:"serial_number"`
+	Category     string             `json:"category"`
+	Warehouse    string             `json:"warehouse"`
+	Unit         string             `json:"unit"`
+	Currency     string             `json:"currency"`
+	Quantity     float64            `json:"quantity"`
+	UnitCost     Money              `json:"unit_cost"` // Средняя стоимость единицы остатка
+	Value        Money              `json:"value"`
+}
+
+// ValuationGroup представляет итог оценки по складу, категории или типу движения в одной валюте
+type ValuationGroup struct {
+	Key      string  `json:"key"`
+	Currency string  `json:"currency"`
+	Quantity float64 `json:"quantity"` // Сумма в базовых единицах оборудования
+	Value    Money   `json:"value"`
+}
+
+// Сумма по оборудованию и валюте
+type costKey struct {
+	ItemID   primitive.ObjectID `bson:"item_id"`
+	Currency string             `bson:"currency"`
+}
+
+type costBalance struct {
+	Quantity float64
+	Value    Money
+}
+
+// Выполнение агрегации с чтением всех результатов
+func aggregateAll[T any](ctx context.Context, collection *mongo.Collection, pipeline []bson.M) ([]T, error) {
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []T
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// Остатки оборудования по валютам на дату: поступления и переоценки слоев за вычетом списаний.
+// Суммы считаются в MongoDB по сохраненным движениям.
+func costBalancesAsOf(ctx context.Context, asOf time.Time) (map[costKey]*costBalance, error) {
+	type total struct {
+		Key      costKey `bson:"_id"`
+		Quantity float64 `bson:"quantity"`
+		Amount   Money   `bson:"amount"`
+	}
+
+	received, err := aggregateAll[total](ctx, costLayerCollection, []bson.M{
+		{"$match": bson.M{"received_at": bson.M{"$lte": asOf}}},
+		{"$group": bson.M{
+			"_id":      bson.M{"item_id": "$item_id", "currency": "$currency"},
+			"quantity": bson.M{"$sum": "$quantity"},
+			"amount":   bson.M{"$sum": "$amount"},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	revalued, err := aggregateAll[total](ctx, costLayerCollection, []bson.M{
+		{"$match": bson.M{"received_at": bson.M{"$lte": asOf}, "revaluations.date": bson.M{"$lte": asOf}}},
+		{"$unwind": "$revaluations"},
+		{"$match": bson.M{"revaluations.date": bson.M{"$lte": asOf}}},
+		{"$group": bson.M{
+			"_id":    bson.M{"item_id": "$item_id", "currency": "$currency"},
+			"amount": bson.M{"$sum": "$revaluations.amount"},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	issued, err := aggregateAll[total](ctx, transactionCollection, []bson.M{
+		{"$match": bson.M{
+			"transaction_type": bson.M{"$in": issueTransactionTypes},
+			"date":             bson.M{"$lte": asOf},
+			"costs":            bson.M{"$exists": true},
+		}},
+		{"$unwind": "$costs"},
+		{"$group": bson.M{
+			"_id":      bson.M{"item_id": "$item_id", "currency": "$costs.currency"},
+			"quantity": bson.M{"$sum": "$costs.quantity"},
+			"amount":   bson.M{"$sum": "$costs.amount"},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	balances := map[costKey]*costBalance{}
+	add := func(totals []total, sign float64) {
+		for _, t := range totals {
+			balance, ok := balances[t.Key]
+			if !ok {
+				balance = &costBalance{}
+				balances[t.Key] = balance
+			}
+			balance.Quantity = roundQuantity(balance.Quantity + sign*t.Quantity)
+			if sign > 0 {
+				balance.Value = balance.Value.Add(t.Amount)
+			} else {
+				balance.Value = balance.Value.Sub(t.Amount)
+			}
+		}
+	}
+	add(received, 1)
+	add(revalued, 1)
+	add(issued, -1)
+	return balances, nil
+}
+
+// itemState представляет реквизиты оборудования на дату
+type itemState struct {
+	Name         string `bson:"name"`
+	SerialNumber string `bson:"serial_number"`
+	Category     string `bson:"category"`
+	Warehouse    string `bson:"warehouse"`
+	Unit         string `bson:"unit"`
+}
+
+// Реквизиты оборудования на дату по истории изменений (склад и категория могли измениться).
+// Оборудование без истории на эту дату берется по текущей карточке.
+func itemStatesAsOf(ctx context.Context, itemIDs []primitive.ObjectID, asOf time.Time) (map[primitive.ObjectID]itemState, error) {
+	revisions, err := aggregateAll[struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		State itemState          `bson:"state"`
+	}](ctx, revisionCollection, []bson.M{
+		{"$match": bson.M{
+			"resource_type": RevisionResourceItem,
+			"resource_id":   bson.M{"$in": itemIDs},
+			"changed_at":    bson.M{"$lte": asOf},
+			"snapshot":      bson.M{"$ne": nil},
+		}},
+		{"$sort": bson.D{{Key: "changed_at", Value: 1}, {Key: "version", Value: 1}}},
+		{"$group": bson.M{
+			"_id": "$resource_id",
+			"state": bson.M{"$last": bson.M{
+				"name":          "$snapshot.name",
+				"serial_number": "$snapshot.serial_number",
+				"category":      "$snapshot.category",
+				"warehouse":     "$snapshot.warehouse",
+				"unit":          "$snapshot.unit",
+			}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[primitive.ObjectID]itemState{}
+	for _, revision := range revisions {
+		states[revision.ID] = revision.State
+	}
+	missing := []primitive.ObjectID{}
+	for _, id := range itemIDs {
+		if _, ok := states[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		items, err := loadAll[WarehouseItem](ctx, warehouseCollection, bson.M{"_id": bson.M{"$in": missing}})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			states[item.ID] = itemState{
+				Name:         item.Name,
+				SerialNumber: item.SerialNumber,
+				Category:     item.Category,
+				Warehouse:    item.Warehouse,
+				Unit:         item.Unit,
+			}
+		}
+	}
+	for id, state := range states {
+		if state.Unit == "" {
+			state.Unit = defaultUnit
+			states[id] = state
+		}
+	}
+	return states, nil
+}
+
+// valuationFilter ограничивает отчет складами и категориями (с подкатегориями)
+type valuationFilter struct {
+	warehouses map[string]bool
+	categories map[string]bool
+}
+
+// Разбор фильтра отчета; descendants=false отключает включение подкатегорий
+func parseValuationFilter(c *gin.Context, ctx context.Context) (valuationFilter, error) {
+	filter := valuationFilter{}
+	if warehouse := c.Query("warehouse"); warehouse != "" {
+		filter.warehouses = map[string]bool{}
+		for _, code := range strings.Split(warehouse, ",") {
+			filter.warehouses[code] = true
+		}
+	}
+	if category := c.Query("category"); category != "" {
+		filter.categories = map[string]bool{}
+		for _, code := range strings.Split(category, ",") {
+			codes := []string{code}
+			if c.Query("descendants") != "false" {
+				expanded, err := categoryWithDescendants(ctx, code)
+				if err != nil {
+					return filter, err
+				}
+				codes = expanded
+			}
+			for _, code := range codes {
+				filter.categories[code] = true
+			}
+		}
+	}
+	return filter, nil
+}
+
+// Проверка реквизитов оборудования на дату по фильтру
+func (f valuationFilter) match(state itemState) bool {
+	if f.warehouses != nil && !f.warehouses[state.Warehouse] {
+		return false
+	}
+	if f.categories != nil && !f.categories[state.Category] {
+		return false
+	}
+	return true
+}
+
+// Разбор даты оценки as_of (по умолчанию - текущий момент)
+func parseAsOf(c *gin.Context) (time.Time, error) {
+	value := c.Query("as_of")
+	if value == "" {
+		return time.Now(), nil
+	}
+	asOf, err := parseDateParam(value)
+	if err != nil {
+		return asOf, &requestError{http.StatusBadRequest, "Invalid as_of parameter"}
+	}
+	// Дата без времени включает весь день
+	if len(value) == len("2006-01-02") {
+		asOf = asOf.Add(24*time.Hour - time.Nanosecond)
+	}
+	return asOf, nil
+}
+
+// Накопление итогов по ключу и валюте
+type valuationGroups map[[2]string]*ValuationGroup
+
+func (g valuationGroups) add(key, currency string, quantity float64, value Money) {
+	group, ok := g[[2]string{key, currency}]
+	if !ok {
+		group = &ValuationGroup{Key: key, Currency: currency}
+		g[[2]string{key, currency}] = group
+	}
+	group.Quantity = roundQuantity(group.Quantity + quantity)
+	group.Value = group.Value.Add(value)
+}
+
+// Итоги, упорядоченные по валюте и убыванию стоимости
+func (g valuationGroups) sorted() []ValuationGroup {
+	result := make([]ValuationGroup, 0, len(g))
+	for _, group := range g {
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Currency != result[j].Currency {
+			return result[i].Currency < result[j].Currency
+		}
+		if cmp := result[i].Value.Cmp(result[j].Value); cmp != 0 {
+			return cmp > 0
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// Оценка запасов на дату по складам и категориям.
+// Суммы в разных валютах не складываются: итоги приводятся по каждой валюте отдельно.
+func getInventoryValuation(c *gin.Context) {
+	asOf, err := parseAsOf(c)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter, err := parseValuationFilter(c, ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load categories: " + err.Error()})
+		return
+	}
+	balances, err := costBalancesAsOf(ctx, asOf)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load valuation data: " + err.Error()})
+		return
+	}
+
+	itemIDs := []primitive.ObjectID{}
+	for key, balance := range balances {
+		if balance.Quantity > 0 {
+			itemIDs = append(itemIDs, key.ItemID)
+		}
+	}
+	states, err := itemStatesAsOf(ctx, itemIDs, asOf)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load item history: " + err.Error()})
+		return
+	}
+
+	valuations := []ItemValuation{}
+	byWarehouse := valuationGroups{}
+	byCategory := valuationGroups{}
+	totals := valuationGroups{}
+	for key, balance := range balances {
+		if balance.Quantity <= 0 {
+			continue
+		}
+		state := states[key.ItemID]
+		if !filter.match(state) {
+			continue
+		}
+
+		valuations = append(valuations, ItemValuation{
+			ItemID:       key.ItemID,
+			Name:         state.Name,
+			SerialNumber: state.SerialNumber,
+			Category:     state.Category,
+			Warehouse:    state.Warehouse,
+			Unit:         state.Unit,
+			Currency:     key.Currency,
+			Quantity:     balance.Quantity,
+			UnitCost:     balance.Value.DivQuantity(balance.Quantity),
+			Value:        balance.Value,
+		})
+		byWarehouse.add(state.Warehouse, key.Currency, balance.Quantity, balance.Value)
+		byCategory.add(state.Category, key.Currency, balance.Quantity, balance.Value)
+		totals.add(key.Currency, key.Currency, balance.Quantity, balance.Value)
+	}
+
+	sort.Slice(valuations, func(i, j int) bool {
+		if valuations[i].Currency != valuations[j].Currency {
+			return valuations[i].Currency < valuations[j].Currency
+		}
+		return valuations[i].Value.Cmp(valuations[j].Value) > 0
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"as_of":        asOf,
+		"method":       costingMethod,
+		"totals":       totals.sorted(),
+		"by_warehouse": byWarehouse.sorted(),
+		"by_category":  byCategory.sorted(),
+		"items":        valuations,
+	})
+}
+
+// Движения транзакции по валютам
+func transactionCostMovements(transaction InventoryTransaction) []CostMovement {
+	sign := transactionSign(transaction.TransactionType)
+	movements := []CostMovement{}
+	index := map[string]int{}
+	for _, allocation := range transaction.Costs {
+		i, ok := index[allocation.Currency]
+		if !ok {
+			i = len(movements)
+			index[allocation.Currency] = i
+			movements = append(movements, CostMovement{
+				TransactionID:   transaction.ID,
+				ItemID:          transaction.ItemID,
+				TransactionType: transaction.TransactionType,
+				Date:            transaction.Date,
+				Currency:        allocation.Currency,
+			})
+		}
+		movements[i].Quantity = roundQuantity(movements[i].Quantity + sign*allocation.Quantity)
+		movements[i].TotalCost = movements[i].TotalCost.Add(allocation.Amount)
+	}
+	for i := range movements {
+		if movements[i].Quantity != 0 {
+			movements[i].UnitCost = movements[i].TotalCost.DivQuantity(movements[i].Quantity * sign)
+		}
+	}
+	return movements
+}
+
+// Себестоимость расхода за период (выдача, корректировка, списание, возврат поставщику).
+// Оборудование отбирается по складу и категории на конец периода.
+func getIssuedCost(c *gin.Context) {
+	from, to, err := parseScorecardPeriod(c)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+	if value := c.Query("to"); len(value) == len("2006-01-02") {
+		to = to.Add(24*time.Hour - time.Nanosecond)
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter, err := parseValuationFilter(c, ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load categories: " + err.Error()})
+		return
+	}
+
+	date := bson.M{"$lte": to}
+	if !from.IsZero() {
+		date["$gte"] = from
+	}
+	transactions, err := loadAll[InventoryTransaction](ctx, transactionCollection, bson.M{
+		"transaction_type": bson.M{"$in": issueTransactionTypes},
+		"date":             date,
+		"costs":            bson.M{"$exists": true},
+	}, options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions: " + err.Error()})
+		return
+	}
+
+	itemIDs := []primitive.ObjectID{}
+	for _, transaction := range transactions {
+		itemIDs = append(itemIDs, transaction.ItemID)
+	}
+	states, err := itemStatesAsOf(ctx, itemIDs, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load item history: " + err.Error()})
+		return
+	}
+
+	issues := []CostMovement{}
+	byType := valuationGroups{}
+	totals := valuationGroups{}
+	for _, transaction := range transactions {
+		if !filter.match(states[transaction.ItemID]) {
+			continue
+		}
+		for _, movement := range transactionCostMovements(transaction) {
+			issues = append(issues, movement)
+			byType.add(movement.TransactionType, movement.Currency, -movement.Quantity, movement.TotalCost)
+			totals.add(movement.Currency, movement.Currency, -movement.Quantity, movement.TotalCost)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"method":    costingMethod,
+		"totals":    totals.sorted(),
+		"by_type":   byType.sorted(),
+		"movements": issues,
+	})
+}
+
+// Слои себестоимости и движения оборудования на дату по сохраненным слоям и транзакциям
+func getItemCostLayers(c *gin.Context) {
+	itemID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID format"})
+		return
+	}
+	asOf, err := parseAsOf(c)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := warehouseCollection.CountDocuments(ctx, bson.M{"_id": itemID})
+	if err != nil || count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	sortByDate := func(field string) *options.FindOptions {
+		return options.Find().SetSort(bson.D{{Key: field, Value: 1}, {Key: "_id", Value: 1}})
+	}
+	layers, err := loadAll[CostLayer](ctx, costLayerCollection,
+		bson.M{"item_id": itemID, "received_at": bson.M{"$lte": asOf}}, sortByDate("received_at"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cost layers: " + err.Error()})
+		return
+	}
+	transactions, err := loadAll[InventoryTransaction](ctx, transactionCollection,
+		bson.M{"item_id": itemID, "date": bson.M{"$lte": asOf}, "costs": bson.M{"$exists": true}}, sortByDate("date"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions: " + err.Error()})
+		return
+	}
+
+	// Остаток слоев на дату: поступление и переоценки за вычетом списаний до этой даты
+	movements := []CostMovement{}
+	index := map[primitive.ObjectID]int{}
+	for i := range layers {
+		layer := &layers[i]
+		index[layer.ID] = i
+		layer.Remaining = layer.Quantity
+		layer.RemainingValue = layer.Amount
+		if layer.TransactionID.IsZero() {
+			movements = append(movements, CostMovement{
+				ItemID:          itemID,
+				TransactionType: CostMovementOpening,
+				Date:            layer.ReceivedAt,
+				Quantity:        layer.Quantity,
+				Currency:        layer.Currency,
+				UnitCost:        layer.Amount.DivQuantity(layer.Quantity),
+				TotalCost:       layer.Amount,
+			})
+		}
+		revaluations := []CostRevaluation{}
+		for _, revaluation := range layer.Revaluations {
+			if revaluation.Date.After(asOf) {
+				continue
+			}
+			revaluations = append(revaluations, revaluation)
+			layer.RemainingValue = layer.RemainingValue.Add(revaluation.Amount)
+			movements = append(movements, CostMovement{
+				TransactionID:   layer.TransactionID,
+				ItemID:          itemID,
+				TransactionType: CostMovementRevaluation,
+				Date:            revaluation.Date,
+				Currency:        layer.Currency,
+				TotalCost:       revaluation.Amount,
+			})
+		}
+		layer.Revaluations = revaluations
+	}
+	for _, transaction := range transactions {
+		if transactionSign(transaction.TransactionType) < 0 {
+			for _, allocation := range transaction.Costs {
+				if i, ok := index[allocation.LayerID]; ok {
+					layers[i].Remaining = roundQuantity(layers[i].Remaining - allocation.Quantity)
+					layers[i].RemainingValue = layers[i].RemainingValue.Sub(allocation.Amount)
+				}
+			}
+		}
+		movements = append(movements, transactionCostMovements(transaction)...)
+	}
+
+	remaining := []CostLayer{}
+	for _, layer := range layers {
+		if layer.Remaining > 0 {
+			layer.UnitCost = layer.RemainingValue.DivQuantity(layer.Remaining)
+			remaining = append(remaining, layer)
+		}
+	}
+
+	// Остаток после каждого движения; стоимость - в валюте движения
+	sort.SliceStable(movements, func(i, j int) bool { return movements[i].Date.Before(movements[j].Date) })
+	var quantity float64
+	values := map[string]Money{}
+	totals := valuationGroups{}
+	for i := range movements {
+		movement := &movements[i]
+		quantity = roundQuantity(quantity + movement.Quantity)
+		if movement.Quantity < 0 {
+			values[movement.Currency] = values[movement.Currency].Sub(movement.TotalCost)
+		} else {
+			values[movement.Currency] = values[movement.Currency].Add(movement.TotalCost)
+		}
+		movement.BalanceQuantity = quantity
+		movement.BalanceValue = values[movement.Currency]
+	}
+	for _, layer := range remaining {
+		totals.add(layer.Currency, layer.Currency, layer.Remaining, layer.RemainingValue)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"item_id":   itemID,
+		"as_of":     asOf,
+		"method":    costingMethod,
+		"quantity":  quantity,
+		"totals":    totals.sorted(),
+		"layers":    remaining,
+		"movements": movements,
+	})
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Статусы гарантии оборудования
+const (
+	WarrantyStatusNone     = "none"     // Гарантия не указана
+	WarrantyStatusActive   = "active"   // Гарантия действует
+	WarrantyStatusExpiring = "expiring" // Гарантия заканчивается в пределах окна
+	WarrantyStatusExpired  = "expired"  // Гарантия закончилась
+)
+
+// Окна предупреждений об окончании гарантии по умолчанию (в днях)
+var defaultWarrantyWindows = []int{90, 30, 7}
+
+// Оборудование с вычисленным состоянием гарантии
+type WarrantyItem struct {
+	WarehouseItem
+	WarrantyStatus string `json:"warranty_status"`
+	DaysLeft       *int   `json:"days_left,omitempty"`
+}
+
+// Чтение окон предупреждений из WARRANTY_ALERT_DAYS (например, "90,30,7")
+func warrantyWindows() []int {
+	value := os.Getenv("WARRANTY_ALERT_DAYS")
+	if value == "" {
+		return defaultWarrantyWindows
+	}
+
+	var windows []int
+	for _, part := range strings.Split(value, ",") {
+		days, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || days <= 0 {
+			log.Printf("Warning: invalid WARRANTY_ALERT_DAYS %q, using defaults", value)
+			return defaultWarrantyWindows
+		}
+		windows = append(windows, days)
+	}
+
+	// Сортируем по убыванию: 90, 30, 7
+	sort.Sort(sort.Reverse(sort.IntSlice(windows)))
+	return windows
+}
+
+// Количество полных дней до окончания гарантии (отрицательное, если истекла)
+func warrantyDaysLeft(expiry time.Time, now time.Time) int {
+	return int(math.Floor(expiry.Sub(now).Hours() / 24))
+}
+
+// Наименьшее окно, в которое попадает оставшийся срок гарантии
+func warrantyWindowFor(daysLeft int, windows []int) (int, bool) {
+	window, found := 0, false
+	for _, w := range windows {
+		if daysLeft <= w {
+			window, found = w, true
+		}
+	}
+	return window, found
+}
+
+// Вычисление состояния гарантии оборудования
+func warrantyStatus(item WarehouseItem, now time.Time, expiringDays int) (string, *int) {
+	if item.WarrantyExpiry.IsZero() {
+		return WarrantyStatusNone, nil
+	}
+
+	daysLeft := warrantyDaysLeft(item.WarrantyExpiry, now)
+	switch {
+	case !item.WarrantyExpiry.After(now):
+		return WarrantyStatusExpired, &daysLeft
+	case daysLeft <= expiringDays:
+		return WarrantyStatusExpiring, &daysLeft
+	default:
+		return WarrantyStatusActive, &daysLeft
+	}
+}
+
+// Запуск фоновой проверки окончания гарантии
+func startWarrantyMonitor() {
+	interval := 24 * time.Hour
+	if value := os.Getenv("WARRANTY_CHECK_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Warning: invalid WARRANTY_CHECK_INTERVAL %q, using %s", value, interval)
+		} else {
+			interval = parsed
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			checkExpiringWarranties()
+			<-ticker.C
+		}
+	}()
+
+	log.Printf("Warranty monitor started (interval %s, windows %v)", interval, warrantyWindows())
+}
+
+// Поиск оборудования с заканчивающейся гарантией и отправка событий warranty.expiring.
+// Для каждого окна предупреждение отправляется один раз; при изменении даты гарантии
+// предупреждения начинаются заново.
+func checkExpiringWarranties() {
+	if !isRabbitConnected() {
+		log.Println("RabbitMQ connection not available, skipping warranty check")
+		return
+	}
+
+	windows := warrantyWindows()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	cursor, err := warehouseCollection.Find(ctx, bson.M{
+		"warranty_expiry": bson.M{
+			"$gt":  now,
+			"$lte": now.AddDate(0, 0, windows[0]),
+		},
+		"archived": bson.M{"$ne": true},
+	})
+	if err != nil {
+		log.Printf("Error fetching items with expiring warranty: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var items []WarehouseItem
+	if err := cursor.All(ctx, &items); err != nil {
+		log.Printf("Error decoding items with expiring warranty: %v", err)
+		return
+	}
+
+	for _, item := range items {
+		daysLeft := warrantyDaysLeft(item.WarrantyExpiry, now)
+		window, ok := warrantyWindowFor(daysLeft, windows)
+		if !ok {
+			continue
+		}
+
+		// Уже предупреждали за это или более узкое окно для той же даты
+		alert := item.WarrantyAlert
+		if alert != nil && alert.WarrantyExpiry.Equal(item.WarrantyExpiry) && alert.WindowDays <= window {
+			continue
+		}
+
+		message := WarrantyExpiringMessage{
+			ItemID:         item.ID.Hex(),
+			Name:           item.Name,
+			SerialNumber:   item.SerialNumber,
+			Category:       item.Category,
+			Location:       item.Location,
+			WarrantyExpiry: item.WarrantyExpiry,
+			DaysLeft:       daysLeft,
+			WindowDays:     window,
+		}
+
+		if err := publishNotification(WarrantyExpiringKey, message); err != nil {
+			log.Printf("Failed to publish warranty event for item %s: %v", item.ID.Hex(), err)
+			continue
+		}
+
+		_, err := warehouseCollection.UpdateOne(ctx, bson.M{"_id": item.ID}, bson.M{
+			"$set": bson.M{"warranty_alert": WarrantyAlert{
+				WindowDays:     window,
+				WarrantyExpiry: item.WarrantyExpiry,
+				NotifiedAt:     now,
+			}},
+		})
+		if err != nil {
+			log.Printf("Failed to mark warranty alert for item %s: %v", item.ID.Hex(), err)
+		}
+	}
+}
+
+// Список оборудования по состоянию гарантии для планирования закупок
+func listItemsByWarranty(c *gin.Context) {
+	status := c.Query("status")
+	expiringDays := warrantyWindows()[0]
+	if daysParam := c.Query("days"); daysParam != "" {
+		days, err := strconv.Atoi(daysParam)
+		if err != nil || days <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days parameter"})
+			return
+		}
+		expiringDays = days
+	}
+
+	now := time.Now()
+	filter := bson.M{}
+	switch status {
+	case "":
+	case WarrantyStatusNone:
+		// Без гарантии: нулевая дата, null или поле отсутствует, как в сводке
+		filter["warranty_expiry"] = bson.M{"$in": bson.A{nil, time.Time{}}}
+	case WarrantyStatusExpired:
+		filter["warranty_expiry"] = bson.M{"$gt": time.Time{}, "$lte": now}
+	case WarrantyStatusExpiring:
+		filter["warranty_expiry"] = bson.M{"$gt": now, "$lte": now.AddDate(0, 0, expiringDays)}
+	case WarrantyStatusActive:
+		filter["warranty_expiry"] = bson.M{"$gt": now.AddDate(0, 0, expiringDays)}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warranty status"})
+		return
+	}
+
+	page, err := parsePageQuery(c, "warranty_expiry", 1)
+	if err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if category := c.Query("category"); category != "" {
+		categories, err := categoryFilter(c, ctx, strings.Split(category, ","))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve categories: " + err.Error()})
+			return
+		}
+		filter["category"] = categories
+	}
+	if err := applyArchivedFilter(c, filter); err != nil {
+		respondError(c, err, "")
+		return
+	}
+
+	items, pagination, err := findPage[WarehouseItem](ctx, warehouseCollection, filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items: " + err.Error()})
+		return
+	}
+
+	summary, err := warrantySummary(ctx, filter, now, expiringDays)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count items: " + err.Error()})
+		return
+	}
+
+	// Вычисляем состояние гарантии для страницы
+	result := []WarrantyItem{}
+	for _, item := range items {
+		itemStatus, daysLeft := warrantyStatus(item, now, expiringDays)
+		result = append(result, WarrantyItem{
+			WarehouseItem:  item,
+			WarrantyStatus: itemStatus,
+			DaysLeft:       daysLeft,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":         result,
+		"summary":       summary,
+		"expiring_days": expiringDays,
+		"pagination":    pagination,
+	})
+}
+
+// Сводка по состояниям гарантии для всего оборудования под фильтром, а не только для страницы
+func warrantySummary(ctx context.Context, filter bson.M, now time.Time, expiringDays int) (map[string]int, error) {
+	buckets, err := aggregateAll[FacetBucket](ctx, warehouseCollection, []bson.M{
+		{"$match": filter},
+		{"$group": bson.M{
+			"_id": bson.M{"$switch": bson.M{
+				"branches": bson.A{
+					bson.M{"case": bson.M{"$lte": bson.A{"$warranty_expiry", time.Time{}}}, "then": WarrantyStatusNone},
+					bson.M{"case": bson.M{"$lte": bson.A{"$warranty_expiry", now}}, "then": WarrantyStatusExpired},
+					bson.M{"case": bson.M{"$lte": bson.A{"$warranty_expiry", now.AddDate(0, 0, expiringDays)}}, "then": WarrantyStatusExpiring},
+				},
+				"default": WarrantyStatusActive,
+			}},
+			"count": bson.M{"$sum": 1},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summary := map[string]int{
+		WarrantyStatusNone:     0,
+		WarrantyStatusActive:   0,
+		WarrantyStatusExpiring: 0,
+		WarrantyStatusExpired:  0,
+	}
+	for _, bucket := range buckets {
+		summary[bucket.Value] = bucket.Count
+	}
+	return summary, nil
+}